@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -21,10 +22,38 @@ func parseGitURL(url string) (string, string, error) {
 	return url, "", nil
 }
 
+// warnPinConflicts reports pins of packageName that disagree with the opam
+// file's existing pins
+func warnPinConflicts(packageName string, conflicts []opam.PinConflict) {
+	var relevant []opam.PinConflict
+	for _, c := range conflicts {
+		// re-pinning the package itself is not a conflict
+		if c.Existing.Package != packageName {
+			relevant = append(relevant, c)
+		}
+	}
+	if len(relevant) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "WARNING: %s pins %d package(s) differently than this opam file:\n",
+		packageName, len(relevant))
+	for _, c := range relevant {
+		fmt.Fprintf(os.Stderr, "  %s\n", c)
+	}
+	fmt.Fprintf(os.Stderr, "consider updating these pins to match %s\n", packageName)
+}
+
 func doAdd(cmd *cobra.Command, args []string) error {
 	opamFileName, _ := cmd.Flags().GetString("file")
 	packageFlag, _ := cmd.Flags().GetString("package")
+	refFlag, _ := cmd.Flags().GetString("ref")
+	branchFlag, _ := cmd.Flags().GetString("branch")
+	tagFlag, _ := cmd.Flags().GetString("tag")
+	verifySignature, _ := cmd.Flags().GetBool("verify-signature")
+	prFlag, _ := cmd.Flags().GetInt("pr")
+	indirectOpts := getIndirectOptions(cmd)
 	urlArg := args[0]
+	ctx := cmd.Context()
 
 	// Parse the URL to extract base URL and optional commit
 	baseURL, commit, err := parseGitURL(urlArg)
@@ -32,20 +61,54 @@ func doAdd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	// Get commit hash (either from URL or fetch latest)
-	if commit == "" {
-		commit, err = git.GetLatestCommit(baseURL)
+	// --branch and --tag are shorthands for full ref names
+	ref := refFlag
+	if branchFlag != "" {
+		ref = "refs/heads/" + branchFlag
+	} else if tagFlag != "" {
+		ref = "refs/tags/" + tagFlag
+	} else if prFlag > 0 {
+		ref = git.PullRequestRef(baseURL, prFlag)
+	}
+
+	// Get commit hash (from URL, from a ref, or fetch latest)
+	if ref != "" {
+		if commit != "" {
+			return fmt.Errorf("cannot use --ref, --branch, --tag, or --pr with a URL that has a commit hash")
+		}
+		commit, err = git.ResolveRefContext(ctx, baseURL, ref)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", ref, err)
+		}
+		// the head of a merged request is on a branch, so it is there to stay
+		if n, ok := git.PullRequestNumber(ref); ok && !isReachable(ctx, baseURL, commit) {
+			fmt.Fprintf(os.Stderr, "WARNING: pinning to the head of pull request #%d, which is ephemeral; "+
+				"opam update will move this pin to the default branch\n", n)
+		}
+	} else if commit == "" {
+		commit, err = git.GetLatestCommitContext(ctx, baseURL)
 		if err != nil {
 			return fmt.Errorf("failed to get latest commit: %w", err)
 		}
 	}
 
+	if verifySignature {
+		if tag, ok := strings.CutPrefix(ref, "refs/tags/"); ok {
+			err = git.VerifyTagContext(ctx, baseURL, tag, commit)
+		} else {
+			err = git.VerifyCommitContext(ctx, baseURL, commit)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
 	// Determine package name
 	var packageName string
 	if packageFlag != "" {
 		packageName = packageFlag
 	} else {
-		packageName, err = opam.FindOpamPackage(baseURL, commit)
+		packageName, err = opam.FindOpamPackageContext(ctx, baseURL, commit)
 		if err != nil {
 			return err
 		}
@@ -62,19 +125,31 @@ func doAdd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	// Add dependency to depends block
-	opamFile.AddDependency(packageName)
-
-	// Add pin-depends entry
 	dep := opam.PinDepend{
 		Package: packageName,
 		URL:     baseURL,
 		Commit:  commit,
 	}
-	opamFile.AddPinDepend(dep)
+
+	// Check the new package's pins against ours before changing anything
+	required, err := dep.Normalize().FetchDependenciesContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch dependencies of %s: %w", packageName, err)
+	}
+	warnPinConflicts(packageName, opamFile.PinConflicts(required))
+
+	// Add dependency to depends block
+	if err := opamFile.AddDependency(packageName); err != nil {
+		return err
+	}
+
+	// Add pin-depends entry
+	if err := opamFile.AddPinDepend(dep); err != nil {
+		return err
+	}
 
 	// Update indirect dependencies
-	_, err = opamFile.UpdateIndirectDependencies()
+	_, err = opamFile.UpdateIndirectDependenciesContext(ctx, indirectOpts)
 	if err != nil {
 		return fmt.Errorf("failed to update indirect dependencies: %w", err)
 	}
@@ -85,7 +160,7 @@ func doAdd(cmd *cobra.Command, args []string) error {
 		fmt.Printf("already up-to-date\n")
 		return nil
 	}
-	if err := os.WriteFile(opamFileName, []byte(newContents), 0644); err != nil {
+	if err := opamFile.Save(opamFileName); err != nil {
 		return err
 	}
 	fmt.Printf("added %s (pinned to %s)\n", packageName, commit)
@@ -99,20 +174,41 @@ var addCmd = &cobra.Command{
 	Short: "add a dependency",
 	Long: `Add a dependency and pin it.
 
-If the URL has a commit hash, it will be pinned to that commit; otherwise, it
-will be pinned to the latest commit of the default branch.
+If the URL has a commit hash, it will be pinned to that commit; if --ref is
+given, it will be pinned to the commit that ref currently points to; otherwise,
+it will be pinned to the latest commit of the default branch.
+
+--branch and --tag pin to the current commit of a branch or tag (annotated
+tags are resolved to the commit they point to). --pr pins to the head of an
+unmerged pull request (a merge request on GitLab) without forking; --ref also
+accepts the full ref name, like refs/pull/<N>/head or
+refs/merge-requests/<N>/head. Such pins are ephemeral: the request may be
+force-pushed or closed, and opam update moves them to the default branch.
+(Once the request is merged, its head is on a branch and the pin is an
+ordinary one, so there is no warning.)
 
 The package is the base name of the opam file. If not provided, perennial-cli
 will look for a unique opam file in the repo and fail if multiple are found.
 
 If the dependency already exists, it will be updated.
 
+Warns if the new dependency pins any package to a different commit than this
+opam file does.
+
+With --verify-signature, the pinned tag (with --tag) or commit must have a
+valid GPG or SSH signature from a key you trust: one in your GPG keyring, or
+listed in git's gpg.ssh.allowedSignersFile.
+
 `,
 	Args: cobra.ExactArgs(1),
 	Example: indent("  ", `
 perennial-cli opam add https://github.com/example/perennial-proof
 perennial-cli opam add -p specific-proof https://github.com/example/monorepo
 perennial-cli opam add https://github.com/example/perennial-proof#4bd989e3f7f2f99
+perennial-cli opam add --tag v1.2.0 https://github.com/example/perennial-proof
+perennial-cli opam add --tag v1.2.0 --verify-signature https://github.com/example/perennial-proof
+perennial-cli opam add --branch develop https://github.com/example/perennial-proof
+perennial-cli opam add --pr 123 https://github.com/example/perennial-proof
 `),
 	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		// No completions for URL argument, disable file completion
@@ -136,4 +232,19 @@ perennial-cli opam add https://github.com/example/perennial-proof#4bd989e3f7f2f9
 func init() {
 	opamCmd.AddCommand(addCmd)
 	addCmd.Flags().StringP("package", "p", "", "opam package name")
+	addCmd.Flags().String("ref", "", "pin to the commit of a remote ref (e.g., main, v1.0, or refs/pull/123/head)")
+	addCmd.Flags().String("branch", "", "pin to the latest commit of a branch")
+	addCmd.Flags().String("tag", "", "pin to the commit of a tag")
+	addCmd.Flags().Int("pr", 0, "pin to the head of a pull request (or GitLab merge request)")
+	addCmd.MarkFlagsMutuallyExclusive("ref", "branch", "tag", "pr")
+	addCmd.Flags().Bool("verify-signature", false, "require a valid signature on the pinned tag or commit")
+	addIndirectFlags(addCmd)
+}
+
+// isReachable reports if commit is known to be reachable from a branch of the
+// remote, for warnings that do not apply to such commits (so failing to check
+// counts as unreachable).
+func isReachable(ctx context.Context, gitURL, commit string) bool {
+	reachable, err := git.IsReachableContext(ctx, gitURL, commit)
+	return err == nil && reachable
 }
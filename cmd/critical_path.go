@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/mit-pdos/perennial-cli/depgraph"
+	"github.com/mit-pdos/perennial-cli/timing"
+	"github.com/spf13/cobra"
+)
+
+// criticalPathCmd represents the deps critical-path command
+var criticalPathCmd = &cobra.Command{
+	Use:   "critical-path [files...]",
+	Short: "Show the longest chain of dependencies",
+	Long: `Show the longest chain of dependencies in .rocqdeps.d (or among the
+dependencies of the given files), starting from the file the others
+transitively depend on.
+
+No matter how many jobs a build runs in parallel, the files on this chain
+have to be compiled one after another, so the chain bounds the build's
+latency. Splitting files on it (or removing dependencies between them)
+speeds up parallel builds.
+
+If the project has a database of compile times (see deps times import), the
+chain is the slowest one rather than the one with the most files, and the
+time of each file is shown. Without one, --weight lines (or size) estimates
+compile times from the number of lines (or bytes) of each file.`,
+	Example: indent("  ", `
+perennial-cli deps critical-path
+perennial-cli deps critical-path new/proof/proof_prelude.v
+`),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return prepareRocqdepFile(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printVo, _ := cmd.Flags().GetBool("vo")
+		deps, err := loadRocqdeps(cmd)
+		if err != nil {
+			return err
+		}
+		sources, err := gatherArgs(cmd, args)
+		if err != nil {
+			return err
+		}
+		root, err := projectRoot(cmd)
+		if err != nil {
+			return err
+		}
+		sources, err = graphPaths(root, sources)
+		if err != nil {
+			return err
+		}
+		out, err := outputPath(cmd)
+		if err != nil {
+			return err
+		}
+		var files []string
+		if len(args) > 0 {
+			files = append(sources, depgraph.RocqDeps(deps, sources)...)
+			if len(files) == 0 {
+				return nil
+			}
+		}
+		weight, unit, err := loadWeights(cmd)
+		if err != nil {
+			return err
+		}
+		path, total, err := depgraph.RocqFileGraph(deps, files).CriticalPath(weight)
+		if err != nil {
+			return err
+		}
+		for _, file := range path {
+			name := out(file)
+			if printVo {
+				name = setExtension(name, ".vo")
+			}
+			if weight != nil {
+				fmt.Printf("%s  %s\n", formatWeight(weight(file), unit), name)
+			} else {
+				printPath(cmd, name)
+			}
+		}
+		if weight != nil {
+			fmt.Printf("%s  total\n", formatWeight(total, unit))
+		}
+		return nil
+	},
+}
+
+func init() {
+	depsCmd.AddCommand(criticalPathCmd)
+
+	criticalPathCmd.Flags().String("times", timing.DefaultFile, timesUsage)
+	criticalPathCmd.Flags().String("weight", "", weightUsage)
+}
@@ -1,9 +1,18 @@
 package cmd
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"maps"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/mit-pdos/perennial-cli/depgraph"
@@ -62,6 +71,344 @@ func gatherVFiles(paths []string) ([]string, error) {
 	return sources, nil
 }
 
+// changedVFiles lists the .v files that differ between ref and the working
+// tree, relative to the current directory, using git diff.
+func changedVFiles(ctx context.Context, ref string) ([]string, error) {
+	diff := exec.CommandContext(ctx, "git", "diff", "--name-only", "--relative", "-z", ref, "--")
+	diff.Stderr = os.Stderr
+	output, err := diff.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff %s failed: %w", ref, err)
+	}
+	var files []string
+	for file := range strings.SplitSeq(string(output), "\x00") {
+		if strings.HasSuffix(file, ".v") {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// rocqdepFiles returns the dependency files given by --file (which may be
+// given several times), expanding glob patterns.
+func rocqdepFiles(cmd *cobra.Command) ([]string, error) {
+	patterns, _ := cmd.Flags().GetStringSlice("file")
+	if len(patterns) == 0 {
+		return []string{".rocqdeps.d"}, nil
+	}
+	var files []string
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			files = append(files, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no dependency files match %s", pattern)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// reportMissing lists the files in the dependency files that do not exist
+// (printing paths with out), returning an error if there are any.
+func reportMissing(cmd *cobra.Command, deps *depgraph.Graph, out func(string) string) error {
+	rocqdepNames, err := rocqdepFiles(cmd)
+	if err != nil {
+		return err
+	}
+	root, err := projectRoot(cmd)
+	if err != nil {
+		return err
+	}
+	missing := depgraph.RocqFileGraph(deps, nil).Missing(func(file string) bool {
+		_, err := os.Stat(filepath.Join(root, file))
+		return err == nil
+	})
+	if len(missing) == 0 {
+		return nil
+	}
+	for _, file := range slices.Sorted(maps.Keys(missing)) {
+		var dependents []string
+		for _, dependent := range missing[file] {
+			dependents = append(dependents, out(dependent))
+		}
+		if len(dependents) > 0 {
+			fmt.Printf("%s (needed by %s)\n", out(file), strings.Join(dependents, ", "))
+		} else {
+			fmt.Println(out(file))
+		}
+	}
+	if len(rocqdepNames) > 1 {
+		return fmt.Errorf("%s refer to %d file(s) that do not exist; they are stale, regenerate them",
+			strings.Join(rocqdepNames, ", "), len(missing))
+	}
+	return fmt.Errorf("%s refers to %d file(s) that do not exist; it is stale, regenerate it (for example, with make %s)",
+		rocqdepNames[0], len(missing), filepath.Base(rocqdepNames[0]))
+}
+
+// reportOrphans compares the .v files of each project (in the directory of a
+// dependency file) with its _RocqProject, listing the files that are not part
+// of the project and the files of the project that are not there. With
+// against "disk" the files are those on disk, and with "deps" those in the
+// dependency files. It returns an error if there are any differences.
+func reportOrphans(cmd *cobra.Command, deps *depgraph.Graph, against string, out func(string) string) error {
+	if against != "disk" && against != "deps" {
+		return fmt.Errorf("unknown --orphans mode %q (expected disk or deps)", against)
+	}
+	rocqdepNames, err := rocqdepFiles(cmd)
+	if err != nil {
+		return err
+	}
+	root, err := projectRoot(cmd)
+	if err != nil {
+		return err
+	}
+	// inProject and found are sets of paths in the dependency graph
+	inProject := make(map[string]bool)
+	found := make(map[string]bool)
+	addAll := func(set map[string]bool, dir string, files []string) error {
+		for i, file := range files {
+			files[i] = filepath.Join(dir, file)
+		}
+		files, err := graphPaths(root, files)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			set[file] = true
+		}
+		return nil
+	}
+	var projFiles []string
+	for _, rocqdepName := range rocqdepNames {
+		dir := filepath.Dir(rocqdepName)
+		projFile, err := depgraph.FindProjectFile(dir)
+		if err != nil {
+			return err
+		}
+		projFiles = append(projFiles, projFile)
+		sources, err := depgraph.ProjectSources(projFile)
+		if err != nil {
+			return err
+		}
+		if err := addAll(inProject, dir, sources); err != nil {
+			return err
+		}
+		if against == "disk" {
+			onDisk, err := depgraph.DiskSources(dir)
+			if err != nil {
+				return err
+			}
+			if err := addAll(found, dir, onDisk); err != nil {
+				return err
+			}
+		}
+	}
+	if against == "deps" {
+		for _, file := range depgraph.RocqFileGraph(deps, nil).Files {
+			found[file] = true
+		}
+	}
+
+	projName := filepath.Base(projFiles[0])
+	foundIn := "on disk"
+	if against == "deps" {
+		foundIn = "in " + strings.Join(rocqdepNames, ", ")
+	}
+	orphans := 0
+	for _, file := range slices.Sorted(maps.Keys(found)) {
+		if !inProject[file] {
+			fmt.Printf("not in %s: %s\n", projName, out(file))
+			orphans++
+		}
+	}
+	for _, file := range slices.Sorted(maps.Keys(inProject)) {
+		if !found[file] {
+			fmt.Printf("not %s: %s\n", foundIn, out(file))
+			orphans++
+		}
+	}
+	if orphans > 0 {
+		return fmt.Errorf("the .v files %s and in %s differ by %d file(s)", foundIn, strings.Join(projFiles, ", "), orphans)
+	}
+	return nil
+}
+
+// reportCollisions lists the logical module paths that the -Q and -R options
+// of each project (in the directory of a dependency file) give to several .v
+// files, returning an error if there are any.
+func reportCollisions(cmd *cobra.Command, out func(string) string) error {
+	rocqdepNames, err := rocqdepFiles(cmd)
+	if err != nil {
+		return err
+	}
+	root, err := projectRoot(cmd)
+	if err != nil {
+		return err
+	}
+	collisions := 0
+	for _, rocqdepName := range rocqdepNames {
+		dir := filepath.Dir(rocqdepName)
+		projFile, err := depgraph.FindProjectFile(dir)
+		if err != nil {
+			return err
+		}
+		mappings, err := depgraph.ProjectMappings(projFile)
+		if err != nil {
+			return err
+		}
+		sources, err := depgraph.ProjectSources(projFile)
+		if err != nil {
+			return err
+		}
+		modules := depgraph.ModuleCollisions(mappings, sources)
+		for _, module := range slices.Sorted(maps.Keys(modules)) {
+			var files []string
+			for _, file := range modules[module] {
+				files = append(files, filepath.Join(dir, file))
+			}
+			files, err := graphPaths(root, files)
+			if err != nil {
+				return err
+			}
+			for i, file := range files {
+				files[i] = out(file)
+			}
+			fmt.Printf("%s: %s\n", module, strings.Join(files, ", "))
+			collisions++
+		}
+	}
+	if collisions > 0 {
+		return fmt.Errorf("%d logical module path(s) refer to several files; Require of them fails with \"found twice\"", collisions)
+	}
+	return nil
+}
+
+// loadRocqdeps parses the dependency files given by --file. If one does not
+// exist, its dependencies are generated with rocq dep instead (and with
+// --write-deps, saved to the file).
+//
+// Several dependency files (such as those of code and proofs built in
+// separate directories) are merged into one graph. The paths in each file are
+// relative to its directory, so they are rewritten to be relative to the
+// current directory, which connects the graphs.
+func loadRocqdeps(cmd *cobra.Command) (*depgraph.Graph, error) {
+	rocqdepNames, err := rocqdepFiles(cmd)
+	if err != nil {
+		return nil, err
+	}
+	var graphs []*depgraph.Graph
+	for _, rocqdepName := range rocqdepNames {
+		deps, err := loadRocqdepFile(cmd, rocqdepName)
+		if err != nil {
+			return nil, err
+		}
+		if len(rocqdepNames) > 1 {
+			deps.Rebase(filepath.Dir(rocqdepName))
+		}
+		graphs = append(graphs, deps)
+	}
+	if len(graphs) == 1 {
+		return graphs[0], nil
+	}
+	return depgraph.Merge(graphs...), nil
+}
+
+// loadRocqdepFile parses one dependency file for loadRocqdeps.
+func loadRocqdepFile(cmd *cobra.Command, rocqdepName string) (*depgraph.Graph, error) {
+	writeDeps, _ := cmd.Flags().GetBool("write-deps")
+	// only deps --vos needs the .vos and .vok files
+	vos, _ := cmd.Flags().GetBool("vos")
+	if _, err := os.Stat(rocqdepName); errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "NOTE: %s not found; generating dependencies with rocq dep\n", rocqdepName)
+		if !writeDeps {
+			if vos {
+				return depgraph.GenerateRocqdepVos(cmd.Context(), filepath.Dir(rocqdepName))
+			}
+			return depgraph.GenerateRocqdep(cmd.Context(), filepath.Dir(rocqdepName))
+		}
+		if err := depgraph.GenerateFile(cmd.Context(), rocqdepName); err != nil {
+			return nil, err
+		}
+	}
+	parse := depgraph.ParseRocqdep
+	if vos {
+		parse = depgraph.ParseRocqdepVos
+	}
+	if noCache, _ := cmd.Flags().GetBool("no-cache"); noCache {
+		return parse(rocqdepName)
+	}
+	cacheFile, err := rocqdepCacheFile(rocqdepName, vos)
+	if err != nil {
+		return parse(rocqdepName)
+	}
+	return depgraph.CachedParse(rocqdepName, cacheFile, parse)
+}
+
+// rocqdepCacheFile returns where the parsed graph of a dependency file is
+// cached (see depgraph.CachedParse), in the user's cache directory. Graphs
+// with the .vos files (for deps --vos) are cached separately.
+func rocqdepCacheFile(rocqdepName string, vos bool) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(rocqdepName)
+	if err != nil {
+		return "", err
+	}
+	key := abs
+	if vos {
+		key += "\x00vos"
+	}
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(cacheDir, "perennial-cli", "deps", hex.EncodeToString(hash[:8])+".graph"), nil
+}
+
+// prepareRocqdepFile checks if the dependency files of the deps commands are
+// stale, with --refresh-deps.
+func prepareRocqdepFile(cmd *cobra.Command) error {
+	refresh, _ := cmd.Flags().GetString("refresh-deps")
+	switch refresh {
+	case "":
+		return nil
+	case "warn", "auto":
+	default:
+		return fmt.Errorf("unknown --refresh-deps mode %q (expected warn or auto)", refresh)
+	}
+	rocqdepNames, err := rocqdepFiles(cmd)
+	if err != nil {
+		return err
+	}
+	for _, rocqdepName := range rocqdepNames {
+		if _, err := os.Stat(rocqdepName); errors.Is(err, fs.ErrNotExist) {
+			// generated by loadRocqdeps
+			continue
+		}
+		newer, err := depgraph.Stale(rocqdepName)
+		if err != nil {
+			return fmt.Errorf("checking if %s is stale: %w", rocqdepName, err)
+		}
+		if newer == "" {
+			continue
+		}
+		if refresh == "warn" {
+			fmt.Fprintf(os.Stderr, "WARNING: %s is older than %s; regenerate it (or use --refresh-deps)\n", rocqdepName, newer)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "NOTE: %s is older than %s; regenerating it with rocq dep\n", rocqdepName, newer)
+		if err := depgraph.GenerateFile(cmd.Context(), rocqdepName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // depsCmd represents the deps command
 var depsCmd = &cobra.Command{
 	Use: "deps",
@@ -69,71 +416,403 @@ var depsCmd = &cobra.Command{
 		perennial-cli deps $(find src -name "*.v")
 		perennial-cli deps new/proof/proof_prelude.v
 		perennial-cli deps -r new/proof/proof_prelude.v
+		perennial-cli deps --depth 2 new/proof/proof_prelude.v
+		perennial-cli deps --direct new/proof/proof_prelude.v
+		perennial-cli deps -r --direct new/code/sync.v
+		perennial-cli deps -r Perennial.program_proof.wal.proof
+		perennial-cli deps --changed origin/main
 		perennial-cli deps --exclude-source $(find new -name "*.v")
+		perennial-cli deps --project-only new/proof/proof_prelude.v
+		perennial-cli deps -r -0 new/code/sync.v | xargs -0 touch
+		perennial-cli deps -r --exclude 'src/generatedproof/**' src/code/sync.v
+		perennial-cli deps --format dot new/proof/proof_prelude.v | dot -Tsvg > deps.svg
+		perennial-cli deps --json new/proof/proof_prelude.v
+		perennial-cli deps --toposort --vo new/proof/proof_prelude.v
+		make $(perennial-cli deps --vos --exclude-source new/proof/proof_prelude.v)
+		perennial-cli deps --why new/proof/proof_prelude.v new/code/sync.v
+		perennial-cli deps --missing
+		perennial-cli deps --orphans
+		perennial-cli deps --collisions
+		perennial-cli deps -f code/.rocqdeps.d -f proof/.rocqdeps.d -r code/src/a.v
+		perennial-cli deps --refresh-deps -r new/proof/proof_prelude.v
 `),
 	Short: "List and analyze .rocqdeps.d dependencies",
 	Long: `List and analyze .rocqdeps.d dependencies.
 
 Parse .rocqdeps.d and report dependencies.
+
+Files can also be given by their logical module path, such as
+Perennial.program_proof.wal.proof, which is resolved with the -Q and -R
+options of _RocqProject (files under -R can also be named by a suffix of the
+path, as in Require).
+
+Paths are printed relative to the project root (the directory of
+.rocqdeps.d), as in .rocqdeps.d; --paths cwd prints them relative to the
+current directory instead, and --paths abs prints absolute paths. Files given
+as arguments are always relative to the current directory.
+
+--include and --exclude filter the output (including graphs) by glob patterns
+matched against the .v paths, where ** matches any number of directories;
+for example, --exclude 'src/generatedproof/**' leaves out generated proofs.
+The graph can also include files outside the project root, such as libraries
+installed in Rocq's user-contrib that rocq dep found, which have absolute paths
+(or paths starting with ..); --project-only leaves them out.
+
+With --why A.v B.v, prints a shortest chain of dependencies from A.v to B.v,
+which explains why A.v (transitively) depends on B.v.
+
+With several --file options (or a glob like '*/.rocqdeps.d'), the
+dependency files are merged, for workspaces that build code and proofs in
+separate directories; their paths are then relative to the current directory.
+
+If .rocqdeps.d does not exist, the dependencies are generated with rocq dep
+using _RocqProject (and saved to .rocqdeps.d with --write-deps).
+
+The parsed dependencies are cached (in the user's cache directory) until
+.rocqdeps.d changes, which speeds up repeated runs on large projects;
+--no-cache always parses .rocqdeps.d.
+
+With --refresh-deps, .rocqdeps.d is first regenerated with rocq dep if it is
+older than the sources or _RocqProject (--refresh-deps=warn only warns).
+
+With --missing, reports the files .rocqdeps.d refers to that no longer exist
+(and the files that need them), which happens when it is stale after files are
+moved or deleted.
+
+With --orphans, compares the .v files on disk with the files _RocqProject
+lists (directly or under its -Q and -R directories), and reports the files
+missing from one or the other: files that are never compiled, and files
+_RocqProject refers to that do not exist. --orphans=deps compares the files in
+.rocqdeps.d instead.
+
+With --collisions, reports the logical module paths that the -Q and -R options
+of _RocqProject give to several .v files (such as src/a.v and generated/a.v,
+with -Q src Example and -Q generated Example), which otherwise only shows up as
+a "found twice" error when the module is required.
+
+With --changed REF, the files are taken from git diff --name-only REF, and
+the output is those files along with everything that depends on them: the
+files that need to be recompiled (and re-checked) after the changes.
+
+With --vos, the dependencies are those for quick compilation (rocq compile
+-vos, as in make vos), and are printed as .vos files. With --exclude-source,
+these are the .vos files needed to open the given files in an editor. This
+requires .rocqdeps.d to be generated with rocq dep -vos. --vos cannot be
+combined with -r, --changed, --depth, or --direct.
+
+With --toposort, the files are listed in a valid compilation order (each file
+after its dependencies), for scripts that drive builds without make.
+
+With --format, prints the dependency graph between the files instead
+(restricted to the dependencies of the given files, or the whole graph if no
+files are given): dot for rendering with Graphviz, mermaid for a flowchart to
+paste into GitHub issues and Markdown docs, graphml for graph tools like
+Gephi and yEd, or json (also --json) for scripts, as an array of
+{"file": ..., "deps": [...]} objects listing the direct dependencies of each
+file.
 `,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		rocqdepName, _ := cmd.Flags().GetString("file")
-		if rocqdepName == "" {
-			if _, err := os.Stat(".rocqdeps.d"); err != nil {
-				return err
-			}
-			cmd.Flags().Set("file", ".rocqdeps.d")
-		}
-		return nil
+		return prepareRocqdepFile(cmd)
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		rocqdepFileName, _ := cmd.Flags().GetString("file")
 		printVo, _ := cmd.Flags().GetBool("vo")
+		vos, _ := cmd.Flags().GetBool("vos")
 		reverse, _ := cmd.Flags().GetBool("reverse")
 		excludeSource, _ := cmd.Flags().GetBool("exclude-source")
+		toposort, _ := cmd.Flags().GetBool("toposort")
+		why, _ := cmd.Flags().GetBool("why")
+		missing, _ := cmd.Flags().GetBool("missing")
+		orphans, _ := cmd.Flags().GetString("orphans")
+		collisions, _ := cmd.Flags().GetBool("collisions")
+		depth, _ := cmd.Flags().GetInt("depth")
+		direct, _ := cmd.Flags().GetBool("direct")
+		if direct {
+			depth = 1
+		}
+		changedRef, _ := cmd.Flags().GetString("changed")
+		format, _ := cmd.Flags().GetString("format")
+		if jsonOutput, _ := cmd.Flags().GetBool("json"); jsonOutput {
+			format = "json"
+		}
+		var writeGraph graphWriter
+		if format != "list" {
+			var ok bool
+			writeGraph, ok = graphFormats[format]
+			if !ok {
+				return fmt.Errorf("unknown format %q (expected list or one of %s)", format,
+					strings.Join(slices.Sorted(maps.Keys(graphFormats)), ", "))
+			}
+		}
 
-		// Gather .v files from arguments (handles directories)
-		sources, err := gatherVFiles(args)
+		filter, err := newPathFilter(cmd)
 		if err != nil {
 			return err
 		}
-		sourceSet := make(map[string]bool)
-		for _, source := range sources {
-			sourceSet[source] = true
+		root, err := projectRoot(cmd)
+		if err != nil {
+			return err
+		}
+		out, err := outputPath(cmd)
+		if err != nil {
+			return err
 		}
 
-		deps, err := depgraph.ParseRocqdep(rocqdepFileName)
+		deps, err := loadRocqdeps(cmd)
 		if err != nil {
 			return err
 		}
+		if vos && !depgraph.HasVos(deps) {
+			return fmt.Errorf("the dependency file has no .vos dependencies; regenerate it with rocq dep -vos")
+		}
 
-		var depSources []string
-		if reverse {
-			// reverse dependencies (targets)
-			depSources = depgraph.RocqTargets(deps, sources)
+		if why {
+			if len(args) != 2 {
+				return fmt.Errorf("--why takes two files: the file that depends on the other")
+			}
+			ends, err := resolveModuleArgs(cmd, args)
+			if err != nil {
+				return err
+			}
+			ends, err = graphPaths(root, ends)
+			if err != nil {
+				return err
+			}
+			from, to := setExtension(ends[0], ".v"), setExtension(ends[1], ".v")
+			path := depgraph.RocqFileGraph(deps, nil).ShortestPath(from, to)
+			if path == nil {
+				return fmt.Errorf("%s does not depend on %s", out(from), out(to))
+			}
+			for i, file := range path {
+				file = out(file)
+				if printVo {
+					file = setExtension(file, ".vo")
+				}
+				if i > 0 {
+					file = "-> " + file
+				}
+				fmt.Println(file)
+			}
+			return nil
+		}
+
+		if orphans != "" {
+			if len(args) > 0 {
+				return fmt.Errorf("--orphans checks the whole project and takes no arguments")
+			}
+			return reportOrphans(cmd, deps, orphans, out)
+		}
+
+		if collisions {
+			if len(args) > 0 {
+				return fmt.Errorf("--collisions checks the whole project and takes no arguments")
+			}
+			return reportCollisions(cmd, out)
+		}
+
+		if missing {
+			if len(args) > 0 {
+				return fmt.Errorf("--missing checks the whole dependency file and takes no arguments")
+			}
+			return reportMissing(cmd, deps, out)
+		}
+
+		var sources []string
+		if changedRef != "" {
+			if len(args) > 0 {
+				return fmt.Errorf("--changed takes the files from git diff, not arguments")
+			}
+			sources, err = changedVFiles(cmd.Context(), changedRef)
+			// everything that depends on the changed files is affected
+			reverse = true
 		} else {
-			// normal dep behavior
-			depSources = depgraph.RocqDeps(deps, sources)
+			// Gather .v files from arguments (handles directories)
+			sources, err = gatherArgs(cmd, args)
 		}
-		for _, source := range depSources {
-			if excludeSource && sourceSet[source] {
+		if err != nil {
+			return err
+		}
+		// arguments and git diff give paths relative to the current directory
+		sources, err = graphPaths(root, sources)
+		if err != nil {
+			return err
+		}
+		wholeGraph := len(args) == 0 && changedRef == ""
+		sourceSet := make(map[string]bool)
+		for _, source := range sources {
+			sourceSet[source] = true
+		}
+
+		selection := depsSelection{
+			reverse:       reverse,
+			vos:           vos,
+			depth:         depth,
+			direct:        direct,
+			excludeSource: excludeSource,
+			graph:         writeGraph != nil,
+		}
+		depSources := selection.related(deps, sources)
+		// a cycle (from stale or hand-edited dependencies) makes the list of
+		// files meaningless, so it is reported instead; graphs are still
+		// written, since they show the cycle
+		involved := append(slices.Clone(sources), depSources...)
+		if wholeGraph {
+			involved = nil
+		}
+		if cycle := depgraph.RocqFileGraph(deps, involved).FindCycle(); cycle != nil {
+			err := &depgraph.CycleError{Cycle: cycle}
+			if writeGraph == nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "WARNING: %v\n", err)
+		}
+
+		files := selection.listed(sources, depSources)
+
+		if reverse && !excludeSource && (writeGraph != nil || toposort || changedRef != "") {
+			// the reverse dependencies do not include the sources (and
+			// changed files that were deleted need not be rebuilt)
+			var existing []string
+			for _, source := range sources {
+				if _, err := os.Stat(filepath.Join(root, source)); err == nil {
+					existing = append(existing, source)
+				}
+			}
+			files = append(existing, files...)
+		}
+		if writeGraph != nil || toposort {
+			if wholeGraph {
+				files = nil
+			}
+			graph := depgraph.RocqFileGraph(deps, files).Filter(filter.Match)
+			if writeGraph != nil {
+				return writeGraph(os.Stdout, graph.Rename(out))
+			}
+			files, err = graph.TopoSort()
+			if err != nil {
+				return err
+			}
+		}
+		for _, source := range files {
+			if !filter.Match(source) {
 				continue
 			}
-			if printVo {
-				fmt.Println(setExtension(source, ".vo"))
-			} else {
-				fmt.Println(source)
+			switch {
+			case printVo:
+				printPath(cmd, setExtension(out(source), ".vo"))
+			case vos:
+				printPath(cmd, setExtension(out(source), ".vos"))
+			default:
+				printPath(cmd, out(source))
 			}
 		}
 		return nil
 	},
 }
 
+// depsSelection is which files deps lists, from its flags
+type depsSelection struct {
+	reverse bool
+	vos     bool
+	// depth, if positive, limits the files to those at most depth steps away
+	// (1 with direct)
+	depth int
+	// direct lists only the files one step away: the files the sources
+	// require, without the sources themselves, or with reverse, the files
+	// that require them (which never include the sources)
+	direct        bool
+	excludeSource bool
+	// graph is set when deps writes a graph, which shows the sources (to
+	// connect the files) even with direct
+	graph bool
+}
+
+// related returns the files related to sources: their dependencies (which
+// include the sources) or with reverse, the files that depend on them.
+func (s depsSelection) related(deps *depgraph.Graph, sources []string) []string {
+	switch {
+	case s.reverse && s.depth > 0:
+		return depgraph.RocqTargetsWithin(deps, sources, s.depth)
+	case s.reverse:
+		// reverse dependencies (targets)
+		return depgraph.RocqTargets(deps, sources)
+	case s.depth > 0:
+		return depgraph.RocqDepsWithin(deps, sources, s.depth)
+	case s.vos:
+		return depgraph.RocqVosDeps(deps, sources)
+	default:
+		// normal dep behavior
+		return depgraph.RocqDeps(deps, sources)
+	}
+}
+
+// listed returns the related files that deps lists, which leaves out the
+// sources with --exclude-source, and for forward dependencies, with --direct.
+func (s depsSelection) listed(sources []string, related []string) []string {
+	exclude := s.excludeSource || (s.direct && !s.reverse && !s.graph)
+	if !exclude {
+		return related
+	}
+	sourceSet := make(map[string]bool)
+	for _, source := range sources {
+		sourceSet[source] = true
+	}
+	var files []string
+	for _, file := range related {
+		if !sourceSet[file] {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// graphWriter writes a dependency graph in some format
+type graphWriter func(io.Writer, *depgraph.FileGraph) error
+
+// graphFormats are the formats for writing dependency graphs with deps
+// --format, other than the default list of files
+var graphFormats = map[string]graphWriter{
+	"dot":     depgraph.WriteDot,
+	"graphml": depgraph.WriteGraphML,
+	"json":    depgraph.WriteJSON,
+	"mermaid": depgraph.WriteMermaid,
+}
+
 func init() {
 	rootCmd.AddCommand(depsCmd)
 
-	depsCmd.PersistentFlags().StringP("file", "f", "", "Path to .rocqdeps.d file")
+	depsCmd.PersistentFlags().StringSliceP("file", "f", nil, "Path to .rocqdeps.d file (may be repeated or a glob, to merge several files; default .rocqdeps.d)")
 	depsCmd.PersistentFlags().Bool("vo", false, "Print .vo dependencies rather than .v sources")
 	depsCmd.PersistentFlags().BoolP("reverse", "r", false, "Get reverse dependencies (files that depend on provided sources)")
+	depsCmd.PersistentFlags().String("refresh-deps", "", "Check if .rocqdeps.d is older than the sources or _RocqProject, and regenerate it with rocq dep (auto, the default if no value is given) or only warn (warn)")
+	depsCmd.PersistentFlags().Lookup("refresh-deps").NoOptDefVal = "auto"
+	depsCmd.PersistentFlags().Bool("no-cache", false, "Parse .rocqdeps.d rather than loading the graph cached from an earlier run")
+	depsCmd.PersistentFlags().Bool("write-deps", false, "If .rocqdeps.d does not exist, save the dependencies generated with rocq dep to it")
+	depsCmd.PersistentFlags().String("paths", "root", "How to print paths: root (relative to the project root, as in .rocqdeps.d), cwd (relative to the current directory), or abs (absolute)")
+	depsCmd.PersistentFlags().BoolP("print0", "0", false, "Terminate each file in lists with a NUL byte instead of a newline, for xargs -0")
 	depsCmd.PersistentFlags().Bool("exclude-source", false, "Exclude source files from output")
+	depsCmd.Flags().String("changed", "", "List the files affected by changes since a git ref (the changed files and everything that depends on them) instead of taking files as arguments")
+	depsCmd.Flags().Bool("direct", false, "Only list the files the given files directly require (not the files themselves), or with -r, the files that directly depend on them")
+	depsCmd.Flags().Int("depth", 0, "Only include dependencies (or with -r, dependents) at most this many steps away (1 for direct dependencies); 0 for no limit")
+	depsCmd.Flags().StringSlice("include", nil, "Only output files matching this glob pattern (may be repeated; ** matches any number of directories)")
+	depsCmd.Flags().StringSlice("exclude", nil, "Do not output files matching this glob pattern (may be repeated; ** matches any number of directories)")
+	depsCmd.Flags().Bool("project-only", false, "Do not output files outside the project root, such as installed libraries")
+	depsCmd.Flags().String("format", "list", "Output format: list (of files), or the dependencies between them as dot (Graphviz), graphml, json, or mermaid")
+	depsCmd.Flags().Bool("json", false, "Shorthand for --format json")
+	depsCmd.Flags().Bool("vos", false, "Follow the dependencies of .vos files, for quick compilation with -vos, and print .vos files")
+	depsCmd.Flags().Bool("toposort", false, "List files in compilation order (dependencies first), or the whole project if none are given")
+	depsCmd.Flags().Bool("missing", false, "Report files in .rocqdeps.d that no longer exist (a sign that it is stale)")
+	depsCmd.Flags().String("orphans", "", "Compare the .v files on disk (disk, the default if no value is given) or in .rocqdeps.d (deps) with the files listed in _RocqProject")
+	depsCmd.Flags().Lookup("orphans").NoOptDefVal = "disk"
+	depsCmd.Flags().Bool("collisions", false, "Report .v files that the -Q and -R options of _RocqProject map to the same logical module path")
+	depsCmd.Flags().Bool("why", false, "Explain why the first file depends on the second, with a shortest chain of dependencies")
+	depsCmd.MarkFlagsMutuallyExclusive("format", "json", "toposort", "why", "missing", "orphans", "collisions")
+	depsCmd.MarkFlagsMutuallyExclusive("reverse", "why")
+	depsCmd.MarkFlagsMutuallyExclusive("direct", "depth")
+	depsCmd.MarkFlagsMutuallyExclusive("vo", "vos")
+	depsCmd.MarkFlagsMutuallyExclusive("vos", "why", "missing", "orphans", "collisions")
+	depsCmd.MarkFlagsMutuallyExclusive("changed", "why", "missing", "orphans", "collisions")
+	// --vos only follows dependencies, all of them
+	for _, flag := range []string{"reverse", "depth", "direct", "changed"} {
+		depsCmd.MarkFlagsMutuallyExclusive("vos", flag)
+	}
 }
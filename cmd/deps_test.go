@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mit-pdos/perennial-cli/depgraph"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resetDepsFlags sets the flags of deps back to their defaults.
+func resetDepsFlags(t *testing.T) {
+	depsCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Changed {
+			require.NoError(t, f.Value.Set(f.DefValue))
+			f.Changed = false
+		}
+	})
+}
+
+// validateDepsFlags parses args as the only flags of deps and checks its flag
+// groups.
+func validateDepsFlags(t *testing.T, args ...string) error {
+	resetDepsFlags(t)
+	t.Cleanup(func() { resetDepsFlags(t) })
+	require.NoError(t, depsCmd.ParseFlags(args))
+	return depsCmd.ValidateFlagGroups()
+}
+
+func TestDepsVosFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"--vos", "-r"},
+		{"--vos", "--depth", "2"},
+		{"--vos", "--direct"},
+		{"--vos", "--changed", "HEAD"},
+	} {
+		assert.Error(t, validateDepsFlags(t, args...), "%v", args)
+	}
+	assert.NoError(t, validateDepsFlags(t, "--vos", "--exclude-source"))
+	assert.NoError(t, validateDepsFlags(t, "-r", "--depth", "2"))
+	assert.Error(t, validateDepsFlags(t, "--vos", "--vo"))
+	assert.Error(t, validateDepsFlags(t, "--vos", "--why"))
+	// --why prints .vo files with --vo
+	assert.NoError(t, validateDepsFlags(t, "--why", "--vo"))
+}
+
+func TestDepsSelection(t *testing.T) {
+	// a chain A -> B -> C -> D, where A also depends on E
+	rocqdeps := filepath.Join(t.TempDir(), ".rocqdeps.d")
+	require.NoError(t, os.WriteFile(rocqdeps, []byte(`A.vo: A.v B.vo E.vo
+B.vo: B.v C.vo
+C.vo: C.v D.vo
+D.vo: D.v
+E.vo: E.v
+`), 0644))
+	deps, err := depgraph.ParseRocqdep(rocqdeps)
+	require.NoError(t, err)
+	list := func(s depsSelection, sources ...string) []string {
+		return s.listed(sources, s.related(deps, sources))
+	}
+
+	// --direct lists what the files require, but not the files themselves
+	direct := depsSelection{direct: true, depth: 1}
+	assert.Equal(t, []string{"B.v", "E.v"}, list(direct, "A.v"))
+	assert.Equal(t, []string{"E.v", "C.v"}, list(direct, "A.v", "B.v"))
+	// unlike --depth 1
+	assert.Equal(t, []string{"A.v", "B.v", "E.v"}, list(depsSelection{depth: 1}, "A.v"))
+	// graphs show the files, to connect them
+	assert.Equal(t, []string{"A.v", "B.v", "E.v"}, list(depsSelection{direct: true, depth: 1, graph: true}, "A.v"))
+
+	// -r --direct lists the files that directly require them (again, not the
+	// files themselves)
+	reverseDirect := depsSelection{reverse: true, direct: true, depth: 1}
+	assert.Equal(t, []string{"C.v"}, list(reverseDirect, "D.v"))
+	assert.Equal(t, []string{"B.v"}, list(reverseDirect, "C.v", "D.v"))
+
+	// --exclude-source
+	assert.Equal(t, []string{"B.v", "E.v", "C.v", "D.v"}, list(depsSelection{excludeSource: true}, "A.v"))
+	assert.Equal(t, []string{"B.v", "A.v"}, list(depsSelection{reverse: true, excludeSource: true}, "C.v", "D.v"))
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/mit-pdos/perennial-cli/depgraph"
+	"github.com/spf13/cobra"
+)
+
+// diffCmd represents the deps diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff <old.rocqdeps.d> <new.rocqdeps.d>",
+	Short: "Compare two dependency files",
+	Long: `Compare two versions of a dependency file, such as .rocqdeps.d before and
+after a refactor, and list the files and dependencies between them that were
+added (+) or removed (-). Dependencies are printed as "A.v -> B.v", meaning
+A.v depends on B.v.
+
+This is useful for reviewing a change for unintended new dependencies, such as
+proofs that start depending on implementation internals.
+
+With --exit-code, exits with status 1 if there are differences (like git diff).`,
+	Example: indent("  ", `
+perennial-cli deps diff old.rocqdeps.d .rocqdeps.d
+perennial-cli deps diff <(git show origin/main:.rocqdeps.d) .rocqdeps.d
+`),
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printVo, _ := cmd.Flags().GetBool("vo")
+		exitCode, _ := cmd.Flags().GetBool("exit-code")
+		var graphs []*depgraph.FileGraph
+		for _, name := range args {
+			deps, err := depgraph.ParseRocqdep(name)
+			if err != nil {
+				return err
+			}
+			graphs = append(graphs, depgraph.RocqFileGraph(deps, nil))
+		}
+		name := func(file string) string {
+			if printVo {
+				return setExtension(file, ".vo")
+			}
+			return file
+		}
+		diff := depgraph.Diff(graphs[0], graphs[1])
+		for _, file := range diff.AddedFiles {
+			fmt.Printf("+ %s\n", name(file))
+		}
+		for _, file := range diff.RemovedFiles {
+			fmt.Printf("- %s\n", name(file))
+		}
+		for _, dep := range diff.AddedDeps {
+			fmt.Printf("+ %s -> %s\n", name(dep.Target), name(dep.Source))
+		}
+		for _, dep := range diff.RemovedDeps {
+			fmt.Printf("- %s -> %s\n", name(dep.Target), name(dep.Source))
+		}
+		if exitCode && !diff.Empty() {
+			return exitCodeError{code: 1}
+		}
+		return nil
+	},
+}
+
+func init() {
+	depsCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().Bool("exit-code", false, "Exit with status 1 if there are differences")
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/mit-pdos/perennial-cli/depgraph"
+	"github.com/mit-pdos/perennial-cli/timing"
+	"github.com/spf13/cobra"
+)
+
+// makeTarget is a phony target of the Makefile fragment from deps emit-make
+type makeTarget struct {
+	name    string
+	prereqs []string
+}
+
+// dirTargets groups files by directory: each directory containing .v files
+// (directly or in a subdirectory) gets a target that builds the .vo files in
+// it and the targets of its subdirectories. Targets are sorted by name.
+func dirTargets(files []string) []makeTarget {
+	prereqs := make(map[string]map[string]bool)
+	add := func(dir, prereq string) {
+		if prereqs[dir] == nil {
+			prereqs[dir] = make(map[string]bool)
+		}
+		prereqs[dir][prereq] = true
+	}
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		add(dir, setExtension(file, ".vo"))
+		for ; dir != "." && dir != "/" && dir != ".."; dir = filepath.Dir(dir) {
+			add(filepath.Dir(dir), dir)
+		}
+	}
+	var targets []makeTarget
+	for _, dir := range slices.Sorted(maps.Keys(prereqs)) {
+		// files at the top level are built by make itself, and files outside
+		// the project by their own Makefile
+		if dir == "." || depgraph.External(dir) {
+			continue
+		}
+		targets = append(targets, makeTarget{name: dir, prereqs: slices.Sorted(maps.Keys(prereqs[dir]))})
+	}
+	return targets
+}
+
+// makeEscape escapes a file name for a Makefile rule
+func makeEscape(name string) string {
+	r := strings.NewReplacer("$", "$$", " ", `\ `, "#", `\#`)
+	return r.Replace(name)
+}
+
+// writeMakeTargets writes targets as phony Makefile rules, with one
+// prerequisite per line.
+func writeMakeTargets(w io.Writer, targets []makeTarget) error {
+	var b strings.Builder
+	b.WriteString("# Generated by perennial-cli deps emit-make; do not edit.\n")
+	var names []string
+	for _, target := range targets {
+		names = append(names, makeEscape(target.name))
+	}
+	if len(names) > 0 {
+		fmt.Fprintf(&b, ".PHONY: %s\n", strings.Join(names, " "))
+	}
+	for _, target := range targets {
+		fmt.Fprintf(&b, "\n%s:", makeEscape(target.name))
+		for _, prereq := range target.prereqs {
+			fmt.Fprintf(&b, " \\\n\t%s", makeEscape(prereq))
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// emitMakeCmd represents the deps emit-make command
+var emitMakeCmd = &cobra.Command{
+	Use:   "emit-make",
+	Short: "Generate Makefile targets for groups of files",
+	Long: `Generate a Makefile fragment with phony targets that build groups of files,
+for partial builds. Include it from the project's Makefile (next to
+.rocqdeps.d, which makes sure dependencies are built first).
+
+By default (--by dir), each directory gets a target named after it that builds
+the .vo files in it and in its subdirectories, so that make src/proof/wal
+builds just that part of the development.
+
+With --by shard --count N, the files are split into N groups as in deps shard
+(balanced by compile time, if there is a database of compile times, or by file
+length with --weight lines or size), with
+targets shard-1 to shard-N, for parallel CI jobs.`,
+	Args: cobra.NoArgs,
+	Example: indent("  ", `
+perennial-cli deps emit-make > targets.mk
+perennial-cli deps emit-make --by shard --count 4 > shards.mk
+`),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return prepareRocqdepFile(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		by, _ := cmd.Flags().GetString("by")
+		count, _ := cmd.Flags().GetInt("count")
+		deps, err := loadRocqdeps(cmd)
+		if err != nil {
+			return err
+		}
+		out, err := outputPath(cmd)
+		if err != nil {
+			return err
+		}
+		graph := depgraph.RocqFileGraph(deps, nil)
+
+		var targets []makeTarget
+		switch by {
+		case "dir":
+			var files []string
+			for _, file := range graph.Files {
+				files = append(files, out(file))
+			}
+			targets = dirTargets(files)
+		case "shard":
+			if count < 1 {
+				return fmt.Errorf("--by shard needs a positive --count")
+			}
+			weight, _, err := loadWeights(cmd)
+			if err != nil {
+				return err
+			}
+			shards, err := graph.Shard(count, weight)
+			if err != nil {
+				return err
+			}
+			for i, shard := range shards {
+				target := makeTarget{name: fmt.Sprintf("shard-%d", i+1)}
+				for _, file := range shard {
+					target.prereqs = append(target.prereqs, setExtension(out(file), ".vo"))
+				}
+				targets = append(targets, target)
+			}
+		default:
+			return fmt.Errorf("unknown --by grouping %q (expected dir or shard)", by)
+		}
+		return writeMakeTargets(os.Stdout, targets)
+	},
+}
+
+func init() {
+	depsCmd.AddCommand(emitMakeCmd)
+
+	emitMakeCmd.Flags().String("by", "dir", "How to group files into targets: dir (a target per directory) or shard (--count balanced groups)")
+	emitMakeCmd.Flags().Int("count", 0, "Number of groups with --by shard")
+	emitMakeCmd.Flags().String("times", timing.DefaultFile, timesUsage)
+	emitMakeCmd.Flags().String("weight", "", weightUsage)
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirTargets(t *testing.T) {
+	targets := dirTargets([]string{"top.v", "src/a.v", "src/wal/b.v", "src/wal/c.v", "lib/x/d.v", "../other/e.v"})
+	assert.Equal(t, []makeTarget{
+		{name: "lib", prereqs: []string{"lib/x"}},
+		{name: "lib/x", prereqs: []string{"lib/x/d.vo"}},
+		{name: "src", prereqs: []string{"src/a.vo", "src/wal"}},
+		{name: "src/wal", prereqs: []string{"src/wal/b.vo", "src/wal/c.vo"}},
+	}, targets)
+}
+
+func TestWriteMakeTargets(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, writeMakeTargets(&b, []makeTarget{
+		{name: "shard-1", prereqs: []string{"a.vo", "my file.vo"}},
+		{name: "shard-2", prereqs: []string{"b.vo"}},
+	}))
+	assert.Equal(t, `# Generated by perennial-cli deps emit-make; do not edit.
+.PHONY: shard-1 shard-2
+
+shard-1: \
+	a.vo \
+	my\ file.vo
+
+shard-2: \
+	b.vo
+`, b.String())
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mit-pdos/perennial-cli/depgraph"
+	"github.com/spf13/cobra"
+)
+
+// globRegexp converts a glob pattern to an equivalent regular expression. As
+// in path.Match, * and ? match within a path component and [...] matches a
+// character class; in addition, ** matches any number of components (so
+// src/generatedproof/** matches every file under src/generatedproof).
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid pattern %s: unterminated [", pattern)
+			}
+			class := pattern[i+1 : i+end]
+			if negated, ok := strings.CutPrefix(class, "!"); ok {
+				class = "^" + negated
+			}
+			re.WriteString("[" + class + "]")
+			i += end
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.Compile(re.String())
+}
+
+// pathFilter selects files by the --include and --exclude glob patterns,
+// and with --project-only, leaves out files outside the project.
+type pathFilter struct {
+	include, exclude []*regexp.Regexp
+	projectOnly      bool
+}
+
+func newPathFilter(cmd *cobra.Command) (*pathFilter, error) {
+	compile := func(flag string) ([]*regexp.Regexp, error) {
+		patterns, _ := cmd.Flags().GetStringSlice(flag)
+		var res []*regexp.Regexp
+		for _, pattern := range patterns {
+			re, err := globRegexp(pattern)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, re)
+		}
+		return res, nil
+	}
+	include, err := compile("include")
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compile("exclude")
+	if err != nil {
+		return nil, err
+	}
+	projectOnly, _ := cmd.Flags().GetBool("project-only")
+	return &pathFilter{include: include, exclude: exclude, projectOnly: projectOnly}, nil
+}
+
+// Match reports if file matches any --include pattern (if there are any) and
+// no --exclude pattern, and with --project-only, if it is in the project.
+func (f *pathFilter) Match(file string) bool {
+	if f.projectOnly && depgraph.External(file) {
+		return false
+	}
+	matches := func(res []*regexp.Regexp) bool {
+		for _, re := range res {
+			if re.MatchString(file) {
+				return true
+			}
+		}
+		return false
+	}
+	return (len(f.include) == 0 || matches(f.include)) && !matches(f.exclude)
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"src/generatedproof/**", "src/generatedproof/a.v", true},
+		{"src/generatedproof/**", "src/generatedproof/x/y/a.v", true},
+		{"src/generatedproof/**", "src/proof/a.v", false},
+		{"**/sync.v", "sync.v", true},
+		{"**/sync.v", "new/code/sync.v", true},
+		{"**/sync.v", "new/code/async.v", false},
+		{"src/*.v", "src/a.v", true},
+		{"src/*.v", "src/x/a.v", false},
+		{"src/?.v", "src/a.v", true},
+		{"src/[ab].v", "src/b.v", true},
+		{"src/[!ab].v", "src/b.v", false},
+		{"a+b.v", "a+b.v", true},
+	}
+	for _, tt := range tests {
+		re, err := globRegexp(tt.pattern)
+		require.NoError(t, err)
+		assert.Equal(t, tt.match, re.MatchString(tt.path), "%s matching %s", tt.pattern, tt.path)
+	}
+
+	_, err := globRegexp("src/[ab.v")
+	assert.Error(t, err)
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/mit-pdos/perennial-cli/opam"
+	"github.com/spf13/cobra"
+)
+
+func doFmt(cmd *cobra.Command, args []string) error {
+	opamFileName, _ := cmd.Flags().GetString("file")
+	check, _ := cmd.Flags().GetBool("check")
+	keepIndirectOrder, _ := cmd.Flags().GetBool("keep-indirect-order")
+	contents, err := os.ReadFile(opamFileName)
+	if err != nil {
+		return err
+	}
+	opamFile, err := opam.Parse(bytes.NewReader(contents))
+	if err != nil {
+		return err
+	}
+	err = opamFile.Format(opam.FormatOptions{KeepIndirectOrder: keepIndirectOrder})
+	if err != nil {
+		return err
+	}
+	if opamFile.String() == string(contents) {
+		return nil
+	}
+	if check {
+		return fmt.Errorf("%s is not formatted (run perennial-cli opam fmt)", opamFileName)
+	}
+	if err := opamFile.Save(opamFileName); err != nil {
+		return err
+	}
+	fmt.Printf("formatted %s\n", opamFileName)
+	return nil
+}
+
+// fmtCmd represents the opam fmt command
+var fmtCmd = &cobra.Command{
+	Use:   "fmt",
+	Short: "Format depends and pin-depends",
+	Long: `Put the depends and pin-depends blocks in a canonical form.
+
+Normalizes indentation and column alignment, sorts direct pin-depends by
+package name, sorts the indirect section, and removes duplicate entries. Two
+direct pins of the same package to different commits are an error rather
+than a duplicate, since dropping either would change what gets built. The
+rest of the opam file is left unchanged.
+
+If the indirect section was generated with --topological, pass
+--keep-indirect-order to preserve its order.`,
+	Args: cobra.NoArgs,
+	Example: indent("  ", `
+perennial-cli opam fmt
+perennial-cli opam fmt --check
+`),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return setDefaultOpamFile(cmd)
+	},
+	RunE: doFmt,
+}
+
+func init() {
+	opamCmd.AddCommand(fmtCmd)
+	fmtCmd.Flags().Bool("check", false, "Fail if the file is not formatted, without changing it")
+	fmtCmd.Flags().Bool("keep-indirect-order", false, "Do not sort the indirect section")
+}
@@ -35,8 +35,9 @@ var initCmd = &cobra.Command{
 
 	Run in a new directory to add an initial project skeleton.
 	`,
-	Args: cobra.ExactArgs(1),
-	RunE: doInit,
+	Args:        cobra.ExactArgs(1),
+	RunE:        doInit,
+	Annotations: map[string]string{networkAnnotation: ""},
 }
 
 func init() {
@@ -1,14 +1,18 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mit-pdos/perennial-cli/depgraph"
 	"github.com/mit-pdos/perennial-cli/rocq_makefile"
@@ -16,10 +20,14 @@ import (
 	"github.com/spf13/cobra"
 )
 
-// Install src to dest, creating destination directory if needed.
-func installFile(src string, dest string) error {
+// copyFile copies src to dest, creating the destination directory if needed.
+// With preserve, dest gets the permissions and modification time of src;
+// otherwise it is written with mode 0644 (and the current time). A non-zero
+// mode sets the permissions of dest instead, regardless of the umask.
+func copyFile(src string, dest string, preserve bool, mode os.FileMode) error {
 	// Check if source file exists
-	if _, err := os.Stat(src); os.IsNotExist(err) {
+	srcInfo, err := os.Stat(src)
+	if os.IsNotExist(err) {
 		return fmt.Errorf("source file does not exist: %s", src)
 	}
 
@@ -29,6 +37,16 @@ func installFile(src string, dest string) error {
 		return fmt.Errorf("failed to create directory %s: %v", destDir, err)
 	}
 
+	// Replace a link from symlinkFile or hardlinkFile rather than writing
+	// through it, to the source, and a read-only file (say, a copy of a
+	// read-only source) rather than failing to open it
+	if info, err := os.Lstat(dest); err == nil &&
+		(info.Mode()&os.ModeSymlink != 0 || os.SameFile(info, srcInfo) || info.Mode().Perm()&0200 == 0) {
+		if err := os.Remove(dest); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", dest, err)
+		}
+	}
+
 	// Copy source file to destination
 	srcFile, err := os.Open(src)
 	if err != nil {
@@ -47,90 +65,631 @@ func installFile(src string, dest string) error {
 	if err != nil {
 		return fmt.Errorf("failed to copy %s to %s: %v", src, dest, err)
 	}
+	if mode == 0 && preserve && srcInfo != nil {
+		mode = srcInfo.Mode().Perm()
+	}
+	if mode != 0 {
+		// OpenFile only sets the mode of new files, and subject to the umask
+		if err := os.Chmod(dest, mode); err != nil {
+			return fmt.Errorf("failed to set permissions of %s: %v", dest, err)
+		}
+	}
+	if preserve && srcInfo != nil {
+		if err := os.Chtimes(dest, srcInfo.ModTime(), srcInfo.ModTime()); err != nil {
+			return fmt.Errorf("failed to set modification time of %s: %v", dest, err)
+		}
+	}
 
 	return nil
 }
 
+// makeDirs creates dir and any missing parents, like os.MkdirAll, but gives
+// the directories it creates exactly mode, regardless of the umask.
+func makeDirs(dir string, mode os.FileMode) error {
+	if info, err := os.Stat(dir); err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		return nil
+	}
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := makeDirs(parent, mode); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir(dir, mode); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create directory %s: %v", dir, err)
+	}
+	if err := os.Chmod(dir, mode); err != nil {
+		return fmt.Errorf("failed to set permissions of %s: %v", dir, err)
+	}
+	return nil
+}
+
+// parseMode parses a file mode given in octal, such as 0444.
+func parseMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("invalid mode %q (expected octal permissions such as 0444)", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// upToDate reports if dest is already a copy of src made by copyFile with
+// preserve: it has the same size and modification time.
+func upToDate(src string, dest string) bool {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return false
+	}
+	destInfo, err := os.Lstat(dest)
+	if err != nil || !destInfo.Mode().IsRegular() {
+		return false
+	}
+	return srcInfo.Size() == destInfo.Size() && srcInfo.ModTime().Equal(destInfo.ModTime())
+}
+
+// symlinkFile installs src to dest as a symbolic link to src (by its absolute
+// path), replacing any existing file.
+func symlinkFile(src string, dest string) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return fmt.Errorf("source file does not exist: %s", src)
+	}
+	target, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+	destDir := filepath.Dir(dest)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", destDir, err)
+	}
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %v", dest, err)
+	}
+	if err := os.Symlink(target, dest); err != nil {
+		return fmt.Errorf("failed to link %s to %s: %v", dest, src, err)
+	}
+	return nil
+}
+
+// linkFile makes hard links for hardlinkFile (replaced in tests, to simulate
+// linking across filesystems)
+var linkFile = os.Link
+
+// hardlinkFile installs src to dest as a hard link to src, replacing any
+// existing file, or if that fails (say, because they are on different
+// filesystems), as a copy made with copyTo.
+func hardlinkFile(src string, dest string, copyTo func(src, dest string) error) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return fmt.Errorf("source file does not exist: %s", src)
+	}
+	destDir := filepath.Dir(dest)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", destDir, err)
+	}
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %v", dest, err)
+	}
+	if err := linkFile(src, dest); err != nil {
+		return copyTo(src, dest)
+	}
+	return nil
+}
+
+// hardlinked reports if dest is a hard link to src (rather than a copy).
+func hardlinked(src string, dest string) bool {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return false
+	}
+	destInfo, err := os.Lstat(dest)
+	return err == nil && os.SameFile(srcInfo, destInfo)
+}
+
+// linkedTo reports if dest is already a symbolic link to src made by
+// symlinkFile.
+func linkedTo(src string, dest string) bool {
+	target, err := os.Readlink(dest)
+	if err != nil {
+		return false
+	}
+	abs, err := filepath.Abs(src)
+	return err == nil && target == abs
+}
+
 type fileToInstall struct {
 	src  string
 	dest string
 }
 
-func getFilesToInstall(makeVars map[string]string, sources []string) []fileToInstall {
+// installExtras selects the build outputs to install besides the .vo and .v
+// files
+type installExtras struct {
+	// globs installs the .glob files
+	globs bool
+	// vos installs the .vos and .vok files of quick compilation, where they
+	// exist
+	vos bool
+	// native installs the native_compute artifacts in .coq-native, where
+	// they exist, using mappings to find their names
+	native   bool
+	mappings []depgraph.Mapping
+}
+
+// nativeFiles returns the native_compute artifacts of vFile (which may not
+// exist): the .cmi and .cmxs files that rocq compile -native-compiler writes
+// to .coq-native next to the .vo file, named after the logical module path
+// of vFile according to mappings.
+func nativeFiles(mappings []depgraph.Mapping, vFile string) []string {
+	for _, m := range mappings {
+		module, ok := m.ModuleName(vFile)
+		if !ok {
+			continue
+		}
+		name := "N" + strings.ReplaceAll(module, ".", "_")
+		dir := filepath.Join(filepath.Dir(vFile), ".coq-native")
+		return []string{filepath.Join(dir, name+".cmi"), filepath.Join(dir, name+".cmxs")}
+	}
+	return nil
+}
+
+// getFilesToInstall gets the .vo and .v files to install for sources, and
+// the files selected by extras.
+func getFilesToInstall(makeVars map[string]string, sources []string, extras installExtras) []fileToInstall {
+	destDirs := destinationsByDir(sources, func(voFile string) string {
+		return rocq_makefile.DestinationOf(makeVars, voFile)
+	})
+
+	var files []fileToInstall
+	for _, vFile := range sources {
+		voFile := setExtension(vFile, ".vo")
+		destDir := destDirs[filepath.Dir(vFile)]
+
+		files = append(files,
+			fileToInstall{src: voFile, dest: path.Join(destDir, path.Base(voFile))},
+			fileToInstall{src: vFile, dest: path.Join(destDir, path.Base(vFile))},
+		)
+		// glob files are only needed by coqdoc and some IDEs
+		if extras.globs {
+			globFile := setExtension(vFile, ".glob")
+			files = append(files, fileToInstall{src: globFile, dest: path.Join(destDir, path.Base(globFile))})
+		}
+		// only files built with make vos (and vok) have these
+		if extras.vos {
+			for _, ext := range []string{".vos", ".vok"} {
+				file := setExtension(vFile, ext)
+				if _, err := os.Stat(file); err == nil {
+					files = append(files, fileToInstall{src: file, dest: path.Join(destDir, path.Base(file))})
+				}
+			}
+		}
+		// only files compiled with -native-compiler have these
+		if extras.native {
+			for _, file := range nativeFiles(extras.mappings, vFile) {
+				if _, err := os.Stat(file); err == nil {
+					files = append(files, fileToInstall{src: file, dest: path.Join(destDir, ".coq-native", path.Base(file))})
+				}
+			}
+		}
+	}
+
+	// Sort by destination
+	slices.SortFunc(files, func(a, b fileToInstall) int {
+		return strings.Compare(a.dest, b.dest)
+	})
+
+	return files
+}
+
+// destinationsByDir gets the install directory of each directory of sources
+// with destinationOf (given a .vo file). Since the files in a directory share
+// their destination, this only calls destinationOf (which runs rocq makefile)
+// once per directory, in parallel.
+func destinationsByDir(sources []string, destinationOf func(voFile string) string) map[string]string {
+	// a file in each directory, to ask for its destination
+	dirFiles := make(map[string]string)
+	for _, vFile := range sources {
+		dir := filepath.Dir(vFile)
+		if _, ok := dirFiles[dir]; !ok {
+			dirFiles[dir] = setExtension(vFile, ".vo")
+		}
+	}
+
 	// Create request and response channels
 	numWorkers := runtime.NumCPU()
 	requests := make(chan string, numWorkers)
-	responses := make(chan []fileToInstall, numWorkers)
+	type response struct{ dir, destDir string }
+	responses := make(chan response, numWorkers)
 
 	// Start worker pool
 	for range numWorkers {
 		go func() {
-			for vFile := range requests {
-				// NOTE: not installing glob files
-				voFile := setExtension(vFile, ".vo")
-				destDir := rocq_makefile.DestinationOf(makeVars, voFile)
-
-				result := []fileToInstall{
-					{src: voFile, dest: path.Join(destDir, path.Base(voFile))},
-					{src: vFile, dest: path.Join(destDir, path.Base(vFile))},
-				}
-				responses <- result
+			for dir := range requests {
+				responses <- response{dir: dir, destDir: destinationOf(dirFiles[dir])}
 			}
 		}()
 	}
 
 	// Send all requests
 	go func() {
-		for _, vFile := range sources {
-			requests <- vFile
+		for dir := range dirFiles {
+			requests <- dir
 		}
 		close(requests)
 	}()
 
 	// Collect all responses
-	var files []fileToInstall
-	for range len(sources) {
-		files = append(files, <-responses...)
+	destDirs := make(map[string]string, len(dirFiles))
+	for range len(dirFiles) {
+		r := <-responses
+		destDirs[r.dir] = r.destDir
 	}
+	return destDirs
+}
 
-	// Sort by destination
-	slices.SortFunc(files, func(a, b fileToInstall) int {
-		return strings.Compare(a.dest, b.dest)
-	})
+// checkBuilt checks that the files to install exist and that each .vo file is
+// at least as new as its .v file, returning the missing files and the stale
+// .vo files.
+func checkBuilt(filesToInstall []fileToInstall) (missing, stale []string) {
+	for _, f := range filesToInstall {
+		info, err := os.Stat(f.src)
+		if err != nil {
+			missing = append(missing, f.src)
+			continue
+		}
+		if !strings.HasSuffix(f.src, ".vo") {
+			continue
+		}
+		if vInfo, err := os.Stat(setExtension(f.src, ".v")); err == nil && vInfo.ModTime().After(info.ModTime()) {
+			stale = append(stale, f.src)
+		}
+	}
+	return missing, stale
+}
 
-	return files
+// installRecord describes installing or removing one file, for install and
+// uninstall --json
+type installRecord struct {
+	Src  string `json:"src,omitempty"`
+	Dest string `json:"dest"`
+	// Action is copy, symlink, or hardlink for install, and remove or rmdir
+	// for uninstall
+	Action string `json:"action"`
+	// Status is what happened: copied, linked, or skipped (if already
+	// installed) for install, removed or absent for uninstall, failed (with
+	// --keep-going), and planned, skipped, or missing (if the source does not
+	// exist) with --dry-run
+	Status string `json:"status"`
+	// Bytes is the size of the file
+	Bytes int64 `json:"bytes"`
+	// Error is why the file failed
+	Error string `json:"error,omitempty"`
 }
 
-func installAll(quietMode bool, filesToInstall []fileToInstall) error {
-	for _, f := range filesToInstall {
-		if err := installFile(f.src, f.dest); err != nil {
-			return err
+// writeInstallRecords writes records as a JSON array, for --json
+func writeInstallRecords(w io.Writer, records []installRecord) error {
+	if records == nil {
+		records = []installRecord{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+// installResult is the result of installing one file in installAll
+type installResult struct {
+	record installRecord
+	err    error
+}
+
+// installOptions configures installAll
+type installOptions struct {
+	// quiet does not list the installed files
+	quiet bool
+	// print0 lists the installed files as NUL-terminated paths, for xargs -0
+	print0 bool
+	// json does not list the files, since they are reported as JSON
+	json bool
+	// jobs is the number of files to install in parallel (runtime.NumCPU()
+	// if not positive)
+	jobs int
+	// force installs files even if they are up to date
+	force bool
+	// link is how files are installed: "copy" (or ""), "symlink" for
+	// symbolic links to the files, or "hard" for hard links
+	link string
+	// noPreserve copies files with mode 0644 and the current time, rather
+	// than the permissions and modification time of the source
+	noPreserve bool
+	// mode, if not zero, is the permissions of copied files
+	mode os.FileMode
+	// dirMode, if not zero, is the permissions of created directories
+	dirMode os.FileMode
+	// keepGoing continues with the remaining files when a file fails,
+	// recording the failure, rather than stopping
+	keepGoing bool
+	// progress, if not nil, shows the progress of installAll instead of
+	// listing files
+	progress *installProgress
+}
+
+// installLinkModes are the values of install --link
+var installLinkModes = []string{"copy", "symlink", "hard"}
+
+// install returns how to install a file with opts, and how to check if it
+// is already installed.
+func (opts installOptions) install() (install func(src, dest string) error, current func(src, dest string) bool) {
+	// how files are copied, including the copies hardlinkFile falls back to
+	copyTo := func(src, dest string) error {
+		return copyFile(src, dest, !opts.noPreserve, opts.mode)
+	}
+	copied := upToDate
+	if opts.mode != 0 {
+		// a copy with other permissions is installed again, to change them
+		copied = func(src, dest string) bool {
+			info, err := os.Lstat(dest)
+			return err == nil && info.Mode().Perm() == opts.mode && upToDate(src, dest)
+		}
+	}
+	switch opts.link {
+	case "symlink":
+		install, current = symlinkFile, linkedTo
+	case "hard":
+		install = func(src, dest string) error {
+			return hardlinkFile(src, dest, copyTo)
 		}
+		current = func(src, dest string) bool {
+			return hardlinked(src, dest) || copied(src, dest)
+		}
+	default:
+		install, current = copyTo, copied
+	}
+	if opts.dirMode != 0 {
+		// create the directory first, so install finds it
+		installIn := install
+		install = func(src, dest string) error {
+			if err := makeDirs(filepath.Dir(dest), opts.dirMode); err != nil {
+				return err
+			}
+			return installIn(src, dest)
+		}
+	}
+	return install, current
+}
+
+// action names installing a file with opts, for installRecord
+func (opts installOptions) action() string {
+	switch opts.link {
+	case "symlink":
+		return "symlink"
+	case "hard":
+		return "hardlink"
+	}
+	return "copy"
+}
+
+// verb describes installing a file with opts, for listing files
+func (opts installOptions) verb() string {
+	if opts.link == "symlink" || opts.link == "hard" {
+		return "LINK"
+	}
+	return "INSTALL"
+}
+
+// listFile lists one installed or removed file as configured by opts
+func (opts installOptions) listFile(verb, file string) {
+	switch {
+	case opts.json:
+	case opts.print0:
+		fmt.Printf("%s\x00", file)
+	case !opts.quiet:
+		fmt.Printf("%s %s\n", verb, file)
+	}
+}
+
+// fileSizeOrZero returns the size of a file, or 0 if it does not exist
+func fileSizeOrZero(name string) int64 {
+	info, err := os.Stat(name)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// installOne installs f with opts, returning what happened.
+func (opts installOptions) installOne(f fileToInstall) (installRecord, error) {
+	install, current := opts.install()
+	record := installRecord{Src: f.src, Dest: f.dest, Action: opts.action(), Bytes: fileSizeOrZero(f.src)}
+	if !opts.force && current(f.src, f.dest) {
+		record.Status = "skipped"
+		return record, nil
+	}
+	if err := install(f.src, f.dest); err != nil {
+		return record, err
+	}
+	record.Status = "copied"
+	if opts.link == "symlink" || (opts.link == "hard" && hardlinked(f.src, f.dest)) {
+		record.Status = "linked"
+	}
+	return record, nil
+}
+
+// installAll installs files, listing them as configured by opts. Files that
+// are already installed (see upToDate and linkedTo) are skipped and not
+// listed, unless opts.force is set. It returns a record of each file
+// (including the skipped ones).
+//
+// Files are copied by up to opts.jobs workers at a time, which is much
+// faster on network filesystems, but listed in order: each file is listed
+// once it and every file before it have been installed, and installation
+// stops at the first file that fails (returning the records of the files
+// before it). With opts.keepGoing, files that fail are recorded as failed
+// instead, and installAll returns an error once every file has been tried.
+func installAll(opts installOptions, filesToInstall []fileToInstall) ([]installRecord, error) {
+	jobs := opts.jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	// results[i] receives the result of installing filesToInstall[i]
+	results := make([]chan installResult, len(filesToInstall))
+	for i := range results {
+		results[i] = make(chan installResult, 1)
+	}
+	requests := make(chan int)
+	stop := make(chan struct{})
+	defer close(stop)
 
-		if !quietMode {
-			fmt.Printf("INSTALL %s\n", f.src)
+	for range jobs {
+		go func() {
+			for i := range requests {
+				record, err := opts.installOne(filesToInstall[i])
+				results[i] <- installResult{record: record, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(requests)
+		for i := range filesToInstall {
+			select {
+			case requests <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var records []installRecord
+	failed := 0
+	for i, f := range filesToInstall {
+		result := <-results[i]
+		if result.err != nil {
+			if !opts.keepGoing {
+				return records, result.err
+			}
+			result.record.Status = "failed"
+			result.record.Error = result.err.Error()
+			failed++
+		}
+		records = append(records, result.record)
+		if opts.progress != nil {
+			opts.progress.add(result.record)
+			continue
+		}
+		if result.record.Status != "skipped" && result.record.Status != "failed" {
+			opts.listFile(opts.verb(), f.src)
 		}
 	}
-	return nil
+	if failed > 0 {
+		return records, fmt.Errorf("%d of %d files failed", failed, len(filesToInstall))
+	}
+	return records, nil
 }
 
-func uninstallAll(quietMode bool, filesToInstall []fileToInstall) error {
+// writeFailureReport lists the errors of the records that failed (with
+// --keep-going), after the files that were installed or removed.
+func writeFailureReport(w io.Writer, what string, records []installRecord) {
+	var failures []installRecord
+	for _, record := range records {
+		if record.Status == "failed" {
+			failures = append(failures, record)
+		}
+	}
+	if len(failures) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "failed to %s %d of %d files:\n", what, len(failures), len(records))
+	for _, record := range failures {
+		fmt.Fprintf(w, "  %s\n", record.Error)
+	}
+}
+
+// installPlan returns what installAll would do with each file, without
+// installing anything: the files that are up to date are skipped, and the
+// sources that do not exist are missing (which would make installing fail).
+func installPlan(opts installOptions, filesToInstall []fileToInstall) []installRecord {
+	_, current := opts.install()
+	var records []installRecord
 	for _, f := range filesToInstall {
-		// Delete the destination file, ignoring if it doesn't exist
-		if err := os.Remove(f.dest); err != nil && !os.IsNotExist(err) {
-			return fmt.Errorf("failed to remove %s: %v", f.dest, err)
+		record := installRecord{Src: f.src, Dest: f.dest, Action: opts.action(), Status: "planned", Bytes: fileSizeOrZero(f.src)}
+		if _, err := os.Stat(f.src); err != nil {
+			record.Status = "missing"
+		} else if !opts.force && current(f.src, f.dest) {
+			record.Status = "skipped"
 		}
+		records = append(records, record)
+	}
+	return records
+}
 
-		if !quietMode {
-			fmt.Printf("RM %s\n", f.dest)
+// printInstallPlan lists the installPlan of the files, noting the files that
+// are up to date, the files that would overwrite an installed file, and the
+// sources that are missing.
+func printInstallPlan(opts installOptions, filesToInstall []fileToInstall) {
+	for _, record := range installPlan(opts, filesToInstall) {
+		note := ""
+		if record.Status == "missing" {
+			note = " (missing source)"
+		} else if record.Status == "skipped" {
+			note = " (up to date)"
+		} else if _, err := os.Lstat(record.Dest); err == nil {
+			note = " (overwrite)"
 		}
+		fmt.Printf("%s %s -> %s%s\n", opts.verb(), record.Src, record.Dest, note)
 	}
-	return nil
 }
 
-func getInstallFiles(cmd *cobra.Command, args []string) ([]fileToInstall, map[string]string, error) {
-	rocqdepName, _ := cmd.Flags().GetString("file")
+// uninstallAll removes the installed files, listing them like installAll,
+// and returns a record of each file. Like installAll, it stops at the first
+// file that fails, or with opts.keepGoing, records it and continues.
+func uninstallAll(opts installOptions, filesToInstall []fileToInstall) ([]installRecord, error) {
+	var records []installRecord
+	failed := 0
+	for _, f := range filesToInstall {
+		record := installRecord{Dest: f.dest, Action: "remove", Status: "removed"}
+		if info, err := os.Lstat(f.dest); err == nil {
+			record.Bytes = info.Size()
+		}
+		// Delete the destination file, ignoring if it doesn't exist
+		if err := os.Remove(f.dest); os.IsNotExist(err) {
+			record.Status = "absent"
+		} else if err != nil {
+			err = fmt.Errorf("failed to remove %s: %v", f.dest, err)
+			if !opts.keepGoing {
+				return records, err
+			}
+			record.Status = "failed"
+			record.Error = err.Error()
+			records = append(records, record)
+			failed++
+			continue
+		}
+		records = append(records, record)
+		opts.listFile("RM", f.dest)
+	}
+	if failed > 0 {
+		return records, fmt.Errorf("%d of %d files failed", failed, len(filesToInstall))
+	}
+	return records, nil
+}
+
+// getInstallFiles gets the files to install for the arguments of install and
+// uninstall, using the makeVars of the project from rocq makefile.
+func getInstallFiles(cmd *cobra.Command, makeVars map[string]string, args []string) ([]fileToInstall, error) {
 	installDeps, _ := cmd.Flags().GetBool("install-deps")
+	var extras installExtras
+	extras.globs, _ = cmd.Flags().GetBool("with-globs")
+	extras.vos, _ = cmd.Flags().GetBool("with-vos")
+	extras.native, _ = cmd.Flags().GetBool("with-native")
+	if extras.native {
+		projFile, err := depgraph.FindProjectFile(".")
+		if err != nil {
+			return nil, err
+		}
+		extras.mappings, err = depgraph.ProjectMappings(projFile)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if len(args) == 0 {
 		// If no args, walk current directory
 		args = []string{"."}
@@ -139,7 +698,7 @@ func getInstallFiles(cmd *cobra.Command, args []string) ([]fileToInstall, map[st
 	// Gather list of .v files
 	sources, err := gatherVFiles(args)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	if installDeps {
@@ -149,9 +708,9 @@ func getInstallFiles(cmd *cobra.Command, args []string) ([]fileToInstall, map[st
 		}
 
 		// Parse dependency graph from .rocqdeps.d
-		deps, err := depgraph.ParseRocqdep(rocqdepName)
+		deps, err := loadRocqdeps(cmd)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to parse deps %s: %w", rocqdepName, err)
+			return nil, fmt.Errorf("failed to parse deps: %w", err)
 		}
 
 		// Add all dependencies not already in sources
@@ -164,17 +723,140 @@ func getInstallFiles(cmd *cobra.Command, args []string) ([]fileToInstall, map[st
 	}
 
 	if len(sources) == 0 {
-		return nil, nil, fmt.Errorf("no sources to install")
+		return nil, fmt.Errorf("no sources to install")
 	}
 
-	// Get makefile vars from _RocqProject or _CoqProject
-	makeVars, err := rocq_makefile.GetRocqVars()
+	// Install sources
+	return getFilesToInstall(makeVars, sources, extras), nil
+}
+
+// getDocFiles gets the documentation to install with --with-doc (none
+// without it), from html/. When uninstalling, the documentation may have been
+// cleaned from html/ after installing it, in which case the files installed
+// under destdir are listed instead.
+func getDocFiles(cmd *cobra.Command, makeVars map[string]string, destdir string, uninstall bool) ([]fileToInstall, error) {
+	if withDoc, _ := cmd.Flags().GetBool("with-doc"); !withDoc {
+		return nil, nil
+	}
+	docroot, err := docRoot(cmd)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	installDir := path.Join(makeVars["COQDOCINSTALL"], docroot, "html")
+	if _, err := os.Stat("html"); uninstall && os.IsNotExist(err) {
+		return installedFiles(stagePath(destdir, installDir), installDir)
+	}
+	return docFiles("html", installDir)
+}
 
-	// Install sources
-	return getFilesToInstall(makeVars, sources), makeVars, nil
+// docRoot returns the directory in the documentation install directory
+// (COQDOCINSTALL) for the project's documentation: --docroot, by default the
+// logical name of the first -Q or -R mapping in the project file.
+func docRoot(cmd *cobra.Command) (string, error) {
+	if docroot, _ := cmd.Flags().GetString("docroot"); docroot != "" {
+		return docroot, nil
+	}
+	projFile, err := depgraph.FindProjectFile(".")
+	if err != nil {
+		return "", err
+	}
+	mappings, err := depgraph.ProjectMappings(projFile)
+	if err != nil {
+		return "", err
+	}
+	if len(mappings) == 0 || mappings[0].Logical == "" {
+		return "", fmt.Errorf("%s has no -Q or -R mapping to name the documentation after; use --docroot", projFile)
+	}
+	return mappings[0].Logical, nil
+}
+
+// docFiles gets the HTML documentation in docDir (html, where make html puts
+// it) to install under installDir, like make install-doc.
+func docFiles(docDir string, installDir string) ([]fileToInstall, error) {
+	if _, err := os.Stat(docDir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("no documentation in %s; generate it first (for example, with make html)", docDir)
+	}
+	var files []fileToInstall
+	err := filepath.WalkDir(docDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(docDir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, fileToInstall{src: p, dest: path.Join(installDir, filepath.ToSlash(rel))})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", docDir, err)
+	}
+	return files, nil
+}
+
+// installedFiles lists the files under dir, the staged location of
+// installDir, as installed to installDir. It returns no files if dir does not
+// exist.
+func installedFiles(dir string, installDir string) ([]fileToInstall, error) {
+	var files []fileToInstall
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, fileToInstall{dest: path.Join(installDir, filepath.ToSlash(rel))})
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", dir, err)
+	}
+	return files, nil
+}
+
+// pruneEmptyDirs removes the directories of the removed files that are now
+// empty, and then their parents that become empty, up to (but not including)
+// root. It returns the removed directories.
+func pruneEmptyDirs(root string, removed []fileToInstall) []string {
+	root = filepath.Clean(root)
+	var pruned []string
+	for _, f := range removed {
+		for dir := filepath.Dir(f.dest); dir != root; dir = filepath.Dir(dir) {
+			if rel, err := filepath.Rel(root, dir); err != nil || !filepath.IsLocal(rel) {
+				// not under root
+				break
+			}
+			// fails if the directory is not empty (or already removed)
+			if err := os.Remove(dir); err != nil {
+				break
+			}
+			pruned = append(pruned, dir)
+		}
+	}
+	return pruned
+}
+
+// stagePath prefixes an install path with the staging root destdir (if any),
+// like DESTDIR in make install.
+func stagePath(destdir string, p string) string {
+	if destdir == "" {
+		return p
+	}
+	return filepath.Join(destdir, p)
+}
+
+// stageFiles prefixes the destinations of files with destdir (see stagePath).
+func stageFiles(destdir string, files []fileToInstall) []fileToInstall {
+	staged := make([]fileToInstall, len(files))
+	for i, f := range files {
+		staged[i] = fileToInstall{src: f.src, dest: stagePath(destdir, f.dest)}
+	}
+	return staged
 }
 
 // installCmd represents the install command
@@ -184,22 +866,183 @@ var installCmd = &cobra.Command{
 	Long: `Install .vo files, typically to an opam switch.
 
 Takes a list of either .v files or directories (which are searched recursively
-for all *.v files). Assumes all input files are compiled. Will automatically
-install any dependencies required by the input .v files, using .rocqdeps.d.
+for all *.v files). Will automatically install any dependencies required by
+the input .v files, using .rocqdeps.d. Before installing anything, checks that
+every file is compiled, reporting all .vo files that are missing or older than
+their .v files (--allow-stale only warns about the latter).
+With --with-globs, also installs the .glob files, for coqdoc and IDE tooling,
+with --with-vos, the .vos and .vok files (where they exist), for quick
+compilation against the installed package, and with --with-native, the
+native_compute artifacts (.cmi and .cmxs files in .coq-native) of files
+compiled with -native-compiler. With --with-doc, also installs the HTML
+documentation generated in html/ (by make html) to the switch's documentation
+directory (COQDOCINSTALL), under --docroot (by default the project's logical
+name), like make install-doc.
+Files are copied in parallel (see --jobs), which speeds up installing to
+network filesystems, but still listed in order. Files that are already
+installed (with the same size and modification time) are skipped, which makes
+installing again after a small change fast; --force copies every file. Copies
+keep the permissions and modification time of the source files, like
+install -p, so timestamp-based staleness checks downstream still work;
+--preserve=false writes them with mode 0644 and the current time instead (and
+so copies every file each time). --mode sets the permissions of the copies
+instead, such as --mode 0444 to make the installed files read-only as opam
+does, and --dir-mode those of the directories install creates; unlike the
+defaults, these are not reduced by the umask. On a
+terminal, large installs show a progress bar instead of listing every file
+(even with --quiet), followed by a summary (--no-progress lists the files).
+Installing stops at the first file that fails (say, on a permission or disk
+error); with --keep-going, the remaining files are installed anyway, and every
+failure is reported at the end (with a nonzero exit status).
+
+With --link symlink, installs symbolic links to the files in the build tree
+instead of copies, so the installed package follows rebuilds without
+installing again: the usual workflow when developing a dependency and its
+consumer side by side in the same switch. With --link hard, installs hard
+links to the files where possible (falling back to copies across
+filesystems, which follow --preserve and --mode like other copies), which
+saves time and disk space for large developments.
+
+With --dry-run, lists where each file would be copied (noting files that are up
+to date, files that would overwrite installed ones, and sources that are
+missing) without installing anything, to check the install directory
+(COQLIBINSTALL) first.
+
+The installed files are recorded in a manifest (by default
+<package>.install-manifest in the install directory, named after the opam
+file), which uninstall uses to remove them.
+
+With --destdir, every installed file (and the manifest) is put under that
+staging root instead, like DESTDIR in make install, so packagers can stage the
+install without touching the real switch; the manifest still records the
+final paths.
+
+With --json, prints a JSON array with a record of each file instead of
+listing them, for build systems: its "src" and "dest", the "action" (copy,
+symlink, or hardlink), its "status" (copied, linked, skipped if it was up to
+date, or failed with --keep-going, with the "error"; with --dry-run, planned,
+skipped, or missing), and its size in "bytes".
 
 Emulates the functionality of "make install" when using rocq makefile.
 	`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		quietMode, _ := cmd.Flags().GetBool("quiet")
-		filesToInstall, makeVars, err := getInstallFiles(cmd, args)
+		var opts installOptions
+		opts.quiet, _ = cmd.Flags().GetBool("quiet")
+		opts.print0, _ = cmd.Flags().GetBool("print0")
+		opts.json, _ = cmd.Flags().GetBool("json")
+		opts.keepGoing, _ = cmd.Flags().GetBool("keep-going")
+		opts.jobs, _ = cmd.Flags().GetInt("jobs")
+		opts.force, _ = cmd.Flags().GetBool("force")
+		opts.link, _ = cmd.Flags().GetString("link")
+		preserve, _ := cmd.Flags().GetBool("preserve")
+		opts.noPreserve = !preserve
+		if !slices.Contains(installLinkModes, opts.link) {
+			return fmt.Errorf("unknown --link mode %q (expected copy, symlink, or hard)", opts.link)
+		}
+		for _, flag := range []struct {
+			name string
+			mode *os.FileMode
+		}{{"mode", &opts.mode}, {"dir-mode", &opts.dirMode}} {
+			if s, _ := cmd.Flags().GetString(flag.name); s != "" {
+				mode, err := parseMode(s)
+				if err != nil {
+					return fmt.Errorf("--%s: %v", flag.name, err)
+				}
+				*flag.mode = mode
+			}
+		}
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		destdir, _ := cmd.Flags().GetString("destdir")
+		// Get makefile vars from _RocqProject or _CoqProject
+		makeVars, err := rocq_makefile.GetRocqVars()
+		if err != nil {
+			return err
+		}
+		filesToInstall, err := getInstallFiles(cmd, makeVars, args)
+		if err != nil {
+			return err
+		}
+		docs, err := getDocFiles(cmd, makeVars, destdir, false)
+		if err != nil {
+			return err
+		}
+		filesToInstall = append(filesToInstall, docs...)
+		manifest, err := manifestFile(cmd, makeVars)
 		if err != nil {
 			return err
 		}
-		if err := installAll(quietMode, filesToInstall); err != nil {
+		installDir := stagePath(destdir, path.Clean(makeVars["COQLIBINSTALL"]))
+		if dryRun && opts.json {
+			return writeInstallRecords(os.Stdout, installPlan(opts, stageFiles(destdir, filesToInstall)))
+		}
+		if dryRun {
+			printInstallPlan(opts, stageFiles(destdir, filesToInstall))
+			fmt.Printf("would install to %s (recorded in %s)\n", installDir, stagePath(destdir, manifest))
+			return nil
+		}
+		// report every file that is not built, rather than failing partway
+		missing, stale := checkBuilt(filesToInstall)
+		for _, file := range missing {
+			fmt.Fprintf(os.Stderr, "missing: %s\n", file)
+		}
+		allowStale, _ := cmd.Flags().GetBool("allow-stale")
+		for _, file := range stale {
+			if allowStale {
+				fmt.Fprintf(os.Stderr, "WARNING: %s is older than %s\n", file, setExtension(file, ".v"))
+			} else {
+				fmt.Fprintf(os.Stderr, "stale: %s is older than %s\n", file, setExtension(file, ".v"))
+			}
+		}
+		if allowStale {
+			stale = nil
+		}
+		if len(missing) > 0 || len(stale) > 0 {
+			return fmt.Errorf("%d file(s) are missing or out of date; build them first (for example, with make)",
+				len(missing)+len(stale))
+		}
+		// record the files before copying them, so uninstall also removes
+		// the files of an install that fails partway
+		var dests []string
+		for _, f := range filesToInstall {
+			dests = append(dests, f.dest)
+		}
+		if err := writeManifest(stagePath(destdir, manifest), dests); err != nil {
+			return err
+		}
+		noProgress, _ := cmd.Flags().GetBool("no-progress")
+		if !noProgress && !opts.json && !opts.print0 &&
+			len(filesToInstall) >= progressThreshold && isTerminal(os.Stdout) {
+			opts.progress = newInstallProgress(os.Stdout, len(filesToInstall))
+		}
+		start := time.Now()
+		records, err := installAll(opts, stageFiles(destdir, filesToInstall))
+		if opts.progress != nil {
+			opts.progress.finish()
+		}
+		if opts.json {
+			// report the files installed before any error
+			if err := writeInstallRecords(os.Stdout, records); err != nil {
+				return err
+			}
+		} else {
+			writeFailureReport(os.Stderr, "install", records)
+		}
+		if err != nil {
 			return fmt.Errorf("error installing sources: %v", err)
 		}
-		if !quietMode {
-			fmt.Printf("installed to %s\n", path.Clean(makeVars["COQLIBINSTALL"]))
+		if (!opts.quiet || opts.progress != nil) && !opts.print0 && !opts.json {
+			skipped := 0
+			var bytes int64
+			for _, record := range records {
+				if record.Status == "skipped" {
+					skipped++
+				} else {
+					bytes += record.Bytes
+				}
+			}
+			fmt.Printf("%d installed (%s), %d up to date in %.1fs\n",
+				len(records)-skipped, formatBytes(bytes), skipped, time.Since(start).Seconds())
+			fmt.Printf("installed to %s\n", installDir)
 		}
 
 		return nil
@@ -216,15 +1059,102 @@ Takes a list of either .v files or directories (which are searched recursively
 for all *.v files). Will automatically uninstall any dependencies required by
 the input .v files, using .rocqdeps.d.
 
+Without files, removes every file listed in the manifest that install writes
+(see --manifest) if there is one, which also removes files from earlier
+installs that the current sources no longer produce, and then the manifest.
+
+Directories in the install directory (COQLIBINSTALL) that are empty after
+removing the files are removed as well, since empty directories in
+user-contrib still show up in Rocq's load path. The same goes for the
+documentation directory (COQDOCINSTALL), for documentation installed with
+--with-doc. If html/ has been cleaned since, --with-doc removes the files
+installed under --docroot instead.
+
+With --destdir, uninstalls from that staging root, as install --destdir does.
+With --keep-going, removes the remaining files when a file fails, and reports
+every failure at the end, as install --keep-going does.
+
+With --json, prints a JSON array with a record of each removed file and
+directory instead, as install --json does: its "dest", the "action" (remove or
+rmdir), its "status" (removed, absent if it was not installed, or failed with
+--keep-going, with the "error"), and its size in "bytes".
+
 Emulates the functionality of "make uninstall" when using rocq makefile.
 	`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		quietMode, _ := cmd.Flags().GetBool("quiet")
-		filesToInstall, _, err := getInstallFiles(cmd, args)
+		var opts installOptions
+		opts.quiet, _ = cmd.Flags().GetBool("quiet")
+		opts.print0, _ = cmd.Flags().GetBool("print0")
+		opts.json, _ = cmd.Flags().GetBool("json")
+		opts.keepGoing, _ = cmd.Flags().GetBool("keep-going")
+		destdir, _ := cmd.Flags().GetString("destdir")
+		// Get makefile vars from _RocqProject or _CoqProject
+		makeVars, err := rocq_makefile.GetRocqVars()
 		if err != nil {
 			return err
 		}
-		if err := uninstallAll(quietMode, filesToInstall); err != nil {
+		manifest, err := manifestFile(cmd, makeVars)
+		if err != nil {
+			return err
+		}
+		manifest = stagePath(destdir, manifest)
+		installDir := stagePath(destdir, path.Clean(makeVars["COQLIBINSTALL"]))
+		docDir := stagePath(destdir, path.Clean(makeVars["COQDOCINSTALL"]))
+
+		var filesToRemove []fileToInstall
+		fromManifest := false
+		if len(args) == 0 {
+			installed, err := readManifest(manifest)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if err == nil {
+				fromManifest = true
+				for _, dest := range installed {
+					filesToRemove = append(filesToRemove, fileToInstall{dest: stagePath(destdir, dest)})
+				}
+			}
+		}
+		if !fromManifest {
+			filesToInstall, err := getInstallFiles(cmd, makeVars, args)
+			if err != nil {
+				return err
+			}
+			docs, err := getDocFiles(cmd, makeVars, destdir, true)
+			if err != nil {
+				return err
+			}
+			filesToRemove = stageFiles(destdir, append(filesToInstall, docs...))
+		}
+
+		records, err := uninstallAll(opts, filesToRemove)
+		if err == nil && fromManifest {
+			err = os.Remove(manifest)
+			filesToRemove = append(filesToRemove, fileToInstall{dest: manifest})
+		}
+		// with --keep-going, the directories of the files that failed are not
+		// empty, but the others may be
+		if err == nil || opts.keepGoing {
+			pruned := pruneEmptyDirs(installDir, filesToRemove)
+			if makeVars["COQDOCINSTALL"] != "" {
+				pruned = append(pruned, pruneEmptyDirs(docDir, filesToRemove)...)
+			}
+			for _, dir := range pruned {
+				records = append(records, installRecord{Dest: dir, Action: "rmdir", Status: "removed"})
+				if !opts.quiet && !opts.print0 && !opts.json {
+					fmt.Printf("RMDIR %s\n", dir)
+				}
+			}
+		}
+		if opts.json {
+			// report the files removed before any error
+			if err := writeInstallRecords(os.Stdout, records); err != nil {
+				return err
+			}
+		} else {
+			writeFailureReport(os.Stderr, "uninstall", records)
+		}
+		if err != nil {
 			return fmt.Errorf("error uninstalling sources: %v", err)
 		}
 
@@ -236,11 +1166,45 @@ func init() {
 	rootCmd.AddCommand(installCmd)
 	rootCmd.AddCommand(uninstallCmd)
 
-	installCmd.PersistentFlags().StringP("file", "f", ".rocqdeps.d", "Path to .rocqdeps.d file")
+	installCmd.PersistentFlags().StringSliceP("file", "f", []string{".rocqdeps.d"}, "Path to .rocqdeps.d file (may be repeated or a glob, to merge several files)")
+	installCmd.PersistentFlags().Bool("write-deps", false, "If .rocqdeps.d does not exist, save the dependencies generated with rocq dep to it")
 	installCmd.PersistentFlags().BoolP("quiet", "q", false, "quiet mode (don't print list of installed files)")
 	installCmd.PersistentFlags().Bool("install-deps", true, "install dependencies of supplied files")
+	installCmd.PersistentFlags().Bool("with-globs", false, "also install .glob files (for coqdoc and IDE tooling)")
+	installCmd.PersistentFlags().Bool("with-vos", false, "also install .vos and .vok files where they exist (for quick compilation with -vos)")
+	installCmd.PersistentFlags().Bool("with-native", false, "also install native_compute artifacts (.coq-native/*.cmi and *.cmxs) where they exist")
+	installCmd.PersistentFlags().Bool("with-doc", false, "also install the HTML documentation in html/ (from make html) to the documentation directory")
+	installCmd.PersistentFlags().String("docroot", "", "directory to install the documentation to, under the documentation directory (default the project's logical name)")
+	installCmd.PersistentFlags().BoolP("print0", "0", false, "list the installed files (without INSTALL) terminated by NUL bytes, for xargs -0")
+	installCmd.PersistentFlags().BoolP("dry-run", "n", false, "print where each file would be installed, without copying anything")
+	installCmd.PersistentFlags().Bool("json", false, "print a JSON record of each file (and what was done with it) instead of listing them")
+	installCmd.MarkFlagsMutuallyExclusive("dry-run", "print0")
+	installCmd.MarkFlagsMutuallyExclusive("json", "print0")
+	installCmd.PersistentFlags().String("manifest", "", "file recording the installed files, for uninstall (default <package>.install-manifest in the install directory)")
+	installCmd.PersistentFlags().Bool("allow-stale", false, "install .vo files that are older than their .v files, with a warning")
+	installCmd.PersistentFlags().Bool("force", false, "copy every file, even if it is already installed")
+	installCmd.PersistentFlags().String("link", "copy", "how to install files: copy, symlink (link to the build tree), or hard (hard links, or copies across filesystems)")
+	installCmd.PersistentFlags().Bool("preserve", true, "give copies the permissions and modification time of the source files, like install -p (--preserve=false uses mode 0644 and the current time)")
+	installCmd.PersistentFlags().String("mode", "", "permissions of copied files in octal, such as 0444 for read-only files (default those of the source, or 0644 with --preserve=false)")
+	installCmd.PersistentFlags().String("dir-mode", "", "permissions of created directories in octal, regardless of the umask (default 0755, less the umask)")
+	installCmd.PersistentFlags().String("destdir", "", "staging root to install under instead of /, like DESTDIR (for packagers)")
+	installCmd.PersistentFlags().Bool("no-progress", false, "list the installed files even when there are many on a terminal, rather than showing a progress bar")
+	installCmd.PersistentFlags().BoolP("keep-going", "k", false, "install the remaining files when a file fails, and report every failure at the end")
+	installCmd.PersistentFlags().IntP("jobs", "j", 0, "number of files to copy in parallel (default the number of CPUs)")
 
-	uninstallCmd.PersistentFlags().StringP("file", "f", ".rocqdeps.d", "Path to .rocqdeps.d file")
+	uninstallCmd.PersistentFlags().StringSliceP("file", "f", []string{".rocqdeps.d"}, "Path to .rocqdeps.d file (may be repeated or a glob, to merge several files)")
+	uninstallCmd.PersistentFlags().Bool("write-deps", false, "If .rocqdeps.d does not exist, save the dependencies generated with rocq dep to it")
 	uninstallCmd.PersistentFlags().BoolP("quiet", "q", false, "quiet mode (don't print list of uninstalled files)")
 	uninstallCmd.PersistentFlags().Bool("install-deps", true, "also uninstall dependencies")
+	uninstallCmd.PersistentFlags().Bool("with-globs", false, "also uninstall .glob files")
+	uninstallCmd.PersistentFlags().Bool("with-vos", false, "also uninstall .vos and .vok files")
+	uninstallCmd.PersistentFlags().Bool("with-native", false, "also uninstall native_compute artifacts")
+	uninstallCmd.PersistentFlags().Bool("with-doc", false, "also uninstall the HTML documentation in html/")
+	uninstallCmd.PersistentFlags().String("docroot", "", "directory the documentation is installed to, under the documentation directory (default the project's logical name)")
+	uninstallCmd.PersistentFlags().BoolP("print0", "0", false, "list the removed files (without RM) terminated by NUL bytes, for xargs -0")
+	uninstallCmd.PersistentFlags().Bool("json", false, "print a JSON record of each removed file instead of listing them")
+	uninstallCmd.MarkFlagsMutuallyExclusive("json", "print0")
+	uninstallCmd.PersistentFlags().BoolP("keep-going", "k", false, "remove the remaining files when a file fails, and report every failure at the end")
+	uninstallCmd.PersistentFlags().String("destdir", "", "staging root to uninstall from instead of /, like DESTDIR")
+	uninstallCmd.PersistentFlags().String("manifest", "", "file recording the installed files, used without arguments (default <package>.install-manifest in the install directory)")
 }
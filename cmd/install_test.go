@@ -1,10 +1,16 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/mit-pdos/perennial-cli/depgraph"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -23,8 +29,9 @@ func TestInstallFile(t *testing.T) {
 	destDir := filepath.Join(tmpDir, "dest", "subdir")
 	destFile := filepath.Join(destDir, "test.vo")
 
-	// Install the file
-	err = installFile(srcFile, destFile)
+	// Install the file, as install does by default
+	install, _ := installOptions{}.install()
+	err = install(srcFile, destFile)
 	require.NoError(t, err)
 
 	// Verify destination file exists
@@ -53,7 +60,8 @@ func TestInstallFileNonExistent(t *testing.T) {
 	srcFile := filepath.Join(tmpDir, "nonexistent.vo")
 	destFile := filepath.Join(tmpDir, "dest.vo")
 
-	err := installFile(srcFile, destFile)
+	install, _ := installOptions{}.install()
+	err := install(srcFile, destFile)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "does not exist")
 }
@@ -74,7 +82,8 @@ func TestInstallFileOverwrite(t *testing.T) {
 	require.NoError(t, err)
 
 	// Install should overwrite
-	err = installFile(srcFile, destFile)
+	install, _ := installOptions{}.install()
+	err = install(srcFile, destFile)
 	require.NoError(t, err)
 
 	// Verify content was overwritten
@@ -82,3 +91,372 @@ func TestInstallFileOverwrite(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, newContent, destContent)
 }
+
+func TestCopyFilePreserve(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// a read-only source, with an old modification time
+	srcFile := filepath.Join(tmpDir, "test.vo")
+	require.NoError(t, os.WriteFile(srcFile, []byte("content"), 0444))
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(srcFile, mtime, mtime))
+
+	destFile := filepath.Join(tmpDir, "dest", "test.vo")
+	require.NoError(t, copyFile(srcFile, destFile, true, 0))
+	info, err := os.Stat(destFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0444), info.Mode().Perm())
+	assert.True(t, info.ModTime().Equal(mtime))
+
+	// copying again replaces the read-only copy
+	require.NoError(t, copyFile(srcFile, destFile, true, 0))
+
+	require.NoError(t, copyFile(srcFile, destFile, false, 0))
+	info, err = os.Stat(destFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+	assert.False(t, info.ModTime().Equal(mtime))
+}
+
+func TestInstallModes(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcFile := filepath.Join(tmpDir, "test.vo")
+	require.NoError(t, os.WriteFile(srcFile, []byte("content"), 0644))
+
+	opts := installOptions{mode: 0444, dirMode: 0750}
+	install, current := opts.install()
+	destFile := filepath.Join(tmpDir, "dest", "sub", "test.vo")
+	require.NoError(t, install(srcFile, destFile))
+	info, err := os.Stat(destFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0444), info.Mode().Perm())
+	for _, dir := range []string{filepath.Join(tmpDir, "dest"), filepath.Join(tmpDir, "dest", "sub")} {
+		info, err := os.Stat(dir)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0750), info.Mode().Perm(), dir)
+	}
+	assert.True(t, current(srcFile, destFile))
+
+	// a copy with other permissions is not current
+	_, current = installOptions{mode: 0640}.install()
+	assert.False(t, current(srcFile, destFile))
+}
+
+func TestParseMode(t *testing.T) {
+	mode, err := parseMode("0444")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0444), mode)
+	mode, err = parseMode("755")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), mode)
+	for _, s := range []string{"", "0", "0888", "1777", "rw"} {
+		_, err := parseMode(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestInstallAll(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var files []fileToInstall
+	for i := range 50 {
+		src := filepath.Join(tmpDir, "src", fmt.Sprintf("f%d.vo", i))
+		require.NoError(t, os.MkdirAll(filepath.Dir(src), 0755))
+		require.NoError(t, os.WriteFile(src, []byte(fmt.Sprint(i)), 0644))
+		files = append(files, fileToInstall{
+			src:  src,
+			dest: filepath.Join(tmpDir, "dest", fmt.Sprintf("d%d", i%5), fmt.Sprintf("f%d.vo", i)),
+		})
+	}
+	// counts the records of each status
+	statuses := func(records []installRecord) map[string]int {
+		counts := make(map[string]int)
+		for _, record := range records {
+			counts[record.Status]++
+		}
+		return counts
+	}
+	opts := installOptions{quiet: true, jobs: 4}
+	records, err := installAll(opts, files)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"copied": len(files)}, statuses(records))
+	assert.Equal(t, installRecord{Src: files[12].src, Dest: files[12].dest, Action: "copy", Status: "copied", Bytes: 2}, records[12])
+	for i, f := range files {
+		content, err := os.ReadFile(f.dest)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprint(i), string(content))
+	}
+
+	// installing again only copies changed files
+	require.NoError(t, os.WriteFile(files[3].src, []byte("changed"), 0644))
+	records, err = installAll(opts, files)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"copied": 1, "skipped": len(files) - 1}, statuses(records))
+	assert.Equal(t, "copied", records[3].Status)
+	content, err := os.ReadFile(files[3].dest)
+	require.NoError(t, err)
+	assert.Equal(t, "changed", string(content))
+
+	records, err = installAll(installOptions{quiet: true, jobs: 4, force: true}, files)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"copied": len(files)}, statuses(records))
+
+	// a missing file stops the installation with its error
+	files[10].src = filepath.Join(tmpDir, "src", "missing.vo")
+	records, err = installAll(installOptions{quiet: true, jobs: 4, force: true}, files)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "missing.vo")
+	assert.Len(t, records, 10)
+
+	// with keepGoing, the other files are installed and the failure recorded
+	files[20].src = filepath.Join(tmpDir, "src", "missing2.vo")
+	records, err = installAll(installOptions{quiet: true, jobs: 4, force: true, keepGoing: true}, files)
+	require.Error(t, err)
+	assert.Equal(t, "2 of 50 files failed", err.Error())
+	assert.Equal(t, map[string]int{"copied": len(files) - 2, "failed": 2}, statuses(records))
+	assert.Equal(t, "failed", records[20].Status)
+	assert.Contains(t, records[20].Error, "missing2.vo")
+
+	var report strings.Builder
+	writeFailureReport(&report, "install", records)
+	assert.Equal(t, "failed to install 2 of 50 files:\n  "+records[10].Error+"\n  "+records[20].Error+"\n", report.String())
+}
+
+func TestUninstallAllKeepGoing(t *testing.T) {
+	tmpDir := t.TempDir()
+	var files []fileToInstall
+	for _, name := range []string{"a.vo", "b/c.vo", "d.vo"} {
+		files = append(files, fileToInstall{dest: filepath.Join(tmpDir, name)})
+	}
+	require.NoError(t, os.WriteFile(files[0].dest, []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(files[2].dest, []byte("d"), 0644))
+	// a non-empty directory cannot be removed
+	require.NoError(t, os.MkdirAll(filepath.Join(files[1].dest, "x"), 0755))
+
+	records, err := uninstallAll(installOptions{quiet: true, keepGoing: true}, files)
+	require.Error(t, err)
+	assert.Equal(t, "1 of 3 files failed", err.Error())
+	require.Len(t, records, 3)
+	assert.Equal(t, []string{"removed", "failed", "removed"},
+		[]string{records[0].Status, records[1].Status, records[2].Status})
+	assert.NoFileExists(t, files[2].dest)
+}
+
+func TestHardlinkFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcFile := filepath.Join(tmpDir, "test.vo")
+	require.NoError(t, os.WriteFile(srcFile, []byte("content"), 0644))
+	destFile := filepath.Join(tmpDir, "dest", "test.vo")
+
+	install, current := installOptions{link: "hard"}.install()
+	require.NoError(t, install(srcFile, destFile))
+	assert.True(t, current(srcFile, destFile))
+	srcInfo, err := os.Stat(srcFile)
+	require.NoError(t, err)
+	destInfo, err := os.Stat(destFile)
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(srcInfo, destInfo))
+
+	// copying over the link does not truncate the source
+	require.NoError(t, copyFile(srcFile, destFile, true, 0))
+	content, err := os.ReadFile(srcFile)
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+	destInfo, err = os.Stat(destFile)
+	require.NoError(t, err)
+	assert.False(t, os.SameFile(srcInfo, destInfo))
+	assert.True(t, current(srcFile, destFile))
+}
+
+func TestHardlinkFileFallback(t *testing.T) {
+	// as if src and dest were on different filesystems
+	linkFile = func(oldname, newname string) error {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EXDEV}
+	}
+	t.Cleanup(func() { linkFile = os.Link })
+
+	tmpDir := t.TempDir()
+	srcFile := filepath.Join(tmpDir, "test.vo")
+	require.NoError(t, os.WriteFile(srcFile, []byte("content"), 0600))
+	destFile := filepath.Join(tmpDir, "dest", "sub", "test.vo")
+
+	// the copy follows --mode and --dir-mode
+	install, current := installOptions{link: "hard", mode: 0444, dirMode: 0750}.install()
+	require.NoError(t, install(srcFile, destFile))
+	assert.False(t, hardlinked(srcFile, destFile))
+	info, err := os.Stat(destFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0444), info.Mode().Perm())
+	info, err = os.Stat(filepath.Dir(destFile))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+	assert.True(t, current(srcFile, destFile))
+	_, current = installOptions{link: "hard", mode: 0644}.install()
+	assert.False(t, current(srcFile, destFile))
+
+	// and --preserve=false
+	install, _ = installOptions{link: "hard", noPreserve: true}.install()
+	require.NoError(t, install(srcFile, destFile))
+	info, err = os.Stat(destFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	// by default, the copy has the permissions of the source
+	install, _ = installOptions{link: "hard"}.install()
+	require.NoError(t, install(srcFile, destFile))
+	info, err = os.Stat(destFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestPruneEmptyDirs(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "user-contrib")
+	for _, dir := range []string{"Ex/a/x", "Ex/a/y", "Ex/b", "Other"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(root, "Ex/b/kept.vo"), nil, 0644))
+
+	removed := []fileToInstall{
+		{dest: filepath.Join(root, "Ex/a/x/A.vo")},
+		{dest: filepath.Join(root, "Ex/a/y/B.vo")},
+		{dest: filepath.Join(root, "Ex/b/C.vo")},
+		// outside root
+		{dest: filepath.Join(root, "../elsewhere/D.vo")},
+	}
+	pruned := pruneEmptyDirs(root, removed)
+	assert.Equal(t, []string{
+		filepath.Join(root, "Ex/a/x"),
+		filepath.Join(root, "Ex/a/y"),
+		filepath.Join(root, "Ex/a"),
+	}, pruned)
+	assert.DirExists(t, filepath.Join(root, "Ex/b"))
+	assert.DirExists(t, filepath.Join(root, "Other"))
+	assert.DirExists(t, root)
+}
+
+func TestStagePath(t *testing.T) {
+	assert.Equal(t, "/opt/switch/lib/rocq/user-contrib/Ex/A.vo",
+		stagePath("", "/opt/switch/lib/rocq/user-contrib/Ex/A.vo"))
+	assert.Equal(t, "/tmp/stage/opt/switch/lib/rocq/user-contrib/Ex/A.vo",
+		stagePath("/tmp/stage", "/opt/switch/lib/rocq/user-contrib/Ex/A.vo"))
+	assert.Equal(t, "stage/opt/Ex/A.vo", stagePath("stage/", "/opt/Ex/A.vo"))
+}
+
+func TestSymlinkFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcFile := filepath.Join(tmpDir, "test.vo")
+	require.NoError(t, os.WriteFile(srcFile, []byte("content"), 0644))
+	destFile := filepath.Join(tmpDir, "dest", "test.vo")
+
+	// replaces a copy
+	require.NoError(t, copyFile(srcFile, destFile, true, 0))
+	assert.False(t, linkedTo(srcFile, destFile))
+	require.NoError(t, symlinkFile(srcFile, destFile))
+	assert.True(t, linkedTo(srcFile, destFile))
+	assert.False(t, upToDate(srcFile, destFile))
+
+	// the link follows the source
+	require.NoError(t, os.WriteFile(srcFile, []byte("rebuilt"), 0644))
+	content, err := os.ReadFile(destFile)
+	require.NoError(t, err)
+	assert.Equal(t, "rebuilt", string(content))
+
+	// copying over the link replaces it rather than writing to the source
+	require.NoError(t, copyFile(srcFile, destFile, true, 0))
+	info, err := os.Lstat(destFile)
+	require.NoError(t, err)
+	assert.True(t, info.Mode().IsRegular())
+	content, err = os.ReadFile(srcFile)
+	require.NoError(t, err)
+	assert.Equal(t, "rebuilt", string(content))
+}
+
+func TestDestinationsByDir(t *testing.T) {
+	var calls atomic.Int32
+	destinationOf := func(voFile string) string {
+		calls.Add(1)
+		return filepath.Join("/lib/Ex", filepath.Dir(voFile))
+	}
+	destDirs := destinationsByDir([]string{"a/x.v", "a/y.v", "b/c/z.v", "w.v"}, destinationOf)
+	assert.Equal(t, map[string]string{
+		"a":   "/lib/Ex/a",
+		"b/c": "/lib/Ex/b/c",
+		".":   "/lib/Ex",
+	}, destDirs)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestCheckBuilt(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := func(name string, age time.Duration) string {
+		p := filepath.Join(tmpDir, name)
+		require.NoError(t, os.WriteFile(p, nil, 0644))
+		mtime := time.Now().Add(-age)
+		require.NoError(t, os.Chtimes(p, mtime, mtime))
+		return p
+	}
+	file("A.v", time.Hour)
+	file("A.vo", time.Minute)
+	file("B.v", time.Minute)
+	file("B.vo", time.Hour)
+	file("C.v", time.Minute)
+
+	var files []fileToInstall
+	for _, name := range []string{"A.v", "A.vo", "B.v", "B.vo", "C.v", "C.vo"} {
+		files = append(files, fileToInstall{src: filepath.Join(tmpDir, name), dest: "/lib/" + name})
+	}
+	missing, stale := checkBuilt(files)
+	assert.Equal(t, []string{filepath.Join(tmpDir, "C.vo")}, missing)
+	assert.Equal(t, []string{filepath.Join(tmpDir, "B.vo")}, stale)
+}
+
+func TestNativeFiles(t *testing.T) {
+	mappings := []depgraph.Mapping{
+		{Dir: "src", Logical: "Perennial", Recursive: true},
+		{Dir: ".", Logical: "Ex"},
+	}
+	assert.Equal(t, []string{
+		"src/program_proof/.coq-native/NPerennial_program_proof_wal.cmi",
+		"src/program_proof/.coq-native/NPerennial_program_proof_wal.cmxs",
+	}, nativeFiles(mappings, "src/program_proof/wal.v"))
+	assert.Equal(t, []string{".coq-native/NEx_a.cmi", ".coq-native/NEx_a.cmxs"}, nativeFiles(mappings, "a.v"))
+	assert.Nil(t, nativeFiles(mappings[:1], "a.v"))
+}
+
+func TestDocFiles(t *testing.T) {
+	dir := t.TempDir()
+	html := filepath.Join(dir, "html")
+	require.NoError(t, os.MkdirAll(filepath.Join(html, "css"), 0755))
+	for _, name := range []string{"index.html", "Ex.a.html", "css/style.css"} {
+		require.NoError(t, os.WriteFile(filepath.Join(html, name), []byte(name), 0644))
+	}
+	files, err := docFiles(html, "/doc/Ex/html")
+	require.NoError(t, err)
+	assert.Equal(t, []fileToInstall{
+		{src: filepath.Join(html, "Ex.a.html"), dest: "/doc/Ex/html/Ex.a.html"},
+		{src: filepath.Join(html, "css/style.css"), dest: "/doc/Ex/html/css/style.css"},
+		{src: filepath.Join(html, "index.html"), dest: "/doc/Ex/html/index.html"},
+	}, files)
+
+	_, err = docFiles(filepath.Join(dir, "missing"), "/doc/Ex/html")
+	assert.Error(t, err)
+}
+
+func TestInstalledFiles(t *testing.T) {
+	destdir := t.TempDir()
+	installed := filepath.Join(destdir, "doc/Ex/html")
+	require.NoError(t, os.MkdirAll(filepath.Join(installed, "css"), 0755))
+	for _, name := range []string{"index.html", "css/style.css"} {
+		require.NoError(t, os.WriteFile(filepath.Join(installed, name), []byte(name), 0644))
+	}
+	files, err := installedFiles(installed, "/doc/Ex/html")
+	require.NoError(t, err)
+	assert.Equal(t, []fileToInstall{
+		{dest: "/doc/Ex/html/css/style.css"},
+		{dest: "/doc/Ex/html/index.html"},
+	}, files)
+
+	files, err = installedFiles(filepath.Join(destdir, "missing"), "/doc/Ex/html")
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
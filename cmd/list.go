@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/mit-pdos/perennial-cli/git"
+	"github.com/mit-pdos/perennial-cli/opam"
+	"github.com/spf13/cobra"
+)
+
+// describeCommit formats a pinned commit with its date and subject, falling
+// back to the bare hash if its metadata cannot be fetched.
+func describeCommit(ctx context.Context, dep opam.PinDepend) string {
+	info, err := git.GetCommitInfoContext(ctx, dep.BaseUrl(), dep.Commit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: could not get commit info for %s: %v\n", dep.Package, err)
+		return dep.Commit
+	}
+	return info.String()
+}
+
+func doList(cmd *cobra.Command, args []string) error {
+	opamFileName, _ := cmd.Flags().GetString("file")
+	contents, err := os.ReadFile(opamFileName)
+	if err != nil {
+		return err
+	}
+	opamFile, err := opam.Parse(bytes.NewReader(contents))
+	if err != nil {
+		return err
+	}
+	for dep, indirect := range opamFile.AllPinDepends() {
+		name := dep.Package
+		if indirect {
+			name += " (indirect)"
+		}
+		fmt.Printf("%s: pinned to %s\n", name, describeCommit(cmd.Context(), dep))
+	}
+	return nil
+}
+
+// listCmd represents the opam list command
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List pinned dependencies",
+	Long: `List every pin-depends entry (direct and indirect) with the date and
+subject of the pinned commit.`,
+	Args: cobra.NoArgs,
+	Example: indent("  ", `
+perennial-cli opam list
+perennial-cli opam list -f perennial.opam
+`),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return setDefaultOpamFile(cmd)
+	},
+	RunE: doList,
+}
+
+func init() {
+	opamCmd.AddCommand(listCmd)
+}
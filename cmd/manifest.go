@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// The install manifest records every file install copies, so uninstall can
+// remove them even after the sources change (when the files it would derive
+// from the sources are no longer the ones that were installed).
+
+const manifestHeader = "# Files installed by perennial-cli install, removed by perennial-cli uninstall\n"
+
+// manifestFile returns the install manifest given by --manifest, by default
+// <package>.install-manifest in the install root (COQLIBINSTALL), where the
+// package is named after the opam file in the current directory (or the
+// current directory itself).
+func manifestFile(cmd *cobra.Command, makeVars map[string]string) (string, error) {
+	if manifest, _ := cmd.Flags().GetString("manifest"); manifest != "" {
+		return manifest, nil
+	}
+	pkg := ""
+	if opamFile, ok := findUniqueOpamFile(); ok {
+		pkg = strings.TrimSuffix(opamFile, ".opam")
+	} else {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		pkg = filepath.Base(cwd)
+	}
+	return filepath.Join(makeVars["COQLIBINSTALL"], pkg+".install-manifest"), nil
+}
+
+// readManifest returns the files listed in a manifest.
+func readManifest(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var files []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		files = append(files, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", name, err)
+	}
+	return files, nil
+}
+
+// writeManifest records files in a manifest, keeping the files it already
+// lists (from earlier installs, which may have installed other files).
+func writeManifest(name string, files []string) error {
+	previous, err := readManifest(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	files = append(slices.Clone(files), previous...)
+	slices.Sort(files)
+	files = slices.Compact(files)
+
+	var b strings.Builder
+	b.WriteString(manifestHeader)
+	for _, file := range files {
+		b.WriteString(file + "\n")
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", filepath.Dir(name), err)
+	}
+	// write to a temporary file and rename it into place, so an interrupted
+	// install never leaves a truncated manifest for uninstall to act on
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(b.String())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// temporary files are only readable by the user
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	return nil
+}
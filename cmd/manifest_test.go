@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest(t *testing.T) {
+	manifest := filepath.Join(t.TempDir(), "lib", "pkg.install-manifest")
+
+	_, err := readManifest(manifest)
+	assert.True(t, os.IsNotExist(err))
+
+	require.NoError(t, writeManifest(manifest, []string{"/lib/Ex/B.vo", "/lib/Ex/A.vo"}))
+	files, err := readManifest(manifest)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/lib/Ex/A.vo", "/lib/Ex/B.vo"}, files)
+
+	// later installs add to the files of earlier ones
+	require.NoError(t, writeManifest(manifest, []string{"/lib/Ex/C.vo", "/lib/Ex/A.vo"}))
+	files, err = readManifest(manifest)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/lib/Ex/A.vo", "/lib/Ex/B.vo", "/lib/Ex/C.vo"}, files)
+
+	// the manifest is replaced, leaving no temporary files behind
+	entries, err := os.ReadDir(filepath.Dir(manifest))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "pkg.install-manifest", entries[0].Name())
+	info, err := os.Stat(manifest)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mit-pdos/perennial-cli/depgraph"
+	"github.com/spf13/cobra"
+)
+
+// isModuleName reports if arg could be a logical module path (like
+// Perennial.program_proof.wal.proof) rather than a file.
+func isModuleName(arg string) bool {
+	return arg != "" && !strings.ContainsRune(arg, filepath.Separator) &&
+		!strings.HasSuffix(arg, ".v") && !strings.HasSuffix(arg, ".vo")
+}
+
+// resolveModuleArgs replaces the arguments that name logical modules rather
+// than existing files with their .v files (relative to the current
+// directory), using the -Q and -R options of the _RocqProject of each
+// dependency file.
+func resolveModuleArgs(cmd *cobra.Command, args []string) ([]string, error) {
+	type project struct {
+		dir      string
+		mappings []depgraph.Mapping
+		sources  []string
+	}
+	// projects are only loaded if some argument is a module
+	var projects []project
+	loadProjects := func() error {
+		if projects != nil {
+			return nil
+		}
+		rocqdepNames, err := rocqdepFiles(cmd)
+		if err != nil {
+			return err
+		}
+		for _, rocqdepName := range rocqdepNames {
+			dir := filepath.Dir(rocqdepName)
+			projFile, err := depgraph.FindProjectFile(dir)
+			if err != nil {
+				return err
+			}
+			mappings, err := depgraph.ProjectMappings(projFile)
+			if err != nil {
+				return err
+			}
+			sources, err := depgraph.ProjectSources(projFile)
+			if err != nil {
+				return err
+			}
+			projects = append(projects, project{dir: dir, mappings: mappings, sources: sources})
+		}
+		return nil
+	}
+
+	var resolved []string
+	for _, arg := range args {
+		if _, err := os.Stat(arg); err == nil || !isModuleName(arg) {
+			resolved = append(resolved, arg)
+			continue
+		}
+		if err := loadProjects(); err != nil {
+			return nil, fmt.Errorf("%s is not a file, and looking it up as a module failed: %w", arg, err)
+		}
+		var files []string
+		for _, p := range projects {
+			for _, file := range depgraph.ResolveModule(p.mappings, p.sources, arg) {
+				files = append(files, filepath.Join(p.dir, file))
+			}
+		}
+		switch len(files) {
+		case 0:
+			return nil, fmt.Errorf("%s is neither a file nor a module of the project", arg)
+		case 1:
+			resolved = append(resolved, files[0])
+		default:
+			return nil, fmt.Errorf("module %s is ambiguous: it could be %s", arg, strings.Join(files, ", "))
+		}
+	}
+	return resolved, nil
+}
+
+// gatherArgs is gatherVFiles for the arguments of the deps commands, which
+// can also be logical module names.
+func gatherArgs(cmd *cobra.Command, args []string) ([]string, error) {
+	paths, err := resolveModuleArgs(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	return gatherVFiles(paths)
+}
@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"fmt"
 	"path/filepath"
 
+	"github.com/mit-pdos/perennial-cli/opam"
 	"github.com/spf13/cobra"
 )
 
@@ -14,6 +16,36 @@ func findUniqueOpamFile() (string, bool) {
 	return files[0], true
 }
 
+// setDefaultOpamFile sets the --file flag to the unique opam file in the
+// current directory, if it was not provided.
+func setDefaultOpamFile(cmd *cobra.Command) error {
+	opamFile, _ := cmd.Flags().GetString("file")
+	if opamFile == "" {
+		opamFile, ok := findUniqueOpamFile()
+		if !ok {
+			return fmt.Errorf("no opam file provided (-f flag) and no unique file found")
+		}
+		cmd.Flags().Set("file", opamFile)
+	}
+	return nil
+}
+
+// addIndirectFlags registers flags that control how indirect dependencies are
+// maintained (see getIndirectOptions)
+func addIndirectFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("topological", false, "Order indirect dependencies so each package follows its dependencies")
+	cmd.Flags().Bool("attribute", false, "Group indirect dependencies with a \"## via <package>\" comment for the direct dependency that requires them")
+}
+
+func getIndirectOptions(cmd *cobra.Command) opam.IndirectOptions {
+	var opts opam.IndirectOptions
+	if topological, _ := cmd.Flags().GetBool("topological"); topological {
+		opts.Order = opam.OrderTopological
+	}
+	opts.Attribute, _ = cmd.Flags().GetBool("attribute")
+	return opts
+}
+
 // opamCmd represents the opam command
 var opamCmd = &cobra.Command{
 	Use:   "opam [command]",
@@ -21,6 +53,7 @@ var opamCmd = &cobra.Command{
 	Long: `Manage opam files.
 
 Helps update dependencies and maintain indirect pin-depends.`,
+	Annotations: map[string]string{networkAnnotation: ""},
 }
 
 func init() {
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/mit-pdos/perennial-cli/git"
+	"github.com/mit-pdos/perennial-cli/opam"
+	"github.com/spf13/cobra"
+)
+
+// pinDistance describes where a pin is relative to the tip of the default
+// branch, given the commits the pin is behind (on the branch but not in the
+// pin) and ahead (in the pin but not on the branch). It also reports if the
+// pin is outdated: behind, or diverged (both behind and ahead, as when the
+// pinned commit was on a branch that was not merged).
+func pinDistance(branch string, behind, ahead int) (string, bool) {
+	switch {
+	case behind > 0 && ahead > 0:
+		return fmt.Sprintf("diverged from %s (%d commit(s) behind, %d commit(s) not on %s)",
+			branch, behind, ahead, branch), true
+	case behind > 0:
+		return fmt.Sprintf("%d commit(s) behind %s", behind, branch), true
+	case ahead > 0:
+		return fmt.Sprintf("%d commit(s) ahead of %s", ahead, branch), false
+	}
+	return "", false
+}
+
+func doOutdated(cmd *cobra.Command, args []string) error {
+	opamFileName, _ := cmd.Flags().GetString("file")
+	showLog, _ := cmd.Flags().GetBool("log")
+	ctx := cmd.Context()
+	contents, err := os.ReadFile(opamFileName)
+	if err != nil {
+		return err
+	}
+	opamFile, err := opam.Parse(bytes.NewReader(contents))
+	if err != nil {
+		return err
+	}
+	outdated := 0
+	snapshots := make(map[string]*git.RefSnapshot)
+	for dep, indirect := range opamFile.AllPinDepends() {
+		snapshot, ok := snapshots[dep.BaseUrl()]
+		if !ok {
+			snapshot, err = git.SnapshotRefs(ctx, dep.BaseUrl())
+			if err != nil {
+				return fmt.Errorf("%s: %w", dep.Package, err)
+			}
+			snapshots[dep.BaseUrl()] = snapshot
+		}
+		latest, err := snapshot.LatestCommit()
+		if err != nil {
+			return fmt.Errorf("%s: %w", dep.Package, err)
+		}
+		if latest == dep.Commit {
+			continue
+		}
+		commits, err := git.CommitsBetweenContext(ctx, dep.BaseUrl(), dep.Commit, latest)
+		if err != nil {
+			return fmt.Errorf("%s: %w", dep.Package, err)
+		}
+		// commits in the pin that are not on the branch, if it diverged
+		ahead, err := git.CommitsBetweenContext(ctx, dep.BaseUrl(), latest, dep.Commit)
+		if err != nil {
+			return fmt.Errorf("%s: %w", dep.Package, err)
+		}
+		branch, err := snapshot.DefaultBranch()
+		if err != nil {
+			branch = "HEAD"
+		}
+		distance, isOutdated := pinDistance(branch, len(commits), len(ahead))
+		if distance == "" {
+			continue
+		}
+		if isOutdated {
+			outdated++
+		}
+		name := dep.Package
+		if indirect {
+			name += " (indirect)"
+		}
+		fmt.Printf("%s: %s\n", name, distance)
+		if showLog && isOutdated {
+			for _, c := range commits {
+				fmt.Printf("  %s\n", c)
+			}
+		}
+	}
+	if outdated == 0 {
+		fmt.Printf("all pins are up-to-date\n")
+	}
+	return nil
+}
+
+// outdatedCmd represents the opam outdated command
+var outdatedCmd = &cobra.Command{
+	Use:   "outdated",
+	Short: "Show how far pinned dependencies are behind",
+	Long: `For every pin-depends entry (direct and indirect), report how many commits
+the pinned commit is behind the remote's default branch. Pins that diverged
+from the branch (say, to a commit on a branch that was never merged, or that
+was rebased) are reported with the number of their commits that are not on
+the branch; they might also be unreachable (see opam verify).
+
+With --log, also list the new commits, newest first.`,
+	Args: cobra.NoArgs,
+	Example: indent("  ", `
+perennial-cli opam outdated
+perennial-cli opam outdated --log -f perennial.opam
+`),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return setDefaultOpamFile(cmd)
+	},
+	RunE: doOutdated,
+}
+
+func init() {
+	opamCmd.AddCommand(outdatedCmd)
+	outdatedCmd.Flags().Bool("log", false, "List the subjects of the commits each pin is behind")
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPinDistance(t *testing.T) {
+	distance, outdated := pinDistance("main", 3, 0)
+	assert.Equal(t, "3 commit(s) behind main", distance)
+	assert.True(t, outdated)
+
+	distance, outdated = pinDistance("main", 3, 2)
+	assert.Equal(t, "diverged from main (3 commit(s) behind, 2 commit(s) not on main)", distance)
+	assert.True(t, outdated)
+
+	distance, outdated = pinDistance("main", 0, 1)
+	assert.Equal(t, "1 commit(s) ahead of main", distance)
+	assert.False(t, outdated)
+
+	distance, outdated = pinDistance("main", 0, 0)
+	assert.Empty(t, distance)
+	assert.False(t, outdated)
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// projectRoot returns the directory that paths in the dependency graph are
+// relative to: the directory of the dependency file, or the current directory
+// if several are merged (see loadRocqdeps).
+func projectRoot(cmd *cobra.Command) (string, error) {
+	rocqdepNames, err := rocqdepFiles(cmd)
+	if err != nil {
+		return "", err
+	}
+	if len(rocqdepNames) > 1 {
+		return ".", nil
+	}
+	return filepath.Dir(rocqdepNames[0]), nil
+}
+
+// graphPaths converts paths relative to the current directory (such as
+// arguments) to paths in the dependency graph, which are relative to root.
+func graphPaths(root string, paths []string) ([]string, error) {
+	converted := make([]string, len(paths))
+	for i, path := range paths {
+		if root == "." && !filepath.IsAbs(path) {
+			converted[i] = filepath.Clean(path)
+			continue
+		}
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		converted[i], err = filepath.Rel(absRoot, absPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return converted, nil
+}
+
+// outputPath returns a function that converts paths in the dependency graph
+// for output, according to --paths: relative to the project root (as in the
+// dependency file), relative to the current directory, or absolute. Paths are
+// always cleaned, without a ./ prefix.
+func outputPath(cmd *cobra.Command) (func(string) string, error) {
+	style, _ := cmd.Flags().GetString("paths")
+	root, err := projectRoot(cmd)
+	if err != nil {
+		return nil, err
+	}
+	// resolve finds a path in the graph relative to the current directory
+	// (or absolute)
+	resolve := func(file string) string {
+		if filepath.IsAbs(file) {
+			return file
+		}
+		return filepath.Join(root, file)
+	}
+	switch style {
+	case "root":
+		return filepath.Clean, nil
+	case "cwd":
+		return func(file string) string {
+			path := resolve(file)
+			if filepath.IsAbs(path) {
+				return relToCwd(path)
+			}
+			return path
+		}, nil
+	case "abs":
+		return func(file string) string {
+			path, err := filepath.Abs(resolve(file))
+			if err != nil {
+				return resolve(file)
+			}
+			return path
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown --paths style %q (expected root, cwd, or abs)", style)
+}
+
+// relToCwd makes an absolute path relative to the current directory, if
+// possible.
+func relToCwd(path string) string {
+	abs, err := filepath.Abs(".")
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(abs, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// printPath prints one path of a list of files: on its own line, or with
+// --print0 terminated by a NUL byte, for xargs -0.
+func printPath(cmd *cobra.Command, path string) {
+	if print0, _ := cmd.Flags().GetBool("print0"); print0 {
+		fmt.Print(path + "\x00")
+		return
+	}
+	fmt.Println(path)
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphPaths(t *testing.T) {
+	paths, err := graphPaths(".", []string{"./a.v", "src/../b.v", "src/c.v"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.v", "b.v", "src/c.v"}, paths)
+
+	paths, err = graphPaths("proof", []string{"proof/a.v", "./proof/src/b.v", "code/c.v"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.v", "src/b.v", "../code/c.v"}, paths)
+
+	abs, err := filepath.Abs("proof/a.v")
+	require.NoError(t, err)
+	paths, err = graphPaths(".", []string{abs})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"proof/a.v"}, paths)
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// progressThreshold is the number of files from which install shows a
+// progress bar rather than listing them (on a terminal)
+const progressThreshold = 100
+
+// isTerminal reports if f is a terminal (rather than a file or pipe).
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// formatBytes formats a size in bytes for people, such as "56.2 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// installProgress draws a progress bar for installAll on one line of a
+// terminal, which it redraws at most every interval.
+type installProgress struct {
+	w        io.Writer
+	total    int
+	done     int
+	bytes    int64
+	interval time.Duration
+	last     time.Time
+}
+
+func newInstallProgress(w io.Writer, total int) *installProgress {
+	return &installProgress{w: w, total: total, interval: 100 * time.Millisecond}
+}
+
+// add counts an installed (or skipped) file.
+func (p *installProgress) add(record installRecord) {
+	p.done++
+	if record.Status != "skipped" && record.Status != "failed" {
+		p.bytes += record.Bytes
+	}
+	if now := time.Now(); p.done == p.total || now.Sub(p.last) >= p.interval {
+		p.last = now
+		p.draw()
+	}
+}
+
+func (p *installProgress) draw() {
+	const width = 30
+	filled := width
+	if p.total > 0 {
+		filled = width * p.done / p.total
+	}
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+	fmt.Fprintf(p.w, "\r[%s] %d/%d files, %s", bar, p.done, p.total, formatBytes(p.bytes))
+}
+
+// finish clears the progress bar, for the summary to replace it.
+func (p *installProgress) finish() {
+	// \x1b[K erases the rest of the line
+	fmt.Fprint(p.w, "\r\x1b[K")
+}
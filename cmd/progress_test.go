@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "0 B", formatBytes(0))
+	assert.Equal(t, "1023 B", formatBytes(1023))
+	assert.Equal(t, "1.0 KiB", formatBytes(1024))
+	assert.Equal(t, "56.2 MiB", formatBytes(56*1024*1024+200*1024))
+	assert.Equal(t, "2.0 GiB", formatBytes(2*1024*1024*1024))
+}
+
+func TestInstallProgress(t *testing.T) {
+	var out strings.Builder
+	p := newInstallProgress(&out, 3)
+	p.add(installRecord{Status: "copied", Bytes: 1024})
+	p.add(installRecord{Status: "skipped", Bytes: 1024})
+	p.add(installRecord{Status: "linked", Bytes: 1024})
+	p.finish()
+	lines := strings.Split(out.String(), "\r")
+	// the first file is drawn immediately, and the last always
+	assert.Contains(t, lines[1], "1/3 files, 1.0 KiB")
+	assert.Contains(t, lines[len(lines)-2], "3/3 files, 2.0 KiB")
+	assert.Contains(t, lines[len(lines)-2], "["+strings.Repeat("=", 30)+"]")
+}
@@ -2,9 +2,15 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/mit-pdos/perennial-cli/config"
+	"github.com/mit-pdos/perennial-cli/git"
 	"github.com/spf13/cobra"
 )
 
@@ -24,6 +30,8 @@ var rootCmd = &cobra.Command{
 	Short:        "CLI to manage perennial verification projects",
 	Long:         `perennial-cli manages verification projects based on Perennial.`,
 	SilenceUsage: true,
+	// errors are printed by Execute, to support exitCodeError
+	SilenceErrors: true,
 	Example: indent("  ", `
 go run github.com/mit-pdos/perennial-cli@latest init <proj_url>
 
@@ -33,11 +41,105 @@ perennial-cli goose
 	CompletionOptions: cobra.CompletionOptions{
 		HiddenDefaultCmd: true,
 	},
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if usesNetwork(cmd) {
+			if err := configureNetwork(); err != nil {
+				return err
+			}
+		}
+		offline, _ := cmd.Flags().GetBool("offline")
+		git.SetOffline(offline)
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		if timeout < 0 {
+			return fmt.Errorf("invalid --timeout %v: must not be negative", timeout)
+		}
+		if timeout > 0 {
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			cancelTimeout = cancel
+			cmd.SetContext(ctx)
+		}
+		return nil
+	},
+}
+
+// networkAnnotation marks the commands that use the network (along with their
+// subcommands), which need the configuration from config.Load. Other commands
+// (such as deps and install) work even if the configuration is broken.
+const networkAnnotation = "network"
+
+// usesNetwork reports if cmd or one of its parents has the networkAnnotation.
+func usesNetwork(cmd *cobra.Command) bool {
+	for ; cmd != nil; cmd = cmd.Parent() {
+		if _, ok := cmd.Annotations[networkAnnotation]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// configureNetwork applies the user configuration (tokens, self-hosted git
+// servers, and HTTP settings) to the git package.
+func configureNetwork() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	for host, token := range cfg.Tokens {
+		git.SetToken(host, token)
+	}
+	for host, h := range cfg.Hosts {
+		p, err := git.NewProvider(h.Type, host)
+		if err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+		git.RegisterProvider(host, p)
+	}
+	httpOpts := git.HTTPOptions{Proxy: cfg.HTTP.Proxy, CAFile: cfg.HTTP.CAFile}
+	if cfg.HTTP.Timeout != "" {
+		httpOpts.Timeout, err = time.ParseDuration(cfg.HTTP.Timeout)
+		if err != nil {
+			return fmt.Errorf("config: invalid http.timeout: %w", err)
+		}
+	}
+	if cfg.HTTP.RateLimitWait != "" {
+		httpOpts.RateLimitWait, err = time.ParseDuration(cfg.HTTP.RateLimitWait)
+		if err != nil {
+			return fmt.Errorf("config: invalid http.rate_limit_wait: %w", err)
+		}
+	}
+	if err := git.ConfigureHTTP(httpOpts); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	return nil
+}
+
+// cancelTimeout releases the context set up for --timeout, if any
+var cancelTimeout context.CancelFunc = func() {}
+
+// exitCodeError signals that the command finished and the process should exit
+// with a specific status, without printing an error.
+type exitCodeError struct {
+	code int
+}
+
+func (e exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
 }
 
 func Execute() {
 	err := rootCmd.Execute()
+	cancelTimeout()
 	if err != nil {
+		var exitErr exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
+		rootCmd.PrintErrln("Error:", err.Error())
 		os.Exit(1)
 	}
 }
+
+func init() {
+	rootCmd.PersistentFlags().Duration("timeout", 0, "Give up on network operations after this long (e.g., 30s or 2m; 0 means no limit)")
+	rootCmd.PersistentFlags().Bool("offline", false, "Never use the network: answer from local caches or fail immediately")
+}
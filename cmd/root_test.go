@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsesNetwork(t *testing.T) {
+	assert.True(t, usesNetwork(updateCmd))
+	assert.True(t, usesNetwork(opamCmd))
+	assert.True(t, usesNetwork(initCmd))
+	assert.False(t, usesNetwork(depsCmd))
+	assert.False(t, usesNetwork(treeCmd))
+	assert.False(t, usesNetwork(installCmd))
+	assert.False(t, usesNetwork(rootCmd))
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"github.com/mit-pdos/perennial-cli/depgraph"
+	"github.com/spf13/cobra"
+)
+
+// printFiles lists the files selected by choose from the dependency graph of
+// the deps command's --file, as .vo files with --vo.
+func printFiles(cmd *cobra.Command, choose func(*depgraph.FileGraph) []string) error {
+	printVo, _ := cmd.Flags().GetBool("vo")
+	deps, err := loadRocqdeps(cmd)
+	if err != nil {
+		return err
+	}
+	out, err := outputPath(cmd)
+	if err != nil {
+		return err
+	}
+	for _, file := range choose(depgraph.RocqFileGraph(deps, nil)) {
+		file = out(file)
+		if printVo {
+			file = setExtension(file, ".vo")
+		}
+		printPath(cmd, file)
+	}
+	return nil
+}
+
+// rootsCmd represents the deps roots command
+var rootsCmd = &cobra.Command{
+	Use:   "roots",
+	Short: "List files that no other file depends on",
+	Long: `List the files in .rocqdeps.d that no other file depends on.
+
+These are the entry points of the development, such as top-level proofs (or
+files that are no longer used).`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return prepareRocqdepFile(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return printFiles(cmd, (*depgraph.FileGraph).Roots)
+	},
+}
+
+// leavesCmd represents the deps leaves command
+var leavesCmd = &cobra.Command{
+	Use:   "leaves",
+	Short: "List files without dependencies",
+	Long: `List the files in .rocqdeps.d that do not depend on any other file in it.
+
+These are the base libraries of the development (dependencies on installed
+libraries are not part of .rocqdeps.d).`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return prepareRocqdepFile(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return printFiles(cmd, (*depgraph.FileGraph).Leaves)
+	},
+}
+
+func init() {
+	depsCmd.AddCommand(rootsCmd)
+	depsCmd.AddCommand(leavesCmd)
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mit-pdos/perennial-cli/depgraph"
+	"github.com/mit-pdos/perennial-cli/timing"
+	"github.com/spf13/cobra"
+)
+
+// shardCmd represents the deps shard command
+var shardCmd = &cobra.Command{
+	Use:   "shard --count N [files...]",
+	Short: "Split files into balanced groups for parallel CI jobs",
+	Long: `Split the given .v files (or every file in .rocqdeps.d) into N groups that
+take about the same time to compile, for building or checking them in
+parallel CI jobs. Compile times come from the project's database of compile
+times (see deps times import); without one, the groups have about the same
+number of files, or with --weight lines (or size), about the same number of
+lines (or bytes), which is a better estimate when a few files are much larger
+than the rest.
+
+Each job also has to build the dependencies of its files, so files are
+preferably grouped with their dependencies. Within each group, files are
+listed in compilation order.
+
+Prints one line per group, with the files separated by spaces, or with
+--index I only the files of the I-th group (counting from 1), one per line.`,
+	Example: indent("  ", `
+perennial-cli deps shard --count 4
+perennial-cli deps shard --count 4 --index 2 --vo src/
+perennial-cli deps shard --count 4 --weight lines
+`),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return prepareRocqdepFile(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printVo, _ := cmd.Flags().GetBool("vo")
+		count, _ := cmd.Flags().GetInt("count")
+		index, _ := cmd.Flags().GetInt("index")
+		if count < 1 {
+			return fmt.Errorf("--count must be positive")
+		}
+		if index < 0 || index > count {
+			return fmt.Errorf("--index must be between 1 and --count (%d)", count)
+		}
+		deps, err := loadRocqdeps(cmd)
+		if err != nil {
+			return err
+		}
+		sources, err := gatherArgs(cmd, args)
+		if err != nil {
+			return err
+		}
+		root, err := projectRoot(cmd)
+		if err != nil {
+			return err
+		}
+		sources, err = graphPaths(root, sources)
+		if err != nil {
+			return err
+		}
+		out, err := outputPath(cmd)
+		if err != nil {
+			return err
+		}
+		if len(args) > 0 && len(sources) == 0 {
+			// RocqFileGraph would include every file
+			return nil
+		}
+		weight, _, err := loadWeights(cmd)
+		if err != nil {
+			return err
+		}
+		shards, err := depgraph.RocqFileGraph(deps, sources).Shard(count, weight)
+		if err != nil {
+			return err
+		}
+		for _, shard := range shards {
+			for i, file := range shard {
+				shard[i] = out(file)
+				if printVo {
+					shard[i] = setExtension(shard[i], ".vo")
+				}
+			}
+		}
+		if index > 0 {
+			for _, file := range shards[index-1] {
+				printPath(cmd, file)
+			}
+			return nil
+		}
+		for _, shard := range shards {
+			fmt.Println(strings.Join(shard, " "))
+		}
+		return nil
+	},
+}
+
+func init() {
+	depsCmd.AddCommand(shardCmd)
+
+	shardCmd.Flags().Int("count", 0, "Number of groups")
+	shardCmd.Flags().Int("index", 0, "Only list the files of this group (from 1 to --count)")
+	shardCmd.Flags().String("times", timing.DefaultFile, timesUsage)
+	shardCmd.Flags().String("weight", "", weightUsage)
+	shardCmd.MarkFlagRequired("count")
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/mit-pdos/perennial-cli/depgraph"
+	"github.com/spf13/cobra"
+)
+
+// statsCmd represents the deps stats command
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Summarize the dependency graph",
+	Long: `Summarize the dependency graph between the files in .rocqdeps.d.
+
+Reports the number of files and dependencies between them, the files with the
+most direct dependencies (fan-out) and dependents (fan-in), the files the most
+other files transitively depend on, and the depth of each file (the length of
+its longest chain of dependencies). Files many others depend on, especially
+deep ones, are bottlenecks for parallel builds. The files include those outside
+the project (such as installed libraries), which are also counted separately.`,
+	Args: cobra.NoArgs,
+	Example: indent("  ", `
+perennial-cli deps stats
+perennial-cli deps stats --top 20
+`),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return prepareRocqdepFile(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		top, _ := cmd.Flags().GetInt("top")
+		deps, err := loadRocqdeps(cmd)
+		if err != nil {
+			return err
+		}
+		graph := depgraph.RocqFileGraph(deps, nil)
+		stats, err := graph.Stats(top)
+		if err != nil {
+			return err
+		}
+		external := 0
+		for _, file := range graph.Files {
+			if depgraph.External(file) {
+				external++
+			}
+		}
+		out, err := outputPath(cmd)
+		if err != nil {
+			return err
+		}
+		if external > 0 {
+			fmt.Printf("files:         %d (%d external)\n", stats.Files, external)
+		} else {
+			fmt.Printf("files:         %d\n", stats.Files)
+		}
+		fmt.Printf("dependencies:  %d\n", stats.Edges)
+		if stats.Edges == 0 {
+			return nil
+		}
+		fmt.Printf("max fan-out:   %d (%s)\n", stats.MaxFanOut.Count, out(stats.MaxFanOut.File))
+		fmt.Printf("max fan-in:    %d (%s)\n", stats.MaxFanIn.Count, out(stats.MaxFanIn.File))
+		fmt.Printf("average depth: %.1f (max %d, %s)\n", stats.AvgDepth, stats.MaxDepth.Count, out(stats.MaxDepth.File))
+		if len(stats.MostDependedOn) > 0 {
+			fmt.Println("most depended upon:")
+			for _, d := range stats.MostDependedOn {
+				fmt.Printf("  %6d  %s\n", d.Count, out(d.File))
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	depsCmd.AddCommand(statsCmd)
+
+	statsCmd.Flags().Int("top", 10, "Number of most depended upon files to list")
+}
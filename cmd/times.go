@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/mit-pdos/perennial-cli/timing"
+	"github.com/spf13/cobra"
+)
+
+// timesUsage is the usage of the --times flag of the commands that use the
+// database of compile times
+const timesUsage = "Path to the database of compile times"
+
+// weightUsage is the usage of the --weight flag of the commands that use
+// estimates of compile times
+const weightUsage = "How to estimate compile times: times (from the --times database), lines or size (of each .v file), or count (the same for every file); by default, times if the database exists and count otherwise"
+
+// loadWeights returns weights for dependency analyses that estimate compile
+// times, according to --weight, and the unit of the weights ("s" for
+// seconds). The weight is nil for counting files, which is the default if
+// there is no database of compile times.
+func loadWeights(cmd *cobra.Command) (weight func(file string) float64, unit string, err error) {
+	mode, _ := cmd.Flags().GetString("weight")
+	switch mode {
+	case "", "times":
+		timesFile, _ := cmd.Flags().GetString("times")
+		times, err := timing.Load(timesFile)
+		if errors.Is(err, fs.ErrNotExist) && mode == "" {
+			return nil, "", nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		return times.Weight(), "s", nil
+	case "count":
+		return nil, "", nil
+	case "lines", "size":
+		root, err := projectRoot(cmd)
+		if err != nil {
+			return nil, "", err
+		}
+		measure, unit := fileSize, "bytes"
+		if mode == "lines" {
+			measure, unit = lineCount, "lines"
+		}
+		return func(file string) float64 {
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(root, file)
+			}
+			// a missing file (from a stale dependency file) does not
+			// take any time
+			n, _ := measure(file)
+			return float64(n)
+		}, unit, nil
+	}
+	return nil, "", fmt.Errorf("unknown --weight %q (expected times, lines, size, or count)", mode)
+}
+
+func fileSize(name string) (int64, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func lineCount(name string) (int64, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return 0, err
+	}
+	return int64(bytes.Count(data, []byte("\n"))), nil
+}
+
+// formatWeight formats a weight from loadWeights with its unit, padded for
+// tables.
+func formatWeight(w float64, unit string) string {
+	if unit == "s" {
+		return fmt.Sprintf("%8.2fs", w)
+	}
+	return fmt.Sprintf("%8.0f %s", w, unit)
+}
+
+// timesCmd represents the deps times command
+var timesCmd = &cobra.Command{
+	Use:   "times",
+	Short: "List recorded compile times",
+	Long: `List the compile time of each file recorded in the project's database of
+compile times (` + timing.DefaultFile + `), slowest first.
+
+The database is created with deps times import. When it exists, deps shard
+balances groups by compile time and deps critical-path finds the slowest
+chain of dependencies.`,
+	Args: cobra.NoArgs,
+	Example: indent("  ", `
+perennial-cli deps times
+`),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		timesFile, _ := cmd.Flags().GetString("times")
+		times, err := timing.Load(timesFile)
+		if err != nil {
+			return err
+		}
+		out, err := outputPath(cmd)
+		if err != nil {
+			return err
+		}
+		files := slices.SortedFunc(maps.Keys(times), func(a, b string) int {
+			return cmp.Or(cmp.Compare(times[b], times[a]), cmp.Compare(a, b))
+		})
+		for _, file := range files {
+			fmt.Printf("%8.2fs  %s\n", times[file], out(file))
+		}
+		return nil
+	},
+}
+
+// timesImportCmd represents the deps times import command
+var timesImportCmd = &cobra.Command{
+	Use:   "import <logs or .v.timing files...>",
+	Short: "Record compile times from build output",
+	Long: `Record compile times in the project's database of compile times
+(` + timing.DefaultFile + `), replacing earlier times for the same files.
+
+Times are read from build logs of make TIMED=1 or make pretty-timed (saved
+with tee, or the time-of-build-pretty.log file), or from the .v.timing files
+written by make TIMING=1.`,
+	Args: cobra.MinimumNArgs(1),
+	Example: indent("  ", `
+make pretty-timed -j8 && perennial-cli deps times import time-of-build-pretty.log
+make TIMED=1 -j8 2>&1 | tee build.log && perennial-cli deps times import build.log
+perennial-cli deps times import $(find src -name "*.v.timing")
+`),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		timesFile, _ := cmd.Flags().GetString("times")
+		times, err := timing.Load(timesFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			times = make(timing.Times)
+		} else if err != nil {
+			return err
+		}
+		imported := 0
+		for _, path := range args {
+			newTimes, err := timing.Import(path)
+			if err != nil {
+				return err
+			}
+			if len(newTimes) == 0 {
+				fmt.Fprintf(os.Stderr, "WARNING: no compile times found in %s\n", path)
+			}
+			imported += len(newTimes)
+			times.Merge(newTimes)
+		}
+		if err := times.Save(timesFile); err != nil {
+			return err
+		}
+		fmt.Printf("recorded %d compile time(s) in %s\n", imported, timesFile)
+		return nil
+	},
+}
+
+func init() {
+	depsCmd.AddCommand(timesCmd)
+	timesCmd.AddCommand(timesImportCmd)
+
+	timesCmd.PersistentFlags().String("times", timing.DefaultFile, timesUsage)
+}
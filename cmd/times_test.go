@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileWeights(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "a.v")
+	require.NoError(t, os.WriteFile(name, []byte("Lemma a : True.\nProof. auto. Qed.\n"), 0644))
+
+	lines, err := lineCount(name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), lines)
+	size, err := fileSize(name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(34), size)
+
+	assert.Equal(t, "    1.50s", formatWeight(1.5, "s"))
+	assert.Equal(t, "     120 lines", formatWeight(120, "lines"))
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mit-pdos/perennial-cli/depgraph"
+	"github.com/spf13/cobra"
+)
+
+// treeCmd represents the deps tree command
+var treeCmd = &cobra.Command{
+	Use:   "tree [files...]",
+	Short: "Show dependencies as a tree",
+	Long: `Show the dependencies of the given files (or with -r, the files that depend
+on them) as a tree, for reading. Without files, shows the trees of every file
+nothing depends on (or with -r, every file without dependencies).
+
+Each file is only expanded the first time it appears: later occurrences are
+marked with (*). Dependencies that form a cycle are marked with (cycle), and
+with --depth, files whose dependencies are not shown are marked with (...).
+Files outside the project root, such as libraries installed in Rocq's
+user-contrib, are marked with (external); --project-only leaves them out.`,
+	Example: indent("  ", `
+perennial-cli deps tree new/proof/proof_prelude.v
+perennial-cli deps tree -r --depth 2 new/code/sync.v
+`),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return prepareRocqdepFile(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printVo, _ := cmd.Flags().GetBool("vo")
+		reverse, _ := cmd.Flags().GetBool("reverse")
+		depth, _ := cmd.Flags().GetInt("depth")
+		ascii, _ := cmd.Flags().GetBool("ascii")
+		projectOnly, _ := cmd.Flags().GetBool("project-only")
+		if depth < 0 {
+			return fmt.Errorf("--depth must not be negative")
+		}
+		deps, err := loadRocqdeps(cmd)
+		if err != nil {
+			return err
+		}
+		roots, err := gatherArgs(cmd, args)
+		if err != nil {
+			return err
+		}
+		root, err := projectRoot(cmd)
+		if err != nil {
+			return err
+		}
+		roots, err = graphPaths(root, roots)
+		if err != nil {
+			return err
+		}
+		out, err := outputPath(cmd)
+		if err != nil {
+			return err
+		}
+
+		graph := depgraph.RocqFileGraph(deps, nil)
+		if projectOnly {
+			graph = graph.Filter(func(file string) bool {
+				return !depgraph.External(file)
+			})
+		}
+		if len(args) == 0 {
+			if reverse {
+				roots = graph.Leaves()
+			} else {
+				roots = graph.Roots()
+			}
+		}
+		inGraph := make(map[string]bool)
+		for _, file := range graph.Files {
+			inGraph[file] = true
+		}
+		for _, file := range roots {
+			if !inGraph[file] {
+				return fmt.Errorf("%s is not in the dependency graph", out(file))
+			}
+		}
+
+		name := func(file string) string {
+			external := depgraph.External(file)
+			file = out(file)
+			if printVo {
+				file = setExtension(file, ".vo")
+			}
+			if external {
+				file += " (external)"
+			}
+			return file
+		}
+		for i, file := range roots {
+			roots[i] = name(file)
+		}
+		return depgraph.WriteTree(os.Stdout, graph.Rename(name), roots, depgraph.TreeOptions{
+			Reverse: reverse,
+			Depth:   depth,
+			ASCII:   ascii,
+		})
+	},
+}
+
+func init() {
+	depsCmd.AddCommand(treeCmd)
+
+	treeCmd.Flags().Int("depth", 0, "Only show files at most this many levels below the given files; 0 for no limit")
+	treeCmd.Flags().Bool("project-only", false, "Leave out files outside the project root, such as installed libraries")
+	treeCmd.Flags().Bool("ascii", false, "Draw the tree with ASCII characters rather than Unicode")
+}
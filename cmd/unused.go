@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"github.com/mit-pdos/perennial-cli/depgraph"
+	"github.com/spf13/cobra"
+)
+
+// unusedCmd represents the deps unused command
+var unusedCmd = &cobra.Command{
+	Use:   "unused [roots...]",
+	Short: "List .v files that nothing uses",
+	Long: `List the files in .rocqdeps.d that no other file depends on, other than the
+given roots: .v files (or directories of them) that are used on their own,
+such as top-level proofs and examples. The remaining files are candidates for
+deletion.
+
+With --transitive, also lists the files that are only needed by unused files,
+which become unused once those are deleted: everything the roots do not
+(transitively) depend on.`,
+	Example: indent("  ", `
+perennial-cli deps unused new/proof/top.v
+perennial-cli deps unused --transitive src/program_proof/examples/ src/program_proof/top.v
+`),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return prepareRocqdepFile(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printVo, _ := cmd.Flags().GetBool("vo")
+		transitive, _ := cmd.Flags().GetBool("transitive")
+		deps, err := loadRocqdeps(cmd)
+		if err != nil {
+			return err
+		}
+		roots, err := gatherArgs(cmd, args)
+		if err != nil {
+			return err
+		}
+		root, err := projectRoot(cmd)
+		if err != nil {
+			return err
+		}
+		roots, err = graphPaths(root, roots)
+		if err != nil {
+			return err
+		}
+		out, err := outputPath(cmd)
+		if err != nil {
+			return err
+		}
+		for _, file := range depgraph.RocqFileGraph(deps, nil).Unused(roots, transitive) {
+			file = out(file)
+			if printVo {
+				file = setExtension(file, ".vo")
+			}
+			printPath(cmd, file)
+		}
+		return nil
+	},
+}
+
+func init() {
+	depsCmd.AddCommand(unusedCmd)
+
+	unusedCmd.Flags().BoolP("transitive", "t", false, "Also list files only needed by unused files")
+}
@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 
 	"github.com/mit-pdos/perennial-cli/git"
 	"github.com/mit-pdos/perennial-cli/opam"
@@ -11,64 +13,218 @@ import (
 )
 
 type completedUpdate struct {
-	Package  string
-	From, To string
+	Package string `json:"package"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Tag     string `json:"tag,omitempty"` // release tag for To, if updating to releases
+}
+
+// updateSummary is the machine-readable summary printed by update --check
+type updateSummary struct {
+	Changed         bool              `json:"changed"`
+	Updated         []completedUpdate `json:"updated"`
+	IndirectChanged bool              `json:"indirect_changed"`
+	Written         bool              `json:"written"`
+	// PinProblems are the pins reported by --verify
+	PinProblems []pinProblem `json:"pin_problems,omitempty"`
+}
+
+// exitUpdated is the exit status of update --check when the opam file was (or
+// would be) changed
+const exitUpdated = 2
+
+// selectPackages returns the packages that match any of the glob patterns
+// (all packages if there are no patterns).
+//
+// Returns an error if a pattern is malformed or does not match any package.
+func selectPackages(patterns []string, packages []string) (map[string]bool, error) {
+	selected := make(map[string]bool)
+	if len(patterns) == 0 {
+		for _, pkg := range packages {
+			selected[pkg] = true
+		}
+		return selected, nil
+	}
+	for _, pattern := range patterns {
+		matched := false
+		for _, pkg := range packages {
+			ok, err := path.Match(pattern, pkg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid package pattern %q: %w", pattern, err)
+			}
+			if ok {
+				selected[pkg] = true
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no pinned package matches %q", pattern)
+		}
+	}
+	return selected, nil
 }
 
 func doUpdate(cmd *cobra.Command, args []string) error {
-	packageFlag, _ := cmd.Flags().GetString("package")
+	packagePatterns, _ := cmd.Flags().GetStringSlice("package")
 	opamFileName, _ := cmd.Flags().GetString("file")
+	verify, _ := cmd.Flags().GetBool("verify")
+	latestRelease, _ := cmd.Flags().GetBool("latest-release")
+	check, _ := cmd.Flags().GetBool("check")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	verifySignature, _ := cmd.Flags().GetBool("verify-signature")
+	indirectOpts := getIndirectOptions(cmd)
+	ctx := cmd.Context()
 	contents, err := os.ReadFile(opamFileName)
 	if err != nil {
 		return err
 	}
 	opamFile, err := opam.Parse(bytes.NewReader(contents))
-	var updates []completedUpdate
+	if err != nil {
+		return err
+	}
+	var pinned []string
+	for _, dep := range opamFile.GetPinDepends() {
+		pinned = append(pinned, dep.Package)
+	}
+	selected, err := selectPackages(packagePatterns, pinned)
+	if err != nil {
+		return err
+	}
+	updates := []completedUpdate{}
+	upgraded := make(map[string]opam.PinDepend)
+	// several packages are often pinned to the same repository, so the refs
+	// of each remote are fetched only once
+	snapshots := make(map[string]*git.RefSnapshot)
 	for _, dep := range opamFile.GetPinDepends() {
-		if packageFlag != "" && packageFlag != dep.Package {
+		if !selected[dep.Package] {
 			continue
 		}
-		hash, err := git.GetLatestCommit(dep.BaseUrl())
-		if err != nil {
-			return err
+		snapshot, ok := snapshots[dep.BaseUrl()]
+		if !ok {
+			snapshot, err = git.SnapshotRefs(ctx, dep.BaseUrl())
+			if err != nil {
+				return fmt.Errorf("%s: %w", dep.Package, err)
+			}
+			snapshots[dep.BaseUrl()] = snapshot
+			// best effort: the pin still works through the host's redirect
+			if moved, err := dep.MovedToContext(ctx); err == nil && moved != "" {
+				fmt.Fprintf(os.Stderr, "NOTE: the repository of %s has moved to %s; "+
+					"consider updating its pin-depends URL\n", dep.Package, moved)
+			}
+		}
+		var hash, tag string
+		if latestRelease {
+			release, err := snapshot.LatestRelease()
+			if err != nil {
+				return fmt.Errorf("%s: %w", dep.Package, err)
+			}
+			hash, tag = release.Commit, release.Name
+		} else {
+			hash, err = snapshot.LatestCommit()
+			if err != nil {
+				return err
+			}
 		}
 		if hash != dep.Commit {
+			target := "the default branch"
+			if tag != "" {
+				target = tag
+			}
+			// failing to check is not an error, since this is only a warning
+			requests, _ := snapshot.EphemeralPullRequestsAt(ctx, dep.Commit)
+			for _, n := range requests {
+				fmt.Fprintf(os.Stderr, "WARNING: %s was pinned to the head of pull request #%d, which is ephemeral; "+
+					"updating it to %s\n", dep.Package, n, target)
+			}
+			if verifySignature {
+				if tag != "" {
+					err = git.VerifyTagContext(ctx, dep.BaseUrl(), tag, hash)
+				} else {
+					err = git.VerifyCommitContext(ctx, dep.BaseUrl(), hash)
+				}
+				if err != nil {
+					return fmt.Errorf("%s: %w", dep.Package, err)
+				}
+			}
 			oldCommit := dep.Commit
 			dep.Commit = hash
-			opamFile.AddPinDepend(dep)
+			if err := opamFile.AddPinDepend(dep); err != nil {
+				return err
+			}
+			upgraded[dep.Package] = dep
 			updates = append(updates, completedUpdate{
 				Package: dep.Package,
 				From:    oldCommit,
 				To:      hash,
+				Tag:     tag,
 			})
 		}
 	}
-	err = opamFile.ExtendCommitHashes()
+	err = opamFile.ExtendCommitHashesContext(ctx)
 	if err != nil {
 		return err
 	}
-	indirectChanged, err := opamFile.UpdateIndirectDependencies()
+	indirectChanged, err := opamFile.UpdateIndirectDependenciesContext(ctx, indirectOpts)
 	if err != nil {
 		return err
 	}
-	newContents := opamFile.String()
-	if newContents == string(contents) {
-		// nothing to do, don't write the file
-		return nil
+	changed := opamFile.String() != string(contents)
+	if changed && !dryRun {
+		if err := opamFile.Save(opamFileName); err != nil {
+			return err
+		}
 	}
-	if err := os.WriteFile(opamFileName, []byte(newContents), 0644); err != nil {
-		return err
+	if check {
+		// the summary is the only output, so it includes what verify finds
+		var problems []pinProblem
+		var verifyErr error
+		if verify {
+			problems, verifyErr = checkPins(ctx, opamFile.AllPinDepends())
+		}
+		summary, err := json.Marshal(updateSummary{
+			Changed:         changed,
+			Updated:         updates,
+			IndirectChanged: indirectChanged,
+			Written:         changed && !dryRun,
+			PinProblems:     problems,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(summary))
+		if verifyErr != nil {
+			return verifyErr
+		}
+		if changed {
+			return exitCodeError{code: exitUpdated}
+		}
+		return nil
 	}
-	if len(updates) > 0 {
-		fmt.Printf("upgraded %d packages:\n", len(updates))
-		for _, update := range updates {
-			fmt.Printf("  %s: %s -> %s\n", update.Package, update.From, update.To)
-		}
-	} else {
-		if indirectChanged {
-			fmt.Printf("updated indirect dependencies\n")
+	if changed {
+		if dryRun {
+			fmt.Printf("dry run: not writing %s\n", opamFileName)
+		}
+		if len(updates) > 0 {
+			fmt.Printf("upgraded %d packages:\n", len(updates))
+			for _, update := range updates {
+				if update.Tag != "" {
+					fmt.Printf("  %s: %s -> %s (%s)\n", update.Package, update.From, update.To, update.Tag)
+				} else {
+					fmt.Printf("  %s: %s -> %s\n", update.Package, update.From,
+						describeCommit(ctx, upgraded[update.Package]))
+				}
+			}
 		} else {
-			fmt.Printf("normalized file\n")
+			if indirectChanged {
+				fmt.Printf("updated indirect dependencies\n")
+			} else {
+				fmt.Printf("normalized file\n")
+			}
+		}
+	}
+	if verify {
+		if err := verifyPins(ctx, opamFile.AllPinDepends()); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -78,11 +234,28 @@ func doUpdate(cmd *cobra.Command, args []string) error {
 var updateCmd = &cobra.Command{
 	Use:   "update",
 	Short: "Update pinned dependencies",
-	Long:  `Update dependencies in pin-depends to the latest commit hash.`,
+	Long: `Update dependencies in pin-depends to the latest commit hash.
+
+With --latest-release, pins each dependency to its most recent release tag
+(compared by version number, ignoring pre-releases) instead of the latest
+commit on the default branch.
+
+With --verify-signature, each new pin must have a valid GPG or SSH signature
+from a key you trust (on the release tag with --latest-release, otherwise on
+the commit); see opam add.
+
+For scheduled CI jobs, --check prints a one-line JSON summary instead of the
+usual messages and exits with status 2 if the opam file was changed (or with
+--dry-run, would be changed), 0 if it is already up-to-date, and 1 on errors.
+With --verify, the summary lists the pins that verify reports in
+"pin_problems" (and unreachable pins are an error, after the summary).`,
 	Example: indent("  ", `
 perennial-cli opam update
 perennial-cli opam update -f perennial.opam
 perennial-cli opam update -p iris
+perennial-cli opam update -p perennial -p 'rocq-*'
+perennial-cli opam update --latest-release -p 'rocq-*'
+perennial-cli opam update --check --dry-run
 `),
 	PreRunE: func(cmd *cobra.Command, args []string) error {
 		opamFile, _ := cmd.Flags().GetString("file")
@@ -104,5 +277,11 @@ func init() {
 
 	// Here you will define your flags and configuration settings.
 
-	updateCmd.PersistentFlags().StringP("package", "p", "", "Update only a specific package")
+	updateCmd.PersistentFlags().StringSliceP("package", "p", nil, "Update only packages matching this glob (can be repeated)")
+	updateCmd.Flags().Bool("latest-release", false, "Pin to the most recent release tag rather than the latest commit")
+	updateCmd.Flags().Bool("check", false, "Print a JSON summary and exit with status 2 if anything changed")
+	updateCmd.Flags().Bool("dry-run", false, "Compute updates without writing the opam file")
+	updateCmd.Flags().Bool("verify-signature", false, "Require a valid signature on each new pinned commit (or release tag)")
+	updateCmd.Flags().Bool("verify", false, "Afterward, check that all pins are reachable from a branch (like opam verify)")
+	addIndirectFlags(updateCmd)
 }
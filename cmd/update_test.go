@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectPackages(t *testing.T) {
+	packages := []string{"perennial", "rocq-iris", "rocq-stdpp", "iris-named-props"}
+
+	selected, err := selectPackages(nil, packages)
+	require.NoError(t, err)
+	assert.Len(t, selected, 4)
+
+	selected, err = selectPackages([]string{"rocq-*", "perennial"}, packages)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{
+		"perennial":  true,
+		"rocq-iris":  true,
+		"rocq-stdpp": true,
+	}, selected)
+
+	_, err = selectPackages([]string{"coq-*"}, packages)
+	assert.ErrorContains(t, err, `no pinned package matches "coq-*"`)
+
+	_, err = selectPackages([]string{"rocq-["}, packages)
+	assert.ErrorContains(t, err, "invalid package pattern")
+}
+
+func TestUpdateSummaryPinProblems(t *testing.T) {
+	problems := []pinProblem{
+		{Package: "rocq-iris", Commit: "fde0f86", Problem: "behind", Branch: "master"},
+		{Package: "rocq-stdpp", Indirect: true, Commit: "187909f", Problem: "unreachable"},
+	}
+	assert.Equal(t, "rocq-iris: fde0f86 is behind master", problems[0].String())
+	assert.Equal(t, "rocq-stdpp (indirect): 187909f is UNREACHABLE from any branch (force-pushed?)", problems[1].String())
+
+	summary, err := json.Marshal(updateSummary{PinProblems: problems})
+	require.NoError(t, err)
+	assert.Equal(t, `{"changed":false,"updated":null,"indirect_changed":false,"written":false,`+
+		`"pin_problems":[{"package":"rocq-iris","commit":"fde0f86","problem":"behind","branch":"master"},`+
+		`{"package":"rocq-stdpp","indirect":true,"commit":"187909f","problem":"unreachable"}]}`, string(summary))
+
+	// without --verify, the summary is unchanged
+	summary, err = json.Marshal(updateSummary{})
+	require.NoError(t, err)
+	assert.NotContains(t, string(summary), "pin_problems")
+}
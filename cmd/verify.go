@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"iter"
+	"os"
+
+	"github.com/mit-pdos/perennial-cli/git"
+	"github.com/mit-pdos/perennial-cli/opam"
+	"github.com/spf13/cobra"
+)
+
+// pinProblem is a pin that verify reports
+type pinProblem struct {
+	Package  string `json:"package"`
+	Indirect bool   `json:"indirect,omitempty"`
+	Commit   string `json:"commit"`
+	// Problem is behind (with the Branch it is behind), unreachable, or moved
+	// (with the URL it MovedTo)
+	Problem string `json:"problem"`
+	Branch  string `json:"branch,omitempty"`
+	MovedTo string `json:"moved_to,omitempty"`
+}
+
+func (p pinProblem) String() string {
+	name := p.Package
+	if p.Indirect {
+		name += " (indirect)"
+	}
+	switch p.Problem {
+	case "moved":
+		return fmt.Sprintf("%s: repository has moved to %s", name, p.MovedTo)
+	case "behind":
+		return fmt.Sprintf("%s: %s is behind %s", name, p.Commit, p.Branch)
+	default:
+		return fmt.Sprintf("%s: %s is UNREACHABLE from any branch (force-pushed?)", name, p.Commit)
+	}
+}
+
+// checkPins checks the status of each pin, returning the pins that are not
+// up-to-date, and an error if any pin is unreachable.
+func checkPins(ctx context.Context, pins iter.Seq2[opam.PinDepend, bool]) ([]pinProblem, error) {
+	var problems []pinProblem
+	unreachable := 0
+	for dep, indirect := range pins {
+		status, err := dep.CheckStatusContext(ctx)
+		if err != nil {
+			return problems, fmt.Errorf("failed to check %s: %w", dep.Package, err)
+		}
+		problem := pinProblem{Package: dep.Package, Indirect: indirect, Commit: dep.Commit}
+		// a moved repository still works through the host's redirect, so
+		// failing to check is not an error
+		if movedTo, err := dep.MovedToContext(ctx); err == nil && movedTo != "" {
+			moved := problem
+			moved.Problem, moved.MovedTo = "moved", movedTo
+			problems = append(problems, moved)
+		}
+		switch status {
+		case opam.PinBehind:
+			branch, err := git.GetDefaultBranchContext(ctx, dep.BaseUrl())
+			if err != nil {
+				branch = "HEAD"
+			}
+			problem.Problem, problem.Branch = "behind", branch
+			problems = append(problems, problem)
+		case opam.PinUnreachable:
+			unreachable++
+			problem.Problem = "unreachable"
+			problems = append(problems, problem)
+		}
+	}
+	if unreachable > 0 {
+		return problems, fmt.Errorf("%d pinned commit(s) are unreachable", unreachable)
+	}
+	return problems, nil
+}
+
+// verifyPins checks the status of each pin, reporting any that are not
+// up-to-date. Returns an error if any pin is unreachable.
+func verifyPins(ctx context.Context, pins iter.Seq2[opam.PinDepend, bool]) error {
+	problems, err := checkPins(ctx, pins)
+	for _, problem := range problems {
+		fmt.Printf("  %s\n", problem)
+	}
+	return err
+}
+
+func doVerify(cmd *cobra.Command, args []string) error {
+	opamFileName, _ := cmd.Flags().GetString("file")
+	contents, err := os.ReadFile(opamFileName)
+	if err != nil {
+		return err
+	}
+	opamFile, err := opam.Parse(bytes.NewReader(contents))
+	if err != nil {
+		return err
+	}
+	return verifyPins(cmd.Context(), opamFile.AllPinDepends())
+}
+
+// verifyCmd represents the opam verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that pinned commits are still available",
+	Long: `Check every pin-depends entry (direct and indirect) against its remote.
+
+Reports pins that are behind the remote's default branch, pins whose
+repository was renamed or transferred (and should use the new URL), and
+separately pins whose commit is no longer reachable from any branch (for
+example, after a force-push). Unreachable pins break fresh clones that use
+shallow fetches, so verify fails if it finds any.`,
+	Args: cobra.NoArgs,
+	Example: indent("  ", `
+perennial-cli opam verify
+perennial-cli opam verify -f perennial.opam
+`),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return setDefaultOpamFile(cmd)
+	},
+	RunE: doVerify,
+}
+
+func init() {
+	opamCmd.AddCommand(verifyCmd)
+}
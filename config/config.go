@@ -0,0 +1,90 @@
+// config implements the user configuration file for perennial-cli
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Config is the user configuration, read from config.toml in the
+// perennial-cli user configuration directory (see Path).
+type Config struct {
+	// Tokens maps a git host (like github.com or gitlab.mpi-sws.org) to an
+	// API token for that host, for accessing private repositories.
+	Tokens map[string]string `toml:"tokens"`
+
+	// Hosts declares self-hosted git servers, keyed by host name.
+	Hosts map[string]Host `toml:"hosts"`
+
+	// HTTP configures network access.
+	HTTP HTTP `toml:"http"`
+}
+
+// HTTP configures how perennial-cli connects to git hosts.
+type HTTP struct {
+	// Proxy is the URL of an HTTP(S) proxy, overriding the HTTPS_PROXY and
+	// HTTP_PROXY environment variables.
+	Proxy string `toml:"proxy"`
+	// CAFile is a PEM bundle of additional certificate authorities to trust.
+	CAFile string `toml:"ca_file"`
+	// Timeout limits each API request, as a duration like "30s".
+	Timeout string `toml:"timeout"`
+	// RateLimitWait is how long to wait for an API rate limit to reset (like
+	// "5m") before failing.
+	RateLimitWait string `toml:"rate_limit_wait"`
+}
+
+// Host is the configuration of a self-hosted git server.
+type Host struct {
+	// Type is the hosting software (github, gitlab, gitea, forgejo, or
+	// sourcehut), which determines the API used to read repositories; "git"
+	// disables the API and uses only git.
+	Type string `toml:"type"`
+}
+
+func Parse(r io.Reader) (*Config, error) {
+	cfg := &Config{}
+	err := toml.NewDecoder(r).DisallowUnknownFields().Decode(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Path returns the location of the configuration file (for example,
+// ~/.config/perennial-cli/config.toml on Linux).
+func Path() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "perennial-cli", "config.toml"), nil
+}
+
+// Load reads the configuration file. A missing file is an empty
+// configuration.
+func Load() (*Config, error) {
+	path, err := Path()
+	if err != nil {
+		return &Config{}, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cfg, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	input := `
+[tokens]
+"github.com" = "ghp_example"
+"gitlab.mpi-sws.org" = "glpat-example"
+`
+	cfg, err := Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"github.com":         "ghp_example",
+		"gitlab.mpi-sws.org": "glpat-example",
+	}, cfg.Tokens)
+}
+
+func TestParseHosts(t *testing.T) {
+	input := `
+[hosts."git.example.org"]
+type = "gitlab"
+
+[hosts."forge.example.org"]
+type = "forgejo"
+`
+	cfg, err := Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Host{
+		"git.example.org":   {Type: "gitlab"},
+		"forge.example.org": {Type: "forgejo"},
+	}, cfg.Hosts)
+}
+
+func TestParseHTTP(t *testing.T) {
+	input := `
+[http]
+proxy = "http://proxy.example.com:3128"
+ca_file = "/etc/ssl/certs/corporate-ca.pem"
+timeout = "30s"
+rate_limit_wait = "5m"
+`
+	cfg, err := Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, HTTP{
+		Proxy:         "http://proxy.example.com:3128",
+		CAFile:        "/etc/ssl/certs/corporate-ca.pem",
+		Timeout:       "30s",
+		RateLimitWait: "5m",
+	}, cfg.HTTP)
+}
+
+func TestParseRejectsUnknownFields(t *testing.T) {
+	_, err := Parse(strings.NewReader(`github_token = "ghp_example"`))
+	assert.Error(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	path, err := Path()
+	require.NoError(t, err)
+
+	// missing file
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Tokens)
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte("[tokens]\n\"github.com\" = \"ghp_example\"\n"), 0644))
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, "ghp_example", cfg.Tokens["github.com"])
+}
@@ -0,0 +1,97 @@
+package depgraph
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+// benchRocqdep generates a .rocqdeps.d for a synthetic project of n files,
+// each depending on a few earlier files (so the graph is acyclic), similar in
+// size to Perennial's for n around 5000.
+func benchRocqdep(n int) string {
+	r := rand.New(rand.NewPCG(1, 2))
+	var b strings.Builder
+	for i := range n {
+		fmt.Fprintf(&b, "src/f%d.vo src/f%d.glob: src/f%d.v", i, i, i)
+		if i > 0 {
+			for range r.IntN(10) {
+				fmt.Fprintf(&b, " src/f%d.vo", r.IntN(i))
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func benchGraph(b *testing.B, n int) *Graph {
+	b.Helper()
+	g, err := Parse(strings.NewReader(benchRocqdep(n)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	filterRocq(g)
+	return g
+}
+
+func BenchmarkParse(b *testing.B) {
+	input := benchRocqdep(5000)
+	b.SetBytes(int64(len(input)))
+	for b.Loop() {
+		if _, err := Parse(strings.NewReader(input)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDeps(b *testing.B) {
+	g := benchGraph(b, 5000)
+	for b.Loop() {
+		g.Deps([]string{"src/f4999.vo"})
+	}
+}
+
+func BenchmarkTargets(b *testing.B) {
+	g := benchGraph(b, 5000)
+	for b.Loop() {
+		g.Targets([]string{"src/f0.vo"})
+	}
+}
+
+func BenchmarkTopoSort(b *testing.B) {
+	g := benchGraph(b, 5000)
+	for b.Loop() {
+		if _, err := g.TopoSort(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFilterNodes(b *testing.B) {
+	g := benchGraph(b, 5000)
+	for b.Loop() {
+		filtered := Merge(g)
+		filtered.FilterNodes(func(name string) bool { return strings.HasSuffix(name, ".vo") })
+	}
+}
+
+func BenchmarkRocqFileGraph(b *testing.B) {
+	g := benchGraph(b, 5000)
+	for b.Loop() {
+		RocqFileGraph(g, nil)
+	}
+}
+
+func BenchmarkUnmarshalBinary(b *testing.B) {
+	data, err := benchGraph(b, 5000).MarshalBinary()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(data)))
+	for b.Loop() {
+		if err := NewGraph().UnmarshalBinary(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
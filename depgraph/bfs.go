@@ -0,0 +1,103 @@
+package depgraph
+
+import (
+	"cmp"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// parallelFrontier is the smallest BFS frontier that is expanded in parallel;
+// smaller frontiers are not worth the synchronization.
+const parallelFrontier = 1024
+
+// bfs does a breadth-first search from seeds along adjacency. It returns the
+// nodes reached (starting with the seeds) in the order a sequential BFS would
+// visit them, and the parent of each node in the BFS tree (-1 for the seeds
+// and nodes that were not reached).
+//
+// Large levels of the search are expanded in parallel, with a concurrent
+// visited set. To stay deterministic, a node reached from several nodes of
+// the frontier is attributed to the first of them (and its first edge), as
+// in a sequential search.
+func bfs(seeds []nodeID, adjacency [][]nodeID) (order []nodeID, parent []nodeID) {
+	n := len(adjacency)
+	parent = make([]nodeID, n)
+	visited := make([]bool, n)
+	// first[node] is the smallest (frontier position, edge index) that
+	// reaches node in the current level, packed into an int64
+	first := make([]atomic.Int64, n)
+	for i := range first {
+		parent[i] = -1
+		first[i].Store(math.MaxInt64)
+	}
+
+	var frontier []nodeID
+	for _, seed := range seeds {
+		if !visited[seed] {
+			visited[seed] = true
+			frontier = append(frontier, seed)
+		}
+	}
+	for len(frontier) > 0 {
+		order = append(order, frontier...)
+		next := expand(frontier, adjacency, visited, first)
+		for _, node := range next {
+			visited[node] = true
+			parent[node] = frontier[first[node].Load()>>32]
+		}
+		frontier = next
+	}
+	return order, parent
+}
+
+// expand finds the unvisited nodes adjacent to the frontier, in the order
+// they are first reached, recording in first how each was reached.
+func expand(frontier []nodeID, adjacency [][]nodeID, visited []bool, first []atomic.Int64) []nodeID {
+	workers := 1
+	if len(frontier) >= parallelFrontier {
+		workers = min(runtime.GOMAXPROCS(0), len(frontier)/(parallelFrontier/4))
+	}
+	found := make([][]nodeID, workers)
+	chunk := (len(frontier) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start, end := w*chunk, min((w+1)*chunk, len(frontier))
+			for pos := start; pos < end; pos++ {
+				for i, next := range adjacency[frontier[pos]] {
+					if visited[next] {
+						continue
+					}
+					key := int64(pos)<<32 | int64(i)
+					for {
+						old := first[next].Load()
+						if key >= old {
+							break
+						}
+						if first[next].CompareAndSwap(old, key) {
+							if old == math.MaxInt64 {
+								// reached for the first time
+								found[w] = append(found[w], next)
+							}
+							break
+						}
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	next := slices.Concat(found...)
+	if workers > 1 {
+		// each worker found nodes in order, but they may be interleaved
+		slices.SortFunc(next, func(a, b nodeID) int {
+			return cmp.Compare(first[a].Load(), first[b].Load())
+		})
+	}
+	return next
+}
@@ -0,0 +1,58 @@
+package depgraph
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sequentialBFS is a straightforward BFS, as a reference for bfs
+func sequentialBFS(seeds []nodeID, adjacency [][]nodeID) (order []nodeID, parent []nodeID) {
+	parent = make([]nodeID, len(adjacency))
+	visited := make([]bool, len(adjacency))
+	for i := range parent {
+		parent[i] = -1
+	}
+	var queue []nodeID
+	for _, seed := range seeds {
+		if !visited[seed] {
+			visited[seed] = true
+			queue = append(queue, seed)
+		}
+	}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		order = append(order, node)
+		for _, next := range adjacency[node] {
+			if !visited[next] {
+				visited[next] = true
+				parent[next] = node
+				queue = append(queue, next)
+			}
+		}
+	}
+	return order, parent
+}
+
+func TestBFSMatchesSequential(t *testing.T) {
+	// a random graph with frontiers large enough to be expanded in parallel
+	r := rand.New(rand.NewPCG(1, 2))
+	const n = 20000
+	adjacency := make([][]nodeID, n)
+	for i := range adjacency {
+		for range r.IntN(6) {
+			adjacency[i] = append(adjacency[i], nodeID(r.IntN(n)))
+		}
+	}
+	var seeds []nodeID
+	for range 3 * parallelFrontier {
+		seeds = append(seeds, nodeID(r.IntN(n)))
+	}
+
+	order, parent := bfs(seeds, adjacency)
+	wantOrder, wantParent := sequentialBFS(seeds, adjacency)
+	assert.Equal(t, wantOrder, order)
+	assert.Equal(t, wantParent, parent)
+}
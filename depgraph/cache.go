@@ -0,0 +1,198 @@
+package depgraph
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// This file implements caching parsed dependency files, which saves parsing
+// large files (like Perennial's, several megabytes) on every run.
+
+// graphMagic starts the binary encoding of a Graph, followed by its
+// graphVersion
+const graphMagic = "depgraph"
+
+// graphVersion identifies the layout of the binary encoding of a Graph.
+// Increase it whenever MarshalBinary changes, so that UnmarshalBinary rejects
+// graphs encoded by older builds. (Version 1 was written with the magic
+// "depgraph1".)
+const graphVersion = 2
+
+// parserVersion identifies the rules Parse, ParseRocqdep, and
+// ParseRocqdepVos use to build a graph from a dependency file. Increase it
+// whenever they change, so that CachedParse does not load graphs parsed by
+// older builds.
+const parserVersion = 1
+
+// MarshalBinary encodes g in a compact binary format, which UnmarshalBinary
+// decodes much faster than Parse.
+func (g *Graph) MarshalBinary() ([]byte, error) {
+	var b []byte
+	b = append(b, graphMagic...)
+	b = binary.AppendUvarint(b, graphVersion)
+	b = binary.AppendUvarint(b, uint64(len(g.names)))
+	for _, name := range g.names {
+		b = binary.AppendUvarint(b, uint64(len(name)))
+		b = append(b, name...)
+	}
+	b = binary.AppendUvarint(b, uint64(len(g.edges)))
+	for _, e := range g.edges {
+		b = binary.AppendUvarint(b, uint64(e.target))
+		b = binary.AppendUvarint(b, uint64(e.source))
+	}
+	return b, nil
+}
+
+// UnmarshalBinary replaces g with the graph encoded by MarshalBinary.
+func (g *Graph) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	magic := make([]byte, len(graphMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != graphMagic {
+		return errors.New("not an encoded dependency graph")
+	}
+	if version, err := binary.ReadUvarint(r); err != nil || version != graphVersion {
+		return fmt.Errorf("unsupported dependency graph version %d (expected %d)", version, graphVersion)
+	}
+	decoded := NewGraph()
+	numNames, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("corrupt dependency graph: %w", err)
+	}
+	for range numNames {
+		n, err := binary.ReadUvarint(r)
+		if err != nil || n > uint64(r.Len()) {
+			return errors.New("corrupt dependency graph: bad name")
+		}
+		name := make([]byte, n)
+		io.ReadFull(r, name)
+		decoded.node(string(name))
+	}
+	if len(decoded.names) != int(numNames) {
+		return errors.New("corrupt dependency graph: duplicate names")
+	}
+	numEdges, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("corrupt dependency graph: %w", err)
+	}
+	for range numEdges {
+		target, err1 := binary.ReadUvarint(r)
+		source, err2 := binary.ReadUvarint(r)
+		if err1 != nil || err2 != nil || target >= numNames || source >= numNames {
+			return errors.New("corrupt dependency graph: bad edge")
+		}
+		decoded.edges = append(decoded.edges, edge{target: nodeID(target), source: nodeID(source)})
+	}
+	*g = *decoded
+	return nil
+}
+
+// cacheKey identifies the contents of a dependency file: its modification
+// time and size (to quickly detect changes) and its hash, along with the
+// versions of the parser and encoding that produced the cached graph.
+type cacheKey struct {
+	ParserVersion uint32
+	GraphVersion  uint32
+	ModTime       int64
+	Size          int64
+	Hash          [sha256.Size]byte
+}
+
+func fileCacheKey(name string) (cacheKey, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return cacheKey{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return cacheKey{}, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return cacheKey{}, err
+	}
+	key := cacheKey{
+		ParserVersion: parserVersion,
+		GraphVersion:  graphVersion,
+		ModTime:       info.ModTime().UnixNano(),
+		Size:          info.Size(),
+	}
+	h.Sum(key.Hash[:0])
+	return key, nil
+}
+
+// CachedParse parses the dependency file rocqdepFile with parse (such as
+// ParseRocqdep), caching the result in cacheFile. If cacheFile holds the
+// graph for the current contents of rocqdepFile (according to its hash and
+// modification time), written by a build with the same parser and encoding
+// versions, the graph is loaded from the cache instead.
+//
+// Failing to read or write the cache is not an error; the file is parsed
+// instead.
+func CachedParse(rocqdepFile, cacheFile string, parse func(string) (*Graph, error)) (*Graph, error) {
+	key, err := fileCacheKey(rocqdepFile)
+	if err != nil {
+		return nil, err
+	}
+	if g, ok := readCache(cacheFile, key); ok {
+		return g, nil
+	}
+	g, err := parse(rocqdepFile)
+	if err != nil {
+		return nil, err
+	}
+	// the cache is only an optimization
+	_ = writeCache(cacheFile, key, g)
+	return g, nil
+}
+
+func readCache(cacheFile string, key cacheKey) (*Graph, bool) {
+	data, err := os.ReadFile(cacheFile)
+	if err != nil {
+		return nil, false
+	}
+	r := bytes.NewReader(data)
+	var cached cacheKey
+	if err := binary.Read(r, binary.LittleEndian, &cached); err != nil || cached != key {
+		return nil, false
+	}
+	g := NewGraph()
+	if err := g.UnmarshalBinary(data[len(data)-r.Len():]); err != nil {
+		return nil, false
+	}
+	return g, true
+}
+
+func writeCache(cacheFile string, key cacheKey, g *Graph) error {
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err != nil {
+		return err
+	}
+	data, err := g.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	// write to a temporary file, so concurrent runs never see a partial cache
+	f, err := os.CreateTemp(filepath.Dir(cacheFile), ".depgraph-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	w := bufio.NewWriter(f)
+	binary.Write(w, binary.LittleEndian, key)
+	w.Write(data)
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), cacheFile)
+}
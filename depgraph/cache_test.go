@@ -0,0 +1,74 @@
+package depgraph
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	g, err := Parse(strings.NewReader(benchRocqdep(100)))
+	require.NoError(t, err)
+	data, err := g.MarshalBinary()
+	require.NoError(t, err)
+	decoded := NewGraph()
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, g, decoded)
+
+	assert.Error(t, decoded.UnmarshalBinary([]byte("not a graph")))
+	assert.Error(t, decoded.UnmarshalBinary(data[:len(data)-3]))
+
+	// graphs encoded in another version are rejected
+	other := bytes.Clone(data)
+	other[len(graphMagic)]++
+	assert.ErrorContains(t, decoded.UnmarshalBinary(other), "unsupported dependency graph version")
+}
+
+func TestCachedParse(t *testing.T) {
+	dir := t.TempDir()
+	rocqdepFile := filepath.Join(dir, ".rocqdeps.d")
+	cacheFile := filepath.Join(dir, "cache", "deps.graph")
+	require.NoError(t, os.WriteFile(rocqdepFile, []byte("A.vo: A.v B.vo\nB.vo: B.v\n"), 0644))
+
+	parses := 0
+	parse := func(name string) (*Graph, error) {
+		parses++
+		return ParseRocqdep(name)
+	}
+	g, err := CachedParse(rocqdepFile, cacheFile, parse)
+	require.NoError(t, err)
+	assert.Equal(t, 1, parses)
+	cached, err := CachedParse(rocqdepFile, cacheFile, parse)
+	require.NoError(t, err)
+	assert.Equal(t, 1, parses, "should load from the cache")
+	assert.Equal(t, g, cached)
+
+	// changing the file (even keeping its size) invalidates the cache
+	require.NoError(t, os.WriteFile(rocqdepFile, []byte("A.vo: A.v C.vo\nC.vo: C.v\n"), 0644))
+	require.NoError(t, os.Chtimes(rocqdepFile, time.Now().Add(time.Second), time.Now().Add(time.Second)))
+	g, err = CachedParse(rocqdepFile, cacheFile, parse)
+	require.NoError(t, err)
+	assert.Equal(t, 2, parses)
+	assert.Contains(t, g.allDeps(), Dep{Target: "A.vo", Source: "C.vo"})
+
+	// a graph cached by a build with another parser is ignored
+	key, err := fileCacheKey(rocqdepFile)
+	require.NoError(t, err)
+	key.ParserVersion++
+	require.NoError(t, writeCache(cacheFile, key, NewGraph()))
+	_, err = CachedParse(rocqdepFile, cacheFile, parse)
+	require.NoError(t, err)
+	assert.Equal(t, 3, parses)
+
+	// a corrupt cache is ignored
+	require.NoError(t, os.WriteFile(cacheFile, []byte("garbage"), 0644))
+	_, err = CachedParse(rocqdepFile, cacheFile, parse)
+	require.NoError(t, err)
+	assert.Equal(t, 4, parses)
+}
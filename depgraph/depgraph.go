@@ -1,47 +1,225 @@
-// depgraph analyzes Rocq Makefile dependencies
+// Package depgraph analyzes Rocq Makefile dependencies, as generated by
+// `rocq dep` (typically in .rocqdeps.d).
 //
-// Processes files generated by `rocq dep`.
+// A [Graph] holds the dependencies between arbitrary files (nodes), as parsed
+// from a Makefile-style .d file by [Parse] or built with [Graph.AddEdge]. Its
+// queries ([Graph.Deps], [Graph.Targets], [Graph.TopoSort], and iteration
+// with [Graph.Nodes] and [Graph.Edges]) are deterministic: results follow the
+// order in which nodes and edges were added, so the same input always gives
+// the same output.
+//
+// A [FileGraph] is a simpler view of the dependencies between Rocq .v files,
+// obtained with [RocqFileGraph], which most of the Rocq-specific analyses
+// (such as [FileGraph.Stats] and [FileGraph.Shard]) work on.
 package depgraph
 
 import (
 	"bufio"
 	"io"
+	"iter"
+	"path/filepath"
 	"slices"
 	"strings"
-
-	orderedmap "github.com/pb33f/ordered-map/v2"
 )
 
 // This file implements generic algorithms for Makefile dependencies (not specialized to Rocq)
 
+// Dep is an edge of a Graph: Target depends on Source.
 type Dep struct {
 	Target string
 	Source string
 }
 
+// Graph is a dependency graph between files. Each file (node) is interned
+// as a small integer, so that large graphs (like Perennial's, with tens of
+// thousands of dependencies) take little memory and are fast to traverse.
+//
+// The zero value is not usable; create graphs with NewGraph or Parse. A Graph
+// may be queried concurrently, but not while it is being modified.
 type Graph struct {
-	deps  []Dep
-	nodes *orderedmap.OrderedMap[string, struct{}]
+	// names of the nodes, indexed by ID, in order of first appearance
+	names []string
+	ids   map[string]nodeID
+	edges []edge
+}
+
+// nodeID identifies a node in a Graph
+type nodeID int32
+
+// edge records that target depends on source
+type edge struct {
+	target, source nodeID
+}
+
+// NewGraph creates an empty graph.
+func NewGraph() *Graph {
+	return &Graph{ids: make(map[string]nodeID)}
+}
+
+// node returns the ID for name, adding it to the graph if needed.
+func (g *Graph) node(name string) nodeID {
+	if id, ok := g.ids[name]; ok {
+		return id
+	}
+	id := nodeID(len(g.names))
+	g.names = append(g.names, name)
+	g.ids[name] = id
+	return id
 }
 
+// AddNode adds a file to the graph without any dependencies, if it is not
+// already there.
+func (g *Graph) AddNode(name string) {
+	g.node(name)
+}
+
+// AddEdge records that target depends on source, adding both to the graph if
+// needed. Adding an edge again records it twice (as Parse does for repeated
+// rules); queries are not affected by duplicate edges.
+func (g *Graph) AddEdge(target, source string) {
+	g.edges = append(g.edges, edge{target: g.node(target), source: g.node(source)})
+}
+
+// Len returns the number of edges in the graph.
 func (g *Graph) Len() int {
-	return len(g.deps)
+	return len(g.edges)
+}
+
+// NumNodes returns the number of nodes in the graph.
+func (g *Graph) NumNodes() int {
+	return len(g.names)
+}
+
+// HasNode reports if name is a node of the graph.
+func (g *Graph) HasNode(name string) bool {
+	_, ok := g.ids[name]
+	return ok
+}
+
+// Nodes iterates over the nodes of the graph, in the order they were added.
+func (g *Graph) Nodes() iter.Seq[string] {
+	return slices.Values(g.names)
+}
+
+// Edges iterates over the edges of the graph, in the order they were added.
+func (g *Graph) Edges() iter.Seq[Dep] {
+	return func(yield func(Dep) bool) {
+		for _, e := range g.edges {
+			if !yield(Dep{Target: g.names[e.target], Source: g.names[e.source]}) {
+				return
+			}
+		}
+	}
 }
 
 // allDeps is for testing
 func (g *Graph) allDeps() []Dep {
-	return g.deps
+	return slices.Collect(g.Edges())
+}
+
+// adjacency returns the sources of each node's dependencies (or with
+// reverse, the targets that depend on it), in the order of the edges.
+func (g *Graph) adjacency(reverse bool) [][]nodeID {
+	adj := make([][]nodeID, len(g.names))
+	for _, e := range g.edges {
+		if reverse {
+			adj[e.source] = append(adj[e.source], e.target)
+		} else {
+			adj[e.target] = append(adj[e.target], e.source)
+		}
+	}
+	return adj
+}
+
+// rules splits a .d file into lines, joining each line that ends with a
+// backslash with the next one (as make does for long rules).
+func rules(scanner *bufio.Scanner) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		var rule strings.Builder
+		for scanner.Scan() {
+			line := scanner.Text()
+			if prefix, ok := strings.CutSuffix(line, "\\"); ok {
+				rule.WriteString(prefix + " ")
+				continue
+			}
+			rule.WriteString(line)
+			if !yield(rule.String()) {
+				return
+			}
+			rule.Reset()
+		}
+		// the last line ended with a backslash
+		if rule.Len() > 0 {
+			yield(rule.String())
+		}
+	}
+}
+
+// splitRule splits a rule "target1 target2: dep1 dep2" into its targets and
+// dependencies, returning false if it has no colon. Paths may contain spaces
+// (or colons) if they are escaped with a backslash, as coqdep does, or quoted.
+func splitRule(line string) (targets, deps []string, ok bool) {
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	endWord := func() {
+		if inWord {
+			if ok {
+				deps = append(deps, word.String())
+			} else {
+				targets = append(targets, word.String())
+			}
+		}
+		word.Reset()
+		inWord = false
+	}
+	for _, c := range line {
+		switch {
+		case escaped:
+			escaped = false
+			if !strings.ContainsRune(" \t:\\#\"'", c) {
+				// not an escape, such as in a Windows path
+				word.WriteRune('\\')
+			}
+			word.WriteRune(c)
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t':
+			endWord()
+		case c == ':' && !ok:
+			endWord()
+			ok = true
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if escaped {
+		word.WriteRune('\\')
+	}
+	endWord()
+	return targets, deps, ok
 }
 
-// Parse dependencies from a .d file
+// Parse reads the dependencies from a Makefile-style .d file, with rules of
+// the form "target1 target2: dep1 dep2". Nodes and edges are added in the
+// order they appear in the file.
 func Parse(r io.Reader) (*Graph, error) {
 	scanner := bufio.NewScanner(r)
-	var deps []Dep
-	nodes := orderedmap.New[string, struct{}]()
-
-	for scanner.Scan() {
-		line := scanner.Text()
+	g := NewGraph()
 
+	for line := range rules(scanner) {
 		// Skip empty lines and comments
 		line = strings.TrimSpace(line)
 		if line == "" || strings.HasPrefix(line, "#") {
@@ -49,23 +227,16 @@ func Parse(r io.Reader) (*Graph, error) {
 		}
 
 		// Parse "target1 target2: dep1 dep2 dep3" format
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) != 2 {
+		targets, dependencies, ok := splitRule(line)
+		if !ok {
 			continue
 		}
 
-		targets := strings.Fields(parts[0])
-		dependencies := strings.Fields(parts[1])
-
 		// Create a Dep for each (dependency, target) pair
 		for _, target := range targets {
-			nodes.Set(target, struct{}{})
+			g.AddNode(target)
 			for _, dep := range dependencies {
-				deps = append(deps, Dep{
-					Target: target,
-					Source: dep,
-				})
-				nodes.Set(dep, struct{}{})
+				g.AddEdge(target, dep)
 			}
 		}
 	}
@@ -74,98 +245,126 @@ func Parse(r io.Reader) (*Graph, error) {
 		return nil, err
 	}
 
-	return &Graph{deps: deps, nodes: nodes}, nil
+	return g, nil
+}
+
+// rename creates a graph with the nodes of g renamed by rename (which may
+// merge nodes) and only the nodes for which keep returns true.
+func (g *Graph) rename(rename func(string) string, keep func(string) bool) *Graph {
+	renamed := NewGraph()
+	newIDs := make([]nodeID, len(g.names))
+	for id, name := range g.names {
+		newIDs[id] = -1
+		if keep(name) {
+			newIDs[id] = renamed.node(rename(name))
+		}
+	}
+	for _, e := range g.edges {
+		if newIDs[e.target] >= 0 && newIDs[e.source] >= 0 {
+			renamed.edges = append(renamed.edges, edge{target: newIDs[e.target], source: newIDs[e.source]})
+		}
+	}
+	return renamed
 }
 
+// FilterNodes removes the nodes for which keep returns false, along with
+// their edges. The remaining nodes and edges keep their order.
 func (g *Graph) FilterNodes(keep func(string) bool) {
-	var filteredDeps []Dep
-	for _, dep := range g.deps {
-		if keep(dep.Target) && keep(dep.Source) {
-			filteredDeps = append(filteredDeps, dep)
+	*g = *g.rename(func(name string) string { return name }, keep)
+}
+
+// Merge combines several graphs into one with all of their dependencies.
+func Merge(graphs ...*Graph) *Graph {
+	merged := NewGraph()
+	for _, g := range graphs {
+		for _, name := range g.names {
+			merged.node(name)
+		}
+		for _, e := range g.edges {
+			merged.AddEdge(g.names[e.target], g.names[e.source])
 		}
 	}
-	for node := range g.nodes.KeysFromOldest() {
-		if !keep(node) {
-			g.nodes.Delete(node)
+	return merged
+}
+
+// Rebase rewrites the relative paths in g, which are relative to dir, to be
+// relative to the current directory instead: for example, src/a.vo becomes
+// dir/src/a.vo, and ../lib/b.vo becomes lib/b.vo if dir is a subdirectory.
+// Absolute paths are unchanged.
+func (g *Graph) Rebase(dir string) {
+	rebase := func(name string) string {
+		if filepath.IsAbs(name) {
+			return name
 		}
+		return filepath.Join(dir, name)
 	}
-	g.deps = filteredDeps
+	*g = *g.rename(rebase, func(string) bool { return true })
 }
 
+// DepChain is a chain of dependencies, from a target to a file without
+// dependencies, where each file depends on the next.
 type DepChain struct {
 	// starts with target and ends with final source
 	path []string
 }
 
+// Targets returns the files of the chain that depend on the next one (all
+// but the last).
 func (c DepChain) Targets() []string {
 	return c.path[:len(c.path)-1]
 }
 
+// Sources returns the files of the chain that the previous one depends on
+// (all but the first).
 func (c DepChain) Sources() []string {
 	return c.path[1:]
 }
 
+// Source returns the last file of the chain, which has no dependencies.
 func (c DepChain) Source() string {
 	return c.path[len(c.path)-1]
 }
 
-// Deps gets all transitive dependencies of targets
+// Deps gets all transitive dependencies of targets, as the chains from the
+// targets to each reachable file without dependencies (along a shortest path,
+// in breadth-first order). Every dependency is on some chain. Targets that
+// are not nodes of the graph are ignored.
 func (g *Graph) Deps(targets []string) []DepChain {
 	// Build adjacency list: target -> list of sources
-	adjacency := orderedmap.New[string, []string]()
-	for _, dep := range g.deps {
-		sources, _ := adjacency.Get(dep.Target)
-		adjacency.Set(dep.Target, append(sources, dep.Source))
-	}
+	adjacency := g.adjacency(false)
 
-	var chains []DepChain
-	visited := make(map[string]bool)
-	addedSources := make(map[string]bool)
-
-	// BFS with path tracking
-	type queueItem struct {
-		node string
-		path []string
-	}
-	var queue []queueItem
+	var targetIDs []nodeID
 	for _, target := range targets {
-		queue = append(queue, queueItem{node: target, path: []string{target}})
-		visited[target] = true
-	}
-
-	for len(queue) > 0 {
-		item := queue[0]
-		queue = queue[1:]
-
-		sources, hasDeps := adjacency.Get(item.node)
-		if !hasDeps {
-			// Leaf node - this is a complete dependency chain
-			if len(item.path) > 1 {
-				// Only add chains that have at least one dependency
-				source := item.path[len(item.path)-1]
-				if !addedSources[source] {
-					addedSources[source] = true
-					chains = append(chains, DepChain{path: slices.Clone(item.path)})
-				}
-			}
-			continue
+		// a target that is not a node has no dependencies
+		if id, ok := g.ids[target]; ok {
+			targetIDs = append(targetIDs, id)
 		}
+	}
+	order, parent := bfs(targetIDs, adjacency)
+	pathTo := func(id nodeID) []string {
+		var path []string
+		for ; id >= 0; id = parent[id] {
+			path = append(path, g.names[id])
+		}
+		slices.Reverse(path)
+		return path
+	}
 
-		// Visit all dependencies
-		for _, source := range sources {
-			newPath := append(slices.Clone(item.path), source)
-
-			if !visited[source] {
-				visited[source] = true
-				queue = append(queue, queueItem{node: source, path: newPath})
-			}
+	var chains []DepChain
+	for _, node := range order {
+		// Leaf nodes complete a dependency chain; only add chains that have
+		// at least one dependency
+		if len(adjacency[node]) == 0 && parent[node] >= 0 {
+			chains = append(chains, DepChain{path: pathTo(node)})
 		}
 	}
 
 	return chains
 }
 
-// Targets returns all nodes that transitively depend on any of the sources.
+// Targets returns all nodes that transitively depend on any of the sources
+// (not including the sources themselves), in breadth-first order. Sources
+// that are not nodes of the graph are ignored.
 func (g *Graph) Targets(sources []string) []string {
 	// This is not simply Deps() on the reverse-dependency graph: that returns
 	// de-duplicated DepChains
@@ -173,39 +372,74 @@ func (g *Graph) Targets(sources []string) []string {
 	// returns ALL reachable nodes in the reverse dependency graph.
 
 	// Build adjacency list for reverse dependencies
-	adjacency := orderedmap.New[string, []string]()
-	for _, dep := range g.deps {
-		// dep.Target depends on dep.Source
-		// So dep.Source is depended on by dep.Target
-		targets, _ := adjacency.Get(dep.Source)
-		adjacency.Set(dep.Source, append(targets, dep.Target))
-	}
+	adjacency := g.adjacency(true)
 
-	// BFS to find all reachable nodes
-	seen := orderedmap.New[string, struct{}]()
-	visited := make(map[string]bool)
-	queue := slices.Clone(sources)
+	var sourceIDs []nodeID
 	for _, src := range sources {
-		visited[src] = true
+		if id, ok := g.ids[src]; ok {
+			sourceIDs = append(sourceIDs, id)
+		}
+	}
+	// BFS to find all reachable nodes
+	order, parent := bfs(sourceIDs, adjacency)
+	var seen []string
+	for _, node := range order {
+		// skip the sources
+		if parent[node] >= 0 {
+			seen = append(seen, g.names[node])
+		}
 	}
 
-	for len(queue) > 0 {
-		node := queue[0]
-		queue = queue[1:]
+	return seen
+}
 
-		dependents, hasDeps := adjacency.Get(node)
-		if !hasDeps {
-			continue
+// TopoSort orders the nodes of g so that each node comes after its
+// dependencies. The order is otherwise determined by the order nodes and
+// edges were added: nodes are visited in order, each after its dependencies
+// (in the order of their edges).
+//
+// It returns a *CycleError if the dependencies have a cycle.
+func (g *Graph) TopoSort() ([]string, error) {
+	const (
+		unvisited = iota
+		onPath
+		finished
+	)
+	adjacency := g.adjacency(false)
+	state := make([]int, len(g.names))
+	sorted := make([]string, 0, len(g.names))
+	// path is the current DFS path, to report a cycle
+	var path []nodeID
+	var visit func(id nodeID) *CycleError
+	visit = func(id nodeID) *CycleError {
+		state[id] = onPath
+		path = append(path, id)
+		for _, dep := range adjacency[id] {
+			switch state[dep] {
+			case onPath:
+				start := slices.Index(path, dep)
+				var cycle []string
+				for _, node := range append(path[start:], dep) {
+					cycle = append(cycle, g.names[node])
+				}
+				return &CycleError{Cycle: cycle}
+			case unvisited:
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
 		}
-
-		for _, dependent := range dependents {
-			if !visited[dependent] {
-				visited[dependent] = true
-				queue = append(queue, dependent)
-				seen.Set(dependent, struct{}{})
+		path = path[:len(path)-1]
+		state[id] = finished
+		sorted = append(sorted, g.names[id])
+		return nil
+	}
+	for id := range g.names {
+		if state[id] == unvisited {
+			if err := visit(nodeID(id)); err != nil {
+				return nil, err
 			}
 		}
 	}
-
-	return slices.Collect(seen.KeysFromOldest())
+	return sorted, nil
 }
@@ -1,10 +1,12 @@
 package depgraph
 
 import (
+	"slices"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParse(t *testing.T) {
@@ -53,3 +55,109 @@ target2: dep2
 	assert.Contains(t, g.allDeps(), Dep{Target: "target1", Source: "dep1"})
 	assert.Contains(t, g.allDeps(), Dep{Target: "target2", Source: "dep2"})
 }
+
+func TestMergeAndRebase(t *testing.T) {
+	code, err := Parse(strings.NewReader("src/a.vo: src/a.v\n"))
+	require.NoError(t, err)
+	proof, err := Parse(strings.NewReader("src/b.vo: src/b.v ../code/src/a.vo /lib/c.vo\n"))
+	require.NoError(t, err)
+	code.Rebase("code")
+	proof.Rebase("proof")
+	g := Merge(code, proof)
+	filterRocq(g)
+	assert.Equal(t, []string{"/lib/c.v", "code/src/a.v", "proof/src/b.v"}, RocqFileGraph(g, nil).Files)
+	assert.Equal(t, []string{"proof/src/b.v"}, RocqTargets(g, []string{"code/src/a.v"}))
+	assert.Contains(t, g.allDeps(), Dep{Target: "proof/src/b.vo", Source: "/lib/c.vo"})
+}
+
+func TestParseContinuations(t *testing.T) {
+	input := `a.vo a.glob: a.v \
+  b.vo \
+  c.vo
+d.vo: d.v \
+`
+	g, err := Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, []Dep{
+		{Target: "a.vo", Source: "a.v"},
+		{Target: "a.vo", Source: "b.vo"},
+		{Target: "a.vo", Source: "c.vo"},
+		{Target: "a.glob", Source: "a.v"},
+		{Target: "a.glob", Source: "b.vo"},
+		{Target: "a.glob", Source: "c.vo"},
+		{Target: "d.vo", Source: "d.v"},
+	}, g.allDeps())
+}
+
+func TestParseEscapedPaths(t *testing.T) {
+	input := `my\ proofs/a.vo: my\ proofs/a.v "my proofs/b.vo" 'lib/c d.vo' weird\:name.vo
+`
+	g, err := Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, []Dep{
+		{Target: "my proofs/a.vo", Source: "my proofs/a.v"},
+		{Target: "my proofs/a.vo", Source: "my proofs/b.vo"},
+		{Target: "my proofs/a.vo", Source: "lib/c d.vo"},
+		{Target: "my proofs/a.vo", Source: "weird:name.vo"},
+	}, g.allDeps())
+}
+
+func TestSplitRule(t *testing.T) {
+	targets, deps, ok := splitRule(`a.vo  a.glob :b.v	c.vo`)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a.vo", "a.glob"}, targets)
+	assert.Equal(t, []string{"b.v", "c.vo"}, deps)
+
+	// backslashes that do not escape anything are kept
+	targets, deps, ok = splitRule(`a.vo: dir\a.v`)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a.vo"}, targets)
+	assert.Equal(t, []string{`dir\a.v`}, deps)
+
+	_, _, ok = splitRule("no rule here")
+	assert.False(t, ok)
+
+	// an empty rule has targets but no dependencies
+	targets, deps, ok = splitRule("a.vo:")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a.vo"}, targets)
+	assert.Empty(t, deps)
+}
+
+func TestGraphAPI(t *testing.T) {
+	g := NewGraph()
+	g.AddNode("a")
+	g.AddEdge("b", "a")
+	g.AddEdge("c", "b")
+	g.AddEdge("c", "a")
+	g.AddNode("a")
+	assert.Equal(t, 3, g.NumNodes())
+	assert.Equal(t, 3, g.Len())
+	assert.True(t, g.HasNode("c"))
+	assert.False(t, g.HasNode("d"))
+	assert.Equal(t, []string{"a", "b", "c"}, slices.Collect(g.Nodes()))
+	assert.Equal(t, []Dep{
+		{Target: "b", Source: "a"},
+		{Target: "c", Source: "b"},
+		{Target: "c", Source: "a"},
+	}, slices.Collect(g.Edges()))
+	assert.Equal(t, []string{"b", "c"}, g.Targets([]string{"a"}))
+}
+
+func TestGraphTopoSort(t *testing.T) {
+	g := NewGraph()
+	g.AddEdge("top", "mid2")
+	g.AddEdge("top", "mid1")
+	g.AddEdge("mid1", "base")
+	g.AddEdge("mid2", "base")
+	g.AddNode("other")
+	sorted, err := g.TopoSort()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"base", "mid2", "mid1", "top", "other"}, sorted)
+
+	g.AddEdge("base", "top")
+	_, err = g.TopoSort()
+	var cycleErr *CycleError
+	require.ErrorAs(t, err, &cycleErr)
+	assert.Equal(t, []string{"top", "mid2", "base", "top"}, cycleErr.Cycle)
+}
@@ -0,0 +1,75 @@
+package depgraph
+
+import (
+	"cmp"
+	"slices"
+)
+
+// GraphDiff is the difference between two versions of a FileGraph, such as
+// before and after a refactor.
+type GraphDiff struct {
+	AddedFiles   []string
+	RemovedFiles []string
+	// dependencies, where Target depends on Source
+	AddedDeps   []Dep
+	RemovedDeps []Dep
+}
+
+// Empty reports if there are no differences.
+func (d GraphDiff) Empty() bool {
+	return len(d.AddedFiles) == 0 && len(d.RemovedFiles) == 0 &&
+		len(d.AddedDeps) == 0 && len(d.RemovedDeps) == 0
+}
+
+// Diff finds the files and dependencies added and removed from old to new,
+// each in sorted order.
+func Diff(old, new *FileGraph) GraphDiff {
+	files := func(g *FileGraph) map[string]bool {
+		set := make(map[string]bool)
+		for _, file := range g.Files {
+			set[file] = true
+		}
+		return set
+	}
+	deps := func(g *FileGraph) map[Dep]bool {
+		set := make(map[Dep]bool)
+		for target, sources := range g.Deps {
+			for _, source := range sources {
+				set[Dep{Target: target, Source: source}] = true
+			}
+		}
+		return set
+	}
+	oldFiles, newFiles := files(old), files(new)
+	oldDeps, newDeps := deps(old), deps(new)
+
+	var d GraphDiff
+	for file := range newFiles {
+		if !oldFiles[file] {
+			d.AddedFiles = append(d.AddedFiles, file)
+		}
+	}
+	for file := range oldFiles {
+		if !newFiles[file] {
+			d.RemovedFiles = append(d.RemovedFiles, file)
+		}
+	}
+	for dep := range newDeps {
+		if !oldDeps[dep] {
+			d.AddedDeps = append(d.AddedDeps, dep)
+		}
+	}
+	for dep := range oldDeps {
+		if !newDeps[dep] {
+			d.RemovedDeps = append(d.RemovedDeps, dep)
+		}
+	}
+	compareDeps := func(a, b Dep) int {
+		return cmp.Or(cmp.Compare(a.Target, b.Target), cmp.Compare(a.Source, b.Source))
+	}
+	slices.Sort(d.AddedFiles)
+	slices.Sort(d.RemovedFiles)
+	slices.SortFunc(d.AddedDeps, compareDeps)
+	slices.SortFunc(d.RemovedDeps, compareDeps)
+	return d
+}
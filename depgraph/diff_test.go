@@ -0,0 +1,28 @@
+package depgraph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	old := exampleFileGraph()
+	new := &FileGraph{
+		Files: []string{"A.v", "B.v", "C.v", "D.v", "F.v"},
+		Deps: map[string][]string{
+			"A.v": {"B.v"},
+			"B.v": {"D.v", "F.v"},
+			"C.v": {"D.v"},
+		},
+	}
+	d := Diff(old, new)
+	assert.Equal(t, GraphDiff{
+		AddedFiles:   []string{"F.v"},
+		RemovedFiles: []string{"E.v"},
+		AddedDeps:    []Dep{{Target: "B.v", Source: "F.v"}},
+		RemovedDeps:  []Dep{{Target: "A.v", Source: "C.v"}},
+	}, d)
+	assert.False(t, d.Empty())
+	assert.True(t, Diff(old, old).Empty())
+}
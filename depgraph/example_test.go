@@ -0,0 +1,46 @@
+package depgraph_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mit-pdos/perennial-cli/depgraph"
+)
+
+func ExampleParse() {
+	g, err := depgraph.Parse(strings.NewReader(`
+a.vo: a.v b.vo c.vo
+b.vo: b.v c.vo
+c.vo: c.v
+`))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(g.Targets([]string{"c.vo"}))
+	// Output: [a.vo b.vo]
+}
+
+func ExampleGraph_TopoSort() {
+	g := depgraph.NewGraph()
+	g.AddEdge("proof.vo", "code.vo")
+	g.AddEdge("proof.vo", "lib.vo")
+	g.AddEdge("code.vo", "lib.vo")
+	order, err := g.TopoSort()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(order)
+	// Output: [lib.vo code.vo proof.vo]
+}
+
+func ExampleGraph_Edges() {
+	g := depgraph.NewGraph()
+	g.AddEdge("b.vo", "a.vo")
+	g.AddEdge("c.vo", "b.vo")
+	for dep := range g.Edges() {
+		fmt.Printf("%s -> %s\n", dep.Target, dep.Source)
+	}
+	// Output:
+	// b.vo -> a.vo
+	// c.vo -> b.vo
+}
@@ -0,0 +1,147 @@
+package depgraph
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteDot writes g in the Graphviz DOT language, with an edge from each
+// file to each of its dependencies.
+func WriteDot(w io.Writer, g *FileGraph) error {
+	if _, err := fmt.Fprintln(w, "digraph deps {"); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "  node [shape=box];")
+	for _, file := range g.Files {
+		deps := g.Deps[file]
+		if len(deps) == 0 {
+			// declare the node so that files without dependencies appear
+			fmt.Fprintf(w, "  %s;\n", strconv.Quote(file))
+		}
+		for _, dep := range deps {
+			fmt.Fprintf(w, "  %s -> %s;\n", strconv.Quote(file), strconv.Quote(dep))
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// fileDeps is the JSON representation of a file in a FileGraph
+type fileDeps struct {
+	File string   `json:"file"`
+	Deps []string `json:"deps"`
+}
+
+// WriteJSON writes g as a JSON array of objects {"file": ..., "deps": [...]},
+// one for each file, listing the files it directly depends on.
+func WriteJSON(w io.Writer, g *FileGraph) error {
+	files := make([]fileDeps, 0, len(g.Files))
+	for _, file := range g.Files {
+		deps := g.Deps[file]
+		if deps == nil {
+			deps = []string{}
+		}
+		files = append(files, fileDeps{File: file, Deps: deps})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(files)
+}
+
+// WriteMermaid writes g as a Mermaid flowchart, with an arrow from each file
+// to each of its dependencies.
+func WriteMermaid(w io.Writer, g *FileGraph) error {
+	if _, err := fmt.Fprintln(w, "flowchart TD"); err != nil {
+		return err
+	}
+	// file names are not valid node ids, so nodes are numbered and labeled
+	// with their file
+	ids := make(map[string]string, len(g.Files))
+	for i, file := range g.Files {
+		ids[file] = fmt.Sprintf("n%d", i)
+		label := strings.ReplaceAll(file, `"`, "#quot;")
+		fmt.Fprintf(w, "  %s[\"%s\"]\n", ids[file], label)
+	}
+	for _, file := range g.Files {
+		for _, dep := range g.Deps[file] {
+			fmt.Fprintf(w, "  %s --> %s\n", ids[file], ids[dep])
+		}
+	}
+	return nil
+}
+
+// graphML is the GraphML document written by WriteGraphML
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Key     graphMLKey   `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID    string      `xml:"id,attr"`
+	Label graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLEdge struct {
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+}
+
+// WriteGraphML writes g in GraphML, for tools like Gephi and yEd, with an
+// edge from each file to each of its dependencies. Nodes are labeled with
+// their file in a "label" attribute.
+func WriteGraphML(w io.Writer, g *FileGraph) error {
+	doc := graphML{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Key:   graphMLKey{ID: "label", For: "node", AttrName: "label", AttrType: "string"},
+		Graph: graphMLGraph{ID: "deps", EdgeDefault: "directed"},
+	}
+	// node ids cannot contain slashes, so nodes are numbered
+	ids := make(map[string]string, len(g.Files))
+	for i, file := range g.Files {
+		ids[file] = fmt.Sprintf("n%d", i)
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID:    ids[file],
+			Label: graphMLData{Key: "label", Value: file},
+		})
+	}
+	for _, file := range g.Files {
+		for _, dep := range g.Deps[file] {
+			doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{Source: ids[file], Target: ids[dep]})
+		}
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,92 @@
+package depgraph
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exampleFileGraph is a diamond (A depends on B and C, which both depend on
+// D) along with a file E without dependencies
+func exampleFileGraph() *FileGraph {
+	return &FileGraph{
+		Files: []string{"A.v", "B.v", "C.v", "D.v", "E.v"},
+		Deps: map[string][]string{
+			"A.v": {"B.v", "C.v"},
+			"B.v": {"D.v"},
+			"C.v": {"D.v"},
+		},
+	}
+}
+
+func TestWriteDot(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, WriteDot(&b, exampleFileGraph()))
+	assert.Equal(t, `digraph deps {
+  node [shape=box];
+  "A.v" -> "B.v";
+  "A.v" -> "C.v";
+  "B.v" -> "D.v";
+  "C.v" -> "D.v";
+  "D.v";
+  "E.v";
+}
+`, b.String())
+}
+
+func TestWriteJSON(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, WriteJSON(&b, exampleFileGraph()))
+	assert.JSONEq(t, `[
+		{"file": "A.v", "deps": ["B.v", "C.v"]},
+		{"file": "B.v", "deps": ["D.v"]},
+		{"file": "C.v", "deps": ["D.v"]},
+		{"file": "D.v", "deps": []},
+		{"file": "E.v", "deps": []}
+	]`, b.String())
+
+	b.Reset()
+	require.NoError(t, WriteJSON(&b, &FileGraph{}))
+	assert.Equal(t, "[]\n", b.String())
+}
+
+func TestWriteMermaid(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, WriteMermaid(&b, exampleFileGraph()))
+	assert.Equal(t, `flowchart TD
+  n0["A.v"]
+  n1["B.v"]
+  n2["C.v"]
+  n3["D.v"]
+  n4["E.v"]
+  n0 --> n1
+  n0 --> n2
+  n1 --> n3
+  n2 --> n3
+`, b.String())
+}
+
+func TestWriteGraphML(t *testing.T) {
+	g := &FileGraph{
+		Files: []string{"A.v", "B&C.v"},
+		Deps:  map[string][]string{"A.v": {"B&C.v"}},
+	}
+	var b strings.Builder
+	require.NoError(t, WriteGraphML(&b, g))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="label" for="node" attr.name="label" attr.type="string"></key>
+  <graph id="deps" edgedefault="directed">
+    <node id="n0">
+      <data key="label">A.v</data>
+    </node>
+    <node id="n1">
+      <data key="label">B&amp;C.v</data>
+    </node>
+    <edge source="n0" target="n1"></edge>
+  </graph>
+</graphml>
+`, b.String())
+}
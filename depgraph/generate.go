@@ -0,0 +1,228 @@
+package depgraph
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// This file implements generating and refreshing .rocqdeps.d with `rocq dep`
+
+// FindProjectFile returns the Rocq project file in dir: _RocqProject, or
+// _CoqProject for older projects.
+func FindProjectFile(dir string) (string, error) {
+	for _, name := range []string{"_RocqProject", "_CoqProject"} {
+		projFile := filepath.Join(dir, name)
+		if _, err := os.Stat(projFile); err == nil {
+			return projFile, nil
+		}
+	}
+	return "", fmt.Errorf("neither _RocqProject nor _CoqProject file found in %s", dir)
+}
+
+// projectWords splits a project file into its arguments, without comments.
+func projectWords(projFile string) ([]string, error) {
+	f, err := os.Open(projFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		words = append(words, strings.Fields(line)...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+// ProjectSources lists the .v files of the project described by projFile: the
+// files it lists, and the .v files under its -Q and -R directories. Paths are
+// relative to the directory of projFile.
+func ProjectSources(projFile string) ([]string, error) {
+	words, err := projectWords(projFile)
+	if err != nil {
+		return nil, err
+	}
+
+	root := filepath.Dir(projFile)
+	var sources []string
+	for i := 0; i < len(words); i++ {
+		switch word := words[i]; {
+		case word == "-Q" || word == "-R":
+			if i+1 >= len(words) {
+				return nil, fmt.Errorf("%s: %s without a directory", projFile, word)
+			}
+			dir := words[i+1]
+			// skip the directory and logical path
+			i += 2
+			files, err := vFilesUnder(root, filepath.Join(root, dir))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", projFile, err)
+			}
+			sources = append(sources, files...)
+		case word == "-I" || word == "-arg":
+			i++
+		case strings.HasSuffix(word, ".v"):
+			sources = append(sources, filepath.Clean(word))
+		}
+	}
+	slices.Sort(sources)
+	return slices.Compact(sources), nil
+}
+
+// vFilesUnder lists the .v files under top, relative to root.
+func vFilesUnder(root, top string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(top, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// skip hidden directories (like .git) and local opam switches
+		if d.IsDir() && p != top && (strings.HasPrefix(d.Name(), ".") || d.Name() == "_opam") {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && strings.HasSuffix(p, ".v") {
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// DiskSources lists the .v files in dir and its subdirectories (other than
+// hidden directories and local opam switches), relative to dir, whether or
+// not they are part of the project.
+func DiskSources(dir string) ([]string, error) {
+	files, err := vFilesUnder(dir, dir)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+// Generate runs rocq dep on the project in dir (configured by its
+// _RocqProject), writing the dependencies to w in the format of .rocqdeps.d.
+func Generate(ctx context.Context, dir string, w io.Writer) error {
+	projFile, err := FindProjectFile(dir)
+	if err != nil {
+		return err
+	}
+	sources, err := ProjectSources(projFile)
+	if err != nil {
+		return err
+	}
+	args := append([]string{"dep", "-vos", "-f", filepath.Base(projFile)}, sources...)
+	cmd := exec.CommandContext(ctx, "rocq", args...)
+	cmd.Dir = dir
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("rocq dep failed: %w", err)
+	}
+	return nil
+}
+
+// GenerateFile runs rocq dep (see Generate) to create or replace the
+// dependency file rocqdepFile, for the project in its directory.
+func GenerateFile(ctx context.Context, rocqdepFile string) error {
+	dir := filepath.Dir(rocqdepFile)
+	// write to a temporary file, so a failure leaves the old file alone
+	f, err := os.CreateTemp(dir, ".rocqdeps-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := Generate(ctx, dir, f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// temporary files are only readable by the user
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), rocqdepFile)
+}
+
+// Stale checks if the dependency file rocqdepFile is older than the project
+// file or any source of the project in its directory, in which case it should
+// be regenerated. It returns a file that is newer, or "" if rocqdepFile is up
+// to date.
+func Stale(rocqdepFile string) (string, error) {
+	info, err := os.Stat(rocqdepFile)
+	if err != nil {
+		return "", err
+	}
+	projFile, err := FindProjectFile(filepath.Dir(rocqdepFile))
+	if err != nil {
+		return "", err
+	}
+	sources, err := ProjectSources(projFile)
+	if err != nil {
+		return "", err
+	}
+	files := []string{projFile}
+	for _, source := range sources {
+		files = append(files, filepath.Join(filepath.Dir(rocqdepFile), source))
+	}
+	for _, file := range files {
+		fileInfo, err := os.Stat(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			// a file listed in the project file may not exist (yet)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if fileInfo.ModTime().After(info.ModTime()) {
+			return file, nil
+		}
+	}
+	return "", nil
+}
+
+// GenerateRocqdep runs rocq dep (see Generate) on the project in dir and
+// parses its output like ParseRocqdep, without writing a dependency file.
+func GenerateRocqdep(ctx context.Context, dir string) (*Graph, error) {
+	return generateRocqdep(ctx, dir, filterRocq)
+}
+
+// GenerateRocqdepVos is like GenerateRocqdep, but parses the output like
+// ParseRocqdepVos.
+func GenerateRocqdepVos(ctx context.Context, dir string) (*Graph, error) {
+	return generateRocqdep(ctx, dir, filterRocqVos)
+}
+
+func generateRocqdep(ctx context.Context, dir string, filter func(*Graph)) (*Graph, error) {
+	var out bytes.Buffer
+	if err := Generate(ctx, dir, &out); err != nil {
+		return nil, err
+	}
+	deps, err := Parse(&out)
+	if err != nil {
+		return nil, err
+	}
+	filter(deps)
+	return deps, nil
+}
@@ -0,0 +1,125 @@
+package depgraph
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFiles creates files (with parent directories) in dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+	}
+}
+
+func TestProjectSources(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"_RocqProject": `# comment
+-Q src Example
+-arg -w -arg -notation-overridden
+extra/b.v
+`,
+		"src/a.v":         "",
+		"src/sub/c.v":     "",
+		"src/notes.txt":   "",
+		"src/.hidden/d.v": "",
+		"extra/b.v":       "",
+		"unlisted/e.v":    "",
+	})
+	projFile, err := FindProjectFile(dir)
+	require.NoError(t, err)
+	sources, err := ProjectSources(projFile)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"extra/b.v", "src/a.v", "src/sub/c.v"}, sources)
+
+	_, err = FindProjectFile(t.TempDir())
+	assert.ErrorContains(t, err, "_RocqProject")
+}
+
+func TestStale(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"_RocqProject": "-Q src Example\n",
+		"src/a.v":      "",
+		".rocqdeps.d":  "src/a.vo: src/a.v\n",
+	})
+	rocqdepFile := filepath.Join(dir, ".rocqdeps.d")
+	past := time.Now().Add(-time.Hour)
+	for _, name := range []string{"_RocqProject", "src/a.v"} {
+		require.NoError(t, os.Chtimes(filepath.Join(dir, name), past, past))
+	}
+	newer, err := Stale(rocqdepFile)
+	require.NoError(t, err)
+	assert.Equal(t, "", newer)
+
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "src/a.v"), time.Now().Add(time.Hour), time.Now().Add(time.Hour)))
+	newer, err = Stale(rocqdepFile)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "src/a.v"), newer)
+}
+
+// useFakeRocq puts a rocq command in the PATH that runs script
+func useFakeRocq(t *testing.T, script string) {
+	bin := t.TempDir()
+	writeFiles(t, bin, map[string]string{"rocq": "#!/bin/sh\n" + script})
+	require.NoError(t, os.Chmod(filepath.Join(bin, "rocq"), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestGenerateFile(t *testing.T) {
+	// prints its arguments as a dependency
+	useFakeRocq(t, "echo \"src/a.vo: $*\"\n")
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"_RocqProject": "-Q src Example\n",
+		"src/a.v":      "",
+	})
+	rocqdepFile := filepath.Join(dir, ".rocqdeps.d")
+	require.NoError(t, GenerateFile(context.Background(), rocqdepFile))
+	contents, err := os.ReadFile(rocqdepFile)
+	require.NoError(t, err)
+	assert.Equal(t, "src/a.vo: dep -vos -f _RocqProject src/a.v\n", string(contents))
+	info, err := os.Stat(rocqdepFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+}
+
+func TestGenerateRocqdep(t *testing.T) {
+	useFakeRocq(t, "echo 'src/a.vo src/a.glob: src/a.v src/b.vo'; echo 'src/b.vo: src/b.v'\n")
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"_RocqProject": "-Q src Example\n",
+		"src/a.v":      "",
+		"src/b.v":      "",
+	})
+	deps, err := GenerateRocqdep(context.Background(), dir)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"src/a.v": {"src/b.v"}}, RocqFileGraph(deps, nil).Deps)
+	_, err = os.Stat(filepath.Join(dir, ".rocqdeps.d"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDiskSources(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"src/a.v":         "",
+		"src/notes.txt":   "",
+		"src/.hidden/d.v": "",
+		"_opam/lib/x.v":   "",
+		"unlisted/e.v":    "",
+	})
+	sources, err := DiskSources(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"src/a.v", "unlisted/e.v"}, sources)
+}
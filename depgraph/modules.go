@@ -0,0 +1,119 @@
+package depgraph
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// This file maps .v files to their logical Rocq module paths, following the
+// -Q and -R options of a project file
+
+// Mapping is a -Q or -R option of a project file, which binds the physical
+// directory Dir (relative to the project file) to the logical path Logical.
+type Mapping struct {
+	Dir     string
+	Logical string
+	// Recursive is set for -R, which also makes the modules in
+	// subdirectories available by their short names
+	Recursive bool
+}
+
+// ProjectMappings returns the -Q and -R mappings of projFile, in order.
+func ProjectMappings(projFile string) ([]Mapping, error) {
+	words, err := projectWords(projFile)
+	if err != nil {
+		return nil, err
+	}
+	var mappings []Mapping
+	for i := 0; i < len(words); i++ {
+		switch word := words[i]; word {
+		case "-Q", "-R":
+			if i+2 >= len(words) {
+				return nil, fmt.Errorf("%s: %s needs a directory and a logical path", projFile, word)
+			}
+			mappings = append(mappings, Mapping{
+				Dir:       filepath.Clean(words[i+1]),
+				Logical:   words[i+2],
+				Recursive: word == "-R",
+			})
+			i += 2
+		case "-I", "-arg":
+			i++
+		}
+	}
+	return mappings, nil
+}
+
+// ModuleName returns the logical module path of file (relative to the
+// project file) according to m, or false if file is not under m.Dir.
+func (m Mapping) ModuleName(file string) (string, bool) {
+	rel, err := filepath.Rel(m.Dir, filepath.Clean(file))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") || !strings.HasSuffix(rel, ".v") {
+		return "", false
+	}
+	parts := strings.Split(strings.TrimSuffix(rel, ".v"), "/")
+	if m.Logical != "" {
+		parts = append([]string{m.Logical}, parts...)
+	}
+	return strings.Join(parts, "."), true
+}
+
+// ModuleCollisions finds the logical module paths that the mappings give to
+// several different files, which Rocq reports as a confusing error only when
+// the module is required. It maps each such module path to its files, sorted.
+// A file mapped to the same module twice (by overlapping mappings) is not a
+// collision.
+func ModuleCollisions(mappings []Mapping, files []string) map[string][]string {
+	modules := make(map[string]map[string]bool)
+	for _, file := range files {
+		for _, m := range mappings {
+			name, ok := m.ModuleName(file)
+			if !ok {
+				continue
+			}
+			if modules[name] == nil {
+				modules[name] = make(map[string]bool)
+			}
+			modules[name][filepath.Clean(file)] = true
+		}
+	}
+	collisions := make(map[string][]string)
+	for name, files := range modules {
+		if len(files) > 1 {
+			collisions[name] = slices.Sorted(maps.Keys(files))
+		}
+	}
+	return collisions
+}
+
+// ResolveModule finds the files among files (relative to the project file)
+// with the logical module path name, such as Perennial.program_proof.wal.proof.
+// As in Require, files under a -R mapping can also be named by a suffix of
+// their module path (like wal.proof), if no module has the full name. Several
+// files are returned if the name is ambiguous, and none if it is unknown.
+func ResolveModule(mappings []Mapping, files []string, name string) []string {
+	var exact, partial []string
+	for _, file := range files {
+		for _, m := range mappings {
+			module, ok := m.ModuleName(file)
+			if !ok {
+				continue
+			}
+			switch {
+			case module == name:
+				exact = append(exact, filepath.Clean(file))
+			case m.Recursive && strings.HasSuffix(module, "."+name):
+				partial = append(partial, filepath.Clean(file))
+			}
+		}
+	}
+	found := exact
+	if len(found) == 0 {
+		found = partial
+	}
+	slices.Sort(found)
+	return slices.Compact(found)
+}
@@ -0,0 +1,79 @@
+package depgraph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectMappings(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"_RocqProject": `-Q src Example
+-R ./external/lib Lib # a vendored library
+-arg -w -arg -notation-overridden
+-I plugin
+extra/b.v
+`,
+	})
+	mappings, err := ProjectMappings(dir + "/_RocqProject")
+	require.NoError(t, err)
+	assert.Equal(t, []Mapping{
+		{Dir: "src", Logical: "Example"},
+		{Dir: "external/lib", Logical: "Lib", Recursive: true},
+	}, mappings)
+}
+
+func TestModuleName(t *testing.T) {
+	m := Mapping{Dir: "src", Logical: "Example"}
+	name, ok := m.ModuleName("src/proof/a.v")
+	assert.True(t, ok)
+	assert.Equal(t, "Example.proof.a", name)
+	_, ok = m.ModuleName("other/a.v")
+	assert.False(t, ok)
+	_, ok = m.ModuleName("srcs/a.v")
+	assert.False(t, ok)
+
+	name, ok = Mapping{Dir: ".", Logical: ""}.ModuleName("./a/b.v")
+	assert.True(t, ok)
+	assert.Equal(t, "a.b", name)
+}
+
+func TestModuleCollisions(t *testing.T) {
+	mappings := []Mapping{
+		{Dir: "src", Logical: "Example"},
+		{Dir: "generated", Logical: "Example"},
+		// overlaps with the first mapping, for the same files
+		{Dir: "src/sub", Logical: "Example.sub"},
+	}
+	files := []string{"src/a.v", "src/b.v", "src/sub/c.v", "generated/a.v", "other/b.v"}
+	assert.Equal(t, map[string][]string{
+		"Example.a": {"generated/a.v", "src/a.v"},
+	}, ModuleCollisions(mappings, files))
+	assert.Empty(t, ModuleCollisions(mappings[:1], files))
+}
+
+func TestResolveModule(t *testing.T) {
+	mappings := []Mapping{
+		{Dir: "src", Logical: "Perennial", Recursive: true},
+		{Dir: "external/iris", Logical: "iris"},
+	}
+	files := []string{
+		"src/program_proof/wal/proof.v",
+		"src/program_proof/wal/invariant.v",
+		"src/program_proof/txn/proof.v",
+		"external/iris/base_logic/lib/invariants.v",
+	}
+	assert.Equal(t, []string{"src/program_proof/wal/proof.v"},
+		ResolveModule(mappings, files, "Perennial.program_proof.wal.proof"))
+	assert.Equal(t, []string{"src/program_proof/wal/proof.v"},
+		ResolveModule(mappings, files, "wal.proof"))
+	assert.Equal(t, []string{"src/program_proof/txn/proof.v", "src/program_proof/wal/proof.v"},
+		ResolveModule(mappings, files, "proof"))
+	assert.Equal(t, []string{"external/iris/base_logic/lib/invariants.v"},
+		ResolveModule(mappings, files, "iris.base_logic.lib.invariants"))
+	// -Q does not allow partial names
+	assert.Empty(t, ResolveModule(mappings, files, "lib.invariants"))
+	assert.Empty(t, ResolveModule(mappings, files, "Perennial.missing"))
+}
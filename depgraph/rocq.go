@@ -1,6 +1,7 @@
 package depgraph
 
 import (
+	"maps"
 	"os"
 	"path/filepath"
 	"slices"
@@ -15,12 +16,37 @@ func filterRocq(deps *Graph) {
 	})
 }
 
+// filterRocqVos is like filterRocq, but also keeps the .vos and .vok files
+// of quick compilation (rocq compile -vos and -vok)
+func filterRocqVos(deps *Graph) {
+	deps.FilterNodes(func(name string) bool {
+		switch filepath.Ext(name) {
+		case ".v", ".vo", ".vos", ".vok":
+			return true
+		}
+		return false
+	})
+}
+
 func setExtension(path string, ext string) string {
 	oldExt := filepath.Ext(path)
 	return strings.TrimSuffix(path, oldExt) + ext
 }
 
+// ParseRocqdep parses a dependency file generated by rocq dep (such as
+// .rocqdeps.d), keeping only the .v and .vo files.
 func ParseRocqdep(rocqdepFileName string) (*Graph, error) {
+	return parseRocqdep(rocqdepFileName, filterRocq)
+}
+
+// ParseRocqdepVos is like ParseRocqdep, but also keeps the .vos and .vok
+// files, for queries about quick compilation (see RocqVosDeps). Their
+// dependencies are only in files generated with rocq dep -vos.
+func ParseRocqdepVos(rocqdepFileName string) (*Graph, error) {
+	return parseRocqdep(rocqdepFileName, filterRocqVos)
+}
+
+func parseRocqdep(rocqdepFileName string, filter func(*Graph)) (*Graph, error) {
 	f, err := os.Open(rocqdepFileName)
 	if err != nil {
 		return nil, err
@@ -30,7 +56,7 @@ func ParseRocqdep(rocqdepFileName string) (*Graph, error) {
 	if err != nil {
 		return nil, err
 	}
-	filterRocq(deps)
+	filter(deps)
 	return deps, nil
 }
 
@@ -39,11 +65,38 @@ func ParseRocqdep(rocqdepFileName string) (*Graph, error) {
 // Args can be a list of .v or .vo files: this function always uses the .vo
 // files for dependencies
 func RocqDeps(deps *Graph, args []string) []string {
+	return rocqDeps(deps, args, ".vo")
+}
+
+// RocqVosDeps gets the dependencies of files in args for quick compilation:
+// the .v files whose .vos files are (transitively) needed to compile the .vos
+// files of args, or to open args in an editor. It requires a graph from
+// ParseRocqdepVos.
+//
+// Args can be .v or .vos files.
+func RocqVosDeps(deps *Graph, args []string) []string {
+	return rocqDeps(deps, args, ".vos")
+}
+
+// HasVos reports if deps has the dependencies of any .vos file, which are
+// needed for RocqVosDeps.
+func HasVos(deps *Graph) bool {
+	for _, e := range deps.edges {
+		if strings.HasSuffix(deps.names[e.target], ".vos") {
+			return true
+		}
+	}
+	return false
+}
+
+// rocqDeps implements RocqDeps and RocqVosDeps, following the dependencies
+// of the files of args with extension ext.
+func rocqDeps(deps *Graph, args []string, ext string) []string {
 	var targets []string
 	for _, arg := range args {
 		target := arg
 		if strings.HasSuffix(arg, ".v") {
-			target = strings.TrimSuffix(arg, ".v") + ".vo"
+			target = strings.TrimSuffix(arg, ".v") + ext
 		}
 		targets = append(targets, target)
 	}
@@ -82,3 +135,359 @@ func RocqTargets(deps *Graph, args []string) []string {
 	}
 	return slices.Collect(seen.KeysFromOldest())
 }
+
+// FileGraph is a dependency graph between .v files, where each file depends
+// on the files whose .vo it requires.
+type FileGraph struct {
+	// Files are the nodes of the graph, sorted
+	Files []string
+	// Deps maps each file to the files it directly depends on, sorted
+	Deps map[string][]string
+}
+
+// RocqFileGraph gets the dependencies between .v files from deps. If files is
+// non-empty, the graph is restricted to those files (which can be .v or .vo
+// files), for example to display the transitive dependencies from RocqDeps.
+func RocqFileGraph(deps *Graph, files []string) *FileGraph {
+	var keep map[string]bool
+	if len(files) > 0 {
+		keep = make(map[string]bool)
+		for _, file := range files {
+			keep[setExtension(file, ".v")] = true
+		}
+	}
+	include := func(file string) bool {
+		return keep == nil || keep[file]
+	}
+
+	g := &FileGraph{Deps: make(map[string][]string)}
+	nodes := make(map[string]bool)
+	for _, node := range deps.names {
+		if file := setExtension(node, ".v"); include(file) {
+			nodes[file] = true
+		}
+	}
+	edges := make(map[Dep]bool)
+	for _, dep := range deps.edges {
+		target, source := deps.names[dep.target], deps.names[dep.source]
+		if !strings.HasSuffix(target, ".vo") || !strings.HasSuffix(source, ".vo") {
+			continue
+		}
+		e := Dep{Target: setExtension(target, ".v"), Source: setExtension(source, ".v")}
+		if include(e.Target) && include(e.Source) && !edges[e] {
+			edges[e] = true
+			g.Deps[e.Target] = append(g.Deps[e.Target], e.Source)
+		}
+	}
+	g.Files = slices.Sorted(maps.Keys(nodes))
+	for _, deps := range g.Deps {
+		slices.Sort(deps)
+	}
+	return g
+}
+
+// TopoSort orders the files of g so that each file comes after its
+// dependencies, which is a valid compilation order. Among files that are
+// ready at the same time, the order of g.Files is preserved.
+//
+// It returns a *CycleError if the dependencies have a cycle.
+func (g *FileGraph) TopoSort() ([]string, error) {
+	// remaining counts the unsorted dependencies of each file
+	remaining := make(map[string]int, len(g.Files))
+	dependents := make(map[string][]string)
+	for _, file := range g.Files {
+		for _, dep := range g.Deps[file] {
+			remaining[file]++
+			dependents[dep] = append(dependents[dep], file)
+		}
+	}
+	sorted := make([]string, 0, len(g.Files))
+	done := make(map[string]bool, len(g.Files))
+	for len(sorted) < len(g.Files) {
+		next := ""
+		for _, file := range g.Files {
+			if !done[file] && remaining[file] == 0 {
+				next = file
+				break
+			}
+		}
+		if next == "" {
+			return nil, &CycleError{Cycle: g.FindCycle()}
+		}
+		done[next] = true
+		sorted = append(sorted, next)
+		for _, file := range dependents[next] {
+			remaining[file]--
+		}
+	}
+	return sorted, nil
+}
+
+// CycleError reports a cycle in the dependencies between files, which
+// happens with stale or hand-edited dependency files.
+type CycleError struct {
+	// Cycle is a path of files, each depending on the next, which starts and
+	// ends with the same file
+	Cycle []string
+}
+
+func (e *CycleError) Error() string {
+	return "dependency cycle: " + strings.Join(e.Cycle, " -> ")
+}
+
+// FindCycle returns a cycle in the dependencies of g (in the form of
+// CycleError.Cycle), or nil if there is none.
+func (g *FileGraph) FindCycle() []string {
+	const (
+		unvisited = iota
+		onPath
+		finished
+	)
+	state := make(map[string]int, len(g.Files))
+	var path []string
+	var visit func(file string) []string
+	visit = func(file string) []string {
+		state[file] = onPath
+		path = append(path, file)
+		for _, dep := range g.Deps[file] {
+			switch state[dep] {
+			case onPath:
+				// the cycle is the part of the path starting at dep
+				start := slices.Index(path, dep)
+				return append(slices.Clone(path[start:]), dep)
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[file] = finished
+		return nil
+	}
+	for _, file := range g.Files {
+		if state[file] == unvisited {
+			if cycle := visit(file); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// ShortestPath returns a shortest chain of dependencies from one file to
+// another (starting with from and ending with to, each file depending on the
+// next), which explains why from transitively depends on to. It returns nil
+// if from does not depend on to.
+func (g *FileGraph) ShortestPath(from, to string) []string {
+	// BFS, recording the file each file was first reached from
+	prev := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		if file == to {
+			var path []string
+			for ; file != ""; file = prev[file] {
+				path = append(path, file)
+			}
+			slices.Reverse(path)
+			return path
+		}
+		for _, dep := range g.Deps[file] {
+			if _, seen := prev[dep]; !seen {
+				prev[dep] = file
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return nil
+}
+
+// RocqDepsWithin is like RocqDeps, but only includes the dependencies at most
+// depth steps away from args (1 for their direct dependencies).
+func RocqDepsWithin(deps *Graph, args []string, depth int) []string {
+	g := RocqFileGraph(deps, nil)
+	return g.within(args, depth, g.Deps, true)
+}
+
+// RocqTargetsWithin is like RocqTargets, but only includes the files that
+// depend on args through at most depth steps (1 for the files that directly
+// depend on them).
+func RocqTargetsWithin(deps *Graph, args []string, depth int) []string {
+	g := RocqFileGraph(deps, nil)
+	dependents := make(map[string][]string)
+	for _, file := range g.Files {
+		for _, dep := range g.Deps[file] {
+			dependents[dep] = append(dependents[dep], file)
+		}
+	}
+	return g.within(args, depth, dependents, false)
+}
+
+// within finds the files reachable from args in at most depth steps along
+// edges, in breadth-first order. The args themselves are included if
+// includeArgs is set.
+func (g *FileGraph) within(args []string, depth int, edges map[string][]string, includeArgs bool) []string {
+	nodes := make(map[string]bool, len(g.Files))
+	for _, file := range g.Files {
+		nodes[file] = true
+	}
+	var found []string
+	dist := make(map[string]int)
+	var queue []string
+	for _, arg := range args {
+		file := setExtension(arg, ".v")
+		if _, seen := dist[file]; seen || !nodes[file] {
+			continue
+		}
+		dist[file] = 0
+		queue = append(queue, file)
+		if includeArgs {
+			found = append(found, file)
+		}
+	}
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		if dist[file] == depth {
+			continue
+		}
+		for _, next := range edges[file] {
+			if _, seen := dist[next]; !seen {
+				dist[next] = dist[file] + 1
+				queue = append(queue, next)
+				found = append(found, next)
+			}
+		}
+	}
+	return found
+}
+
+// Roots returns the files no other file depends on (such as top-level
+// proofs), in the order of g.Files.
+func (g *FileGraph) Roots() []string {
+	dependedOn := make(map[string]bool)
+	for _, deps := range g.Deps {
+		for _, dep := range deps {
+			dependedOn[dep] = true
+		}
+	}
+	var roots []string
+	for _, file := range g.Files {
+		if !dependedOn[file] {
+			roots = append(roots, file)
+		}
+	}
+	return roots
+}
+
+// Unused returns the files no other file depends on, other than the given
+// roots (files that are used on their own, such as top-level proofs), in the
+// order of g.Files. With transitive, it also includes the files that are only
+// needed by unused files: everything the roots do not transitively depend on.
+func (g *FileGraph) Unused(roots []string, transitive bool) []string {
+	isRoot := make(map[string]bool)
+	for _, root := range roots {
+		isRoot[root] = true
+	}
+	if !transitive {
+		var unused []string
+		for _, file := range g.Roots() {
+			if !isRoot[file] {
+				unused = append(unused, file)
+			}
+		}
+		return unused
+	}
+	used := make(map[string]bool)
+	stack := slices.Clone(roots)
+	for len(stack) > 0 {
+		file := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if used[file] {
+			continue
+		}
+		used[file] = true
+		stack = append(stack, g.Deps[file]...)
+	}
+	var unused []string
+	for _, file := range g.Files {
+		if !used[file] {
+			unused = append(unused, file)
+		}
+	}
+	return unused
+}
+
+// Leaves returns the files without dependencies (such as base libraries), in
+// the order of g.Files.
+func (g *FileGraph) Leaves() []string {
+	var leaves []string
+	for _, file := range g.Files {
+		if len(g.Deps[file]) == 0 {
+			leaves = append(leaves, file)
+		}
+	}
+	return leaves
+}
+
+// Missing finds the files of g that do not exist according to exists (a
+// symptom of a stale dependency file, after files are moved or deleted). It
+// maps each missing file to the files that directly depend on it.
+func (g *FileGraph) Missing(exists func(file string) bool) map[string][]string {
+	missing := make(map[string][]string)
+	for _, file := range g.Files {
+		if !exists(file) {
+			missing[file] = nil
+		}
+	}
+	for _, file := range g.Files {
+		for _, dep := range g.Deps[file] {
+			if dependents, ok := missing[dep]; ok {
+				missing[dep] = append(dependents, file)
+			}
+		}
+	}
+	return missing
+}
+
+// External reports if a file in a dependency graph is outside the project
+// root that paths in the graph are relative to, such as a library installed
+// in Rocq's user-contrib that rocq dep found: its path is absolute or starts
+// with "..".
+func External(file string) bool {
+	file = filepath.Clean(file)
+	return filepath.IsAbs(file) || file == ".." || strings.HasPrefix(file, "../")
+}
+
+// Filter returns the subgraph of g with only the files for which keep
+// returns true.
+func (g *FileGraph) Filter(keep func(file string) bool) *FileGraph {
+	filtered := &FileGraph{Deps: make(map[string][]string)}
+	for _, file := range g.Files {
+		if !keep(file) {
+			continue
+		}
+		filtered.Files = append(filtered.Files, file)
+		for _, dep := range g.Deps[file] {
+			if keep(dep) {
+				filtered.Deps[file] = append(filtered.Deps[file], dep)
+			}
+		}
+	}
+	return filtered
+}
+
+// Rename returns a copy of g with each file renamed by rename (which should
+// be one-to-one).
+func (g *FileGraph) Rename(rename func(file string) string) *FileGraph {
+	renamed := &FileGraph{Deps: make(map[string][]string)}
+	for _, file := range g.Files {
+		renamed.Files = append(renamed.Files, rename(file))
+		for _, dep := range g.Deps[file] {
+			renamed.Deps[rename(file)] = append(renamed.Deps[rename(file)], rename(dep))
+		}
+	}
+	return renamed
+}
@@ -244,3 +244,214 @@ D.vo: D.v B.vo
 	targets := RocqTargets(g, []string{"B.vo", "C.vo"})
 	assert.ElementsMatch(t, []string{"A.v", "D.v"}, targets)
 }
+
+func TestRocqFileGraph(t *testing.T) {
+	testData := `A.vo A.glob: A.v B.vo C.vo /usr/lib/rocqworker
+A.vos: A.v B.vos C.vos
+B.vo: B.v D.vo
+C.vo: C.v D.vo
+D.vo: D.v
+E.vo: E.v
+`
+
+	g, err := Parse(strings.NewReader(testData))
+	require.NoError(t, err)
+	filterRocq(g)
+
+	fg := RocqFileGraph(g, nil)
+	assert.Equal(t, []string{"A.v", "B.v", "C.v", "D.v", "E.v"}, fg.Files)
+	assert.Equal(t, map[string][]string{
+		"A.v": {"B.v", "C.v"},
+		"B.v": {"D.v"},
+		"C.v": {"D.v"},
+	}, fg.Deps)
+
+	// restricted to the dependencies of B
+	fg = RocqFileGraph(g, RocqDeps(g, []string{"B.v"}))
+	assert.Equal(t, []string{"B.v", "D.v"}, fg.Files)
+	assert.Equal(t, map[string][]string{"B.v": {"D.v"}}, fg.Deps)
+}
+
+func TestTopoSort(t *testing.T) {
+	testData := `A.vo: A.v B.vo C.vo
+B.vo: B.v D.vo
+C.vo: C.v D.vo
+D.vo: D.v
+E.vo: E.v
+`
+
+	g, err := Parse(strings.NewReader(testData))
+	require.NoError(t, err)
+	filterRocq(g)
+
+	order, err := RocqFileGraph(g, nil).TopoSort()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"D.v", "B.v", "C.v", "A.v", "E.v"}, order)
+
+	order, err = RocqFileGraph(g, RocqDeps(g, []string{"B.v"})).TopoSort()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"D.v", "B.v"}, order)
+}
+
+func TestTopoSortCycle(t *testing.T) {
+	fg := &FileGraph{
+		Files: []string{"A.v", "B.v", "C.v"},
+		Deps:  map[string][]string{"A.v": {"B.v"}, "B.v": {"A.v"}},
+	}
+	_, err := fg.TopoSort()
+	var cycleErr *CycleError
+	require.ErrorAs(t, err, &cycleErr)
+	assert.Equal(t, []string{"A.v", "B.v", "A.v"}, cycleErr.Cycle)
+	assert.EqualError(t, err, "dependency cycle: A.v -> B.v -> A.v")
+}
+
+func TestFindCycle(t *testing.T) {
+	// B -> C -> D -> B is a cycle reachable from A, and E depends on itself
+	testData := `A.vo: A.v B.vo
+B.vo: B.v C.vo
+C.vo: C.v D.vo
+D.vo: D.v B.vo
+E.vo: E.v E.vo
+`
+
+	g, err := Parse(strings.NewReader(testData))
+	require.NoError(t, err)
+	filterRocq(g)
+
+	assert.Equal(t, []string{"B.v", "C.v", "D.v", "B.v"}, RocqFileGraph(g, nil).FindCycle())
+	assert.Equal(t, []string{"E.v", "E.v"}, RocqFileGraph(g, []string{"E.v"}).FindCycle())
+	assert.Nil(t, RocqFileGraph(g, []string{"A.v", "B.v", "C.v"}).FindCycle())
+
+	// the other algorithms terminate despite the cycle
+	assert.ElementsMatch(t, []string{"A.v", "B.v", "C.v", "D.v"}, RocqDeps(g, []string{"A.v"}))
+	assert.ElementsMatch(t, []string{"A.v", "B.v", "C.v"}, RocqTargets(g, []string{"D.v"}))
+}
+
+func TestShortestPath(t *testing.T) {
+	// A reaches D directly through B, or through C and E
+	testData := `A.vo: A.v B.vo C.vo
+B.vo: B.v D.vo
+C.vo: C.v E.vo
+E.vo: E.v D.vo
+D.vo: D.v
+`
+
+	g, err := Parse(strings.NewReader(testData))
+	require.NoError(t, err)
+	filterRocq(g)
+	fg := RocqFileGraph(g, nil)
+
+	assert.Equal(t, []string{"A.v", "B.v", "D.v"}, fg.ShortestPath("A.v", "D.v"))
+	assert.Equal(t, []string{"C.v", "E.v", "D.v"}, fg.ShortestPath("C.v", "D.v"))
+	assert.Equal(t, []string{"A.v"}, fg.ShortestPath("A.v", "A.v"))
+	assert.Nil(t, fg.ShortestPath("D.v", "A.v"))
+}
+
+func TestRocqDepsWithin(t *testing.T) {
+	// a chain A -> B -> C -> D, where A also depends on E
+	testData := `A.vo: A.v B.vo E.vo
+B.vo: B.v C.vo
+C.vo: C.v D.vo
+D.vo: D.v
+E.vo: E.v
+`
+
+	g, err := Parse(strings.NewReader(testData))
+	require.NoError(t, err)
+	filterRocq(g)
+
+	assert.Equal(t, []string{"A.v", "B.v", "E.v"}, RocqDepsWithin(g, []string{"A.vo"}, 1))
+	assert.Equal(t, []string{"A.v", "B.v", "E.v", "C.v"}, RocqDepsWithin(g, []string{"A.v"}, 2))
+	assert.ElementsMatch(t, RocqDeps(g, []string{"A.v"}), RocqDepsWithin(g, []string{"A.v"}, 10))
+
+	assert.Equal(t, []string{"C.v"}, RocqTargetsWithin(g, []string{"D.v"}, 1))
+	assert.Equal(t, []string{"C.v", "B.v"}, RocqTargetsWithin(g, []string{"D.vo"}, 2))
+	assert.ElementsMatch(t, RocqTargets(g, []string{"D.v"}), RocqTargetsWithin(g, []string{"D.v"}, 10))
+}
+
+func TestRootsAndLeaves(t *testing.T) {
+	testData := `A.vo: A.v B.vo C.vo
+B.vo: B.v D.vo
+C.vo: C.v D.vo
+D.vo: D.v
+E.vo: E.v
+`
+
+	g, err := Parse(strings.NewReader(testData))
+	require.NoError(t, err)
+	filterRocq(g)
+	fg := RocqFileGraph(g, nil)
+
+	// E is both: nothing depends on it, and it has no dependencies
+	assert.Equal(t, []string{"A.v", "E.v"}, fg.Roots())
+	assert.Equal(t, []string{"D.v", "E.v"}, fg.Leaves())
+}
+
+func TestMissing(t *testing.T) {
+	g := exampleFileGraph()
+	exists := func(file string) bool { return file != "C.v" && file != "E.v" }
+	assert.Equal(t, map[string][]string{
+		"C.v": {"A.v"},
+		"E.v": nil,
+	}, g.Missing(exists))
+	assert.Empty(t, g.Missing(func(string) bool { return true }))
+}
+
+func TestFileGraphFilter(t *testing.T) {
+	g := exampleFileGraph().Filter(func(file string) bool { return file != "B.v" })
+	assert.Equal(t, []string{"A.v", "C.v", "D.v", "E.v"}, g.Files)
+	assert.Equal(t, map[string][]string{
+		"A.v": {"C.v"},
+		"C.v": {"D.v"},
+	}, g.Deps)
+}
+
+func TestExternal(t *testing.T) {
+	assert.False(t, External("src/a.v"))
+	assert.False(t, External("./src/a.v"))
+	assert.False(t, External("..a.v"))
+	assert.True(t, External("../code/a.v"))
+	assert.True(t, External("src/../../a.v"))
+	assert.True(t, External("/opt/rocq/lib/user-contrib/iris/base.v"))
+}
+
+func TestFileGraphRename(t *testing.T) {
+	g := exampleFileGraph().Rename(func(file string) string { return "src/" + file })
+	assert.Equal(t, []string{"src/A.v", "src/B.v", "src/C.v", "src/D.v", "src/E.v"}, g.Files)
+	assert.Equal(t, map[string][]string{
+		"src/A.v": {"src/B.v", "src/C.v"},
+		"src/B.v": {"src/D.v"},
+		"src/C.v": {"src/D.v"},
+	}, g.Deps)
+}
+
+func TestUnused(t *testing.T) {
+	g := exampleFileGraph()
+	assert.Equal(t, []string{"E.v"}, g.Unused([]string{"A.v"}, false))
+	assert.Equal(t, []string{"A.v", "E.v"}, g.Unused(nil, false))
+	// B.v is only needed by A.v
+	assert.Equal(t, []string{"A.v", "B.v", "E.v"}, g.Unused([]string{"C.v"}, true))
+	assert.Empty(t, g.Unused([]string{"A.v", "E.v"}, false))
+}
+
+func TestRocqVosDeps(t *testing.T) {
+	testData := `A.vo A.glob: A.v B.vo /usr/lib/rocqworker
+A.vos A.vok A.required_vos: A.v B.vos /usr/lib/rocqworker
+B.vo: B.v C.vo
+B.vos B.vok: B.v C.vos
+C.vo: C.v
+C.vos C.vok: C.v
+`
+	g, err := Parse(strings.NewReader(testData))
+	require.NoError(t, err)
+	filterRocqVos(g)
+	assert.True(t, HasVos(g))
+	assert.Equal(t, []string{"A.v", "B.v", "C.v"}, RocqVosDeps(g, []string{"A.v"}))
+	assert.Equal(t, []string{"B.v", "C.v"}, RocqVosDeps(g, []string{"B.vos"}))
+	assert.Contains(t, g.allDeps(), Dep{Target: "A.vok", Source: "B.vos"})
+	// the .vo dependencies are unaffected
+	assert.Equal(t, []string{"A.v", "B.v", "C.v"}, RocqDeps(g, []string{"A.v"}))
+
+	filterRocq(g)
+	assert.False(t, HasVos(g))
+}
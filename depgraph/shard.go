@@ -0,0 +1,65 @@
+package depgraph
+
+// Shard partitions the files of g into n groups of roughly equal total
+// weight, for building or checking them in parallel jobs. weight gives the
+// cost of each file (such as its compile time); if nil, every file costs the
+// same, so the groups have about the same number of files. n must be
+// positive.
+//
+// Each job has to build the dependencies of its files as well, so files are
+// preferably put in the same group as their direct dependencies. Within each
+// group, files are in topological order. Shard returns a *CycleError if the
+// dependencies have a cycle.
+func (g *FileGraph) Shard(n int, weight func(file string) float64) ([][]string, error) {
+	order, err := g.TopoSort()
+	if err != nil {
+		return nil, err
+	}
+	if weight == nil {
+		weight = func(string) float64 { return 1 }
+	}
+	total := 0.0
+	for _, file := range order {
+		total += weight(file)
+	}
+	target := total / float64(n)
+
+	shards := make([][]string, n)
+	load := make([]float64, n)
+	shardOf := make(map[string]int, len(order))
+	affinity := make([]float64, n)
+	for _, file := range order {
+		// dependencies come first in the topological order, so they have
+		// already been assigned
+		clear(affinity)
+		for _, dep := range g.Deps[file] {
+			affinity[shardOf[dep]] += weight(dep)
+		}
+		// choose the shard with the most of the file's dependencies among
+		// those with room for it, breaking ties by load
+		w := weight(file)
+		best := -1
+		for i := range shards {
+			if load[i]+w > target {
+				continue
+			}
+			if best < 0 || affinity[i] > affinity[best] ||
+				(affinity[i] == affinity[best] && load[i] < load[best]) {
+				best = i
+			}
+		}
+		if best < 0 {
+			// no shard has room for the file; use the least loaded
+			best = 0
+			for i := range shards {
+				if load[i] < load[best] {
+					best = i
+				}
+			}
+		}
+		shards[best] = append(shards[best], file)
+		load[best] += w
+		shardOf[file] = best
+	}
+	return shards, nil
+}
@@ -0,0 +1,50 @@
+package depgraph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShard(t *testing.T) {
+	shards, err := exampleFileGraph().Shard(2, nil)
+	require.NoError(t, err)
+	// B goes with its dependency D, but then that shard has no room for C
+	assert.Equal(t, [][]string{{"D.v", "B.v", "E.v"}, {"C.v", "A.v"}}, shards)
+
+	shards, err = exampleFileGraph().Shard(1, nil)
+	require.NoError(t, err)
+	assert.Len(t, shards, 1)
+	assert.Len(t, shards[0], 5)
+}
+
+func TestShardWeighted(t *testing.T) {
+	weights := map[string]float64{"A.v": 1, "B.v": 1, "C.v": 1, "D.v": 1, "E.v": 4}
+	shards, err := exampleFileGraph().Shard(2, func(file string) float64 {
+		return weights[file]
+	})
+	require.NoError(t, err)
+	// E alone is as expensive as all the other files
+	assert.Equal(t, [][]string{{"D.v", "B.v", "C.v", "A.v"}, {"E.v"}}, shards)
+}
+
+func TestShardCycle(t *testing.T) {
+	g := &FileGraph{
+		Files: []string{"A.v", "B.v"},
+		Deps:  map[string][]string{"A.v": {"B.v"}, "B.v": {"A.v"}},
+	}
+	_, err := g.Shard(2, nil)
+	var cycleErr *CycleError
+	assert.ErrorAs(t, err, &cycleErr)
+}
+
+func TestShardLargeFile(t *testing.T) {
+	weights := map[string]float64{"A.v": 1, "B.v": 3, "C.v": 9, "D.v": 3, "E.v": 1}
+	shards, err := exampleFileGraph().Shard(2, func(file string) float64 {
+		return weights[file]
+	})
+	require.NoError(t, err)
+	// C does not fit with its dependency D, so it gets a shard of its own
+	assert.Equal(t, [][]string{{"D.v", "B.v", "A.v", "E.v"}, {"C.v"}}, shards)
+}
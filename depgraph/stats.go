@@ -0,0 +1,161 @@
+package depgraph
+
+import (
+	"cmp"
+	"slices"
+)
+
+// FileCount is a file along with some count, such as its number of
+// dependencies.
+type FileCount struct {
+	File  string
+	Count int
+}
+
+// Stats summarizes the structure of a FileGraph, to help find bottlenecks.
+type Stats struct {
+	Files int
+	Edges int
+	// MaxFanOut is the file with the most direct dependencies
+	MaxFanOut FileCount
+	// MaxFanIn is the file with the most files directly depending on it
+	MaxFanIn FileCount
+	// MostDependedOn are the files with the most files transitively
+	// depending on them, in decreasing order
+	MostDependedOn []FileCount
+	// AvgDepth is the average over all files of their depth, the length of
+	// the longest chain of dependencies starting from the file
+	AvgDepth float64
+	MaxDepth FileCount
+}
+
+// bitset is a set of files, by their index in the topological order
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (s bitset) add(i int) {
+	s[i/64] |= 1 << (i % 64)
+}
+
+func (s bitset) union(other bitset) {
+	for i := range s {
+		s[i] |= other[i]
+	}
+}
+
+func (s bitset) contains(i int) bool {
+	return s[i/64]&(1<<(i%64)) != 0
+}
+
+// Stats computes statistics about g, including the top files that are most
+// depended on. It returns a *CycleError if the dependencies have a cycle.
+func (g *FileGraph) Stats(top int) (Stats, error) {
+	order, err := g.TopoSort()
+	if err != nil {
+		return Stats{}, err
+	}
+	index := make(map[string]int, len(order))
+	for i, file := range order {
+		index[file] = i
+	}
+
+	stats := Stats{Files: len(order)}
+	fanIn := make([]int, len(order))
+	depth := make([]int, len(order))
+	// closure[i] is the set of transitive dependencies of order[i], which
+	// come before it in the topological order
+	closure := make([]bitset, len(order))
+	totalDepth := 0
+	for i, file := range order {
+		deps := g.Deps[file]
+		stats.Edges += len(deps)
+		if len(deps) > stats.MaxFanOut.Count {
+			stats.MaxFanOut = FileCount{File: file, Count: len(deps)}
+		}
+		closure[i] = newBitset(len(order))
+		for _, dep := range deps {
+			j := index[dep]
+			fanIn[j]++
+			depth[i] = max(depth[i], depth[j]+1)
+			closure[i].add(j)
+			closure[i].union(closure[j])
+		}
+		totalDepth += depth[i]
+		if depth[i] > stats.MaxDepth.Count {
+			stats.MaxDepth = FileCount{File: file, Count: depth[i]}
+		}
+	}
+	if len(order) > 0 {
+		stats.AvgDepth = float64(totalDepth) / float64(len(order))
+	}
+
+	dependents := make([]FileCount, len(order))
+	for j, file := range order {
+		if fanIn[j] > stats.MaxFanIn.Count {
+			stats.MaxFanIn = FileCount{File: file, Count: fanIn[j]}
+		}
+		dependents[j] = FileCount{File: file}
+		// only files after j can depend on it
+		for i := j + 1; i < len(order); i++ {
+			if closure[i].contains(j) {
+				dependents[j].Count++
+			}
+		}
+	}
+	slices.SortStableFunc(dependents, func(a, b FileCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.File, b.File))
+	})
+	for _, d := range dependents[:min(top, len(dependents))] {
+		if d.Count > 0 {
+			stats.MostDependedOn = append(stats.MostDependedOn, d)
+		}
+	}
+	return stats, nil
+}
+
+// CriticalPath finds the longest chain of dependencies in g, which bounds how
+// fast a parallel build can be. weight gives the cost of each file (such as
+// its compile time); if nil, every file costs 1, so the critical path is the
+// chain with the most files. It returns the files on the path, each after
+// its dependencies, and their total weight.
+//
+// It returns a *CycleError if the dependencies have a cycle.
+func (g *FileGraph) CriticalPath(weight func(file string) float64) ([]string, float64, error) {
+	order, err := g.TopoSort()
+	if err != nil {
+		return nil, 0, err
+	}
+	if weight == nil {
+		weight = func(string) float64 { return 1 }
+	}
+	// cost[file] is the total weight of the longest chain ending at file, and
+	// prev[file] is the previous file on that chain
+	cost := make(map[string]float64, len(order))
+	prev := make(map[string]string, len(order))
+	end := ""
+	for _, file := range order {
+		longest := 0.0
+		for _, dep := range g.Deps[file] {
+			if cost[dep] > longest {
+				longest = cost[dep]
+				prev[file] = dep
+			}
+		}
+		cost[file] = longest + weight(file)
+		if end == "" || cost[file] > cost[end] {
+			end = file
+		}
+	}
+	if end == "" {
+		return nil, 0, nil
+	}
+	var path []string
+	for file := end; file != ""; file = prev[file] {
+		path = append(path, file)
+	}
+	slices.Reverse(path)
+	return path, cost[end], nil
+}
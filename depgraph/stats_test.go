@@ -0,0 +1,68 @@
+package depgraph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	stats, err := exampleFileGraph().Stats(3)
+	require.NoError(t, err)
+	assert.Equal(t, 5, stats.Files)
+	assert.Equal(t, 4, stats.Edges)
+	assert.Equal(t, FileCount{"A.v", 2}, stats.MaxFanOut)
+	assert.Equal(t, FileCount{"D.v", 2}, stats.MaxFanIn)
+	// A, B, and C all depend on D
+	assert.Equal(t, []FileCount{{"D.v", 3}, {"B.v", 1}, {"C.v", 1}}, stats.MostDependedOn)
+	// depths are A: 2, B: 1, C: 1, D: 0, E: 0
+	assert.InDelta(t, 0.8, stats.AvgDepth, 1e-9)
+	assert.Equal(t, FileCount{"A.v", 2}, stats.MaxDepth)
+}
+
+func TestStatsLarge(t *testing.T) {
+	// a chain of files, each depending on the previous one, with more files
+	// than fit in one word of a bitset
+	g := &FileGraph{Deps: make(map[string][]string)}
+	const n = 150
+	name := func(i int) string { return string(rune('A'+i/26)) + string(rune('a'+i%26)) + ".v" }
+	for i := range n {
+		g.Files = append(g.Files, name(i))
+		if i > 0 {
+			g.Deps[name(i)] = []string{name(i - 1)}
+		}
+	}
+	stats, err := g.Stats(1)
+	require.NoError(t, err)
+	assert.Equal(t, []FileCount{{name(0), n - 1}}, stats.MostDependedOn)
+	assert.Equal(t, FileCount{name(n - 1), n - 1}, stats.MaxDepth)
+}
+
+func TestStatsCycle(t *testing.T) {
+	g := &FileGraph{
+		Files: []string{"A.v", "B.v"},
+		Deps:  map[string][]string{"A.v": {"B.v"}, "B.v": {"A.v"}},
+	}
+	_, err := g.Stats(10)
+	assert.ErrorContains(t, err, "dependency cycle")
+}
+
+func TestCriticalPath(t *testing.T) {
+	path, total, err := exampleFileGraph().CriticalPath(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"D.v", "B.v", "A.v"}, path)
+	assert.Equal(t, 3.0, total)
+
+	weights := map[string]float64{"A.v": 1, "B.v": 1, "C.v": 5, "D.v": 2, "E.v": 7}
+	path, total, err = exampleFileGraph().CriticalPath(func(file string) float64 {
+		return weights[file]
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"D.v", "C.v", "A.v"}, path)
+	assert.Equal(t, 8.0, total)
+
+	path, _, err = (&FileGraph{}).CriticalPath(nil)
+	require.NoError(t, err)
+	assert.Empty(t, path)
+}
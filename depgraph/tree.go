@@ -0,0 +1,86 @@
+package depgraph
+
+import (
+	"bufio"
+	"io"
+	"slices"
+)
+
+// TreeOptions configures WriteTree.
+type TreeOptions struct {
+	// Reverse shows the files that depend on each file, rather than its
+	// dependencies
+	Reverse bool
+	// Depth limits the tree to this many levels below the roots (0 for no
+	// limit)
+	Depth int
+	// ASCII draws the tree with ASCII characters instead of Unicode box
+	// drawing
+	ASCII bool
+}
+
+// tree markers, after a file's name
+const (
+	// the file was already expanded elsewhere in the output
+	sharedMarker = " (*)"
+	// the file depends on itself through its ancestors in the tree
+	cycleMarker = " (cycle)"
+	// the file has children beyond the depth limit
+	truncatedMarker = " (...)"
+)
+
+// WriteTree writes the dependencies of each root in g as a tree, one file per
+// line, for reading by humans. Each file is only expanded the first time it
+// appears; later occurrences are marked with (*), dependencies that form a
+// cycle with (cycle), and files whose children are beyond the depth limit
+// with (...).
+func WriteTree(w io.Writer, g *FileGraph, roots []string, opts TreeOptions) error {
+	children := g.Deps
+	if opts.Reverse {
+		children = make(map[string][]string)
+		for _, file := range g.Files {
+			for _, dep := range g.Deps[file] {
+				children[dep] = append(children[dep], file)
+			}
+		}
+	}
+	branch, last, vertical, space := "├── ", "└── ", "│   ", "    "
+	if opts.ASCII {
+		branch, last, vertical, space = "|-- ", "`-- ", "|   ", "    "
+	}
+
+	bw := bufio.NewWriter(w)
+	expanded := make(map[string]bool)
+	// path is the files from the root to the current one, to detect cycles
+	var path []string
+	var visit func(file, prefix string, depth int)
+	visit = func(file, prefix string, depth int) {
+		switch {
+		case slices.Contains(path, file):
+			bw.WriteString(file + cycleMarker + "\n")
+			return
+		case expanded[file] && len(children[file]) > 0:
+			bw.WriteString(file + sharedMarker + "\n")
+			return
+		case opts.Depth > 0 && depth == opts.Depth && len(children[file]) > 0:
+			bw.WriteString(file + truncatedMarker + "\n")
+			return
+		}
+		bw.WriteString(file + "\n")
+		expanded[file] = true
+		path = append(path, file)
+		for i, child := range children[file] {
+			connector, indent := branch, vertical
+			if i == len(children[file])-1 {
+				connector, indent = last, space
+			}
+			bw.WriteString(prefix + connector)
+			visit(child, prefix+indent, depth+1)
+		}
+		path = path[:len(path)-1]
+	}
+	for _, root := range roots {
+		visit(root, "", 0)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,73 @@
+package depgraph
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTree(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, WriteTree(&b, exampleFileGraph(), []string{"A.v"}, TreeOptions{}))
+	assert.Equal(t, `A.v
+├── B.v
+│   └── D.v
+└── C.v
+    └── D.v
+`, b.String())
+
+	b.Reset()
+	require.NoError(t, WriteTree(&b, exampleFileGraph(), []string{"D.v"}, TreeOptions{Reverse: true, ASCII: true}))
+	assert.Equal(t, "D.v\n"+
+		"|-- B.v\n"+
+		"|   `-- A.v\n"+
+		"`-- C.v\n"+
+		"    `-- A.v\n", b.String())
+
+	b.Reset()
+	require.NoError(t, WriteTree(&b, exampleFileGraph(), []string{"A.v"}, TreeOptions{Depth: 1}))
+	assert.Equal(t, `A.v
+├── B.v (...)
+└── C.v (...)
+`, b.String())
+}
+
+func TestWriteTreeShared(t *testing.T) {
+	g := &FileGraph{
+		Files: []string{"A.v", "B.v", "C.v", "D.v", "E.v"},
+		Deps: map[string][]string{
+			"A.v": {"B.v", "C.v"},
+			"B.v": {"D.v"},
+			"C.v": {"B.v"},
+			"D.v": {"E.v"},
+		},
+	}
+	var b strings.Builder
+	require.NoError(t, WriteTree(&b, g, []string{"A.v", "D.v"}, TreeOptions{}))
+	assert.Equal(t, `A.v
+├── B.v
+│   └── D.v
+│       └── E.v
+└── C.v
+    └── B.v (*)
+D.v (*)
+`, b.String())
+}
+
+func TestWriteTreeCycle(t *testing.T) {
+	g := &FileGraph{
+		Files: []string{"A.v", "B.v"},
+		Deps: map[string][]string{
+			"A.v": {"B.v"},
+			"B.v": {"A.v"},
+		},
+	}
+	var b strings.Builder
+	require.NoError(t, WriteTree(&b, g, []string{"A.v"}, TreeOptions{}))
+	assert.Equal(t, `A.v
+└── B.v
+    └── A.v (cycle)
+`, b.String())
+}
@@ -0,0 +1,113 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// GetArchive downloads a gzipped tarball of a git repository at a specific
+// commit, which is much faster than fetching its files one at a time. The
+// caller must close the returned stream.
+//
+// All files in the archive are under a single top-level directory, whose
+// name depends on the host. The archive is downloaded through the host's API
+// (see Provider), or for other hosts, created with git archive from the clone
+// cache.
+func GetArchive(gitURL, commit string) (io.ReadCloser, error) {
+	return GetArchiveContext(context.Background(), gitURL, commit)
+}
+
+// GetArchiveContext is like GetArchive but cancels the download when ctx is
+// done.
+func GetArchiveContext(ctx context.Context, gitURL, commit string) (io.ReadCloser, error) {
+	repo, p, err := lookupProvider(gitURL)
+	var archive io.ReadCloser
+	if err == nil {
+		archive, err = p.Archive(ctx, repo, commit)
+	}
+	if err != nil {
+		return withFallback(ctx, err, func() (io.ReadCloser, error) {
+			return archiveCached(ctx, gitURL, commit)
+		})
+	}
+	return archive, nil
+}
+
+// archiveCached creates an archive of the repository at commit using the
+// clone cache.
+func archiveCached(ctx context.Context, gitURL, commit string) (io.ReadCloser, error) {
+	dir, err := cachedRepo(ctx, gitURL, commit)
+	if err != nil {
+		return nil, err
+	}
+	// like the hosts' archives, put the files under a directory named after
+	// the repository and commit
+	name := strings.TrimSuffix(path.Base(strings.TrimSuffix(gitURL, "/")), ".git")
+	prefix := name + "-" + shortHash(commit) + "/"
+	return gitStream(ctx, dir, "archive", "--format=tar.gz", "--prefix="+prefix, commit+"^{commit}")
+}
+
+// gitStream runs a git command like runGit, but returns its output as a
+// stream. Reading the stream returns git's error (rather than io.EOF) if the
+// command fails.
+func gitStream(ctx context.Context, dir string, args ...string) (io.ReadCloser, error) {
+	cmd := gitCommand(ctx, args...)
+	cmd.Dir = dir
+	s := &gitOutput{ctx: ctx, cmd: cmd, subcommand: args[0]}
+	cmd.Stderr = &s.stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, gitError(ctx, args[0], err, &s.stderr)
+	}
+	s.stdout = stdout
+	return s, nil
+}
+
+// gitOutput is the output of a running git command
+type gitOutput struct {
+	ctx        context.Context
+	cmd        *exec.Cmd
+	subcommand string
+	stdout     io.Reader
+	stderr     bytes.Buffer
+	done       bool
+	err        error // result of the command, once done
+}
+
+func (s *gitOutput) wait() error {
+	if !s.done {
+		s.done = true
+		if err := s.cmd.Wait(); err != nil {
+			s.err = gitError(s.ctx, s.subcommand, err, &s.stderr)
+		}
+	}
+	return s.err
+}
+
+func (s *gitOutput) Read(p []byte) (int, error) {
+	n, err := s.stdout.Read(p)
+	if errors.Is(err, io.EOF) {
+		if err := s.wait(); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+// Close stops the command, if it has not finished.
+func (s *gitOutput) Close() error {
+	if !s.done {
+		s.cmd.Process.Kill()
+		s.done = true
+		s.cmd.Wait()
+	}
+	return nil
+}
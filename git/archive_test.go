@@ -0,0 +1,98 @@
+package git
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readArchive returns the regular files in a gzipped tarball, by name.
+func readArchive(t *testing.T, r io.Reader) map[string]string {
+	t.Helper()
+	gz, err := gzip.NewReader(r)
+	require.NoError(t, err)
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		require.NoError(t, err)
+		if hdr.Typeflag == tar.TypeReg {
+			data, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			files[hdr.Name] = string(data)
+		}
+	}
+}
+
+func TestGetArchive_Local(t *testing.T) {
+	useTempCache(t)
+	repo := newLocalRepo(t)
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "example.opam"), []byte("opam-version: \"2.0\"\n"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(repo, "src"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "src", "a.v"), []byte("Lemma a : True."), 0644))
+	gitCmd(t, repo, "add", ".")
+	gitCmd(t, repo, "commit", "--quiet", "-m", "add files")
+	commit := gitCmd(t, repo, "rev-parse", "HEAD")
+
+	archive, err := GetArchive(repo, commit)
+	require.NoError(t, err)
+	defer archive.Close()
+	prefix := filepath.Base(repo) + "-" + commit[:7] + "/"
+	assert.Equal(t, map[string]string{
+		prefix + "example.opam": "opam-version: \"2.0\"\n",
+		prefix + "src/a.v":      "Lemma a : True.",
+	}, readArchive(t, archive))
+
+	_, err = GetArchive(repo, "0123456789012345678901234567890123456789")
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestGitStream_Error(t *testing.T) {
+	repo := newLocalRepo(t)
+	s, err := gitStream(context.Background(), repo, "archive", "no-such-ref")
+	require.NoError(t, err)
+	defer s.Close()
+	_, err = io.ReadAll(s)
+	assert.ErrorContains(t, err, "git archive")
+	assert.ErrorContains(t, err, "no-such-ref")
+}
+
+func TestGitHubProvider_Archive(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/user/repo/tarball/abc123", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		http.Redirect(w, r, "/codeload/user/repo/legacy.tar.gz/abc123", http.StatusFound)
+	})
+	mux.HandleFunc("/codeload/user/repo/legacy.tar.gz/abc123", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tarball"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	p := GitHubProvider{APIURL: server.URL}
+	repo := Repo{Scheme: "https", Host: "github.example.com", Path: "user/repo"}
+	SetToken(repo.Host, "secret")
+	defer delete(tokens, repo.Host)
+
+	archive, err := p.Archive(context.Background(), repo, "abc123")
+	require.NoError(t, err)
+	defer archive.Close()
+	data, err := io.ReadAll(archive)
+	require.NoError(t, err)
+	assert.Equal(t, "tarball", string(data))
+
+	_, err = p.Archive(context.Background(), repo, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
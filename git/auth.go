@@ -0,0 +1,32 @@
+package git
+
+import "os"
+
+// tokens maps a host to its API token, as set by SetToken
+var tokens = make(map[string]string)
+
+// tokenEnv lists environment variables that hold tokens for public hosts;
+// these take precedence over SetToken.
+var tokenEnv = map[string]string{
+	"github.com": "GITHUB_TOKEN",
+	"gitlab.com": "GITLAB_TOKEN",
+}
+
+// SetToken sets the API token to use for requests to host (like github.com
+// or gitlab.mpi-sws.org), which is needed to access private repositories.
+//
+// The GITHUB_TOKEN and GITLAB_TOKEN environment variables, if set, override
+// the token for github.com and gitlab.com.
+func SetToken(host, token string) {
+	tokens[host] = token
+}
+
+// token returns the API token for host, or "" if there is none.
+func token(host string) string {
+	if env, ok := tokenEnv[host]; ok {
+		if tok := os.Getenv(env); tok != "" {
+			return tok
+		}
+	}
+	return tokens[host]
+}
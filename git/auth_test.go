@@ -0,0 +1,28 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToken(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GITLAB_TOKEN", "")
+	t.Cleanup(func() { clear(tokens) })
+
+	assert.Empty(t, githubAuth("github.com"))
+
+	SetToken("github.com", "from-config")
+	SetToken("gitlab.mpi-sws.org", "mpi-token")
+	assert.Equal(t, "Bearer from-config", githubAuth("github.com").Get("Authorization"))
+	assert.Equal(t, "mpi-token", gitlabAuth("gitlab.mpi-sws.org").Get("PRIVATE-TOKEN"))
+	assert.Empty(t, gitlabAuth("gitlab.com"))
+
+	// environment takes precedence, but only for its own host
+	t.Setenv("GITHUB_TOKEN", "from-env")
+	t.Setenv("GITLAB_TOKEN", "gitlab-env")
+	assert.Equal(t, "Bearer from-env", githubAuth("github.com").Get("Authorization"))
+	assert.Equal(t, "gitlab-env", gitlabAuth("gitlab.com").Get("PRIVATE-TOKEN"))
+	assert.Equal(t, "mpi-token", gitlabAuth("gitlab.mpi-sws.org").Get("PRIVATE-TOKEN"))
+}
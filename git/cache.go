@@ -0,0 +1,324 @@
+package git
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// repoLocks holds a *sync.Mutex for each directory of the clone cache, which
+// serializes fetches into that clone (fetches of different repositories run
+// in parallel)
+var repoLocks sync.Map
+
+// lockRepo locks the clone in dir, returning the function to unlock it.
+func lockRepo(dir string) func() {
+	mu, _ := repoLocks.LoadOrStore(dir, new(sync.Mutex))
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// initClone creates an empty bare repository in dir with url as its origin.
+// It is set up in a temporary directory and renamed into place, so that dir
+// is never left half-initialized.
+func initClone(ctx context.Context, dir, url string) error {
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), filepath.Base(dir)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if _, err := runGit(ctx, tmp, "init", "--quiet", "--bare"); err != nil {
+		return err
+	}
+	if _, err := runGit(ctx, tmp, "remote", "add", "origin", url); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
+
+// validClone reports if dir is a clone of url made by initClone.
+func validClone(ctx context.Context, dir, url string) bool {
+	// read dir's own config, rather than that of a repository around it
+	output, err := runGit(ctx, "", "config", "--file", filepath.Join(dir, "config"), "--get", "remote.origin.url")
+	return err == nil && strings.TrimSpace(string(output)) == url
+}
+
+// cacheDir returns the directory holding cached clones.
+func cacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "perennial-cli", "git"), nil
+}
+
+// cachedRepo returns a bare clone of gitURL (without file contents, which are
+// fetched on demand) that contains commit, creating or fetching it if needed.
+//
+// The clone cache makes file access work for any git host, including those
+// without a supported API. A repository on the local filesystem is not
+// cloned; its own path is returned.
+func cachedRepo(ctx context.Context, gitURL, commit string) (string, error) {
+	if dir, ok := localPath(gitURL); ok {
+		if _, err := runGit(ctx, dir, "rev-parse", "--quiet", "--verify", commit+"^{commit}"); err != nil {
+			return "", fmt.Errorf("commit %s not found in %s: %w", commit, dir, err)
+		}
+		return dir, nil
+	}
+	url := strings.TrimPrefix(gitURL, "git+")
+	base, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(url))
+	name := strings.TrimSuffix(path.Base(url), ".git") + "-" + hex.EncodeToString(sum[:8])
+	dir := filepath.Join(base, name)
+
+	defer lockRepo(dir)()
+
+	if !validClone(ctx, dir, url) {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		// missing, or broken (say, by an interrupted run of an older
+		// version), so start over
+		if err := os.RemoveAll(dir); err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(base, 0755); err != nil {
+			return "", err
+		}
+		if err := initClone(ctx, dir, url); err != nil {
+			return "", fmt.Errorf("failed to create clone of %s: %w", url, err)
+		}
+	}
+
+	hasCommit := func() bool {
+		_, err := runGit(ctx, dir, "rev-parse", "--quiet", "--verify", commit+"^{commit}")
+		return err == nil
+	}
+	if err := checkOnline(gitURL); err != nil {
+		// use whatever the cache has, even if it might be outdated
+		if hasCommit() {
+			return dir, nil
+		}
+		return "", err
+	}
+	if len(commit) == 40 {
+		// full hashes never change, but anything else (abbreviated hashes
+		// and ref names) may refer to new commits
+		if hasCommit() {
+			return dir, nil
+		}
+		// most servers allow a shallow fetch of just the pinned commit,
+		// which is much cheaper than fetching every branch
+		if _, err := runGit(ctx, dir, "fetch", "--quiet", "--depth=1", "--filter=blob:none", "origin", commit); err == nil && hasCommit() {
+			return dir, nil
+		}
+	}
+	if _, err := runGit(ctx, dir, "fetch", "--quiet", "--filter=blob:none", "origin",
+		"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"); err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	if hasCommit() {
+		return dir, nil
+	}
+	return "", fmt.Errorf("commit %s not found in %s", commit, url)
+}
+
+// archiveFile reads a file at commit with git archive --remote, which avoids
+// fetching anything else from the repository. Few servers support this (and
+// most only for commits at the tip of a ref), so callers should fall back to
+// the clone cache.
+func archiveFile(ctx context.Context, gitURL, commit, path string) ([]byte, error) {
+	if err := checkOnline(gitURL); err != nil {
+		return nil, err
+	}
+	url := strings.TrimPrefix(gitURL, "git+")
+	output, err := runGit(ctx, "", "archive", "--remote="+url, "--format=tar", commit, "--", path)
+	if err != nil {
+		return nil, err
+	}
+	r := tar.NewReader(bytes.NewReader(output))
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in archive of %s", path, commit)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive of %s: %w", commit, err)
+		}
+		if hdr.Name == path && hdr.Typeflag == tar.TypeReg {
+			return io.ReadAll(r)
+		}
+	}
+}
+
+// resolveCommitCached resolves an abbreviated commit hash using the clone
+// cache.
+func resolveCommitCached(ctx context.Context, gitURL, commit string) (string, error) {
+	dir, err := cachedRepo(ctx, gitURL, commit)
+	if err != nil {
+		return "", err
+	}
+	output, err := runGit(ctx, dir, "rev-parse", "--verify", commit+"^{commit}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// commitFormat is the git log format parsed by parseCommit
+const commitFormat = "--format=%H%x00%an%x00%cI%x00%s"
+
+// parseCommit parses a line of git log output in commitFormat.
+func parseCommit(line string) (CommitInfo, error) {
+	fields := strings.Split(strings.TrimSuffix(line, "\n"), "\x00")
+	if len(fields) != 4 {
+		return CommitInfo{}, fmt.Errorf("unexpected git log output: %s", line)
+	}
+	date, err := time.Parse(time.RFC3339, fields[2])
+	if err != nil {
+		return CommitInfo{}, fmt.Errorf("unexpected commit date from git log: %w", err)
+	}
+	return CommitInfo{Hash: fields[0], Author: fields[1], Date: date, Subject: fields[3]}, nil
+}
+
+// commitInfoCached reads the metadata of a commit using the clone cache.
+func commitInfoCached(ctx context.Context, gitURL, commit string) (CommitInfo, error) {
+	dir, err := cachedRepo(ctx, gitURL, commit)
+	if err != nil {
+		return CommitInfo{}, err
+	}
+	output, err := runGit(ctx, dir, "show", "--no-patch", commitFormat, commit+"^{commit}")
+	if err != nil {
+		return CommitInfo{}, err
+	}
+	return parseCommit(string(output))
+}
+
+// commitsBetweenCached lists the commits in base..head using the clone cache.
+func commitsBetweenCached(ctx context.Context, gitURL, base, head string) ([]CommitInfo, error) {
+	if _, err := cachedRepo(ctx, gitURL, base); err != nil {
+		return nil, err
+	}
+	dir, err := cachedRepo(ctx, gitURL, head)
+	if err != nil {
+		return nil, err
+	}
+	output, err := runGit(ctx, dir, "log", commitFormat, base+".."+head)
+	if err != nil {
+		return nil, err
+	}
+	var commits []CommitInfo
+	for line := range strings.Lines(string(output)) {
+		info, err := parseCommit(line)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, info)
+	}
+	return commits, nil
+}
+
+// listFilesCached lists the files selected by opts at commit using the clone
+// cache.
+func listFilesCached(ctx context.Context, gitURL, commit string, opts ListOptions) ([]string, error) {
+	dir, err := cachedRepo(ctx, gitURL, commit)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"ls-tree"}
+	if opts.Recursive {
+		args = append(args, "-r")
+	}
+	args = append(args, commit)
+	if path := opts.dir(); path != "" {
+		// with a trailing slash, ls-tree lists the directory's contents
+		args = append(args, "--", path+"/")
+	}
+	output, err := runGit(ctx, dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	// Output format: "mode type hash\tname" on each line
+	var files []string
+	for line := range strings.Lines(string(output)) {
+		info, name, ok := strings.Cut(strings.TrimSuffix(line, "\n"), "\t")
+		if !ok {
+			return nil, fmt.Errorf("unexpected git ls-tree output: %s", line)
+		}
+		if fields := strings.Fields(info); len(fields) == 3 && fields[1] == "blob" && opts.includes(name) {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// getFileCached reads a file at commit using the clone cache.
+func getFileCached(ctx context.Context, gitURL, commit, path string) ([]byte, error) {
+	dir, err := cachedRepo(ctx, gitURL, commit)
+	if err != nil {
+		return nil, err
+	}
+	data, err := runGit(ctx, dir, "cat-file", "blob", commit+":"+path)
+	if err != nil && checkOnline(gitURL) != nil {
+		// file contents are fetched on demand, so they may not be cached
+		return nil, fmt.Errorf("failed to read %s at %s: %w: %w", path, commit, ErrOffline, err)
+	}
+	if err != nil {
+		// the commit is present, so the file must be missing
+		return nil, fmt.Errorf("failed to read %s at %s: %w: %w", path, commit, ErrNotFound, err)
+	}
+	return data, nil
+}
+
+// statusError is an unsuccessful HTTP status from a hosting API
+type statusError int
+
+func (s statusError) Error() string {
+	return fmt.Sprintf("status %d", int(s))
+}
+
+func (s statusError) Is(target error) bool {
+	return target == ErrNotFound && int(s) == http.StatusNotFound
+}
+
+// ErrNotFound means a file does not exist in a repository (or the repository
+// itself was not found).
+var ErrNotFound = errors.New("not found")
+
+// withFallback handles an API request that failed with apiErr, by instead
+// fetching with git (using fallback) if the API is unsupported or
+// unavailable.
+//
+// A 404 is taken at its word: the file or commit does not exist (or the
+// repository is private and needs a token), and fetching a whole repository
+// would not be worth it.
+func withFallback[T any](ctx context.Context, apiErr error, fallback func() (T, error)) (T, error) {
+	var zero T
+	var status statusError
+	if ctx.Err() != nil || (errors.As(apiErr, &status) && status == http.StatusNotFound) {
+		return zero, apiErr
+	}
+	result, err := fallback()
+	if err != nil {
+		if errors.Is(apiErr, ErrUnsupported) || errors.Is(apiErr, ErrOffline) {
+			return zero, err
+		}
+		return zero, fmt.Errorf("%w (fetching with git also failed: %v)", apiErr, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,281 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useTempCache points the clone cache to a temporary directory
+func useTempCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+}
+
+// redirectRemote makes git fetch url from the local repository at repo, so
+// that url is treated as a remote (and cloned into the cache) in tests.
+func redirectRemote(t *testing.T, url, repo string) {
+	t.Helper()
+	gitConfig := filepath.Join(t.TempDir(), "gitconfig")
+	require.NoError(t, os.WriteFile(gitConfig, []byte("[url \""+repo+"\"]\n\tinsteadOf = "+url+"\n"), 0644))
+	t.Setenv("GIT_CONFIG_GLOBAL", gitConfig)
+}
+
+func TestCachedFiles(t *testing.T) {
+	useTempCache(t)
+	repo := newLocalRepo(t)
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "example.opam"), []byte("opam-version: \"2.0\"\n"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(repo, "src"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "src", "a.v"), nil, 0644))
+	gitCmd(t, repo, "add", ".")
+	gitCmd(t, repo, "commit", "--quiet", "-m", "add files")
+	commit := gitCmd(t, repo, "rev-parse", "HEAD")
+	// a host without a supported API, so these use the cache
+	url := "https://git.example.com/repo"
+	redirectRemote(t, url, repo)
+
+	full, err := ResolveCommit(url, commit[:8])
+	require.NoError(t, err)
+	assert.Equal(t, commit, full)
+
+	files, err := ListFiles(url, commit)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.opam"}, files)
+
+	data, err := GetFile(url, commit, "example.opam")
+	require.NoError(t, err)
+	assert.Equal(t, "opam-version: \"2.0\"\n", string(data))
+
+	_, err = GetFile(url, commit, "missing.opam")
+	assert.Error(t, err)
+
+	// a cached commit does not need the remote
+	require.NoError(t, os.RemoveAll(repo))
+	data, err = GetFile(url, commit, "src/a.v")
+	require.NoError(t, err)
+	assert.Empty(t, data)
+}
+
+func TestCachedRepoRepair(t *testing.T) {
+	useTempCache(t)
+	repo := newLocalRepo(t)
+	commit := gitCmd(t, repo, "rev-parse", "HEAD")
+	url := "https://git.example.com/repo"
+	redirectRemote(t, url, repo)
+
+	dir, err := cachedRepo(context.Background(), url, commit)
+	require.NoError(t, err)
+
+	// a half-initialized clone is replaced
+	require.NoError(t, os.RemoveAll(dir))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "objects"), 0755))
+	repaired, err := cachedRepo(context.Background(), url, commit)
+	require.NoError(t, err)
+	assert.Equal(t, dir, repaired)
+	assert.True(t, validClone(context.Background(), dir, url))
+
+	// no temporary directories are left behind
+	entries, err := os.ReadDir(filepath.Dir(dir))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestLockRepo(t *testing.T) {
+	unlock := lockRepo("a")
+	// another repository is not blocked
+	done := make(chan struct{})
+	go func() {
+		lockRepo("b")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("locking b waited for a")
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		lockRepo("a")()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("locked a twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+}
+
+func TestLocalRemote(t *testing.T) {
+	useTempCache(t)
+	repo := newLocalRepo(t)
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "example.opam"), []byte("opam-version: \"2.0\"\n"), 0644))
+	gitCmd(t, repo, "add", ".")
+	gitCmd(t, repo, "commit", "--quiet", "-m", "add opam file")
+	commit := gitCmd(t, repo, "rev-parse", "HEAD")
+
+	for _, url := range []string{repo, "file://" + repo, "git+file://" + repo} {
+		files, err := ListFiles(url, commit)
+		require.NoError(t, err, url)
+		assert.Equal(t, []string{"example.opam"}, files, url)
+
+		data, err := GetFile(url, commit[:8], "example.opam")
+		require.NoError(t, err, url)
+		assert.Equal(t, "opam-version: \"2.0\"\n", string(data), url)
+	}
+
+	// local repositories are read in place rather than cloned
+	base, err := cacheDir()
+	require.NoError(t, err)
+	assert.NoDirExists(t, base)
+
+	// new commits are visible immediately
+	gitCmd(t, repo, "rm", "--quiet", "example.opam")
+	gitCmd(t, repo, "commit", "--quiet", "-m", "remove opam file")
+	files, err := ListFiles(repo, gitCmd(t, repo, "rev-parse", "HEAD"))
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestCachedFiles_MissingCommit(t *testing.T) {
+	useTempCache(t)
+	repo := newLocalRepo(t)
+	_, err := ListFiles(repo, "0123456789012345678901234567890123456789")
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestWithFallback(t *testing.T) {
+	ctx := context.Background()
+	fallback := func() (string, error) { return "fetched", nil }
+	failing := func() (string, error) { return "", errors.New("fetch failed") }
+
+	result, err := withFallback(ctx, statusError(503), fallback)
+	require.NoError(t, err)
+	assert.Equal(t, "fetched", result)
+
+	_, err = withFallback(ctx, statusError(404), fallback)
+	assert.ErrorIs(t, err, statusError(404))
+
+	_, err = withFallback(ctx, statusError(503), failing)
+	assert.ErrorIs(t, err, statusError(503))
+	assert.ErrorContains(t, err, "fetch failed")
+
+	_, err = withFallback(ctx, ErrUnsupported, failing)
+	assert.EqualError(t, err, "fetch failed")
+}
+
+func TestArchiveFile(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	repo := newLocalRepo(t)
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "example.opam"), []byte("opam-version: \"2.0\"\n"), 0644))
+	gitCmd(t, repo, "add", ".")
+	gitCmd(t, repo, "commit", "--quiet", "-m", "add opam file")
+	commit := gitCmd(t, repo, "rev-parse", "HEAD")
+
+	// by default, servers only archive refs
+	_, err := archiveFile(context.Background(), repo, commit, "example.opam")
+	assert.Error(t, err)
+
+	gitCmd(t, repo, "config", "uploadArchive.allowUnreachable", "true")
+	data, err := archiveFile(context.Background(), repo, commit, "example.opam")
+	require.NoError(t, err)
+	assert.Equal(t, "opam-version: \"2.0\"\n", string(data))
+
+	_, err = archiveFile(context.Background(), repo, commit, "missing.opam")
+	assert.Error(t, err)
+
+	// GetFile uses the archive without filling the cache
+	data, err = GetFile(repo, commit, "example.opam")
+	require.NoError(t, err)
+	assert.Equal(t, "opam-version: \"2.0\"\n", string(data))
+	entries, _ := os.ReadDir(filepath.Join(cache, "perennial-cli", "git"))
+	assert.Empty(t, entries)
+}
+
+func TestCachedFiles_OldCommit(t *testing.T) {
+	useTempCache(t)
+	repo := newLocalRepo(t)
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "old.opam"), nil, 0644))
+	gitCmd(t, repo, "add", ".")
+	gitCmd(t, repo, "commit", "--quiet", "-m", "add old.opam")
+	old := gitCmd(t, repo, "rev-parse", "HEAD")
+	gitCmd(t, repo, "mv", "old.opam", "new.opam")
+	gitCmd(t, repo, "commit", "--quiet", "-m", "rename")
+
+	files, err := ListFiles(repo, old)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"old.opam"}, files)
+
+	files, err = ListFiles(repo, gitCmd(t, repo, "rev-parse", "HEAD"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new.opam"}, files)
+}
+
+func TestCachedFiles_ListOptions(t *testing.T) {
+	useTempCache(t)
+	repo := newLocalRepo(t)
+	for _, path := range []string{"root.opam", "packages/a/a.opam", "packages/b.opam"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(repo, filepath.Dir(path)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(repo, path), nil, 0644))
+	}
+	gitCmd(t, repo, "add", ".")
+	gitCmd(t, repo, "commit", "--quiet", "-m", "add packages")
+	commit := gitCmd(t, repo, "rev-parse", "HEAD")
+	ctx := context.Background()
+
+	files, err := ListFilesWith(ctx, repo, commit, ListOptions{Path: "packages"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"packages/b.opam"}, files)
+
+	files, err = ListFilesWith(ctx, repo, commit, ListOptions{Path: "packages", Recursive: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"packages/a/a.opam", "packages/b.opam"}, files)
+
+	files, err = ListFilesWith(ctx, repo, commit, ListOptions{Recursive: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"packages/a/a.opam", "packages/b.opam", "root.opam"}, files)
+}
+
+func TestGetCommitInfo_Cached(t *testing.T) {
+	useTempCache(t)
+	repo := newLocalRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-05-02T12:00:00Z")
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "fix wp lemma\n\nlonger description")
+	commit := gitCmd(t, repo, "rev-parse", "HEAD")
+
+	info, err := GetCommitInfo(repo, commit)
+	require.NoError(t, err)
+	assert.Equal(t, commit, info.Hash)
+	assert.Equal(t, "test", info.Author)
+	assert.Equal(t, "fix wp lemma", info.Subject)
+	assert.True(t, info.Date.Equal(time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)), info.Date)
+	assert.Equal(t, commit[:7]+" (2024-05-02: fix wp lemma)", info.String())
+}
+
+func TestCommitsBetween_Cached(t *testing.T) {
+	useTempCache(t)
+	repo := newLocalRepo(t)
+	base := gitCmd(t, repo, "rev-parse", "HEAD")
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "second")
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "third")
+	head := gitCmd(t, repo, "rev-parse", "HEAD")
+
+	commits, err := CommitsBetween(repo, base, head)
+	require.NoError(t, err)
+	require.Len(t, commits, 2)
+	assert.Equal(t, head, commits[0].Hash)
+	assert.Equal(t, "third", commits[0].Subject)
+	assert.Equal(t, "second", commits[1].Subject)
+
+	commits, err = CommitsBetween(repo, head, head)
+	require.NoError(t, err)
+	assert.Empty(t, commits)
+}
@@ -0,0 +1,74 @@
+package git
+
+import (
+	"context"
+	"io"
+)
+
+// Client is the interface to remote repositories used by other packages, so
+// that tests (and programs embedding them) can substitute a fake for the
+// network.
+type Client interface {
+	GetLatestCommit(ctx context.Context, gitURL string) (string, error)
+	GetDefaultBranch(ctx context.Context, gitURL string) (string, error)
+	ResolveRef(ctx context.Context, gitURL, ref string) (string, error)
+	ResolveCommit(ctx context.Context, gitURL, commit string) (string, error)
+	IsReachable(ctx context.Context, gitURL, commit string) (bool, error)
+	ListFiles(ctx context.Context, gitURL, commit string, opts ListOptions) ([]string, error)
+	// GetFile returns an error wrapping ErrNotFound if path does not exist at
+	// commit.
+	GetFile(ctx context.Context, gitURL, commit, path string) ([]byte, error)
+	GetArchive(ctx context.Context, gitURL, commit string) (io.ReadCloser, error)
+	GetCommitInfo(ctx context.Context, gitURL, commit string) (CommitInfo, error)
+	CommitsBetween(ctx context.Context, gitURL, base, head string) ([]CommitInfo, error)
+	CanonicalURL(ctx context.Context, gitURL string) (string, error)
+}
+
+// DefaultClient implements Client with the functions of this package.
+var DefaultClient Client = defaultClient{}
+
+type defaultClient struct{}
+
+func (defaultClient) GetLatestCommit(ctx context.Context, gitURL string) (string, error) {
+	return GetLatestCommitContext(ctx, gitURL)
+}
+
+func (defaultClient) GetDefaultBranch(ctx context.Context, gitURL string) (string, error) {
+	return GetDefaultBranchContext(ctx, gitURL)
+}
+
+func (defaultClient) ResolveRef(ctx context.Context, gitURL, ref string) (string, error) {
+	return ResolveRefContext(ctx, gitURL, ref)
+}
+
+func (defaultClient) ResolveCommit(ctx context.Context, gitURL, commit string) (string, error) {
+	return ResolveCommitContext(ctx, gitURL, commit)
+}
+
+func (defaultClient) IsReachable(ctx context.Context, gitURL, commit string) (bool, error) {
+	return IsReachableContext(ctx, gitURL, commit)
+}
+
+func (defaultClient) ListFiles(ctx context.Context, gitURL, commit string, opts ListOptions) ([]string, error) {
+	return ListFilesWith(ctx, gitURL, commit, opts)
+}
+
+func (defaultClient) GetFile(ctx context.Context, gitURL, commit, path string) ([]byte, error) {
+	return GetFileContext(ctx, gitURL, commit, path)
+}
+
+func (defaultClient) GetArchive(ctx context.Context, gitURL, commit string) (io.ReadCloser, error) {
+	return GetArchiveContext(ctx, gitURL, commit)
+}
+
+func (defaultClient) GetCommitInfo(ctx context.Context, gitURL, commit string) (CommitInfo, error) {
+	return GetCommitInfoContext(ctx, gitURL, commit)
+}
+
+func (defaultClient) CommitsBetween(ctx context.Context, gitURL, base, head string) ([]CommitInfo, error) {
+	return CommitsBetweenContext(ctx, gitURL, base, head)
+}
+
+func (defaultClient) CanonicalURL(ctx context.Context, gitURL string) (string, error) {
+	return CanonicalURLContext(ctx, gitURL)
+}
@@ -0,0 +1,191 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Limits on the response cache. Responses larger than maxCachedResponse (such
+// as big tree listings or file contents) are not cached at all; the cache is
+// meant for small, frequently revalidated responses like refs and commits.
+// After saving a response, entries not used within maxResponseAge are
+// removed, and then the least recently used entries until the cache fits in
+// maxResponseCacheSize.
+const (
+	maxCachedResponse    = 256 << 10
+	maxResponseCacheSize = 32 << 20
+	maxResponseAge       = 30 * 24 * time.Hour
+)
+
+// cachedResponse is a response body saved along with its ETag
+type cachedResponse struct {
+	ETag string `json:"etag"`
+	Body []byte `json:"body"`
+}
+
+// responseCachePath returns the file that caches the response to a request.
+//
+// The headers are part of the key so that responses obtained with one token
+// are not served for requests with another.
+func responseCachePath(url string, header http.Header) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	io.WriteString(h, url)
+	for _, key := range slices.Sorted(maps.Keys(header)) {
+		io.WriteString(h, "\n"+key+": "+strings.Join(header[key], ", "))
+	}
+	return filepath.Join(dir, "perennial-cli", "http", hex.EncodeToString(h.Sum(nil))+".json"), nil
+}
+
+// cachedGet issues a GET request using get, with a cache keyed on the URL and
+// headers. If a response was cached, the request includes its ETag in an
+// If-None-Match header, and a 304 Not Modified reply is turned into the
+// cached response. Hosting APIs answer conditional requests cheaply (GitHub
+// does not count them against the rate limit).
+//
+// The cache is best-effort: failing to read or write it is not an error.
+// See maxCachedResponse for how its size is bounded.
+func cachedGet(ctx context.Context, url string, header http.Header,
+	get func(context.Context, string, http.Header) (*http.Response, error)) (*http.Response, error) {
+	path, err := responseCachePath(url, header)
+	if err != nil {
+		if offline {
+			return nil, fmt.Errorf("cannot fetch %s: %w", url, ErrOffline)
+		}
+		return get(ctx, url, header)
+	}
+	var cached cachedResponse
+	haveCached := false
+	if data, err := os.ReadFile(path); err == nil && json.Unmarshal(data, &cached) == nil && cached.ETag != "" {
+		haveCached = true
+		header = header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		header.Set("If-None-Match", cached.ETag)
+	}
+	if offline {
+		if !haveCached {
+			return nil, fmt.Errorf("cannot fetch %s: %w", url, ErrOffline)
+		}
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Header:        make(http.Header),
+			Body:          io.NopCloser(bytes.NewReader(cached.Body)),
+			ContentLength: int64(len(cached.Body)),
+		}, nil
+	}
+
+	resp, err := get(ctx, url, header)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case haveCached && resp.StatusCode == http.StatusNotModified:
+		closeBody(resp)
+		resp.StatusCode = http.StatusOK
+		resp.Status = "200 OK"
+		resp.Body = io.NopCloser(bytes.NewReader(cached.Body))
+		resp.ContentLength = int64(len(cached.Body))
+		// record the use, so eviction removes least recently used entries
+		now := time.Now()
+		os.Chtimes(path, now, now)
+	case resp.StatusCode == http.StatusOK && resp.Header.Get("ETag") != "" &&
+		resp.ContentLength <= maxCachedResponse:
+		// read one byte past the limit to find out if the body is too large
+		// (the length is -1 when unknown)
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxCachedResponse+1))
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		if len(body) > maxCachedResponse {
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+			break
+		}
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		saveResponse(path, cachedResponse{ETag: resp.Header.Get("ETag"), Body: body})
+		pruneResponseCache(filepath.Dir(path), maxResponseCacheSize, maxResponseAge)
+	}
+	return resp, nil
+}
+
+// saveResponse writes a response to the cache, ignoring errors.
+func saveResponse(path string, cached cachedResponse) {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	// write atomically, since other processes may read the cache
+	f, err := os.CreateTemp(filepath.Dir(path), "response-*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// pruneResponseCache removes cache entries in dir that were last used more
+// than maxAge ago, then the least recently used ones until the remaining
+// entries take at most maxSize bytes. Errors are ignored.
+func pruneResponseCache(dir string, maxSize int64, maxAge time.Duration) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	type cacheFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []cacheFile
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, cacheFile{filepath.Join(dir, entry.Name()), info.Size(), info.ModTime()})
+	}
+	// most recently used first
+	slices.SortFunc(files, func(a, b cacheFile) int {
+		return b.modTime.Compare(a.modTime)
+	})
+	var total int64
+	for _, f := range files {
+		total += f.size
+		if time.Since(f.modTime) > maxAge || total > maxSize {
+			os.Remove(f.path)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package git
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedGet(t *testing.T) {
+	useTempCache(t)
+	requests, notModified := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, "response body")
+	}))
+	defer server.Close()
+
+	get := func(header http.Header) string {
+		resp, err := httpGet(context.Background(), server.URL, header)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	assert.Equal(t, "response body", get(nil))
+	assert.Equal(t, 0, notModified)
+	assert.Equal(t, "response body", get(nil))
+	assert.Equal(t, 1, notModified)
+
+	// a different token does not use the cached response
+	assert.Equal(t, "response body", get(http.Header{"Authorization": {"Bearer other"}}))
+	assert.Equal(t, 1, notModified)
+	assert.Equal(t, 3, requests)
+}
+
+func TestCachedGet_NoETag(t *testing.T) {
+	useTempCache(t)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Empty(t, r.Header.Get("If-None-Match"))
+		io.WriteString(w, "uncacheable")
+	}))
+	defer server.Close()
+
+	for range 2 {
+		resp, err := httpGet(context.Background(), server.URL, nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, 2, requests)
+}
+
+func TestCachedGet_LargeResponse(t *testing.T) {
+	useTempCache(t)
+	large := strings.Repeat("x", maxCachedResponse+1)
+	conditional := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			conditional++
+		}
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, large)
+	}))
+	defer server.Close()
+
+	for range 2 {
+		resp, err := httpGet(context.Background(), server.URL, nil)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, large, string(body))
+	}
+	assert.Equal(t, 0, conditional, "large response should not be cached")
+}
+
+func TestPruneResponseCache(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	write := func(name string, size int, age time.Duration) {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, make([]byte, size), 0644))
+		require.NoError(t, os.Chtimes(path, now.Add(-age), now.Add(-age)))
+	}
+	write("new.json", 10, time.Minute)
+	write("recent.json", 10, time.Hour)
+	write("older.json", 10, 2*time.Hour)
+	write("stale.json", 1, 48*time.Hour)
+
+	pruneResponseCache(dir, 25, 24*time.Hour)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"new.json", "recent.json"}, names)
+}
@@ -2,245 +2,433 @@
 package git
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
-	"os/exec"
 	"strings"
+	"time"
 )
 
-// GetLatestCommit returns the latest commit hash from a git URL.
-//
-// Returns the full 40-character commit hash.
-func GetLatestCommit(gitURL string) (string, error) {
-	if strings.HasPrefix(gitURL, "https://gitlab") {
-		// avoid a redirect warning
-		if !strings.HasSuffix(gitURL, ".git") {
-			gitURL = gitURL + ".git"
-		}
+// remoteRef is a ref advertised by a remote
+type remoteRef struct {
+	Hash string
+	Name string // full ref name (e.g., refs/heads/main or HEAD)
+}
+
+// lsRemote lists the refs of a remote that match patterns, using git
+// ls-remote.
+func lsRemote(ctx context.Context, gitURL string, patterns ...string) ([]remoteRef, error) {
+	if err := checkOnline(gitURL); err != nil {
+		return nil, err
 	}
-	cmd := exec.Command("git", "ls-remote", gitURL, "HEAD")
-	cmd.Stderr = os.Stderr
-	output, err := cmd.Output()
+	url := remoteURL(gitURL)
+	output, err := runGit(ctx, "", append([]string{"ls-remote", url}, patterns...)...)
 	if err != nil {
-		return "", fmt.Errorf("failed to run git ls-remote: %w", err)
+		return nil, fmt.Errorf("failed to list refs of %s: %w", url, err)
 	}
+	refs, _, err := parseLsRemote(output)
+	return refs, err
+}
 
-	// Output format: "commit_hash\tHEAD"
-	parts := strings.Fields(string(output))
-	if len(parts) < 1 {
-		return "", fmt.Errorf("unexpected git ls-remote output: %s", output)
+// parseLsRemote parses the output of git ls-remote. With --symref, the output
+// also reports symbolic refs, which are returned as a map from the name of
+// the symbolic ref (like HEAD) to its target (like refs/heads/main).
+func parseLsRemote(output []byte) ([]remoteRef, map[string]string, error) {
+	// Output format: "commit_hash\tref" on each line, and
+	// "ref: target\tref" for symbolic refs
+	var refs []remoteRef
+	symrefs := make(map[string]string)
+	for line := range strings.Lines(string(output)) {
+		if rest, ok := strings.CutPrefix(line, "ref: "); ok {
+			target, name, _ := strings.Cut(strings.TrimSpace(rest), "\t")
+			symrefs[name] = target
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) < 2 {
+			return nil, nil, fmt.Errorf("unexpected git ls-remote output: %s", output)
+		}
+		refs = append(refs, remoteRef{Hash: parts[0], Name: parts[1]})
 	}
+	return refs, symrefs, nil
+}
 
-	return parts[0], nil
+// httpGet issues a GET request with extra headers (such as for
+// authentication), which is canceled along with ctx.
+//
+// Responses with an ETag are cached, and later requests for the same URL are
+// made conditional so that unchanged responses are served from the cache (see
+// cachedGet).
+func httpGet(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	return cachedGet(ctx, url, header, httpGetRetry)
 }
 
-// ResolveCommit resolves an abbreviated commit hash to a full hash.
-// If the commit is already a full hash (40 characters), it returns it unchanged.
-// Uses the GitHub/GitLab API to resolve the hash.
-func ResolveCommit(gitURL, commit string) (string, error) {
-	// If already a full hash, return as-is
-	if len(commit) == 40 {
-		return commit, nil
+// httpGetRetry issues a GET request like httpGet, without caching.
+//
+// Network errors and transient failures (5xx and 429 responses) are retried
+// with jittered exponential backoff, honoring any Retry-After header. An
+// exhausted rate limit is only waited for if it resets within the time
+// configured by ConfigureHTTP. After the last attempt, the response is
+// returned as-is for the caller to check.
+func httpGetRetry(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		resp, err := httpClient.Do(req)
+		if attempt == maxAttempts || ctx.Err() != nil {
+			return resp, err
+		}
+		delay := backoff(attempt)
+		if err == nil {
+			if reset, ok := rateLimitReset(resp); ok {
+				wait := time.Until(reset)
+				if reset.IsZero() || wait > rateLimitWait {
+					return resp, nil
+				}
+				delay = max(wait, 0)
+			} else if !isTransient(resp.StatusCode) {
+				return resp, nil
+			} else if d, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				delay = d
+			}
+			closeBody(resp)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
 	}
+}
 
-	url := strings.TrimPrefix(gitURL, "git+")
-	url = strings.TrimSuffix(url, ".git")
-
-	if strings.Contains(url, "github.com") {
-		return resolveCommitGitHub(url, commit)
-	} else if strings.Contains(url, "gitlab") {
-		return resolveCommitGitLab(url, commit)
+// remoteURL converts gitURL to the URL to pass to git commands.
+func remoteURL(gitURL string) string {
+	gitURL = strings.TrimPrefix(gitURL, "git+")
+	if _, p, err := lookupProvider(gitURL); err == nil {
+		if _, ok := p.(GitLabProvider); ok && !strings.HasSuffix(gitURL, ".git") {
+			// avoid a redirect warning
+			gitURL = gitURL + ".git"
+		}
 	}
-	return "", fmt.Errorf("unsupported git hosting service: %s", url)
+	return gitURL
 }
 
-func resolveCommitGitHub(url, commit string) (string, error) {
-	// GitHub API: https://api.github.com/repos/user/repo/commits/sha
-	url = strings.Replace(url, "https://github.com/", "", 1)
-	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/commits/%s", url, commit)
+// GetLatestCommit returns the latest commit hash from a git URL.
+//
+// Like the other functions in this package, this accepts SSH remotes (such as
+// git@github.com:owner/repo.git) as well as https URLs (see ParseRepo).
+//
+// Returns the full 40-character commit hash.
+func GetLatestCommit(gitURL string) (string, error) {
+	return GetLatestCommitContext(context.Background(), gitURL)
+}
 
-	resp, err := http.Get(apiURL)
+// GetLatestCommitContext is like GetLatestCommit but stops waiting for the
+// remote when ctx is done.
+func GetLatestCommitContext(ctx context.Context, gitURL string) (string, error) {
+	refs, err := lsRemote(ctx, gitURL, "HEAD")
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch commit info: %w", err)
+		return "", err
 	}
-	defer resp.Body.Close()
+	for _, ref := range refs {
+		if ref.Name == "HEAD" {
+			return ref.Hash, nil
+		}
+	}
+	return "", fmt.Errorf("remote %s has no HEAD", gitURL)
+}
+
+// GetDefaultBranch returns the name of the default branch of a remote (the
+// branch its HEAD points to, like main or master).
+func GetDefaultBranch(gitURL string) (string, error) {
+	return GetDefaultBranchContext(context.Background(), gitURL)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to fetch commit info: status %d", resp.StatusCode)
+// GetDefaultBranchContext is like GetDefaultBranch but stops waiting for the
+// remote when ctx is done.
+func GetDefaultBranchContext(ctx context.Context, gitURL string) (string, error) {
+	if err := checkOnline(gitURL); err != nil {
+		return "", err
 	}
+	url := remoteURL(gitURL)
+	output, err := runGit(ctx, "", "ls-remote", "--symref", url, "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to list refs of %s: %w", url, err)
+	}
+	_, symrefs, err := parseLsRemote(output)
+	if err != nil {
+		return "", err
+	}
+	target, ok := symrefs["HEAD"]
+	if !ok {
+		return "", fmt.Errorf("remote %s does not report a default branch", gitURL)
+	}
+	return strings.TrimPrefix(target, "refs/heads/"), nil
+}
 
-	// Parse GitHub API response
-	var result struct {
-		SHA string `json:"sha"`
+// ResolveRef resolves a ref on the remote to a commit hash. The ref can be a
+// branch or tag name (like main or v1.0), or a full ref name (such as
+// refs/heads/main, refs/pull/123/head on GitHub, or
+// refs/merge-requests/123/head on GitLab). As in git, a branch takes
+// precedence over a tag with the same name.
+//
+// Annotated tags are peeled to the commit they point to. Returns the full
+// 40-character commit hash.
+func ResolveRef(gitURL, ref string) (string, error) {
+	return ResolveRefContext(context.Background(), gitURL, ref)
+}
+
+// ResolveRefContext is like ResolveRef but stops waiting for the remote when
+// ctx is done.
+func ResolveRefContext(ctx context.Context, gitURL, ref string) (string, error) {
+	refs, err := lsRemote(ctx, gitURL, ref, ref+"^{}")
+	if err != nil {
+		return "", err
 	}
+	if hash, ok := resolveRefIn(refs, ref); ok {
+		return hash, nil
+	}
+	return "", fmt.Errorf("ref %s not found in %s", ref, gitURL)
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to parse GitHub API response: %w", err)
+// resolveRefIn finds the commit ref refers to among refs advertised by a
+// remote, as described for ResolveRef.
+func resolveRefIn(refs []remoteRef, ref string) (string, bool) {
+	hashes := make(map[string]string, len(refs))
+	for _, r := range refs {
+		hashes[r.Name] = r.Hash
 	}
+	candidates := []string{ref}
+	if !strings.HasPrefix(ref, "refs/") && ref != "HEAD" {
+		candidates = []string{"refs/heads/" + ref, "refs/tags/" + ref}
+	}
+	for _, name := range candidates {
+		if hash, ok := hashes[name+"^{}"]; ok {
+			return hash, true
+		}
+		if hash, ok := hashes[name]; ok {
+			return hash, true
+		}
+	}
+	return "", false
+}
 
-	return result.SHA, nil
+// ResolveCommit resolves an abbreviated commit hash to a full hash.
+// If the commit is already a full hash (40 characters), it returns it unchanged.
+// Uses the API of the host's Provider to resolve the hash, or the clone cache
+// for other hosts.
+func ResolveCommit(gitURL, commit string) (string, error) {
+	return ResolveCommitContext(context.Background(), gitURL, commit)
 }
 
-func resolveCommitGitLab(url, commit string) (string, error) {
-	// GitLab API: https://gitlab.com/api/v4/projects/user%2Frepo/repository/commits/sha
-	parts := strings.SplitN(url, "/", 4)
-	if len(parts) < 4 {
-		return "", fmt.Errorf("invalid GitLab URL format: %s", url)
+// ResolveCommitContext is like ResolveCommit but cancels the API request when
+// ctx is done.
+func ResolveCommitContext(ctx context.Context, gitURL, commit string) (string, error) {
+	// If already a full hash, return as-is
+	if len(commit) == 40 {
+		return commit, nil
+	}
+	repo, p, err := lookupProvider(gitURL)
+	var hash string
+	if err == nil {
+		hash, err = p.ResolveRef(ctx, repo, commit)
 	}
-	domain := parts[0] + "//" + parts[2]
-	projectPath := strings.ReplaceAll(parts[3], "/", "%2F")
-	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/repository/commits/%s", domain, projectPath, commit)
-
-	resp, err := http.Get(apiURL)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch commit info: %w", err)
+		return withFallback(ctx, err, func() (string, error) {
+			return resolveCommitCached(ctx, gitURL, commit)
+		})
 	}
-	defer resp.Body.Close()
+	return hash, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to fetch commit info: status %d", resp.StatusCode)
-	}
+// GetCommitInfo fetches the metadata (author, date, and subject) of a commit.
+// Uses the API of the host's Provider, or the clone cache for other hosts.
+func GetCommitInfo(gitURL, commit string) (CommitInfo, error) {
+	return GetCommitInfoContext(context.Background(), gitURL, commit)
+}
 
-	// Parse GitLab API response
-	var result struct {
-		ID string `json:"id"`
+// GetCommitInfoContext is like GetCommitInfo but cancels the API request when
+// ctx is done.
+func GetCommitInfoContext(ctx context.Context, gitURL, commit string) (CommitInfo, error) {
+	repo, p, err := lookupProvider(gitURL)
+	var info CommitInfo
+	if err == nil {
+		info, err = p.CommitInfo(ctx, repo, commit)
 	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to parse GitLab API response: %w", err)
+	if err != nil {
+		return withFallback(ctx, err, func() (CommitInfo, error) {
+			return commitInfoCached(ctx, gitURL, commit)
+		})
 	}
+	return info, nil
+}
 
-	return result.ID, nil
+// CommitsBetween lists the commits that are reachable from head but not from
+// base (such as the commits a pin at base is behind a branch tip), newest
+// first. Uses the API of the host's Provider, or the clone cache for other
+// hosts.
+func CommitsBetween(gitURL, base, head string) ([]CommitInfo, error) {
+	return CommitsBetweenContext(context.Background(), gitURL, base, head)
+}
+
+// CommitsBetweenContext is like CommitsBetween but cancels the API request
+// when ctx is done.
+func CommitsBetweenContext(ctx context.Context, gitURL, base, head string) ([]CommitInfo, error) {
+	repo, p, err := lookupProvider(gitURL)
+	var commits []CommitInfo
+	if err == nil {
+		commits, err = p.CommitsBetween(ctx, repo, base, head)
+	}
+	if err != nil {
+		return withFallback(ctx, err, func() ([]CommitInfo, error) {
+			return commitsBetweenCached(ctx, gitURL, base, head)
+		})
+	}
+	return commits, nil
 }
 
 // ListFiles returns a list of files at the root of a git repository at a specific commit.
-// Uses the GitHub/GitLab API to list directory contents.
+// Uses the API of the host's Provider to list directory contents, or the
+// clone cache for other hosts.
 func ListFiles(gitURL, commit string) ([]string, error) {
-	url := strings.TrimPrefix(gitURL, "git+")
-	url = strings.TrimSuffix(url, ".git")
-
-	if strings.Contains(url, "github.com") {
-		return listFilesGitHub(url, commit)
-	} else if strings.Contains(url, "gitlab") {
-		return listFilesGitLab(url, commit)
-	}
-	return nil, fmt.Errorf("unsupported git hosting service: %s", url)
+	return ListFilesContext(context.Background(), gitURL, commit)
 }
 
-func listFilesGitHub(url, commit string) ([]string, error) {
-	// GitHub API: https://api.github.com/repos/user/repo/contents?ref=commit
-	url = strings.Replace(url, "https://github.com/", "", 1)
-	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/contents?ref=%s", url, commit)
+// ListFilesContext is like ListFiles but cancels the API request when ctx is
+// done.
+func ListFilesContext(ctx context.Context, gitURL, commit string) ([]string, error) {
+	return ListFilesWith(ctx, gitURL, commit, ListOptions{})
+}
 
-	resp, err := http.Get(apiURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch repository listing: %w", err)
+// ListFilesWith lists the files in a directory of a git repository at a
+// specific commit (and optionally, its subdirectories), as paths relative to
+// the repository root.
+func ListFilesWith(ctx context.Context, gitURL, commit string, opts ListOptions) ([]string, error) {
+	repo, p, err := lookupProvider(gitURL)
+	var files []string
+	if err == nil {
+		files, err = p.ListFiles(ctx, repo, commit, opts)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch repository listing: status %d", resp.StatusCode)
+	if err != nil {
+		return withFallback(ctx, err, func() ([]string, error) {
+			return listFilesCached(ctx, gitURL, commit, opts)
+		})
 	}
+	return files, nil
+}
 
-	// Parse GitHub API response (array of objects with "name", "type", etc.)
-	var entries []struct {
-		Name string `json:"name"`
-		Type string `json:"type"`
-		Path string `json:"path"`
-	}
+// GetFile fetches a file from a git repository at a specific commit.
+// Works with GitHub, GitLab, Gitea/Forgejo (such as Codeberg), and sourcehut
+// repositories through their APIs or raw file URLs (see Provider), and with
+// other hosts through the clone cache.
+//
+// Like the other API requests, this uses the host's token (see SetToken), if
+// any, so that it works for private repositories.
+func GetFile(gitURL, commit, path string) ([]byte, error) {
+	return GetFileContext(context.Background(), gitURL, commit, path)
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
-		return nil, fmt.Errorf("failed to parse GitHub API response: %w", err)
+// GetFileContext is like GetFile but cancels the download when ctx is done.
+func GetFileContext(ctx context.Context, gitURL, commit, path string) ([]byte, error) {
+	repo, p, err := lookupProvider(gitURL)
+	var data []byte
+	if err == nil {
+		data, err = p.GetFile(ctx, repo, commit, path)
 	}
-
-	var files []string
-	for _, entry := range entries {
-		// Only include files (not directories) at the root
-		if entry.Type == "file" && !strings.Contains(entry.Path, "/") {
-			files = append(files, entry.Name)
+	if err != nil {
+		if p == nil && !isLocalRemote(gitURL) {
+			// git archive is the cheapest option if the server allows it
+			if data, err := archiveFile(ctx, gitURL, commit, path); err == nil {
+				return data, nil
+			}
 		}
+		return withFallback(ctx, err, func() ([]byte, error) {
+			return getFileCached(ctx, gitURL, commit, path)
+		})
 	}
+	return data, nil
+}
 
-	return files, nil
+// IsReachable checks whether commit is reachable from any branch of the remote
+// at gitURL. A pinned commit can become unreachable if a branch is
+// force-pushed, after which fresh (shallow) clones can no longer fetch it.
+//
+// Fetches the commit history of all branches (without trees or file
+// contents) into a temporary repository to answer the query.
+func IsReachable(gitURL, commit string) (bool, error) {
+	return IsReachableContext(context.Background(), gitURL, commit)
 }
 
-func listFilesGitLab(url, commit string) ([]string, error) {
-	// GitLab API: https://gitlab.com/api/v4/projects/user%2Frepo/repository/tree?ref=commit
-	parts := strings.SplitN(url, "/", 4)
-	if len(parts) < 4 {
-		return nil, fmt.Errorf("invalid GitLab URL format: %s", url)
+// IsReachableContext is like IsReachable but kills the fetch when ctx is done.
+func IsReachableContext(ctx context.Context, gitURL, commit string) (bool, error) {
+	if err := checkOnline(gitURL); err != nil {
+		return false, err
 	}
-	domain := parts[0] + "//" + parts[2]
-	projectPath := strings.ReplaceAll(parts[3], "/", "%2F")
-	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/repository/tree?ref=%s", domain, projectPath, commit)
-
-	resp, err := http.Get(apiURL)
+	url := remoteURL(gitURL)
+	dir, err := os.MkdirTemp("", "perennial-cli-reachable-*")
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch repository listing: %w", err)
+		return false, err
 	}
-	defer resp.Body.Close()
+	defer os.RemoveAll(dir)
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch repository listing: status %d", resp.StatusCode)
+	if _, err := runGit(ctx, dir, "init", "--quiet", "--bare"); err != nil {
+		return false, err
 	}
-
-	// Parse GitLab API response (array of objects with "name", "type", "path")
-	var entries []struct {
-		Name string `json:"name"`
-		Type string `json:"type"`
-		Path string `json:"path"`
+	if _, err := runGit(ctx, dir, "remote", "add", "origin", url); err != nil {
+		return false, err
 	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
-		return nil, fmt.Errorf("failed to parse GitLab API response: %w", err)
+	if _, err := runGit(ctx, dir, "fetch", "--quiet", "--filter=tree:0", "origin", "+refs/heads/*:refs/heads/*"); err != nil {
+		return false, fmt.Errorf("failed to fetch branches of %s: %w", url, err)
 	}
 
-	var files []string
-	for _, entry := range entries {
-		// Only include files (blobs) at the root
-		if entry.Type == "blob" && !strings.Contains(entry.Path, "/") {
-			files = append(files, entry.Name)
+	// Only commits reachable from some branch were fetched, so if the commit
+	// is missing it is unreachable.
+	output, err := runGit(ctx, dir, "rev-parse", "--quiet", "--verify", commit+"^{commit}")
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, err
 		}
+		return false, nil
 	}
-
-	return files, nil
+	fullHash := strings.TrimSpace(string(output))
+	output, err = runGit(ctx, dir, "for-each-ref", "--count=1", "--contains", fullHash, "refs/heads/")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(output)) != "", nil
 }
 
-// GetFile fetches a file from a git repository at a specific commit.
-// Works with GitHub and GitLab repositories.
-func GetFile(gitURL, commit, path string) ([]byte, error) {
-	url := strings.TrimPrefix(gitURL, "git+")
-	url = strings.TrimSuffix(url, ".git")
-
-	var rawURL string
-	if strings.Contains(url, "github.com") {
-		// GitHub: https://github.com/user/repo -> https://raw.githubusercontent.com/user/repo/commit/path
-		url = strings.Replace(url, "github.com", "raw.githubusercontent.com", 1)
-		rawURL = fmt.Sprintf("%s/%s/%s", url, commit, path)
-	} else if strings.Contains(url, "gitlab") {
-		// GitLab: https://gitlab.com/user/repo -> https://gitlab.com/user/repo/-/raw/commit/path
-		rawURL = fmt.Sprintf("%s/-/raw/%s/%s", url, commit, path)
-	} else {
-		return nil, fmt.Errorf("unsupported git hosting service: %s", url)
-	}
-
-	resp, err := http.Get(rawURL)
+// runGit runs a git command in dir and returns its standard output.
+//
+// git's standard error is captured rather than shown, and included in the
+// error if the command fails.
+func runGit(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := gitCommand(ctx, args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch file: %w", err)
+		return nil, gitError(ctx, args[0], err, &stderr)
 	}
-	defer resp.Body.Close()
+	return output, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch file: status %d", resp.StatusCode)
+// gitError describes the failure of a git subcommand, including what git
+// printed to stderr.
+func gitError(ctx context.Context, subcommand string, err error, stderr *bytes.Buffer) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("git %s: %w", subcommand, ctx.Err())
 	}
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return fmt.Errorf("git %s: %w: %s", subcommand, err, msg)
 	}
-
-	return data, nil
+	return fmt.Errorf("git %s: %w", subcommand, err)
 }
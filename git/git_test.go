@@ -1,6 +1,10 @@
 package git
 
 import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -61,3 +65,148 @@ func TestListFiles(t *testing.T) {
 		assert.NotEmpty(t, file, "file name should not be empty")
 	}
 }
+
+// newLocalRepo creates a git repository in a temporary directory with a single
+// commit on the main branch and returns its path.
+func newLocalRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	gitCmd(t, dir, "init", "--quiet", "--initial-branch=main")
+	gitCmd(t, dir, "commit", "--quiet", "--allow-empty", "-m", "initial commit")
+	return dir
+}
+
+// gitCmd runs a git command in dir and returns its trimmed output.
+func gitCmd(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, "git %v: %s", args, output)
+	return strings.TrimSpace(string(output))
+}
+
+func TestIsReachable(t *testing.T) {
+	repo := newLocalRepo(t)
+	first := gitCmd(t, repo, "rev-parse", "HEAD")
+
+	// a commit that only exists on a side branch is still reachable
+	gitCmd(t, repo, "checkout", "--quiet", "-b", "side")
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "side commit")
+	side := gitCmd(t, repo, "rev-parse", "HEAD")
+
+	// simulate a force-push that drops a commit from main
+	gitCmd(t, repo, "checkout", "--quiet", "main")
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "dropped commit")
+	dropped := gitCmd(t, repo, "rev-parse", "HEAD")
+	gitCmd(t, repo, "reset", "--quiet", "--hard", first)
+
+	reachable, err := IsReachable(repo, first)
+	require.NoError(t, err)
+	assert.True(t, reachable, "commit on main should be reachable")
+
+	reachable, err = IsReachable(repo, side[:10])
+	require.NoError(t, err)
+	assert.True(t, reachable, "abbreviated commit on side branch should be reachable")
+
+	reachable, err = IsReachable(repo, dropped)
+	require.NoError(t, err)
+	assert.False(t, reachable, "dropped commit should be unreachable")
+}
+
+func TestResolveRef(t *testing.T) {
+	repo := newLocalRepo(t)
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "pull request")
+	pr := gitCmd(t, repo, "rev-parse", "HEAD")
+	// GitHub exposes pull requests under refs/pull/<N>/head
+	gitCmd(t, repo, "update-ref", "refs/pull/123/head", pr)
+	gitCmd(t, repo, "reset", "--quiet", "--hard", "HEAD~1")
+
+	commit, err := ResolveRef(repo, "refs/pull/123/head")
+	require.NoError(t, err)
+	assert.Equal(t, pr, commit)
+
+	_, err = ResolveRef(repo, "refs/pull/124/head")
+	assert.ErrorContains(t, err, "ref refs/pull/124/head not found")
+}
+
+func TestGetLatestCommit_Local(t *testing.T) {
+	repo := newLocalRepo(t)
+	commit, err := GetLatestCommit(repo)
+	require.NoError(t, err)
+	assert.Equal(t, gitCmd(t, repo, "rev-parse", "HEAD"), commit)
+}
+
+func TestContextCanceled(t *testing.T) {
+	repo := newLocalRepo(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := GetLatestCommitContext(ctx, repo)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = IsReachableContext(ctx, repo, "HEAD")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// fails before making any request
+	_, err = GetFileContext(ctx, "https://github.com/mit-pdos/perennial", "master", "perennial.opam")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestGitErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	_, err := GetLatestCommit(missing)
+	// git's message is part of the error rather than printed
+	assert.ErrorContains(t, err, "failed to list refs of "+missing)
+	assert.ErrorContains(t, err, "does not appear to be a git repository")
+}
+
+func TestGetDefaultBranch(t *testing.T) {
+	repo := newLocalRepo(t)
+	branch, err := GetDefaultBranch(repo)
+	require.NoError(t, err)
+	assert.Equal(t, "main", branch)
+
+	gitCmd(t, repo, "checkout", "--quiet", "-b", "develop")
+	branch, err = GetDefaultBranch(repo)
+	require.NoError(t, err)
+	assert.Equal(t, "develop", branch)
+}
+
+func TestResolveRef_BranchesAndTags(t *testing.T) {
+	repo := newLocalRepo(t)
+	first := gitCmd(t, repo, "rev-parse", "HEAD")
+	gitCmd(t, repo, "tag", "-a", "v1.0", "-m", "release 1.0")
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "second")
+	second := gitCmd(t, repo, "rev-parse", "HEAD")
+	gitCmd(t, repo, "tag", "lightweight")
+	gitCmd(t, repo, "branch", "feature/main", first)
+	// a tag with the same name as a branch
+	gitCmd(t, repo, "tag", "main", first)
+
+	tests := []struct {
+		ref    string
+		commit string
+	}{
+		{"main", second},
+		{"refs/heads/main", second},
+		{"refs/tags/main", first},
+		{"v1.0", first}, // annotated tags are peeled
+		{"refs/tags/v1.0", first},
+		{"lightweight", second},
+		{"feature/main", first},
+		{"HEAD", second},
+	}
+	for _, tt := range tests {
+		commit, err := ResolveRef(repo, tt.ref)
+		require.NoError(t, err, tt.ref)
+		assert.Equal(t, tt.commit, commit, tt.ref)
+	}
+
+	_, err := ResolveRef(repo, "feature")
+	assert.ErrorContains(t, err, "ref feature not found")
+}
@@ -0,0 +1,146 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+)
+
+// GiteaProvider accesses repositories on a Gitea or Forgejo instance (such as
+// Codeberg).
+type GiteaProvider struct{}
+
+// repoAPI returns the API URL for a Gitea repository, like
+// https://codeberg.org/api/v1/repos/user/repo.
+func (GiteaProvider) repoAPI(repo Repo) string {
+	return fmt.Sprintf("%s/api/v1/repos/%s", repo.BaseURL(), repo.Path)
+}
+
+func (p GiteaProvider) CommitInfo(ctx context.Context, repo Repo, commit string) (CommitInfo, error) {
+	// Gitea API: https://codeberg.org/api/v1/repos/user/repo/git/commits/sha
+	// (same format as GitHub)
+	var result githubCommit
+	if err := getJSON(ctx, p.repoAPI(repo)+"/git/commits/"+commit, giteaAuth(repo.Host), "commit info", &result); err != nil {
+		return CommitInfo{}, err
+	}
+	return result.info(), nil
+}
+
+func (p GiteaProvider) ResolveRef(ctx context.Context, repo Repo, ref string) (string, error) {
+	info, err := p.CommitInfo(ctx, repo, ref)
+	if err != nil {
+		return "", err
+	}
+	return info.Hash, nil
+}
+
+func (p GiteaProvider) CanonicalRepo(ctx context.Context, repo Repo) (Repo, error) {
+	// Gitea API: https://codeberg.org/api/v1/repos/user/repo (which redirects
+	// to the new location of a renamed or transferred repository)
+	var result struct {
+		FullName string `json:"full_name"`
+	}
+	if err := getJSON(ctx, p.repoAPI(repo), giteaAuth(repo.Host), "repository", &result); err != nil {
+		return Repo{}, err
+	}
+	return Repo{Scheme: repo.Scheme, Host: repo.Host, Path: result.FullName}, nil
+}
+
+func (p GiteaProvider) Archive(ctx context.Context, repo Repo, commit string) (io.ReadCloser, error) {
+	// Gitea API: https://codeberg.org/api/v1/repos/user/repo/archive/sha.tar.gz
+	return getStream(ctx, fmt.Sprintf("%s/archive/%s.tar.gz", p.repoAPI(repo), commit), giteaAuth(repo.Host))
+}
+
+func (p GiteaProvider) CommitsBetween(ctx context.Context, repo Repo, base, head string) ([]CommitInfo, error) {
+	// Gitea API: https://codeberg.org/api/v1/repos/user/repo/compare/base...head
+	// (commits in the same format as GitHub)
+	var result struct {
+		Commits []githubCommit `json:"commits"`
+	}
+	if err := getJSON(ctx, fmt.Sprintf("%s/compare/%s...%s", p.repoAPI(repo), base, head),
+		giteaAuth(repo.Host), "comparison", &result); err != nil {
+		return nil, err
+	}
+	var commits []CommitInfo
+	for _, c := range result.Commits {
+		commits = append(commits, c.info())
+	}
+	// the API lists the oldest commit first
+	slices.Reverse(commits)
+	return commits, nil
+}
+
+func (p GiteaProvider) ListFiles(ctx context.Context, repo Repo, commit string, opts ListOptions) ([]string, error) {
+	if opts.Recursive {
+		return p.listTree(ctx, repo, commit, opts)
+	}
+	// Gitea API: https://codeberg.org/api/v1/repos/user/repo/contents/path?ref=commit
+	contentsURL := p.repoAPI(repo) + "/contents"
+	if dir := opts.dir(); dir != "" {
+		contentsURL += "/" + dir
+	}
+
+	// Same format as GitHub (array of objects with "name", "type", "path")
+	var entries []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+		Path string `json:"path"`
+	}
+	if err := getJSON(ctx, contentsURL+"?ref="+commit, giteaAuth(repo.Host), "repository listing", &entries); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.Type == "file" && opts.includes(entry.Path) {
+			files = append(files, entry.Path)
+		}
+	}
+	return files, nil
+}
+
+// listTree lists files recursively using the (paginated) trees API.
+func (p GiteaProvider) listTree(ctx context.Context, repo Repo, commit string, opts ListOptions) ([]string, error) {
+	var files []string
+	for page := 1; ; page++ {
+		// Gitea API: https://codeberg.org/api/v1/repos/user/repo/git/trees/commit?recursive=true&page=1
+		apiURL := fmt.Sprintf("%s/git/trees/%s?recursive=true&page=%d", p.repoAPI(repo), commit, page)
+		var result struct {
+			Tree []struct {
+				Path string `json:"path"`
+				Type string `json:"type"`
+			} `json:"tree"`
+			Truncated bool `json:"truncated"`
+		}
+		if err := getJSON(ctx, apiURL, giteaAuth(repo.Host), "repository listing", &result); err != nil {
+			return nil, err
+		}
+		for _, entry := range result.Tree {
+			if entry.Type == "blob" && opts.includes(entry.Path) {
+				files = append(files, entry.Path)
+			}
+		}
+		if !result.Truncated || len(result.Tree) == 0 {
+			return files, nil
+		}
+	}
+}
+
+func (p GiteaProvider) GetFile(ctx context.Context, repo Repo, commit, path string) ([]byte, error) {
+	// Gitea API (which, unlike the web raw URL, accepts tokens):
+	// https://codeberg.org/api/v1/repos/user/repo/raw/path?ref=commit
+	rawURL := fmt.Sprintf("%s/raw/%s?ref=%s", p.repoAPI(repo), path, commit)
+	return getRaw(ctx, rawURL, giteaAuth(repo.Host))
+}
+
+// giteaAuth returns the headers that authenticate a request to the Gitea
+// instance at host.
+func giteaAuth(host string) http.Header {
+	header := make(http.Header)
+	if tok := token(host); tok != "" {
+		header.Set("Authorization", "token "+tok)
+	}
+	return header
+}
@@ -0,0 +1,67 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newGiteaServer starts a fake Gitea instance serving user/repo, which is
+// registered as a Gitea instance for the duration of the test.
+func newGiteaServer(t *testing.T) string {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/repos/user/repo/git/commits/abc123", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"sha": "abc1230000000000000000000000000000000000"})
+	})
+	mux.HandleFunc("/api/v1/repos/user/repo/contents", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "abc123", r.URL.Query().Get("ref"))
+		json.NewEncoder(w).Encode([]map[string]string{
+			{"name": "repo.opam", "path": "repo.opam", "type": "file"},
+			{"name": "src", "path": "src", "type": "dir"},
+		})
+	})
+	mux.HandleFunc("/api/v1/repos/user/repo/raw/repo.opam", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "abc123", r.URL.Query().Get("ref"))
+		assert.Equal(t, "token secret", r.Header.Get("Authorization"))
+		io.WriteString(w, "opam-version: \"2.0\"\n")
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	u, err := neturl.Parse(server.URL)
+	require.NoError(t, err)
+	RegisterProvider(u.Host, GiteaProvider{})
+	SetToken(u.Host, "secret")
+	t.Cleanup(func() {
+		delete(providers, u.Host)
+		delete(tokens, u.Host)
+	})
+	return server.URL + "/user/repo"
+}
+
+func TestGitea(t *testing.T) {
+	repo := newGiteaServer(t)
+	ctx := context.Background()
+
+	hash, err := ResolveCommitContext(ctx, "git+"+repo+".git", "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, "abc1230000000000000000000000000000000000", hash)
+
+	files, err := ListFilesContext(ctx, repo, "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"repo.opam"}, files)
+
+	data, err := GetFileContext(ctx, repo, "abc123", "repo.opam")
+	require.NoError(t, err)
+	assert.Equal(t, "opam-version: \"2.0\"\n", string(data))
+
+	_, err = GetFileContext(ctx, repo, "abc123", "missing.opam")
+	assert.ErrorIs(t, err, statusError(http.StatusNotFound))
+}
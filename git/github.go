@@ -0,0 +1,233 @@
+package git
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GitHubProvider accesses repositories on GitHub.
+type GitHubProvider struct {
+	// APIURL is the base URL of the REST API (https://api.github.com if
+	// empty); for GitHub Enterprise, this is https://<host>/api/v3.
+	APIURL string
+	// RawURL is the base URL for raw files (https://raw.githubusercontent.com
+	// if empty); for GitHub Enterprise, this is https://<host>/raw.
+	RawURL string
+}
+
+func (p GitHubProvider) apiURL() string {
+	if p.APIURL != "" {
+		return strings.TrimSuffix(p.APIURL, "/")
+	}
+	return "https://api.github.com"
+}
+
+func (p GitHubProvider) rawURL() string {
+	if p.RawURL != "" {
+		return strings.TrimSuffix(p.RawURL, "/")
+	}
+	return "https://raw.githubusercontent.com"
+}
+
+// githubCommit is the commit format of the GitHub (and Gitea) API
+type githubCommit struct {
+	SHA    string `json:"sha"`
+	Commit struct {
+		Author struct {
+			Name string `json:"name"`
+		} `json:"author"`
+		Committer struct {
+			Date time.Time `json:"date"`
+		} `json:"committer"`
+		Message string `json:"message"`
+	} `json:"commit"`
+}
+
+func (c githubCommit) info() CommitInfo {
+	return CommitInfo{
+		Hash:    c.SHA,
+		Author:  c.Commit.Author.Name,
+		Date:    c.Commit.Committer.Date,
+		Subject: firstLine(c.Commit.Message),
+	}
+}
+
+func (p GitHubProvider) CommitInfo(ctx context.Context, repo Repo, commit string) (CommitInfo, error) {
+	// GitHub API: https://api.github.com/repos/user/repo/commits/sha
+	apiURL := fmt.Sprintf("%s/repos/%s/commits/%s", p.apiURL(), repo.Path, commit)
+	var result githubCommit
+	if err := getJSON(ctx, apiURL, githubAuth(repo.Host), "commit info", &result); err != nil {
+		return CommitInfo{}, err
+	}
+	return result.info(), nil
+}
+
+func (p GitHubProvider) ResolveRef(ctx context.Context, repo Repo, ref string) (string, error) {
+	info, err := p.CommitInfo(ctx, repo, ref)
+	if err != nil {
+		return "", err
+	}
+	return info.Hash, nil
+}
+
+func (p GitHubProvider) CanonicalRepo(ctx context.Context, repo Repo) (Repo, error) {
+	// GitHub API: https://api.github.com/repos/user/repo (which redirects to
+	// the new location of a renamed or transferred repository)
+	var result struct {
+		FullName string `json:"full_name"`
+	}
+	apiURL := fmt.Sprintf("%s/repos/%s", p.apiURL(), repo.Path)
+	if err := getJSON(ctx, apiURL, githubAuth(repo.Host), "repository", &result); err != nil {
+		return Repo{}, err
+	}
+	return Repo{Scheme: repo.Scheme, Host: repo.Host, Path: result.FullName}, nil
+}
+
+func (p GitHubProvider) Archive(ctx context.Context, repo Repo, commit string) (io.ReadCloser, error) {
+	// GitHub API: https://api.github.com/repos/user/repo/tarball/sha (which
+	// redirects to a download URL)
+	return getStream(ctx, fmt.Sprintf("%s/repos/%s/tarball/%s", p.apiURL(), repo.Path, commit), githubAuth(repo.Host))
+}
+
+// githubComparePageSize is the number of commits requested per page of a
+// comparison
+const githubComparePageSize = 100
+
+func (p GitHubProvider) CommitsBetween(ctx context.Context, repo Repo, base, head string) ([]CommitInfo, error) {
+	// GitHub API: https://api.github.com/repos/user/repo/compare/base...head
+	var commits []CommitInfo
+	for page := 1; ; page++ {
+		apiURL := fmt.Sprintf("%s/repos/%s/compare/%s...%s?per_page=%d&page=%d",
+			p.apiURL(), repo.Path, base, head, githubComparePageSize, page)
+		var result struct {
+			AheadBy int            `json:"ahead_by"`
+			Commits []githubCommit `json:"commits"`
+		}
+		if err := getJSON(ctx, apiURL, githubAuth(repo.Host), "comparison", &result); err != nil {
+			return nil, err
+		}
+		for _, c := range result.Commits {
+			commits = append(commits, c.info())
+		}
+		if len(result.Commits) == 0 || len(commits) >= result.AheadBy {
+			break
+		}
+	}
+	// the API lists the oldest commit first
+	slices.Reverse(commits)
+	return commits, nil
+}
+
+func (p GitHubProvider) ListFiles(ctx context.Context, repo Repo, commit string, opts ListOptions) ([]string, error) {
+	if opts.Recursive {
+		return p.listTree(ctx, repo, commit, opts)
+	}
+	// GitHub API: https://api.github.com/repos/user/repo/contents/path?ref=commit
+	contentsURL := fmt.Sprintf("%s/repos/%s/contents", p.apiURL(), repo.Path)
+	if dir := opts.dir(); dir != "" {
+		contentsURL += "/" + dir
+	}
+
+	// array of objects with "name", "type", etc.
+	var entries []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+		Path string `json:"path"`
+	}
+	if err := getJSON(ctx, contentsURL+"?ref="+commit, githubAuth(repo.Host), "repository listing", &entries); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		// Only include files (not directories)
+		if entry.Type == "file" && opts.includes(entry.Path) {
+			files = append(files, entry.Path)
+		}
+	}
+	return files, nil
+}
+
+// listTree lists files recursively using the trees API, which returns the
+// whole tree of a commit in one request.
+func (p GitHubProvider) listTree(ctx context.Context, repo Repo, commit string, opts ListOptions) ([]string, error) {
+	// GitHub API: https://api.github.com/repos/user/repo/git/trees/commit?recursive=1
+	apiURL := fmt.Sprintf("%s/repos/%s/git/trees/%s?recursive=1", p.apiURL(), repo.Path, commit)
+	var result struct {
+		Tree []struct {
+			Path string `json:"path"`
+			Type string `json:"type"`
+		} `json:"tree"`
+		Truncated bool `json:"truncated"`
+	}
+	if err := getJSON(ctx, apiURL, githubAuth(repo.Host), "repository listing", &result); err != nil {
+		return nil, err
+	}
+	if result.Truncated {
+		return nil, fmt.Errorf("%w: tree of %s is too large to list with the GitHub API", ErrUnsupported, commit)
+	}
+
+	var files []string
+	for _, entry := range result.Tree {
+		if entry.Type == "blob" && opts.includes(entry.Path) {
+			files = append(files, entry.Path)
+		}
+	}
+	return files, nil
+}
+
+func (p GitHubProvider) GetFile(ctx context.Context, repo Repo, commit, path string) ([]byte, error) {
+	header := githubAuth(repo.Host)
+	if len(header) > 0 {
+		return p.getContents(ctx, repo, commit, path, header)
+	}
+	// GitHub: https://github.com/user/repo -> https://raw.githubusercontent.com/user/repo/commit/path
+	rawURL := fmt.Sprintf("%s/%s/%s/%s", p.rawURL(), repo.Path, commit, path)
+	return getRaw(ctx, rawURL, header)
+}
+
+// getContents gets a file through the contents API, which (unlike raw file
+// URLs) reliably accepts tokens for private repositories.
+func (p GitHubProvider) getContents(ctx context.Context, repo Repo, commit, path string, header http.Header) ([]byte, error) {
+	// GitHub API: https://api.github.com/repos/user/repo/contents/path?ref=commit
+	apiURL := fmt.Sprintf("%s/repos/%s/contents/%s?ref=%s", p.apiURL(), repo.Path, path, commit)
+	var result struct {
+		Type     string `json:"type"`
+		Encoding string `json:"encoding"`
+		Content  string `json:"content"`
+	}
+	if err := getJSON(ctx, apiURL, header, "file", &result); err != nil {
+		return nil, err
+	}
+	if result.Type != "file" {
+		return nil, fmt.Errorf("%s is a %s, not a file", path, result.Type)
+	}
+	if result.Encoding == "base64" {
+		// the content is split into lines
+		data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(result.Content, "\n", ""))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+		return data, nil
+	}
+	// files over 1MB are not included in the response, but can be requested
+	// in raw form
+	raw := header.Clone()
+	raw.Set("Accept", "application/vnd.github.raw+json")
+	return getRaw(ctx, apiURL, raw)
+}
+
+// githubAuth returns the headers that authenticate a request to GitHub.
+func githubAuth(host string) http.Header {
+	header := make(http.Header)
+	if tok := token(host); tok != "" {
+		header.Set("Authorization", "Bearer "+tok)
+	}
+	return header
+}
@@ -0,0 +1,167 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GitLabProvider accesses repositories on a GitLab instance (gitlab.com or
+// self-hosted).
+type GitLabProvider struct{}
+
+// projectAPI returns the API URL for a GitLab project, like
+// https://gitlab.com/api/v4/projects/user%2Frepo.
+func (GitLabProvider) projectAPI(repo Repo) string {
+	projectPath := strings.ReplaceAll(repo.Path, "/", "%2F")
+	return fmt.Sprintf("%s/api/v4/projects/%s", repo.BaseURL(), projectPath)
+}
+
+// gitlabCommit is the commit format of the GitLab API
+type gitlabCommit struct {
+	ID            string    `json:"id"`
+	AuthorName    string    `json:"author_name"`
+	CommittedDate time.Time `json:"committed_date"`
+	Title         string    `json:"title"`
+}
+
+func (c gitlabCommit) info() CommitInfo {
+	return CommitInfo{
+		Hash:    c.ID,
+		Author:  c.AuthorName,
+		Date:    c.CommittedDate,
+		Subject: c.Title,
+	}
+}
+
+func (p GitLabProvider) CommitInfo(ctx context.Context, repo Repo, commit string) (CommitInfo, error) {
+	// GitLab API: https://gitlab.com/api/v4/projects/user%2Frepo/repository/commits/sha
+	apiURL := fmt.Sprintf("%s/repository/commits/%s", p.projectAPI(repo), commit)
+	var result gitlabCommit
+	if err := getJSON(ctx, apiURL, gitlabAuth(repo.Host), "commit info", &result); err != nil {
+		return CommitInfo{}, err
+	}
+	return result.info(), nil
+}
+
+func (p GitLabProvider) CommitsBetween(ctx context.Context, repo Repo, base, head string) ([]CommitInfo, error) {
+	// GitLab API: https://gitlab.com/api/v4/projects/user%2Frepo/repository/compare?from=base&to=head
+	query := neturl.Values{}
+	query.Set("from", base)
+	query.Set("to", head)
+	apiURL := fmt.Sprintf("%s/repository/compare?%s", p.projectAPI(repo), query.Encode())
+	var result struct {
+		Commits []gitlabCommit `json:"commits"`
+	}
+	if err := getJSON(ctx, apiURL, gitlabAuth(repo.Host), "comparison", &result); err != nil {
+		return nil, err
+	}
+	var commits []CommitInfo
+	for _, c := range result.Commits {
+		commits = append(commits, c.info())
+	}
+	// the API lists the oldest commit first
+	slices.Reverse(commits)
+	return commits, nil
+}
+
+func (p GitLabProvider) ResolveRef(ctx context.Context, repo Repo, ref string) (string, error) {
+	info, err := p.CommitInfo(ctx, repo, ref)
+	if err != nil {
+		return "", err
+	}
+	return info.Hash, nil
+}
+
+func (p GitLabProvider) CanonicalRepo(ctx context.Context, repo Repo) (Repo, error) {
+	// GitLab API: https://gitlab.com/api/v4/projects/user%2Frepo (GitLab
+	// keeps the old path of a moved project as an alias)
+	var result struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	}
+	if err := getJSON(ctx, p.projectAPI(repo), gitlabAuth(repo.Host), "project", &result); err != nil {
+		return Repo{}, err
+	}
+	return Repo{Scheme: repo.Scheme, Host: repo.Host, Path: result.PathWithNamespace}, nil
+}
+
+func (p GitLabProvider) Archive(ctx context.Context, repo Repo, commit string) (io.ReadCloser, error) {
+	// GitLab API: https://gitlab.com/api/v4/projects/user%2Frepo/repository/archive.tar.gz?sha=sha
+	apiURL := fmt.Sprintf("%s/repository/archive.tar.gz?sha=%s", p.projectAPI(repo), neturl.QueryEscape(commit))
+	return getStream(ctx, apiURL, gitlabAuth(repo.Host))
+}
+
+// gitlabPageSize is the number of entries requested per page (the maximum
+// GitLab allows)
+const gitlabPageSize = 100
+
+func (p GitLabProvider) ListFiles(ctx context.Context, repo Repo, commit string, opts ListOptions) ([]string, error) {
+	// GitLab API: https://gitlab.com/api/v4/projects/user%2Frepo/repository/tree?ref=commit&path=dir&recursive=true
+	query := neturl.Values{}
+	query.Set("ref", commit)
+	if dir := opts.dir(); dir != "" {
+		query.Set("path", dir)
+	}
+	if opts.Recursive {
+		query.Set("recursive", "true")
+	}
+	query.Set("per_page", strconv.Itoa(gitlabPageSize))
+
+	var files []string
+	// the listing is paginated
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		apiURL := fmt.Sprintf("%s/repository/tree?%s", p.projectAPI(repo), query.Encode())
+
+		// array of objects with "name", "type", "path"
+		var entries []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+			Path string `json:"path"`
+		}
+		if err := getJSON(ctx, apiURL, gitlabAuth(repo.Host), "repository listing", &entries); err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			// Only include files (blobs)
+			if entry.Type == "blob" && opts.includes(entry.Path) {
+				files = append(files, entry.Path)
+			}
+		}
+		if len(entries) < gitlabPageSize {
+			return files, nil
+		}
+	}
+}
+
+func (p GitLabProvider) GetFile(ctx context.Context, repo Repo, commit, path string) ([]byte, error) {
+	header := gitlabAuth(repo.Host)
+	var rawURL string
+	if len(header) > 0 {
+		// Raw file URLs do not accept API tokens, so private
+		// repositories go through the API:
+		// https://gitlab.com/api/v4/projects/user%2Frepo/repository/files/path/raw?ref=commit
+		rawURL = fmt.Sprintf("%s/repository/files/%s/raw?ref=%s",
+			p.projectAPI(repo), neturl.PathEscape(path), commit)
+	} else {
+		// GitLab: https://gitlab.com/user/repo -> https://gitlab.com/user/repo/-/raw/commit/path
+		rawURL = fmt.Sprintf("%s/-/raw/%s/%s", repo.URL(), commit, path)
+	}
+	return getRaw(ctx, rawURL, header)
+}
+
+// gitlabAuth returns the headers that authenticate a request to the GitLab
+// instance at host.
+func gitlabAuth(host string) http.Header {
+	header := make(http.Header)
+	if tok := token(host); tok != "" {
+		header.Set("PRIVATE-TOKEN", tok)
+	}
+	return header
+}
@@ -0,0 +1,204 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// HTTPOptions configures network access for hosting APIs and git.
+type HTTPOptions struct {
+	// Proxy is the URL of an HTTP(S) proxy. If empty, the proxy is taken from
+	// the HTTPS_PROXY, HTTP_PROXY, and NO_PROXY environment variables.
+	Proxy string
+	// CAFile is a PEM file of certificate authorities to trust in addition to
+	// the system ones, such as for a TLS-intercepting corporate proxy. This
+	// holds for git as well, which is given a bundle combining its default
+	// certificate authorities with these (see gitCABundle).
+	CAFile string
+	// Timeout limits each HTTP request, including reading the response (no
+	// limit if zero).
+	Timeout time.Duration
+	// RateLimitWait is the longest to wait for an exhausted API rate limit to
+	// reset before retrying; if the reset is later, requests fail with a
+	// RateLimitError instead.
+	RateLimitWait time.Duration
+}
+
+// maxConnsPerHost limits the concurrent connections to each API host, so
+// that parallel fetches do not trip abuse detection.
+const maxConnsPerHost = 8
+
+// newTransport returns a transport that keeps connections to API hosts alive
+// for reuse by later requests. Connections use HTTP/2 when the server
+// supports it, which multiplexes concurrent requests over one connection.
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = true
+	transport.MaxConnsPerHost = maxConnsPerHost
+	transport.MaxIdleConnsPerHost = maxConnsPerHost
+	return transport
+}
+
+// httpClient is shared by all API requests, so that they reuse connections
+// (see ConfigureHTTP)
+var httpClient = &http.Client{Transport: newTransport()}
+
+// rateLimitWait is set by ConfigureHTTP
+var rateLimitWait time.Duration
+
+// gitConfig holds extra configuration passed to every git command, to match
+// httpClient
+var gitConfig []string
+
+// ConfigureHTTP sets up the HTTP client used for API requests, and the
+// equivalent settings for git commands.
+func ConfigureHTTP(opts HTTPOptions) error {
+	transport := newTransport()
+	var config []string
+	if opts.Proxy != "" {
+		proxy, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return fmt.Errorf("invalid proxy URL %q: %w", opts.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+		config = append(config, "http.proxy="+opts.Proxy)
+	}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", opts.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+		bundle, err := gitCABundle(opts.CAFile, pem)
+		if err != nil {
+			return err
+		}
+		config = append(config, "http.sslCAInfo="+bundle)
+	}
+	httpClient = &http.Client{Transport: transport, Timeout: opts.Timeout}
+	gitConfig = config
+	rateLimitWait = opts.RateLimitWait
+	return nil
+}
+
+// systemCABundles are the usual locations of the system's PEM bundle of
+// certificate authorities, which git uses by default (the same list as Go's
+// crypto/x509 on Linux, plus macOS)
+var systemCABundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",                // Debian, Ubuntu, Arch
+	"/etc/pki/tls/certs/ca-bundle.crt",                  // Fedora, RHEL
+	"/etc/ssl/ca-bundle.pem",                            // openSUSE
+	"/etc/pki/tls/cacert.pem",                           // OpenELEC
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", // CentOS, RHEL 7
+	"/etc/ssl/cert.pem",                                 // Alpine, macOS
+}
+
+// defaultGitCABundle returns the CA bundle git would use without
+// http.sslCAInfo from ConfigureHTTP: the one configured for git, or else the
+// system one. It returns "" if none is found.
+var defaultGitCABundle = func() string {
+	candidates := []string{os.Getenv("SSL_CERT_FILE")}
+	if out, err := exec.Command("git", "config", "--get", "--path", "http.sslCAInfo").Output(); err == nil {
+		candidates = append(candidates, strings.TrimSpace(string(out)))
+	}
+	for _, path := range append(candidates, systemCABundles...) {
+		if info, err := os.Stat(path); path != "" && err == nil && info.Mode().IsRegular() {
+			return path
+		}
+	}
+	return ""
+}
+
+// gitCABundle returns a CA bundle for git that trusts the certificates in
+// caFile (with contents pem) in addition to the default ones.
+//
+// Unlike Go's TLS configuration, http.sslCAInfo replaces git's list of
+// certificate authorities rather than adding to it, so passing caFile
+// directly would break access to public hosts if it holds only a corporate
+// CA. The combined bundle is written to the cache directory, named after its
+// contents. If no default bundle is found (for example, when git uses the
+// platform's certificate store), caFile is used as is.
+func gitCABundle(caFile string, pem []byte) (string, error) {
+	system := defaultGitCABundle()
+	if system == "" {
+		return caFile, nil
+	}
+	systemPEM, err := os.ReadFile(system)
+	if err != nil {
+		return "", fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	combined := bytes.Join([][]byte{bytes.TrimRight(systemPEM, "\n"), pem}, []byte("\n"))
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot store CA bundle for git: %w", err)
+	}
+	sum := sha256.Sum256(combined)
+	path := filepath.Join(cacheDir, "perennial-cli", "ca", hex.EncodeToString(sum[:])+".pem")
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("cannot store CA bundle for git: %w", err)
+	}
+	// write atomically, since other processes may be using the bundle
+	f, err := os.CreateTemp(filepath.Dir(path), "bundle-*")
+	if err != nil {
+		return "", fmt.Errorf("cannot store CA bundle for git: %w", err)
+	}
+	_, err = f.Write(combined)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("cannot store CA bundle for git: %w", err)
+	}
+	return path, nil
+}
+
+// gitCommand prepares a git command with the configuration from
+// ConfigureHTTP.
+//
+// While offline (see SetOffline), git may only use local repositories; this
+// also stops it from lazily fetching file contents missing from the clone
+// cache.
+func gitCommand(ctx context.Context, args ...string) *exec.Cmd {
+	var configArgs []string
+	for _, c := range gitConfig {
+		configArgs = append(configArgs, "-c", c)
+	}
+	if offline {
+		configArgs = append(configArgs, "-c", "protocol.allow=never", "-c", "protocol.file.allow=always")
+	}
+	return exec.CommandContext(ctx, "git", append(configArgs, args...)...)
+}
+
+// closeBody discards the rest of a response body (up to a limit) before
+// closing it, which lets the connection be reused.
+func closeBody(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
@@ -0,0 +1,106 @@
+package git
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigureHTTP_CAFile(t *testing.T) {
+	useTempCache(t)
+	fastRetries(t)
+	defer ConfigureHTTP(HTTPOptions{})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// the test server's certificate is not trusted by default
+	require.NoError(t, ConfigureHTTP(HTTPOptions{}))
+	_, err := getRaw(t.Context(), server.URL, nil)
+	assert.Error(t, err)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, cert, 0644))
+	useCABundle(t, "")
+	require.NoError(t, ConfigureHTTP(HTTPOptions{CAFile: caFile}))
+	assert.Equal(t, []string{"http.sslCAInfo=" + caFile}, gitConfig)
+	data, err := getRaw(t.Context(), server.URL, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(data))
+}
+
+// useCABundle makes path the default CA bundle for git during a test
+func useCABundle(t *testing.T, path string) {
+	old := defaultGitCABundle
+	defaultGitCABundle = func() string { return path }
+	t.Cleanup(func() { defaultGitCABundle = old })
+}
+
+func TestConfigureHTTP_GitCABundle(t *testing.T) {
+	useTempCache(t)
+	defer ConfigureHTTP(HTTPOptions{})
+	dir := t.TempDir()
+	system := filepath.Join(dir, "system.pem")
+	systemCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("system")})
+	require.NoError(t, os.WriteFile(system, systemCert, 0644))
+	caFile := filepath.Join(dir, "corporate.pem")
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	corporateCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, corporateCert, 0644))
+
+	// git trusts both the default certificate authorities and the CA file
+	useCABundle(t, system)
+	require.NoError(t, ConfigureHTTP(HTTPOptions{CAFile: caFile}))
+	require.Len(t, gitConfig, 1)
+	bundle, ok := strings.CutPrefix(gitConfig[0], "http.sslCAInfo=")
+	require.True(t, ok)
+	assert.NotEqual(t, caFile, bundle)
+	data, err := os.ReadFile(bundle)
+	require.NoError(t, err)
+	assert.Equal(t, string(systemCert)+string(corporateCert), string(data))
+
+	// the same bundle is reused
+	require.NoError(t, ConfigureHTTP(HTTPOptions{CAFile: caFile}))
+	assert.Equal(t, []string{"http.sslCAInfo=" + bundle}, gitConfig)
+}
+
+func TestConfigureHTTP_Proxy(t *testing.T) {
+	useTempCache(t)
+	defer ConfigureHTTP(HTTPOptions{})
+	proxied := ""
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a proxy receives the full URL of plain HTTP requests
+		proxied = r.URL.String()
+		w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+
+	require.NoError(t, ConfigureHTTP(HTTPOptions{Proxy: proxy.URL}))
+	assert.Equal(t, []string{"http.proxy=" + proxy.URL}, gitConfig)
+	data, err := getRaw(t.Context(), "http://git.example.com/file", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "via proxy", string(data))
+	assert.Equal(t, "http://git.example.com/file", proxied)
+	assert.Equal(t, []string{"-c", "http.proxy=" + proxy.URL, "status"}, gitCommand(t.Context(), "status").Args[1:])
+}
+
+func TestConfigureHTTP_Errors(t *testing.T) {
+	defer ConfigureHTTP(HTTPOptions{})
+	assert.Error(t, ConfigureHTTP(HTTPOptions{CAFile: filepath.Join(t.TempDir(), "missing.pem")}))
+
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0644))
+	assert.ErrorContains(t, ConfigureHTTP(HTTPOptions{CAFile: notPEM}), "no certificates")
+
+	assert.Error(t, ConfigureHTTP(HTTPOptions{Proxy: "://bad"}))
+}
@@ -0,0 +1,55 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrOffline means an operation needed the network, which is disabled by
+// SetOffline.
+var ErrOffline = errors.New("network access disabled in offline mode")
+
+// offline is set by SetOffline
+var offline bool
+
+// SetOffline disables (or re-enables) network access. While offline,
+// operations are answered from the clone cache and the API response cache,
+// and anything else fails immediately with an error wrapping ErrOffline
+// rather than waiting for the network. Repositories at local paths are still
+// accessed directly.
+func SetOffline(on bool) {
+	offline = on
+}
+
+// isLocalRemote reports whether gitURL is a repository on the local
+// filesystem, following git's rules for distinguishing paths from URLs.
+func isLocalRemote(gitURL string) bool {
+	_, ok := localPath(gitURL)
+	return ok
+}
+
+// localPath returns the path of a repository on the local filesystem, given
+// as a plain path or a file:// URL.
+func localPath(gitURL string) (string, bool) {
+	url := strings.TrimPrefix(gitURL, "git+")
+	if path, ok := strings.CutPrefix(url, "file://"); ok {
+		return path, true
+	}
+	if strings.Contains(url, "://") {
+		return "", false
+	}
+	if _, _, scp := cutSCPLike(url); scp {
+		return "", false
+	}
+	return url, true
+}
+
+// checkOnline returns an error if accessing the remote at gitURL needs the
+// network while offline.
+func checkOnline(gitURL string) error {
+	if offline && !isLocalRemote(gitURL) {
+		return fmt.Errorf("cannot contact %s: %w", strings.TrimPrefix(gitURL, "git+"), ErrOffline)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package git
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useOffline(t *testing.T) {
+	SetOffline(true)
+	t.Cleanup(func() { SetOffline(false) })
+}
+
+func TestOffline_Remotes(t *testing.T) {
+	useOffline(t)
+	ctx := context.Background()
+	for _, url := range []string{
+		"https://github.com/mit-pdos/perennial",
+		"git+https://gitlab.mpi-sws.org/iris/iris",
+		"git@github.com:mit-pdos/perennial.git",
+	} {
+		_, err := GetLatestCommitContext(ctx, url)
+		assert.ErrorIs(t, err, ErrOffline, url)
+		_, err = SnapshotRefs(ctx, url)
+		assert.ErrorIs(t, err, ErrOffline, url)
+	}
+
+	// local repositories do not need the network
+	repo := newLocalRepo(t)
+	_, err := GetLatestCommit(repo)
+	assert.NoError(t, err)
+	_, err = GetLatestCommit("file://" + repo)
+	assert.NoError(t, err)
+}
+
+func TestOffline_HTTPCache(t *testing.T) {
+	useTempCache(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, "cached body")
+	}))
+	defer server.Close()
+
+	_, err := getRaw(context.Background(), server.URL+"/file", nil)
+	require.NoError(t, err)
+
+	useOffline(t)
+	server.Close()
+	data, err := getRaw(context.Background(), server.URL+"/file", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "cached body", string(data))
+
+	_, err = getRaw(context.Background(), server.URL+"/other", nil)
+	assert.ErrorIs(t, err, ErrOffline)
+}
+
+func TestOffline_CloneCache(t *testing.T) {
+	useTempCache(t)
+	// cache a commit of a "remote" repository through a local clone, then
+	// pretend the remote is a URL that would need the network
+	repo := newLocalRepo(t)
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "example.opam"), nil, 0644))
+	gitCmd(t, repo, "add", ".")
+	gitCmd(t, repo, "commit", "--quiet", "-m", "add opam file")
+	gitCmd(t, repo, "config", "uploadpack.allowFilter", "true")
+	commit := gitCmd(t, repo, "rev-parse", "HEAD")
+	url := "https://git.example.com/repo"
+	redirectRemote(t, url, repo)
+
+	_, err := ListFiles(url, commit)
+	require.NoError(t, err)
+
+	useOffline(t)
+	// without the redirect, git would need the network to reach the remote
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	_, err = ListFiles(url, commit)
+	assert.NoError(t, err)
+	_, err = ListFiles(url, "0123456789012345678901234567890123456789")
+	assert.ErrorIs(t, err, ErrOffline)
+	// file contents are not cached until they are read
+	_, err = GetFile(url, commit, "example.opam")
+	assert.ErrorIs(t, err, ErrOffline)
+}
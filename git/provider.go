@@ -0,0 +1,292 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// Repo identifies a repository on a git host.
+type Repo struct {
+	Scheme string // https (or http)
+	Host   string // like github.com
+	Path   string // like mit-pdos/perennial (without .git)
+}
+
+// ParseRepo parses the URL of a repository, with or without the git+ prefix
+// and .git suffix used in opam files.
+//
+// SSH remotes (ssh://git@github.com/owner/repo or the scp-like
+// git@github.com:owner/repo.git) are also accepted, and identify the
+// repository at the same path on the host's web URL.
+func ParseRepo(gitURL string) (Repo, error) {
+	rawURL := strings.TrimPrefix(gitURL, "git+")
+	if host, path, ok := cutSCPLike(rawURL); ok {
+		rawURL = "ssh://" + host + "/" + path
+	}
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return Repo{}, fmt.Errorf("invalid repository URL: %w", err)
+	}
+	switch u.Scheme {
+	case "https", "http":
+	case "ssh":
+		// the web interface and API are on the same host, over https
+		u.Scheme = "https"
+		u.Host = u.Hostname()
+	default:
+		return Repo{}, fmt.Errorf("not a web URL: %s", gitURL)
+	}
+	if u.Host == "" {
+		return Repo{}, fmt.Errorf("not a web URL: %s", gitURL)
+	}
+	path := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if path == "" {
+		return Repo{}, fmt.Errorf("no repository in URL: %s", gitURL)
+	}
+	return Repo{Scheme: u.Scheme, Host: u.Host, Path: path}, nil
+}
+
+// cutSCPLike splits an scp-like git remote ([user@]host:path) into the
+// host (with the user, if any) and path. As in git, this syntax is recognized
+// when there is a colon before the first slash.
+func cutSCPLike(remote string) (host, path string, ok bool) {
+	if strings.Contains(remote, "://") {
+		return "", "", false
+	}
+	host, path, ok = strings.Cut(remote, ":")
+	if !ok || host == "" || strings.Contains(host, "/") {
+		return "", "", false
+	}
+	return host, strings.TrimPrefix(path, "/"), true
+}
+
+// BaseURL returns the URL of the host, like https://github.com.
+func (r Repo) BaseURL() string {
+	return r.Scheme + "://" + r.Host
+}
+
+// URL returns the web URL of the repository, like
+// https://github.com/mit-pdos/perennial.
+func (r Repo) URL() string {
+	return r.BaseURL() + "/" + r.Path
+}
+
+// CommitInfo is metadata about a commit.
+type CommitInfo struct {
+	Hash    string // full commit hash
+	Author  string
+	Date    time.Time // commit date
+	Subject string    // first line of the commit message
+}
+
+// String formats the commit as its short hash, date, and subject, like
+// "577140b (2024-05-02: fix wp lemma)".
+func (c CommitInfo) String() string {
+	return fmt.Sprintf("%s (%s: %s)", shortHash(c.Hash), c.Date.Format(time.DateOnly), c.Subject)
+}
+
+// shortHash abbreviates a commit hash for display.
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
+
+// Provider implements access to repositories through the API of one kind of
+// git host (like GitHub or GitLab).
+//
+// Methods may return an error wrapping ErrUnsupported for operations the host
+// cannot do; these (and other failures, except for 404s) fall back to
+// fetching the repository with git.
+type Provider interface {
+	// ResolveRef resolves a ref (a branch, tag, or abbreviated commit hash)
+	// to a full commit hash.
+	ResolveRef(ctx context.Context, repo Repo, ref string) (string, error)
+	// ListFiles lists the files in a directory of the repository at commit,
+	// as paths relative to the repository root.
+	ListFiles(ctx context.Context, repo Repo, commit string, opts ListOptions) ([]string, error)
+	// GetFile gets the contents of path at commit.
+	GetFile(ctx context.Context, repo Repo, commit, path string) ([]byte, error)
+	// CommitInfo gets the metadata of a commit.
+	CommitInfo(ctx context.Context, repo Repo, commit string) (CommitInfo, error)
+	// CommitsBetween lists the commits reachable from head but not from base,
+	// newest first.
+	CommitsBetween(ctx context.Context, repo Repo, base, head string) ([]CommitInfo, error)
+	// CanonicalRepo returns the current location of repo, which differs from
+	// repo if it was renamed or transferred.
+	CanonicalRepo(ctx context.Context, repo Repo) (Repo, error)
+	// Archive downloads the repository at commit as a gzipped tarball.
+	Archive(ctx context.Context, repo Repo, commit string) (io.ReadCloser, error)
+}
+
+// ListOptions selects the files returned by ListFilesWith.
+type ListOptions struct {
+	// Path is the directory to list, relative to the repository root (empty
+	// for the root).
+	Path string
+	// Recursive also lists the files in subdirectories.
+	Recursive bool
+}
+
+// dir returns the directory to list, without leading or trailing slashes.
+func (opts ListOptions) dir() string {
+	return strings.Trim(opts.Path, "/")
+}
+
+// includes reports whether the file at path (relative to the repository
+// root) is selected by opts.
+func (opts ListOptions) includes(path string) bool {
+	rel := path
+	if dir := opts.dir(); dir != "" {
+		var ok bool
+		rel, ok = strings.CutPrefix(path, dir+"/")
+		if !ok {
+			return false
+		}
+	}
+	return opts.Recursive || !strings.Contains(rel, "/")
+}
+
+// ErrUnsupported means an operation is not supported for a host (either
+// because there is no Provider for the host, or the Provider does not support
+// it).
+var ErrUnsupported = errors.New("unsupported git hosting service")
+
+// providers maps hosts to their Provider
+var providers = map[string]Provider{
+	"github.com":   GitHubProvider{},
+	"gitlab.com":   GitLabProvider{},
+	"codeberg.org": GiteaProvider{},
+	"git.sr.ht":    SourcehutProvider{},
+}
+
+// RegisterProvider sets the Provider used for repositories on host (like
+// gitlab.mpi-sws.org), replacing any previous one. A nil Provider disables API
+// access for host, so that its repositories are always fetched with git.
+func RegisterProvider(host string, p Provider) {
+	providers[host] = p
+}
+
+// ProviderKinds are the kinds of hosting software accepted by NewProvider.
+var ProviderKinds = []string{"github", "gitlab", "gitea", "forgejo", "sourcehut", "git"}
+
+// NewProvider returns a Provider for a self-hosted instance of kind (one of
+// ProviderKinds) at host. The kind "git" returns a nil Provider, which
+// accesses repositories only with git (see RegisterProvider).
+func NewProvider(kind, host string) (Provider, error) {
+	switch kind {
+	case "github":
+		// GitHub Enterprise Server
+		return GitHubProvider{
+			APIURL: "https://" + host + "/api/v3",
+			RawURL: "https://" + host + "/raw",
+		}, nil
+	case "gitlab":
+		return GitLabProvider{}, nil
+	case "gitea", "forgejo":
+		return GiteaProvider{}, nil
+	case "sourcehut":
+		return SourcehutProvider{}, nil
+	case "git":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown host type %q for %s (expected one of %s)",
+		kind, host, strings.Join(ProviderKinds, ", "))
+}
+
+// providerFor returns the Provider for host, or nil if there is none.
+func providerFor(host string) Provider {
+	if p, ok := providers[host]; ok {
+		return p
+	}
+	// guess the software of self-hosted instances that are not configured
+	// from their name
+	switch {
+	case strings.Contains(host, "gitlab"):
+		return GitLabProvider{}
+	case strings.Contains(host, "gitea"), strings.Contains(host, "forgejo"):
+		return GiteaProvider{}
+	}
+	return nil
+}
+
+// lookupProvider parses gitURL and finds the Provider for its host.
+func lookupProvider(gitURL string) (Repo, Provider, error) {
+	repo, err := ParseRepo(gitURL)
+	if err != nil {
+		return Repo{}, nil, fmt.Errorf("%w: %s", ErrUnsupported, gitURL)
+	}
+	p := providerFor(repo.Host)
+	if p == nil {
+		return repo, nil, fmt.Errorf("%w: %s", ErrUnsupported, repo.Host)
+	}
+	return repo, p, nil
+}
+
+// getJSON fetches url and decodes the JSON response into v. what describes
+// the request for error messages.
+func getJSON(ctx context.Context, url string, header http.Header, what string, v any) error {
+	resp, err := httpGet(ctx, url, header)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", what, err)
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch %s: %w", what, responseError(resp))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse API response for %s: %w", what, err)
+	}
+	return nil
+}
+
+// getRaw downloads the file at url.
+func getRaw(ctx context.Context, url string, header http.Header) ([]byte, error) {
+	resp, err := httpGet(ctx, url, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch file: %w", err)
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch file: %w", responseError(resp))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return data, nil
+}
+
+// getStream downloads url without reading the response, for large downloads
+// (which are not cached, unlike the responses of httpGet).
+func getStream(ctx context.Context, url string, header http.Header) (io.ReadCloser, error) {
+	if offline {
+		return nil, fmt.Errorf("cannot fetch %s: %w", url, ErrOffline)
+	}
+	resp, err := httpGetRetry(ctx, url, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download archive: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer closeBody(resp)
+		return nil, fmt.Errorf("failed to download archive: %w", responseError(resp))
+	}
+	return resp.Body, nil
+}
+
+// firstLine returns the subject of a commit message.
+func firstLine(message string) string {
+	subject, _, _ := strings.Cut(message, "\n")
+	return strings.TrimSpace(subject)
+}
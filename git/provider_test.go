@@ -0,0 +1,349 @@
+package git
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRepo(t *testing.T) {
+	tests := []struct {
+		url  string
+		repo Repo
+	}{
+		{"https://github.com/mit-pdos/perennial", Repo{"https", "github.com", "mit-pdos/perennial"}},
+		{"git+https://github.com/mit-pdos/perennial.git", Repo{"https", "github.com", "mit-pdos/perennial"}},
+		{"https://gitlab.mpi-sws.org/iris/stdpp/", Repo{"https", "gitlab.mpi-sws.org", "iris/stdpp"}},
+		{"https://gitlab.com/group/subgroup/repo", Repo{"https", "gitlab.com", "group/subgroup/repo"}},
+		{"git@github.com:mit-pdos/perennial.git", Repo{"https", "github.com", "mit-pdos/perennial"}},
+		{"github.com:mit-pdos/perennial", Repo{"https", "github.com", "mit-pdos/perennial"}},
+		{"ssh://git@gitlab.mpi-sws.org:2222/iris/stdpp.git", Repo{"https", "gitlab.mpi-sws.org", "iris/stdpp"}},
+		{"git+ssh://git@github.com/mit-pdos/perennial", Repo{"https", "github.com", "mit-pdos/perennial"}},
+	}
+	for _, tt := range tests {
+		repo, err := ParseRepo(tt.url)
+		require.NoError(t, err, tt.url)
+		assert.Equal(t, tt.repo, repo, tt.url)
+	}
+	assert.Equal(t, "https://github.com/mit-pdos/perennial", tests[0].repo.URL())
+
+	for _, url := range []string{"/tmp/repo", "https://github.com/", "file:///tmp/repo", "./repo:name", "git@github.com:"} {
+		_, err := ParseRepo(url)
+		assert.Error(t, err, url)
+	}
+}
+
+func TestProviderFor(t *testing.T) {
+	assert.Equal(t, GitHubProvider{}, providerFor("github.com"))
+	assert.Equal(t, GitLabProvider{}, providerFor("gitlab.com"))
+	assert.Equal(t, GitLabProvider{}, providerFor("gitlab.mpi-sws.org"))
+	assert.Equal(t, GiteaProvider{}, providerFor("codeberg.org"))
+	assert.Equal(t, GiteaProvider{}, providerFor("gitea.example.com"))
+	assert.Equal(t, SourcehutProvider{}, providerFor("git.sr.ht"))
+	assert.Nil(t, providerFor("example.com"))
+
+	RegisterProvider("example.com", GitLabProvider{})
+	defer delete(providers, "example.com")
+	assert.Equal(t, GitLabProvider{}, providerFor("example.com"))
+}
+
+func TestLookupProvider_SSH(t *testing.T) {
+	repo, p, err := lookupProvider("git@github.com:mit-pdos/perennial.git")
+	require.NoError(t, err)
+	assert.Equal(t, GitHubProvider{}, p)
+	assert.Equal(t, "https://github.com/mit-pdos/perennial", repo.URL())
+
+	// SSH remotes are passed to git as-is
+	assert.Equal(t, "git@github.com:mit-pdos/perennial.git",
+		remoteURL("git@github.com:mit-pdos/perennial.git"))
+	assert.Equal(t, "ssh://git@gitlab.com/group/repo.git",
+		remoteURL("git+ssh://git@gitlab.com/group/repo"))
+}
+
+func TestNewProvider(t *testing.T) {
+	p, err := NewProvider("github", "github.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, GitHubProvider{
+		APIURL: "https://github.example.com/api/v3",
+		RawURL: "https://github.example.com/raw",
+	}, p)
+
+	p, err = NewProvider("forgejo", "git.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, GiteaProvider{}, p)
+
+	_, err = NewProvider("bitbucket", "git.example.com")
+	assert.ErrorContains(t, err, "unknown host type")
+
+	// a configured host overrides the guess from its name
+	p, err = NewProvider("git", "gitlab-mirror.example.com")
+	require.NoError(t, err)
+	RegisterProvider("gitlab-mirror.example.com", p)
+	defer delete(providers, "gitlab-mirror.example.com")
+	assert.Nil(t, providerFor("gitlab-mirror.example.com"))
+	assert.Equal(t, "https://gitlab-mirror.example.com/repo",
+		remoteURL("https://gitlab-mirror.example.com/repo"))
+
+	RegisterProvider("git.example.com", GitLabProvider{})
+	defer delete(providers, "git.example.com")
+	assert.Equal(t, "https://git.example.com/group/repo.git",
+		remoteURL("git+https://git.example.com/group/repo"))
+}
+
+func TestGitHubProvider(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/repos/user/repo/commits/abc123", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"sha": "abc1230000000000000000000000000000000000",
+			"commit": {
+				"author": {"name": "Alice", "date": "2024-05-01T10:00:00Z"},
+				"committer": {"name": "Bob", "date": "2024-05-02T10:00:00Z"},
+				"message": "fix wp lemma\n\nlonger description"
+			}
+		}`))
+	})
+	mux.HandleFunc("/api/repos/user/repo/contents", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]map[string]string{
+			{"name": "repo.opam", "path": "repo.opam", "type": "file"},
+			{"name": "src", "path": "src", "type": "dir"},
+		})
+	})
+	mux.HandleFunc("/api/repos/user/repo/git/trees/abc123", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "1", r.URL.Query().Get("recursive"))
+		w.Write([]byte(`{"tree": [
+			{"path": "repo.opam", "type": "blob"},
+			{"path": "packages", "type": "tree"},
+			{"path": "packages/a", "type": "tree"},
+			{"path": "packages/a/a.opam", "type": "blob"},
+			{"path": "packages/b.opam", "type": "blob"}
+		], "truncated": false}`))
+	})
+	mux.HandleFunc("/raw/user/repo/abc123/repo.opam", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("opam-version: \"2.0\"\n"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	p := GitHubProvider{APIURL: server.URL + "/api", RawURL: server.URL + "/raw"}
+	repo := Repo{Scheme: "https", Host: "github.example.com", Path: "user/repo"}
+	ctx := context.Background()
+
+	info, err := p.CommitInfo(ctx, repo, "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, "abc1230000000000000000000000000000000000", info.Hash)
+	assert.Equal(t, "Alice", info.Author)
+	assert.Equal(t, "2024-05-02", info.Date.Format("2006-01-02"))
+	assert.Equal(t, "fix wp lemma", info.Subject)
+
+	hash, err := p.ResolveRef(ctx, repo, "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, info.Hash, hash)
+
+	files, err := p.ListFiles(ctx, repo, "abc123", ListOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"repo.opam"}, files)
+
+	files, err = p.ListFiles(ctx, repo, "abc123", ListOptions{Path: "packages", Recursive: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"packages/a/a.opam", "packages/b.opam"}, files)
+
+	data, err := p.GetFile(ctx, repo, "abc123", "repo.opam")
+	require.NoError(t, err)
+	assert.Equal(t, "opam-version: \"2.0\"\n", string(data))
+}
+
+func TestListOptions(t *testing.T) {
+	tests := []struct {
+		opts ListOptions
+		path string
+		ok   bool
+	}{
+		{ListOptions{}, "a.opam", true},
+		{ListOptions{}, "sub/a.opam", false},
+		{ListOptions{Recursive: true}, "sub/a.opam", true},
+		{ListOptions{Path: "sub"}, "sub/a.opam", true},
+		{ListOptions{Path: "sub/"}, "sub/a.opam", true},
+		{ListOptions{Path: "sub"}, "sub/deeper/a.opam", false},
+		{ListOptions{Path: "sub", Recursive: true}, "sub/deeper/a.opam", true},
+		{ListOptions{Path: "sub"}, "subway/a.opam", false},
+		{ListOptions{Path: "sub"}, "a.opam", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.ok, tt.opts.includes(tt.path), "%+v %s", tt.opts, tt.path)
+	}
+}
+
+func TestGitLabProvider_Pagination(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v4/projects/group/repo/repository/tree", r.URL.Path)
+		assert.Equal(t, "packages", r.URL.Query().Get("path"))
+		assert.Equal(t, "true", r.URL.Query().Get("recursive"))
+		// a full first page, then a partial one
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		require.NoError(t, err)
+		n := gitlabPageSize
+		if page > 1 {
+			n = 1
+		}
+		var entries []map[string]string
+		for i := range n {
+			entries = append(entries, map[string]string{
+				"path": fmt.Sprintf("packages/p%d.opam", (page-1)*gitlabPageSize+i),
+				"type": "blob",
+			})
+		}
+		json.NewEncoder(w).Encode(entries)
+	}))
+	defer server.Close()
+
+	u, err := neturl.Parse(server.URL)
+	require.NoError(t, err)
+	repo := Repo{Scheme: u.Scheme, Host: u.Host, Path: "group/repo"}
+	files, err := GitLabProvider{}.ListFiles(context.Background(), repo, "abc123", ListOptions{Path: "packages", Recursive: true})
+	require.NoError(t, err)
+	assert.Len(t, files, gitlabPageSize+1)
+	assert.Equal(t, fmt.Sprintf("packages/p%d.opam", gitlabPageSize), files[gitlabPageSize])
+}
+
+func TestGitHubProvider_PrivateGetFile(t *testing.T) {
+	const contents = "opam-version: \"2.0\"\nsynopsis: \"private\"\n"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/user/private/contents/private.opam", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		assert.Equal(t, "abc123", r.URL.Query().Get("ref"))
+		encoded := base64.StdEncoding.EncodeToString([]byte(contents))
+		// GitHub wraps the content at 60 characters
+		json.NewEncoder(w).Encode(map[string]string{
+			"type":     "file",
+			"encoding": "base64",
+			"content":  encoded[:20] + "\n" + encoded[20:] + "\n",
+		})
+	})
+	mux.HandleFunc("/repos/user/private/contents/large.v", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") == "application/vnd.github.raw+json" {
+			w.Write([]byte("large file"))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"type": "file", "encoding": "none", "content": ""})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	p := GitHubProvider{APIURL: server.URL}
+	repo := Repo{Scheme: "https", Host: "github.example.com", Path: "user/private"}
+	SetToken(repo.Host, "secret")
+	defer delete(tokens, repo.Host)
+
+	data, err := p.GetFile(context.Background(), repo, "abc123", "private.opam")
+	require.NoError(t, err)
+	assert.Equal(t, contents, string(data))
+
+	data, err = p.GetFile(context.Background(), repo, "abc123", "large.v")
+	require.NoError(t, err)
+	assert.Equal(t, "large file", string(data))
+}
+
+func TestGitLabProvider_PrivateGetFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the file path is URL-encoded as one path segment
+		assert.Equal(t, "/api/v4/projects/group%2Fprivate/repository/files/theories%2FA.v/raw", r.URL.EscapedPath())
+		assert.Equal(t, "secret", r.Header.Get("PRIVATE-TOKEN"))
+		w.Write([]byte("Lemma a : True."))
+	}))
+	defer server.Close()
+
+	u, err := neturl.Parse(server.URL)
+	require.NoError(t, err)
+	repo := Repo{Scheme: u.Scheme, Host: u.Host, Path: "group/private"}
+	SetToken(repo.Host, "secret")
+	defer delete(tokens, repo.Host)
+
+	data, err := GitLabProvider{}.GetFile(context.Background(), repo, "abc123", "theories/A.v")
+	require.NoError(t, err)
+	assert.Equal(t, "Lemma a : True.", string(data))
+}
+
+func TestGitHubProvider_CommitsBetween(t *testing.T) {
+	const ahead = githubComparePageSize + 20
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/user/repo/compare/base...head", r.URL.Path)
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		require.NoError(t, err)
+		var commits []map[string]any
+		// oldest first, as in the GitHub API
+		for i := (page - 1) * githubComparePageSize; i < min(page*githubComparePageSize, ahead); i++ {
+			commits = append(commits, map[string]any{
+				"sha":    fmt.Sprintf("%040d", i),
+				"commit": map[string]any{"message": fmt.Sprintf("commit %d", i)},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"ahead_by": ahead, "commits": commits})
+	}))
+	defer server.Close()
+
+	p := GitHubProvider{APIURL: server.URL}
+	repo := Repo{Scheme: "https", Host: "github.example.com", Path: "user/repo"}
+	commits, err := p.CommitsBetween(context.Background(), repo, "base", "head")
+	require.NoError(t, err)
+	require.Len(t, commits, ahead)
+	assert.Equal(t, fmt.Sprintf("commit %d", ahead-1), commits[0].Subject)
+	assert.Equal(t, "commit 0", commits[ahead-1].Subject)
+}
+
+func TestGitHubProvider_CanonicalRepo(t *testing.T) {
+	useTempCache(t)
+	mux := http.NewServeMux()
+	// GitHub redirects the old name of a renamed repository by its id
+	mux.HandleFunc("/repos/old-owner/old-name", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/repositories/42", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/repositories/42", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		w.Write([]byte(`{"id": 42, "full_name": "new-owner/new-name"}`))
+	})
+	mux.HandleFunc("/repos/user/repo", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": 43, "full_name": "User/Repo"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	const host = "github.example.com"
+	RegisterProvider(host, GitHubProvider{APIURL: server.URL})
+	defer delete(providers, host)
+	SetToken(host, "secret")
+	defer delete(tokens, host)
+
+	tests := []struct {
+		url, canonical string
+	}{
+		{"git+https://github.example.com/old-owner/old-name.git", "git+https://github.example.com/new-owner/new-name.git"},
+		{"https://github.example.com/old-owner/old-name", "https://github.example.com/new-owner/new-name"},
+		{"git@github.example.com:old-owner/old-name.git", "git@github.example.com:new-owner/new-name.git"},
+		// only the case differs
+		{"https://github.example.com/user/repo", "https://github.example.com/user/repo"},
+		// no API for this host
+		{"https://git.example.com/old-owner/old-name", "https://git.example.com/old-owner/old-name"},
+	}
+	for _, tt := range tests {
+		url, err := CanonicalURL(tt.url)
+		require.NoError(t, err, tt.url)
+		assert.Equal(t, tt.canonical, url, tt.url)
+	}
+}
+
+func TestMovedURL(t *testing.T) {
+	repo := Repo{Scheme: "https", Host: "github.com", Path: "a/b"}
+	moved := Repo{Scheme: "https", Host: "github.com", Path: "c/d"}
+	assert.Equal(t, "git+https://github.com/c/d", movedURL("git+https://github.com/a/b", repo, moved))
+	// the path is not written as in the URL
+	assert.Equal(t, "git+https://github.com/c/d", movedURL("git+https://github.com/a/%62", repo, moved))
+}
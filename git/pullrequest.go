@@ -0,0 +1,41 @@
+package git
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// pullRequestRe matches the refs for the head of a GitHub (or Gitea) pull
+// request and a GitLab merge request, like refs/pull/123/head and
+// refs/merge-requests/123/head.
+var pullRequestRe = regexp.MustCompile(`^refs/(?:pull|merge-requests)/(\d+)/head$`)
+
+// PullRequestNumber parses a pull request or merge request ref, returning the
+// number of the request.
+func PullRequestNumber(ref string) (int, bool) {
+	m := pullRequestRe.FindStringSubmatch(ref)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// PullRequestRef returns the ref of the head of pull request n on the remote
+// at gitURL: refs/merge-requests/<n>/head on GitLab, and refs/pull/<n>/head
+// elsewhere.
+//
+// Pins to these refs are ephemeral: the request can be force-pushed, and once
+// it is closed the commit may disappear.
+func PullRequestRef(gitURL string, n int) string {
+	if _, p, err := lookupProvider(gitURL); err == nil {
+		if _, ok := p.(GitLabProvider); ok {
+			return fmt.Sprintf("refs/merge-requests/%d/head", n)
+		}
+	}
+	return fmt.Sprintf("refs/pull/%d/head", n)
+}
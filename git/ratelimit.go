@@ -0,0 +1,72 @@
+package git
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimitError means a hosting API refused a request because the rate limit
+// for the client (or its token) was used up.
+type RateLimitError struct {
+	Host          string    // API host, like api.github.com
+	Reset         time.Time // when the limit resets (zero if unknown)
+	Authenticated bool      // whether the request used a token
+}
+
+func (e *RateLimitError) Error() string {
+	msg := "rate limited by " + e.Host
+	if !e.Reset.IsZero() {
+		msg += " until " + e.Reset.Local().Format(time.TimeOnly)
+	}
+	if !e.Authenticated {
+		msg += "; " + tokenHint(e.Host)
+	}
+	return msg
+}
+
+// tokenHint suggests how to set a token for the API at apiHost, since
+// authenticated requests have a much higher rate limit.
+func tokenHint(apiHost string) string {
+	host := strings.TrimPrefix(apiHost, "api.")
+	if env, ok := tokenEnv[host]; ok {
+		return "set " + env + " to raise the limit"
+	}
+	return fmt.Sprintf("add a token for %s to the [tokens] section of the config file to raise the limit", host)
+}
+
+// rateLimitReset checks whether resp reports an exhausted rate limit, using
+// GitHub's X-RateLimit-* or GitLab's RateLimit-* headers. Returns the reset
+// time, which is zero if the response does not say.
+func rateLimitReset(resp *http.Response) (time.Time, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return time.Time{}, false
+	}
+	for _, prefix := range []string{"X-RateLimit-", "RateLimit-"} {
+		if resp.Header.Get(prefix+"Remaining") != "0" {
+			continue
+		}
+		secs, err := strconv.ParseInt(resp.Header.Get(prefix+"Reset"), 10, 64)
+		if err != nil {
+			return time.Time{}, true
+		}
+		return time.Unix(secs, 0), true
+	}
+	return time.Time{}, false
+}
+
+// responseError returns the error for an unsuccessful API response.
+func responseError(resp *http.Response) error {
+	reset, ok := rateLimitReset(resp)
+	if !ok {
+		return statusError(resp.StatusCode)
+	}
+	e := &RateLimitError{Reset: reset}
+	if req := resp.Request; req != nil {
+		e.Host = req.URL.Host
+		e.Authenticated = req.Header.Get("Authorization") != "" || req.Header.Get("PRIVATE-TOKEN") != ""
+	}
+	return e
+}
@@ -0,0 +1,62 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rateLimitedServer serves 403 rate limit errors for the first limited
+// requests, with the limit resetting at reset.
+func rateLimitedServer(t *testing.T, limited int, reset time.Time) *httptest.Server {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= limited {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRateLimitError(t *testing.T) {
+	useTempCache(t)
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	server := rateLimitedServer(t, 1, reset)
+
+	var v struct{}
+	err := getJSON(context.Background(), server.URL, nil, "commit info", &v)
+	var rateErr *RateLimitError
+	require.True(t, errors.As(err, &rateErr), "%v", err)
+	assert.True(t, rateErr.Reset.Equal(reset))
+	assert.False(t, rateErr.Authenticated)
+	assert.ErrorContains(t, err, "rate limited by 127.0.0.1")
+	assert.ErrorContains(t, err, "until "+reset.Local().Format(time.TimeOnly))
+
+	assert.Equal(t, "set GITHUB_TOKEN to raise the limit", tokenHint("api.github.com"))
+	assert.Contains(t, tokenHint("gitlab.mpi-sws.org"), "add a token for gitlab.mpi-sws.org")
+	authErr := &RateLimitError{Host: "api.github.com", Authenticated: true}
+	assert.Equal(t, "rate limited by api.github.com", authErr.Error())
+}
+
+func TestRateLimitWait(t *testing.T) {
+	useTempCache(t)
+	defer ConfigureHTTP(HTTPOptions{})
+	require.NoError(t, ConfigureHTTP(HTTPOptions{RateLimitWait: 5 * time.Second}))
+	server := rateLimitedServer(t, 1, time.Now())
+
+	var v struct{}
+	assert.NoError(t, getJSON(context.Background(), server.URL, nil, "commit info", &v))
+}
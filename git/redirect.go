@@ -0,0 +1,54 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CanonicalURL returns the current URL of the repository at gitURL.
+//
+// Hosts redirect requests for a renamed or transferred repository to its new
+// location, so fetches through the old URL keep working (until someone
+// creates a new repository with the old name). CanonicalURL follows the
+// redirect and returns the new URL in the same form as gitURL (keeping the
+// git+ prefix and .git suffix, if any), or gitURL itself if the repository
+// has not moved or its host has no supported API.
+func CanonicalURL(gitURL string) (string, error) {
+	return CanonicalURLContext(context.Background(), gitURL)
+}
+
+// CanonicalURLContext is like CanonicalURL but cancels the API request when
+// ctx is done.
+func CanonicalURLContext(ctx context.Context, gitURL string) (string, error) {
+	repo, p, err := lookupProvider(gitURL)
+	if err != nil {
+		return gitURL, nil
+	}
+	canonical, err := p.CanonicalRepo(ctx, repo)
+	if errors.Is(err, ErrUnsupported) {
+		return gitURL, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up %s: %w", gitURL, err)
+	}
+	// hosts treat repository names case-insensitively
+	if canonical.Path == "" || strings.EqualFold(canonical.Path, repo.Path) {
+		return gitURL, nil
+	}
+	return movedURL(gitURL, repo, canonical), nil
+}
+
+// movedURL rewrites gitURL, which refers to repo, to refer to moved instead.
+func movedURL(gitURL string, repo, moved Repo) string {
+	i := strings.LastIndex(gitURL, repo.Path)
+	if i < 0 {
+		// the path is escaped or otherwise written differently
+		if strings.HasPrefix(gitURL, "git+") {
+			return "git+" + moved.URL()
+		}
+		return moved.URL()
+	}
+	return gitURL[:i] + moved.Path + gitURL[i+len(repo.Path):]
+}
@@ -0,0 +1,50 @@
+package git
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxAttempts is the number of times httpGet tries a request
+const maxAttempts = 4
+
+// retryBaseDelay is the backoff before the first retry; each later retry
+// waits twice as long.
+var retryBaseDelay = 500 * time.Millisecond
+
+// maxRetryDelay caps the wait before a retry, including one requested by a
+// Retry-After header.
+const maxRetryDelay = 30 * time.Second
+
+// isTransient reports whether a request that failed with status is worth
+// retrying.
+func isTransient(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests
+}
+
+// backoff returns how long to wait after the given (1-based) failed attempt:
+// a random duration between half and all of the exponential delay, so that
+// concurrent clients do not retry in lockstep.
+func backoff(attempt int) time.Duration {
+	d := min(retryBaseDelay<<(attempt-1), maxRetryDelay)
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryAfter parses a Retry-After header, which is either a number of seconds
+// or an HTTP date.
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		d = t.Sub(now)
+	} else {
+		return 0, false
+	}
+	return max(0, min(d, maxRetryDelay)), true
+}
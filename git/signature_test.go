@@ -0,0 +1,60 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useSSHSigning configures git to sign with a new SSH key and trust it for
+// verification.
+func useSSHSigning(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+	dir := t.TempDir()
+	key := filepath.Join(dir, "key")
+	output, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "test", "-f", key).CombinedOutput()
+	require.NoError(t, err, "ssh-keygen: %s", output)
+	pub, err := os.ReadFile(key + ".pub")
+	require.NoError(t, err)
+	allowed := filepath.Join(dir, "allowed_signers")
+	require.NoError(t, os.WriteFile(allowed, append([]byte("test@example.com "), pub...), 0644))
+
+	config := filepath.Join(dir, "gitconfig")
+	require.NoError(t, os.WriteFile(config, []byte(
+		"[gpg]\n\tformat = ssh\n[gpg \"ssh\"]\n\tallowedSignersFile = "+allowed+
+			"\n[user]\n\tsigningkey = "+key+"\n"), 0644))
+	t.Setenv("GIT_CONFIG_GLOBAL", config)
+}
+
+func TestVerifyCommit(t *testing.T) {
+	useTempCache(t)
+	useSSHSigning(t)
+	repo := newLocalRepo(t)
+	unsigned := gitCmd(t, repo, "rev-parse", "HEAD")
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-S", "-m", "signed")
+	signed := gitCmd(t, repo, "rev-parse", "HEAD")
+
+	assert.NoError(t, VerifyCommit(repo, signed))
+	assert.ErrorIs(t, VerifyCommit(repo, unsigned), ErrUnverified)
+}
+
+func TestVerifyTag(t *testing.T) {
+	useTempCache(t)
+	useSSHSigning(t)
+	repo := newLocalRepo(t)
+	commit := gitCmd(t, repo, "rev-parse", "HEAD")
+	gitCmd(t, repo, "tag", "-s", "-m", "release", "v1.0")
+	gitCmd(t, repo, "tag", "-a", "-m", "unsigned release", "v1.1")
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "second")
+	gitCmd(t, repo, "tag", "-s", "-m", "release", "v2.0")
+
+	assert.NoError(t, VerifyTag(repo, "v1.0", commit))
+	assert.ErrorIs(t, VerifyTag(repo, "v1.1", commit), ErrUnverified)
+	assert.ErrorContains(t, VerifyTag(repo, "v2.0", commit), "points to")
+}
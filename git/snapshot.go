@@ -0,0 +1,132 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// RefSnapshot holds all the refs of a remote at one point in time, so that
+// several queries about the remote (such as when updating multiple packages
+// pinned to the same repository) cost a single git ls-remote.
+type RefSnapshot struct {
+	gitURL  string
+	refs    []remoteRef
+	symrefs map[string]string
+}
+
+// SnapshotRefs fetches all the refs of the remote at gitURL.
+func SnapshotRefs(ctx context.Context, gitURL string) (*RefSnapshot, error) {
+	if err := checkOnline(gitURL); err != nil {
+		return nil, err
+	}
+	url := remoteURL(gitURL)
+	output, err := runGit(ctx, "", "ls-remote", "--symref", url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs of %s: %w", url, err)
+	}
+	refs, symrefs, err := parseLsRemote(output)
+	if err != nil {
+		return nil, err
+	}
+	return &RefSnapshot{gitURL: gitURL, refs: refs, symrefs: symrefs}, nil
+}
+
+// LatestCommit returns the commit of the remote's HEAD, like GetLatestCommit.
+func (s *RefSnapshot) LatestCommit() (string, error) {
+	if hash, ok := resolveRefIn(s.refs, "HEAD"); ok {
+		return hash, nil
+	}
+	return "", fmt.Errorf("remote %s has no HEAD", s.gitURL)
+}
+
+// DefaultBranch returns the name of the remote's default branch, like
+// GetDefaultBranch.
+func (s *RefSnapshot) DefaultBranch() (string, error) {
+	target, ok := s.symrefs["HEAD"]
+	if !ok {
+		return "", fmt.Errorf("remote %s does not report a default branch", s.gitURL)
+	}
+	return strings.TrimPrefix(target, "refs/heads/"), nil
+}
+
+// ResolveRef resolves a branch, tag, or full ref name to a commit hash, like
+// ResolveRef.
+func (s *RefSnapshot) ResolveRef(ref string) (string, error) {
+	if hash, ok := resolveRefIn(s.refs, ref); ok {
+		return hash, nil
+	}
+	return "", fmt.Errorf("ref %s not found in %s", ref, s.gitURL)
+}
+
+// ResolveCommit resolves an abbreviated commit hash, like ResolveCommit.
+// Hashes of commits at the tip of a ref are resolved from the snapshot;
+// others need a request to the remote.
+func (s *RefSnapshot) ResolveCommit(ctx context.Context, commit string) (string, error) {
+	if len(commit) == 40 {
+		return commit, nil
+	}
+	match := ""
+	for _, ref := range s.refs {
+		if strings.HasPrefix(ref.Hash, commit) && ref.Hash != match {
+			if match != "" {
+				// ambiguous among the refs, so ask the remote
+				match = ""
+				break
+			}
+			match = ref.Hash
+		}
+	}
+	if match != "" {
+		return match, nil
+	}
+	return ResolveCommitContext(ctx, s.gitURL, commit)
+}
+
+// Tags returns the tags of the remote, like ListTags.
+func (s *RefSnapshot) Tags() []Tag {
+	return parseTags(s.refs)
+}
+
+// LatestRelease returns the tag with the highest release version, like
+// LatestRelease.
+func (s *RefSnapshot) LatestRelease() (Tag, error) {
+	return latestRelease(s.gitURL, s.Tags())
+}
+
+// PullRequestsAt returns the numbers of the pull requests (or merge requests)
+// whose head is commit.
+func (s *RefSnapshot) PullRequestsAt(commit string) []int {
+	var requests []int
+	for _, ref := range s.refs {
+		if n, ok := PullRequestNumber(ref.Name); ok && ref.Hash == commit {
+			requests = append(requests, n)
+		}
+	}
+	return requests
+}
+
+// EphemeralPullRequestsAt returns the numbers of the pull requests whose head
+// is commit, like PullRequestsAt, but only if commit is not reachable from any
+// branch (see IsReachable). Hosts keep pull request refs after a merge, so
+// the head of a merged (or fast-forwarded) request is an ordinary commit on a
+// branch, and pinning it is not ephemeral.
+func (s *RefSnapshot) EphemeralPullRequestsAt(ctx context.Context, commit string) ([]int, error) {
+	requests := s.PullRequestsAt(commit)
+	if len(requests) == 0 {
+		return nil, nil
+	}
+	for _, ref := range s.refs {
+		if strings.HasPrefix(ref.Name, "refs/heads/") && ref.Hash == commit {
+			return nil, nil
+		}
+	}
+	reachable, err := IsReachableContext(ctx, s.gitURL, commit)
+	if err != nil {
+		return nil, err
+	}
+	if reachable {
+		return nil, nil
+	}
+	return requests, nil
+}
@@ -0,0 +1,108 @@
+package git
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefSnapshot(t *testing.T) {
+	useTempCache(t)
+	repo := newLocalRepo(t)
+	first := gitCmd(t, repo, "rev-parse", "HEAD")
+	gitCmd(t, repo, "tag", "-a", "v1.0", "-m", "release 1.0")
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "untagged")
+	untagged := gitCmd(t, repo, "rev-parse", "HEAD")
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "second")
+	second := gitCmd(t, repo, "rev-parse", "HEAD")
+	gitCmd(t, repo, "tag", "v1.1")
+	gitCmd(t, repo, "tag", "v2.0-rc1")
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "third")
+	third := gitCmd(t, repo, "rev-parse", "HEAD")
+
+	ctx := context.Background()
+	s, err := SnapshotRefs(ctx, repo)
+	require.NoError(t, err)
+
+	// later changes to the remote are not seen
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "fourth")
+
+	latest, err := s.LatestCommit()
+	require.NoError(t, err)
+	assert.Equal(t, third, latest)
+
+	branch, err := s.DefaultBranch()
+	require.NoError(t, err)
+	assert.Equal(t, "main", branch)
+
+	commit, err := s.ResolveRef("v1.0")
+	require.NoError(t, err)
+	assert.Equal(t, first, commit)
+	_, err = s.ResolveRef("missing")
+	assert.ErrorContains(t, err, "not found")
+
+	release, err := s.LatestRelease()
+	require.NoError(t, err)
+	assert.Equal(t, Tag{Name: "v1.1", Commit: second}, release)
+	assert.Len(t, s.Tags(), 3)
+
+	// from the snapshot
+	commit, err = s.ResolveCommit(ctx, second[:8])
+	require.NoError(t, err)
+	assert.Equal(t, second, commit)
+	// not at the tip of any ref, so this uses the remote
+	commit, err = s.ResolveCommit(ctx, untagged[:8])
+	require.NoError(t, err)
+	assert.Equal(t, untagged, commit)
+}
+
+func TestPullRequests(t *testing.T) {
+	repo := newLocalRepo(t)
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "proposed change")
+	proposed := gitCmd(t, repo, "rev-parse", "HEAD")
+	gitCmd(t, repo, "update-ref", "refs/pull/12/head", proposed)
+	gitCmd(t, repo, "update-ref", "refs/pull/12/merge", proposed)
+	gitCmd(t, repo, "reset", "--quiet", "--hard", "HEAD~")
+
+	commit, err := ResolveRef(repo, PullRequestRef(repo, 12))
+	require.NoError(t, err)
+	assert.Equal(t, proposed, commit)
+
+	s, err := SnapshotRefs(context.Background(), repo)
+	require.NoError(t, err)
+	assert.Equal(t, []int{12}, s.PullRequestsAt(proposed))
+	latest, err := s.LatestCommit()
+	require.NoError(t, err)
+	assert.Empty(t, s.PullRequestsAt(latest))
+
+	requests, err := s.EphemeralPullRequestsAt(context.Background(), proposed)
+	require.NoError(t, err)
+	assert.Equal(t, []int{12}, requests)
+
+	// the refs of merged requests are kept, but their heads are on a branch
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "merged change")
+	merged := gitCmd(t, repo, "rev-parse", "HEAD")
+	gitCmd(t, repo, "update-ref", "refs/pull/13/head", merged)
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "later change")
+	latest = gitCmd(t, repo, "rev-parse", "HEAD")
+	gitCmd(t, repo, "update-ref", "refs/pull/14/head", latest)
+	s, err = SnapshotRefs(context.Background(), repo)
+	require.NoError(t, err)
+	for _, commit := range []string{merged, latest} {
+		assert.NotEmpty(t, s.PullRequestsAt(commit))
+		requests, err := s.EphemeralPullRequestsAt(context.Background(), commit)
+		require.NoError(t, err)
+		assert.Empty(t, requests)
+	}
+
+	n, ok := PullRequestNumber("refs/merge-requests/7/head")
+	assert.True(t, ok)
+	assert.Equal(t, 7, n)
+	_, ok = PullRequestNumber("refs/heads/pull/7/head")
+	assert.False(t, ok)
+
+	assert.Equal(t, "refs/pull/3/head", PullRequestRef("https://github.com/mit-pdos/perennial", 3))
+	assert.Equal(t, "refs/merge-requests/3/head", PullRequestRef("https://gitlab.mpi-sws.org/iris/iris", 3))
+}
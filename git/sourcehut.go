@@ -0,0 +1,53 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// SourcehutProvider accesses repositories on sourcehut (git.sr.ht).
+//
+// sourcehut's API needs an OAuth token even for public repositories, so only
+// GetFile is supported (using raw file URLs); other operations fall back to
+// fetching with git.
+type SourcehutProvider struct{}
+
+func (SourcehutProvider) ResolveRef(ctx context.Context, repo Repo, ref string) (string, error) {
+	return "", fmt.Errorf("%w: resolving refs on %s", ErrUnsupported, repo.Host)
+}
+
+func (SourcehutProvider) CanonicalRepo(ctx context.Context, repo Repo) (Repo, error) {
+	return Repo{}, fmt.Errorf("%w: repository metadata on %s", ErrUnsupported, repo.Host)
+}
+
+func (SourcehutProvider) Archive(ctx context.Context, repo Repo, commit string) (io.ReadCloser, error) {
+	// sourcehut: https://git.sr.ht/~user/repo/archive/sha.tar.gz
+	return getStream(ctx, fmt.Sprintf("%s/archive/%s.tar.gz", repo.URL(), commit), sourcehutAuth(repo.Host))
+}
+
+func (SourcehutProvider) ListFiles(ctx context.Context, repo Repo, commit string, opts ListOptions) ([]string, error) {
+	return nil, fmt.Errorf("%w: listing files on %s", ErrUnsupported, repo.Host)
+}
+
+func (SourcehutProvider) CommitInfo(ctx context.Context, repo Repo, commit string) (CommitInfo, error) {
+	return CommitInfo{}, fmt.Errorf("%w: commit info on %s", ErrUnsupported, repo.Host)
+}
+
+func (SourcehutProvider) CommitsBetween(ctx context.Context, repo Repo, base, head string) ([]CommitInfo, error) {
+	return nil, fmt.Errorf("%w: comparing commits on %s", ErrUnsupported, repo.Host)
+}
+
+func (SourcehutProvider) GetFile(ctx context.Context, repo Repo, commit, path string) ([]byte, error) {
+	// sourcehut: https://git.sr.ht/~user/repo -> https://git.sr.ht/~user/repo/blob/commit/path
+	return getRaw(ctx, fmt.Sprintf("%s/blob/%s/%s", repo.URL(), commit, path), sourcehutAuth(repo.Host))
+}
+
+func sourcehutAuth(host string) http.Header {
+	header := make(http.Header)
+	if tok := token(host); tok != "" {
+		header.Set("Authorization", "Bearer "+tok)
+	}
+	return header
+}
@@ -0,0 +1,32 @@
+package git
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourcehutGetFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/~user/repo/blob/abc123/repo.opam" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "opam-version: \"2.0\"\n")
+	}))
+	defer server.Close()
+	u, err := neturl.Parse(server.URL)
+	require.NoError(t, err)
+	RegisterProvider(u.Host, SourcehutProvider{})
+	defer delete(providers, u.Host)
+
+	data, err := GetFileContext(context.Background(), server.URL+"/~user/repo", "abc123", "repo.opam")
+	require.NoError(t, err)
+	assert.Equal(t, "opam-version: \"2.0\"\n", string(data))
+}
@@ -0,0 +1,139 @@
+package git
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Tag is a tag on a remote, with the commit it points to.
+type Tag struct {
+	Name   string // tag name, without the refs/tags/ prefix
+	Commit string // commit hash (annotated tags are peeled)
+}
+
+// ListTags lists the tags of a remote.
+func ListTags(gitURL string) ([]Tag, error) {
+	return ListTagsContext(context.Background(), gitURL)
+}
+
+// ListTagsContext is like ListTags but stops waiting for the remote when ctx
+// is done.
+func ListTagsContext(ctx context.Context, gitURL string) ([]Tag, error) {
+	refs, err := lsRemote(ctx, gitURL, "refs/tags/*")
+	if err != nil {
+		return nil, err
+	}
+	return parseTags(refs), nil
+}
+
+// parseTags finds the tags among refs advertised by a remote.
+func parseTags(refs []remoteRef) []Tag {
+	// Annotated tags are listed twice: once for the tag object, and once
+	// (with a ^{} suffix) for the commit it points to.
+	peeled := make(map[string]string)
+	for _, ref := range refs {
+		if name, ok := strings.CutSuffix(ref.Name, "^{}"); ok {
+			peeled[name] = ref.Hash
+		}
+	}
+	var tags []Tag
+	for _, ref := range refs {
+		if !strings.HasPrefix(ref.Name, "refs/tags/") || strings.HasSuffix(ref.Name, "^{}") {
+			continue
+		}
+		commit := ref.Hash
+		if c, ok := peeled[ref.Name]; ok {
+			commit = c
+		}
+		tags = append(tags, Tag{
+			Name:   strings.TrimPrefix(ref.Name, "refs/tags/"),
+			Commit: commit,
+		})
+	}
+	return tags
+}
+
+// versionRe matches a version number in a tag, like v1.2.3, 4.3.0, or
+// iris-4.3.0, with an optional pre-release suffix (like -rc1 or -beta).
+var versionRe = regexp.MustCompile(`(\d+(?:\.\d+)*)([-+~][0-9A-Za-z.+~-]*)?$`)
+
+// releaseVersion parses the version number of a release tag.
+//
+// Returns false for tags that are not releases: tags without a version
+// number, and pre-releases.
+func releaseVersion(tag string) ([]int, bool) {
+	m := versionRe.FindStringSubmatch(tag)
+	if m == nil || m[2] != "" {
+		return nil, false
+	}
+	var version []int
+	for _, part := range strings.Split(m[1], ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, false
+		}
+		version = append(version, n)
+	}
+	return version, true
+}
+
+// LatestRelease returns the tag with the highest release version on a remote.
+//
+// Tags are compared by their version number (so v1.10 is newer than v1.9);
+// pre-releases and tags without a version are ignored.
+func LatestRelease(gitURL string) (Tag, error) {
+	return LatestReleaseContext(context.Background(), gitURL)
+}
+
+// LatestReleaseContext is like LatestRelease but stops waiting for the remote
+// when ctx is done.
+func LatestReleaseContext(ctx context.Context, gitURL string) (Tag, error) {
+	tags, err := ListTagsContext(ctx, gitURL)
+	if err != nil {
+		return Tag{}, err
+	}
+	return latestRelease(gitURL, tags)
+}
+
+// latestRelease picks the tag with the highest release version among tags of
+// the remote at gitURL.
+func latestRelease(gitURL string, tags []Tag) (Tag, error) {
+	var latest Tag
+	var latestVersion []int
+	for _, tag := range tags {
+		version, ok := releaseVersion(tag.Name)
+		if !ok {
+			continue
+		}
+		if latestVersion == nil || compareVersions(version, latestVersion) > 0 {
+			latest = tag
+			latestVersion = version
+		}
+	}
+	if latestVersion == nil {
+		return Tag{}, fmt.Errorf("no release tags found in %s", gitURL)
+	}
+	return latest, nil
+}
+
+// compareVersions compares version numbers component-wise, treating missing
+// components as 0 (so 1.2 and 1.2.0 are equal).
+func compareVersions(a, b []int) int {
+	for i := range max(len(a), len(b)) {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if c := cmp.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
@@ -0,0 +1,51 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReleaseVersion(t *testing.T) {
+	tests := []struct {
+		tag     string
+		version []int
+		ok      bool
+	}{
+		{"v1.2.3", []int{1, 2, 3}, true},
+		{"4.3.0", []int{4, 3, 0}, true},
+		{"iris-4.3.0", []int{4, 3, 0}, true},
+		{"coq-8.20", []int{8, 20}, true},
+		{"v2.0-rc1", nil, false},
+		{"v1.0.0-beta.2", nil, false},
+		{"stable", nil, false},
+	}
+	for _, tt := range tests {
+		version, ok := releaseVersion(tt.tag)
+		assert.Equal(t, tt.ok, ok, "tag %s", tt.tag)
+		assert.Equal(t, tt.version, version, "tag %s", tt.tag)
+	}
+}
+
+func TestLatestRelease(t *testing.T) {
+	repo := newLocalRepo(t)
+	gitCmd(t, repo, "tag", "v1.9")
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "release 1.10")
+	release := gitCmd(t, repo, "rev-parse", "HEAD")
+	// annotated tags should be peeled to their commit
+	gitCmd(t, repo, "tag", "-a", "-m", "release", "v1.10")
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "pre-release")
+	gitCmd(t, repo, "tag", "v2.0-rc1")
+	gitCmd(t, repo, "tag", "nightly")
+
+	tag, err := LatestRelease(repo)
+	require.NoError(t, err)
+	assert.Equal(t, Tag{Name: "v1.10", Commit: release}, tag)
+}
+
+func TestLatestRelease_NoTags(t *testing.T) {
+	repo := newLocalRepo(t)
+	_, err := LatestRelease(repo)
+	assert.ErrorContains(t, err, "no release tags")
+}
@@ -41,16 +41,18 @@ func updatePerennialPin(opamPath string) error {
 	if err != nil {
 		return fmt.Errorf("failed to get latest commit for perennial: %w", err)
 	}
-	f.AddPinDepend(opam.PinDepend{
+	if err := f.AddPinDepend(opam.PinDepend{
 		Package: "perennial",
 		URL:     perennialUrl,
 		Commit:  commit,
-	})
+	}); err != nil {
+		panic(fmt.Errorf("template opam does not parse: %w", err))
+	}
 	_, err = f.UpdateIndirectDependencies()
 	if err != nil {
 		return fmt.Errorf("failed to update indirect dependencies: %w", err)
 	}
-	if err := os.WriteFile(opamPath, []byte(f.String()), 0644); err != nil {
+	if err := f.Save(opamPath); err != nil {
 		panic("could not write back opam file")
 	}
 	fmt.Printf("added perennial dependency\n")
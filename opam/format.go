@@ -0,0 +1,170 @@
+package opam
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// FormatOptions configures Format.
+type FormatOptions struct {
+	// KeepIndirectOrder preserves the order of the indirect section (for
+	// example, if it was generated with OrderTopological) instead of sorting it
+	// by package name.
+	KeepIndirectOrder bool
+}
+
+// Format puts the depends and pin-depends blocks in a canonical form, so that
+// diffs stay small regardless of who last edited the file:
+//
+//   - entries are indented by two spaces (continuation lines of multi-line
+//     constraints by four), and pin-depends columns are aligned
+//   - direct pin-depends are sorted by package name, keeping any comments
+//     above a pin attached to it
+//   - the indirect section is sorted by package name (see FormatOptions); if
+//     it is split into "## via" groups, pins are sorted within each group
+//     and groups are sorted by the direct dependency they are attributed to
+//   - duplicate entries are removed, as are indirect pins for packages that
+//     are pinned directly
+//
+// Direct pins of the same package to different URLs or commits are an error,
+// since keeping either one would change what the package resolves to. The
+// rest of the file is unchanged.
+func (f *OpamFile) Format(opts FormatOptions) error {
+	if err := f.ensureBlocks(); err != nil {
+		return err
+	}
+	f.Lines = slices.Replace(f.Lines, f.depends.startLine, f.depends.endLine, f.formattedDepends()...)
+	f.update()
+	pinLines, err := f.formattedPinDepends(opts)
+	if err != nil {
+		return err
+	}
+	f.Lines = slices.Replace(f.Lines, f.pinDepends.startLine, f.pinDepends.endLine, pinLines...)
+	f.update()
+	return nil
+}
+
+// formatComment indents a non-entry line (a comment or blank line) within a
+// block
+func formatComment(line string) string {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return ""
+	}
+	return "  " + line
+}
+
+// formattedDepends returns the lines of the depends block in canonical form
+func (f *OpamFile) formattedDepends() []string {
+	entryAt := make(map[int]dependEntry)
+	for _, entry := range f.dependEntries() {
+		entryAt[entry.lines.startLine] = entry
+	}
+
+	lines := []string{strings.TrimSpace(f.Lines[f.depends.startLine])}
+	seen := make(map[string]bool)
+	for i := f.depends.startLine + 1; i < f.depends.endLine-1; i++ {
+		entry, ok := entryAt[i]
+		if !ok {
+			lines = append(lines, formatComment(f.Lines[i]))
+			continue
+		}
+		entryLines := []string{"  " + strings.TrimSpace(f.Lines[i])}
+		for j := i + 1; j < entry.lines.endLine; j++ {
+			entryLines = append(entryLines, "    "+strings.TrimSpace(f.Lines[j]))
+		}
+		key := strings.Join(entryLines, "\n")
+		if !seen[key] {
+			seen[key] = true
+			lines = append(lines, entryLines...)
+		}
+		i = entry.lines.endLine - 1
+	}
+	return append(lines, strings.TrimSpace(f.Lines[f.depends.endLine-1]))
+}
+
+// formattedPinDepends returns the lines of the pin-depends block in canonical
+// form
+func (f *OpamFile) formattedPinDepends(opts FormatOptions) ([]string, error) {
+	// a direct pin with the comment lines immediately above it
+	type directPin struct {
+		comments []string
+		dep      PinDepend
+	}
+	var direct []directPin
+	var comments []string
+	isDirect := make(map[string]bool)
+	// index in direct of each package
+	directIndex := make(map[string]int)
+	for i := range f.pinDepends.innerLineNums() {
+		if f.indirectPinDepends.Contains(i) {
+			continue
+		}
+		dep := parsePinDependLine(f.Lines[i])
+		if dep == nil {
+			if line := formatComment(f.Lines[i]); line != "" {
+				comments = append(comments, line)
+			}
+			continue
+		}
+		if i, ok := directIndex[dep.Package]; ok {
+			// a duplicate; keep its comments with the first pin
+			first := &direct[i]
+			if first.dep.URL != dep.URL || first.dep.Commit != dep.Commit {
+				return nil, fmt.Errorf("conflicting pins for %s: %s#%s and %s#%s",
+					dep.Package, first.dep.URL, first.dep.Commit, dep.URL, dep.Commit)
+			}
+			first.comments = append(first.comments, comments...)
+		} else {
+			isDirect[dep.Package] = true
+			directIndex[dep.Package] = len(direct)
+			direct = append(direct, directPin{comments: comments, dep: *dep})
+		}
+		comments = nil
+	}
+	slices.SortStableFunc(direct, func(a, b directPin) int {
+		return strings.Compare(a.dep.Package, b.dep.Package)
+	})
+
+	var groups []IndirectGroup
+	seen := make(map[string]bool)
+	for _, group := range f.GetIndirectGroups() {
+		var deps []PinDepend
+		for _, dep := range group.Deps {
+			if !isDirect[dep.Package] && !seen[dep.Package] {
+				seen[dep.Package] = true
+				deps = append(deps, dep)
+			}
+		}
+		if len(deps) == 0 {
+			continue
+		}
+		if !opts.KeepIndirectOrder {
+			slices.SortStableFunc(deps, func(a, b PinDepend) int {
+				return strings.Compare(a.Package, b.Package)
+			})
+		}
+		groups = append(groups, IndirectGroup{Via: group.Via, Deps: deps})
+	}
+	if !opts.KeepIndirectOrder {
+		slices.SortStableFunc(groups, func(a, b IndirectGroup) int {
+			return strings.Compare(a.Via, b.Via)
+		})
+	}
+
+	lines := []string{strings.TrimSpace(f.Lines[f.pinDepends.startLine])}
+	for _, pin := range direct {
+		lines = append(lines, pin.comments...)
+		lines = append(lines, pin.dep.String())
+	}
+	// comments after the last direct pin
+	lines = append(lines, comments...)
+	if !f.indirectPinDepends.empty() {
+		if len(lines) > 1 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, indirectSectionLines(groups)...)
+	}
+	return append(lines, strings.TrimSpace(f.Lines[f.pinDepends.endLine-1])), nil
+}
@@ -0,0 +1,126 @@
+package opam
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	f := parseString(t, `opam-version: "2.0"
+
+depends: [
+    "perennial"
+ "rocq-core" { >= "9.0" &
+                 < "9.2" }
+  # for tests
+	"coq-record-update" { (>= "0.3.6") }
+  "perennial"
+]
+
+pin-depends: [
+    ["zzz.dev" "git+https://example.com/zzz#abc"]
+
+  # use our fork
+  ["perennial.dev"  "git+https://github.com/mit-pdos/perennial#577140b"]
+  # duplicate
+  ["zzz.dev" "git+https://example.com/zzz#abc"]
+  ## begin indirect
+  ["rocq-stdpp.dev" "git+https://gitlab.mpi-sws.org/iris/stdpp#187909f"]
+  ["perennial.dev"  "git+https://github.com/mit-pdos/perennial#0000000"]
+  ["rocq-iris.dev" "git+https://gitlab.mpi-sws.org/iris/iris#fde0f86"]
+  ["rocq-stdpp.dev" "git+https://gitlab.mpi-sws.org/iris/stdpp#187909f"]
+  ## end
+  ]
+build: [make "-j%{jobs}%"]
+`)
+	require.NoError(t, f.Format(FormatOptions{}))
+	assert.Equal(t, `opam-version: "2.0"
+
+depends: [
+  "perennial"
+  "rocq-core" { >= "9.0" &
+    < "9.2" }
+  # for tests
+  "coq-record-update" { (>= "0.3.6") }
+]
+
+pin-depends: [
+  # use our fork
+  ["perennial.dev"             "git+https://github.com/mit-pdos/perennial#577140b"]
+  # duplicate
+  ["zzz.dev"                   "git+https://example.com/zzz#abc"]
+
+  ## begin indirect
+  ["rocq-iris.dev"             "git+https://gitlab.mpi-sws.org/iris/iris#fde0f86"]
+  ["rocq-stdpp.dev"            "git+https://gitlab.mpi-sws.org/iris/stdpp#187909f"]
+  ## end
+]
+build: [make "-j%{jobs}%"]
+`, f.String())
+
+	// formatting is idempotent
+	formatted := f.String()
+	require.NoError(t, f.Format(FormatOptions{}))
+	assert.Equal(t, formatted, f.String())
+}
+
+func TestFormat_ConflictingPins(t *testing.T) {
+	f := parseString(t, `pin-depends: [
+  ["zzz.dev" "git+https://example.com/zzz#abc"]
+  ["zzz.dev" "git+https://example.com/zzz#def"]
+]
+`)
+	original := f.String()
+	err := f.Format(FormatOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "conflicting pins for zzz")
+	assert.Equal(t, original, f.String())
+}
+
+func TestFormat_KeepIndirectOrder(t *testing.T) {
+	f := parseString(t, exampleOpam)
+	require.NoError(t, f.Format(FormatOptions{KeepIndirectOrder: true}))
+
+	var packages []string
+	for _, dep := range f.GetIndirect() {
+		packages = append(packages, dep.Package)
+	}
+	assert.Equal(t, []string{"rocq-stdpp", "rocq-iris", "iris-named-props"}, packages)
+}
+
+func TestFormat_SortIndirect(t *testing.T) {
+	f := parseString(t, exampleOpam)
+	require.NoError(t, f.Format(FormatOptions{}))
+
+	var packages []string
+	for _, dep := range f.GetIndirect() {
+		packages = append(packages, dep.Package)
+	}
+	assert.Equal(t, []string{"iris-named-props", "rocq-iris", "rocq-stdpp"}, packages)
+}
+
+func TestFormat_Attribution(t *testing.T) {
+	f := parseString(t, `pin-depends: [
+  ["perennial.dev" "git+https://github.com/mit-pdos/perennial#577140b"]
+  ## begin indirect
+  ## via perennial
+  ["rocq-stdpp.dev" "git+https://gitlab.mpi-sws.org/iris/stdpp#187909f"]
+  ["rocq-iris.dev" "git+https://gitlab.mpi-sws.org/iris/iris#fde0f86"]
+  ## via example-proof
+  ["iris-named-props.dev" "git+https://github.com/tchajed/iris-named-props#c388714"]
+  ["rocq-iris.dev" "git+https://gitlab.mpi-sws.org/iris/iris#fde0f86"]
+  ## end
+]
+`)
+	require.NoError(t, f.Format(FormatOptions{}))
+	assert.Contains(t, f.String(), `  ## begin indirect
+  ## via example-proof
+  ["iris-named-props.dev"      "git+https://github.com/tchajed/iris-named-props#c388714"]
+  ## via perennial
+  ["rocq-iris.dev"             "git+https://gitlab.mpi-sws.org/iris/iris#fde0f86"]
+  ["rocq-stdpp.dev"            "git+https://gitlab.mpi-sws.org/iris/stdpp#187909f"]
+  ## end
+`)
+}
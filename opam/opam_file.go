@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"iter"
+	"os"
 	"regexp"
 	"slices"
 	"strings"
@@ -22,6 +23,8 @@ var (
 	closeBracketRe  = regexp.MustCompile(`^\s*\]`)
 	beginIndirectRe = regexp.MustCompile(`^\s*##\s*begin indirect\b.*$`)
 	endIndirectRe   = regexp.MustCompile(`^\s*##\s*end\b.*$`)
+	// Matches "## via <package>" comments in the indirect section
+	viaRe = regexp.MustCompile(`^\s*##\s*via\s+(\S+)`)
 	// Matches: ["package.name" "git+https://...#commit"]
 	pinDependLineRe = regexp.MustCompile(`^\s*\[\s*"([^"]+)"\s+"([^"]+)"\s*\]`)
 	// Matches dependency lines: "package-name" or "package-name" { version-constraint }
@@ -183,19 +186,30 @@ func Parse(r io.Reader) (*OpamFile, error) {
 		return nil, err
 	}
 	f := &OpamFile{Lines: lines}
-	err := f.findRegions()
-	if err != nil {
+	if err := f.ensureBlocks(); err != nil {
 		return nil, err
 	}
+	return f, nil
+}
+
+// ensureBlocks parses f.Lines and adds empty depends and pin-depends blocks if
+// they are missing, so that dependencies can always be added.
+func (f *OpamFile) ensureBlocks() error {
+	if !f.depends.empty() && !f.pinDepends.empty() {
+		return nil
+	}
+	if err := f.findRegions(); err != nil {
+		return err
+	}
 	if f.depends.empty() {
-		f.Lines = slices.Insert(f.Lines, f.depends.endLine, "depends: [", "]")
-		f.depends = region{startLine: len(f.Lines) - 2, endLine: len(f.Lines)}
+		f.Lines = append(f.Lines, "depends: [", "]")
+		f.update()
 	}
 	if f.pinDepends.empty() {
 		f.Lines = slices.Insert(f.Lines, f.depends.endLine, "pin-depends: [", "]")
 		f.update()
 	}
-	return f, nil
+	return nil
 }
 
 // String returns the opam file as a string
@@ -203,6 +217,34 @@ func (f *OpamFile) String() string {
 	return strings.Join(f.Lines, "\n") + "\n"
 }
 
+// WriteTo writes the opam file to w, one line at a time.
+//
+// Implements io.WriterTo.
+func (f *OpamFile) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, line := range f.Lines {
+		n, err := io.WriteString(w, line+"\n")
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Save writes the opam file to path, replacing any existing contents.
+func (f *OpamFile) Save(path string) error {
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteTo(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
 // parsePinDependLine parses a line like:
 //
 //	["perennial.dev"           "git+https://github.com/mit-pdos/perennial#577140b0594fbdea"]
@@ -244,33 +286,43 @@ func (dep PinDepend) String() string {
 	return fmt.Sprintf("  [%-27s \"%s\"]", "\""+fullPackageName+"\"", fullURL)
 }
 
+// AllPinDepends iterates over all pin-depends in file order, both direct and
+// indirect. The second value is true for pins in the indirect section.
+func (f *OpamFile) AllPinDepends() iter.Seq2[PinDepend, bool] {
+	return func(yield func(PinDepend, bool) bool) {
+		for i := range f.pinDepends.innerLineNums() {
+			dep := parsePinDependLine(f.Lines[i])
+			if dep == nil {
+				continue
+			}
+			if !yield(*dep, f.indirectPinDepends.Contains(i)) {
+				return
+			}
+		}
+	}
+}
+
 // GetPinDepends returns all direct pin-depends (excluding indirect dependencies).
 func (f *OpamFile) GetPinDepends() []PinDepend {
 	var deps []PinDepend
-	for i := range f.pinDepends.innerLineNums() {
-		// Skip lines in the indirect section
-		if f.indirectPinDepends.Contains(i) {
-			continue
-		}
-
-		line := f.Lines[i]
-		dep := parsePinDependLine(line)
-		if dep != nil {
-			deps = append(deps, *dep)
+	for dep, indirect := range f.AllPinDepends() {
+		if !indirect {
+			deps = append(deps, dep)
 		}
 	}
-
 	return deps
 }
 
 // AddPinDepend adds or updates a pin-depends entry in the opam file.
 // If an entry for the package already exists, it will be replaced.
 // If the package is in the indirect section, it will be removed from there.
-// If no pin-depends block exists in the file, the function returns without changes.
+// If no pin-depends block exists in the file, one is created.
 // The new entry is added immediately after the "pin-depends: [" line if it doesn't already exist.
-func (f *OpamFile) AddPinDepend(dep PinDepend) {
-	if f.pinDepends.empty() {
-		return
+//
+// Returns an error only if f.Lines cannot be parsed.
+func (f *OpamFile) AddPinDepend(dep PinDepend) error {
+	if err := f.ensureBlocks(); err != nil {
+		return err
 	}
 	dep.Normalize()
 
@@ -302,70 +354,119 @@ func (f *OpamFile) AddPinDepend(dep PinDepend) {
 	}
 
 	f.update()
+	return nil
 }
 
+// GetIndirect returns the pin-depends in the indirect section.
 func (f *OpamFile) GetIndirect() []PinDepend {
+	var deps []PinDepend
+	for dep, indirect := range f.AllPinDepends() {
+		if indirect {
+			deps = append(deps, dep)
+		}
+	}
+	return deps
+}
+
+// IndirectGroup is a group of indirect pin-depends, optionally attributed to
+// the direct dependency that requires them. Attributed groups are preceded by
+// a "## via <package>" comment in the indirect section.
+type IndirectGroup struct {
+	Via  string // direct dependency that requires Deps ("" if unattributed)
+	Deps []PinDepend
+}
+
+// GetIndirectGroups returns the indirect section, split into groups by its
+// "## via" comments.
+func (f *OpamFile) GetIndirectGroups() []IndirectGroup {
 	if f.indirectPinDepends.empty() {
 		return nil
 	}
+	groups := []IndirectGroup{{}}
+	for i := range f.indirectPinDepends.innerLineNums() {
+		if matches := viaRe.FindStringSubmatch(f.Lines[i]); matches != nil {
+			groups = append(groups, IndirectGroup{Via: matches[1]})
+			continue
+		}
+		if dep := parsePinDependLine(f.Lines[i]); dep != nil {
+			last := &groups[len(groups)-1]
+			last.Deps = append(last.Deps, *dep)
+		}
+	}
+	// drop the initial group if all pins are attributed
+	if len(groups[0].Deps) == 0 {
+		groups = groups[1:]
+	}
+	return groups
+}
 
-	var deps []PinDepend
-	start := f.indirectPinDepends.startLine + 1 // Skip "## begin indirect" line
-	end := f.indirectPinDepends.endLine - 1     // Skip "## end" line
-
-	for i := start; i < end; i++ {
-		line := f.Lines[i]
-		dep := parsePinDependLine(line)
-		if dep != nil {
-			deps = append(deps, *dep)
+// hasAttribution checks if the indirect section has "## via" comments
+func (f *OpamFile) hasAttribution() bool {
+	for _, group := range f.GetIndirectGroups() {
+		if group.Via != "" {
+			return true
 		}
 	}
+	return false
+}
 
-	return deps
+// SetIndirect replaces the indirect section of pin-depends with indirects.
+//
+// Packages that are already direct pin-depends are updated in place rather
+// than being added to the indirect section. If no pin-depends block exists in
+// the file, one is created.
+func (f *OpamFile) SetIndirect(indirects []PinDepend) error {
+	return f.SetIndirectGroups([]IndirectGroup{{Deps: indirects}})
 }
 
-func (f *OpamFile) SetIndirect(indirects []PinDepend) {
-	if f.pinDepends.empty() {
-		return
+// SetIndirectGroups is like SetIndirect, but writes each group with a
+// "## via" comment attributing it to a direct dependency.
+func (f *OpamFile) SetIndirectGroups(groups []IndirectGroup) error {
+	if err := f.ensureBlocks(); err != nil {
+		return err
 	}
 
 	// First, update any packages that are already in the main pin-depends section
 	// and filter them out from the indirects list
-	var filteredIndirects []PinDepend
-	for _, indirect := range indirects {
-		found := false
-		start := f.pinDepends.startLine + 1
-
-		// Check if package exists in main pin-depends (outside indirect section)
-		for i := start; i < f.pinDepends.endLine-1; i++ {
-			// Skip lines in indirect section
-			if f.indirectPinDepends.Contains(i) {
-				continue
+	var filteredGroups []IndirectGroup
+	numIndirects := 0
+	for _, group := range groups {
+		var filteredIndirects []PinDepend
+		for _, indirect := range group.Deps {
+			found := false
+			start := f.pinDepends.startLine + 1
+
+			// Check if package exists in main pin-depends (outside indirect section)
+			for i := start; i < f.pinDepends.endLine-1; i++ {
+				// Skip lines in indirect section
+				if f.indirectPinDepends.Contains(i) {
+					continue
+				}
+
+				existingDep := parsePinDependLine(f.Lines[i])
+				if existingDep != nil && existingDep.Package == indirect.Package {
+					// Update the existing entry
+					f.Lines[i] = indirect.String()
+					found = true
+					break
+				}
 			}
 
-			existingDep := parsePinDependLine(f.Lines[i])
-			if existingDep != nil && existingDep.Package == indirect.Package {
-				// Update the existing entry
-				f.Lines[i] = indirect.String()
-				found = true
-				break
+			// Only add to indirect section if not found in main section
+			if !found {
+				filteredIndirects = append(filteredIndirects, indirect)
 			}
 		}
-
-		// Only add to indirect section if not found in main section
-		if !found {
-			filteredIndirects = append(filteredIndirects, indirect)
+		if len(filteredIndirects) > 0 {
+			filteredGroups = append(filteredGroups, IndirectGroup{Via: group.Via, Deps: filteredIndirects})
+			numIndirects += len(filteredIndirects)
 		}
 	}
 
 	// If there's already an indirect region, replace it
 	if !f.indirectPinDepends.empty() {
 		// Build new indirect section
-		indirectLines := []string{"  ## begin indirect"}
-		for _, dep := range filteredIndirects {
-			indirectLines = append(indirectLines, dep.String())
-		}
-		indirectLines = append(indirectLines, "  ## end")
+		indirectLines := indirectSectionLines(filteredGroups)
 
 		// Replace the indirect region
 		start := f.indirectPinDepends.startLine
@@ -374,16 +475,9 @@ func (f *OpamFile) SetIndirect(indirects []PinDepend) {
 		f.Lines = slices.Replace(f.Lines, start, end, indirectLines...)
 	} else {
 		// don't add an empty indirect section
-		if len(filteredIndirects) > 0 {
+		if numIndirects > 0 {
 			// Add new indirect section before the closing ] of pin-depends
-			indirectLines := []string{
-				"",
-				"  ## begin indirect",
-			}
-			for _, dep := range filteredIndirects {
-				indirectLines = append(indirectLines, dep.String())
-			}
-			indirectLines = append(indirectLines, "  ## end")
+			indirectLines := append([]string{""}, indirectSectionLines(filteredGroups)...)
 
 			// Insert before the closing ] of pin-depends
 			insertPos := f.pinDepends.endLine - 1
@@ -392,39 +486,108 @@ func (f *OpamFile) SetIndirect(indirects []PinDepend) {
 		}
 	}
 	f.update()
+	return nil
 }
 
-// GetDependencies returns all dependencies listed in the depends block,
-// ignoring version constraints. Returns just the package names.
-func (f *OpamFile) GetDependencies() []string {
+// indirectSectionLines formats an indirect section, including the ## begin
+// indirect and ## end markers
+func indirectSectionLines(groups []IndirectGroup) []string {
+	lines := []string{"  ## begin indirect"}
+	for _, group := range groups {
+		if group.Via != "" {
+			lines = append(lines, "  ## via "+group.Via)
+		}
+		for _, dep := range group.Deps {
+			lines = append(lines, dep.String())
+		}
+	}
+	return append(lines, "  ## end")
+}
+
+// dependEntry is a single entry in the depends block. An entry spans multiple
+// lines if its { ... } constraint does.
+type dependEntry struct {
+	Package string
+	lines   region
+}
+
+// braceDepthChange returns the number of { minus the number of } in line,
+// ignoring braces in strings and comments.
+func braceDepthChange(line string) int {
+	change := 0
+	inString := false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case inString && c == '\\':
+			i++ // skip escaped character
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '#':
+			return change
+		case c == '{':
+			change++
+		case c == '}':
+			change--
+		}
+	}
+	return change
+}
+
+// dependEntries parses the entries of the depends block.
+//
+// A line only starts a new entry if it is not inside the { ... } constraint of
+// the previous entry, so constraints can be split over several lines.
+func (f *OpamFile) dependEntries() []dependEntry {
 	if f.depends.empty() {
 		return nil
 	}
 
-	var deps []string
+	var entries []dependEntry
+	depth := 0
 	for i := range f.depends.innerLineNums() {
 		line := f.Lines[i]
-		matches := dependLineRe.FindStringSubmatch(line)
-		if matches != nil {
-			deps = append(deps, matches[1])
+		if depth == 0 {
+			if matches := dependLineRe.FindStringSubmatch(line); matches != nil {
+				entries = append(entries, dependEntry{
+					Package: matches[1],
+					lines:   region{startLine: i, endLine: i + 1},
+				})
+			}
+		} else if len(entries) > 0 {
+			// continuation of the previous entry's constraint
+			entries[len(entries)-1].lines.endLine = i + 1
 		}
+		depth = max(0, depth+braceDepthChange(line))
 	}
+	return entries
+}
 
+// GetDependencies returns all dependencies listed in the depends block,
+// ignoring version constraints. Returns just the package names.
+func (f *OpamFile) GetDependencies() []string {
+	var deps []string
+	for _, entry := range f.dependEntries() {
+		deps = append(deps, entry.Package)
+	}
 	return deps
 }
 
 // AddDependency adds a new dependency to the depends block.
 // If the dependency already exists, it does nothing.
 // The dependency is added without version constraints.
-func (f *OpamFile) AddDependency(packageName string) {
-	if f.depends.empty() {
-		return
+// If no depends block exists in the file, one is created.
+//
+// Returns an error only if f.Lines cannot be parsed.
+func (f *OpamFile) AddDependency(packageName string) error {
+	if err := f.ensureBlocks(); err != nil {
+		return err
 	}
 
 	// Check if dependency already exists
 	existingDeps := f.GetDependencies()
 	if slices.Contains(existingDeps, packageName) {
-		return // Already exists, nothing to do
+		return nil // Already exists, nothing to do
 	}
 
 	// Add the new dependency after the opening "depends: [" line
@@ -432,4 +595,5 @@ func (f *OpamFile) AddDependency(packageName string) {
 	f.Lines = slices.Insert(f.Lines, f.depends.startLine+1, newLine)
 
 	f.update()
+	return nil
 }
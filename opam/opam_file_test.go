@@ -1,6 +1,8 @@
 package opam
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -160,11 +162,11 @@ func TestAddPinDepend_Update(t *testing.T) {
 	f := parseString(t, exampleOpam)
 
 	// Update existing dependency
-	f.AddPinDepend(PinDepend{
+	require.NoError(t, f.AddPinDepend(PinDepend{
 		Package: "perennial",
 		URL:     "git+https://github.com/mit-pdos/perennial",
 		Commit:  "newcommit1",
-	})
+	}))
 
 	deps := f.GetPinDepends()
 	found := false
@@ -191,11 +193,11 @@ func TestAddPinDepend_Add(t *testing.T) {
 	f := parseString(t, exampleOpam)
 
 	// Add new dependency
-	f.AddPinDepend(PinDepend{
+	require.NoError(t, f.AddPinDepend(PinDepend{
 		Package: "new-package",
 		URL:     "https://example.com/package",
 		Commit:  "abc123",
-	})
+	}))
 
 	deps := f.GetPinDepends()
 	found := false
@@ -217,7 +219,7 @@ func TestSetIndirect(t *testing.T) {
 		{Package: "pkg1", URL: "git+https://example.com/pkg1", Commit: "commit1"},
 		{Package: "pkg2", URL: "git+https://example.com/pkg2", Commit: "commit2"},
 	}
-	f.SetIndirect(newIndirect)
+	require.NoError(t, f.SetIndirect(newIndirect))
 
 	indirect := f.GetIndirect()
 	require.Len(t, indirect, 2)
@@ -423,7 +425,7 @@ func TestAddDependency(t *testing.T) {
 	f := parseString(t, exampleOpam)
 
 	// Add a new dependency
-	f.AddDependency("new-package")
+	require.NoError(t, f.AddDependency("new-package"))
 
 	deps := f.GetDependencies()
 	require.Len(t, deps, 3)
@@ -438,7 +440,7 @@ func TestAddDependency_Duplicate(t *testing.T) {
 	f := parseString(t, exampleOpam)
 
 	// Try to add an existing dependency
-	f.AddDependency("perennial")
+	require.NoError(t, f.AddDependency("perennial"))
 
 	deps := f.GetDependencies()
 	// Should still have only 2 dependencies
@@ -452,9 +454,9 @@ func TestAddDependency_Multiple(t *testing.T) {
 	f := parseString(t, exampleOpam)
 
 	// Add multiple new dependencies
-	f.AddDependency("package-a")
-	f.AddDependency("package-b")
-	f.AddDependency("package-c")
+	require.NoError(t, f.AddDependency("package-a"))
+	require.NoError(t, f.AddDependency("package-b"))
+	require.NoError(t, f.AddDependency("package-c"))
 
 	deps := f.GetDependencies()
 	require.Len(t, deps, 5)
@@ -483,9 +485,191 @@ pin-depends: [
 	f := parseString(t, opamWithoutIndirect)
 
 	// Call SetIndirect with an empty list
-	f.SetIndirect([]PinDepend{})
+	require.NoError(t, f.SetIndirect([]PinDepend{}))
 
 	// Verify the file doesn't contain indirect marker
 	output := f.String()
 	assert.NotContains(t, output, "## begin indirect")
 }
+
+func TestWriteTo(t *testing.T) {
+	f := parseString(t, exampleOpam)
+
+	var buf strings.Builder
+	n, err := f.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(exampleOpam)), n)
+	assert.Equal(t, exampleOpam, buf.String())
+}
+
+func TestSave(t *testing.T) {
+	f := parseString(t, exampleOpam)
+	require.NoError(t, f.AddDependency("new-package"))
+
+	path := filepath.Join(t.TempDir(), "example.opam")
+	require.NoError(t, f.Save(path))
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, f.String(), string(contents))
+}
+
+func TestAddPinDepend_CreatesBlock(t *testing.T) {
+	// An OpamFile constructed without Parse has no pin-depends region yet
+	f := &OpamFile{Lines: []string{`opam-version: "2.0"`}}
+	require.NoError(t, f.AddPinDepend(PinDepend{
+		Package: "perennial",
+		URL:     "https://github.com/mit-pdos/perennial",
+		Commit:  "abc123",
+	}))
+	require.NoError(t, f.AddDependency("perennial"))
+
+	assert.Equal(t, []string{"perennial"}, f.GetDependencies())
+	deps := f.GetPinDepends()
+	require.Len(t, deps, 1)
+	assert.Equal(t, "abc123", deps[0].Commit)
+
+	// the result should round-trip through Parse
+	reparsed := parseString(t, f.String())
+	assert.Equal(t, deps, reparsed.GetPinDepends())
+}
+
+func TestAddDependency_ParseError(t *testing.T) {
+	f := &OpamFile{Lines: []string{"depends: ["}}
+	err := f.AddDependency("perennial")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unclosed depends block")
+}
+
+const multiLineDependsOpam = `opam-version: "2.0"
+
+depends: [
+  "rocq-core" { >= "9.0" &
+                < "9.2" |
+                "dev" }
+  "coq-record-update" {
+    >= "0.3.6" # "not-a-package"
+  }
+  "perennial"
+]
+`
+
+func TestGetDependencies_MultiLineConstraints(t *testing.T) {
+	f := parseString(t, multiLineDependsOpam)
+
+	assert.Equal(t, []string{"rocq-core", "coq-record-update", "perennial"}, f.GetDependencies())
+
+	entries := f.dependEntries()
+	require.Len(t, entries, 3)
+	assert.Equal(t, region{startLine: 3, endLine: 6}, entries[0].lines)
+	assert.Equal(t, region{startLine: 6, endLine: 9}, entries[1].lines)
+	assert.Equal(t, region{startLine: 9, endLine: 10}, entries[2].lines)
+}
+
+func TestAddDependency_MultiLineConstraints(t *testing.T) {
+	f := parseString(t, multiLineDependsOpam)
+
+	require.NoError(t, f.AddDependency("dev"))
+	require.NoError(t, f.AddDependency("perennial"))
+	assert.Equal(t, []string{"dev", "rocq-core", "coq-record-update", "perennial"}, f.GetDependencies())
+
+	// existing constraints are untouched
+	assert.Contains(t, f.String(), `  "rocq-core" { >= "9.0" &
+                < "9.2" |
+                "dev" }
+`)
+}
+
+func TestBraceDepthChange(t *testing.T) {
+	assert.Equal(t, 1, braceDepthChange(`  "pkg" { >= "1.0" &`))
+	assert.Equal(t, -1, braceDepthChange(`  "dev" }`))
+	assert.Equal(t, 0, braceDepthChange(`  "pkg" { >= "1.0" }`))
+	assert.Equal(t, 0, braceDepthChange(`  "pkg" # {`))
+	assert.Equal(t, 0, braceDepthChange(`  "pkg{" "x\"}"`))
+}
+
+func TestAllPinDepends(t *testing.T) {
+	f := parseString(t, exampleOpam)
+
+	var packages []string
+	var indirects []bool
+	for dep, indirect := range f.AllPinDepends() {
+		packages = append(packages, dep.Package)
+		indirects = append(indirects, indirect)
+	}
+	assert.Equal(t, []string{"perennial", "rocq-stdpp", "rocq-iris", "iris-named-props"}, packages)
+	assert.Equal(t, []bool{false, true, true, true}, indirects)
+
+	// stopping early is supported
+	for dep := range f.AllPinDepends() {
+		assert.Equal(t, "perennial", dep.Package)
+		break
+	}
+}
+
+const attributedOpam = `opam-version: "2.0"
+
+depends: [
+  "perennial"
+  "example-proof"
+]
+
+pin-depends: [
+  ["example-proof.dev"         "git+https://github.com/tchajed/perennial-example-proof#0123456"]
+  ["perennial.dev"             "git+https://github.com/mit-pdos/perennial#577140b"]
+
+  ## begin indirect
+  ## via example-proof
+  ["iris-named-props.dev"      "git+https://github.com/tchajed/iris-named-props#c388714"]
+  ## via perennial
+  ["rocq-iris.dev"             "git+https://gitlab.mpi-sws.org/iris/iris#fde0f86"]
+  ["rocq-stdpp.dev"            "git+https://gitlab.mpi-sws.org/iris/stdpp#187909f"]
+  ## end
+]
+`
+
+func TestGetIndirectGroups(t *testing.T) {
+	f := parseString(t, attributedOpam)
+
+	groups := f.GetIndirectGroups()
+	require.Len(t, groups, 2)
+	assert.Equal(t, "example-proof", groups[0].Via)
+	require.Len(t, groups[0].Deps, 1)
+	assert.Equal(t, "iris-named-props", groups[0].Deps[0].Package)
+	assert.Equal(t, "perennial", groups[1].Via)
+	require.Len(t, groups[1].Deps, 2)
+	assert.True(t, f.hasAttribution())
+
+	// all pins are still indirect
+	assert.Len(t, f.GetIndirect(), 3)
+
+	// an unattributed section is a single group
+	f = parseString(t, exampleOpam)
+	groups = f.GetIndirectGroups()
+	require.Len(t, groups, 1)
+	assert.Equal(t, "", groups[0].Via)
+	assert.False(t, f.hasAttribution())
+}
+
+func TestSetIndirectGroups(t *testing.T) {
+	f := parseString(t, attributedOpam)
+
+	// round-trips through GetIndirectGroups
+	require.NoError(t, f.SetIndirectGroups(f.GetIndirectGroups()))
+	assert.Equal(t, attributedOpam, f.String())
+
+	// groups that are entirely direct dependencies are dropped
+	require.NoError(t, f.SetIndirectGroups([]IndirectGroup{
+		{Via: "example-proof", Deps: []PinDepend{
+			{Package: "perennial", URL: "git+https://github.com/mit-pdos/perennial", Commit: "577140b"},
+		}},
+		{Via: "perennial", Deps: []PinDepend{
+			{Package: "rocq-stdpp", URL: "git+https://gitlab.mpi-sws.org/iris/stdpp", Commit: "187909f"},
+		}},
+	}))
+	assert.Contains(t, f.String(), `  ## begin indirect
+  ## via perennial
+  ["rocq-stdpp.dev"            "git+https://gitlab.mpi-sws.org/iris/stdpp#187909f"]
+  ## end
+`)
+}
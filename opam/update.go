@@ -2,9 +2,13 @@ package opam
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"path"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/mit-pdos/perennial-cli/git"
 )
@@ -18,11 +22,31 @@ var packagesWithoutPinDepends = map[string]bool{
 	"iris-named-props":  true,
 }
 
+// gitClient accesses the remote repositories of dependencies
+var gitClient = git.DefaultClient
+
+// SetGitClient sets the client used to fetch dependencies' opam files and
+// resolve their commits (nil restores git.DefaultClient), so that tests and
+// embedders can stub out remotes.
+func SetGitClient(c git.Client) {
+	if c == nil {
+		c = git.DefaultClient
+	}
+	gitClient = c
+}
+
+// opamDir is the directory opam searches for opam files if there are none at
+// the root of a repository
+const opamDir = "opam"
+
 // fetchOpamFile fetches an opam file from a URL at a specific commit.
 // The URL should be a git repository URL (with or without git+ prefix).
-func fetchOpamFile(gitURL, packageName, commit string) ([]byte, error) {
-	path := packageName + ".opam"
-	data, err := git.GetFile(gitURL, commit, path)
+func fetchOpamFile(ctx context.Context, gitURL, packageName, commit string) ([]byte, error) {
+	data, err := gitClient.GetFile(ctx, gitURL, commit, packageName+".opam")
+	if errors.Is(err, git.ErrNotFound) {
+		// opam also looks for opam files in an opam directory
+		data, err = gitClient.GetFile(ctx, gitURL, commit, opamDir+"/"+packageName+".opam")
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch opam file: %w", err)
 	}
@@ -32,17 +56,24 @@ func fetchOpamFile(gitURL, packageName, commit string) ([]byte, error) {
 // FindOpamPackage tries to find the unique opam package in a repository at a specific commit.
 // Returns the package name (without .opam extension) if a unique opam file is found.
 func FindOpamPackage(gitURL, commit string) (string, error) {
-	files, err := git.ListFiles(gitURL, commit)
+	return FindOpamPackageContext(context.Background(), gitURL, commit)
+}
+
+// FindOpamPackageContext is like FindOpamPackage but cancels the request when
+// ctx is done.
+func FindOpamPackageContext(ctx context.Context, gitURL, commit string) (string, error) {
+	files, err := gitClient.ListFiles(ctx, gitURL, commit, git.ListOptions{})
 	if err != nil {
 		return "", err
 	}
 
 	// Look for .opam files
-	var opamFiles []string
-	for _, filename := range files {
-		if strings.HasSuffix(filename, ".opam") {
-			packageName := strings.TrimSuffix(filename, ".opam")
-			opamFiles = append(opamFiles, packageName)
+	opamFiles := opamPackages(files)
+	if len(opamFiles) == 0 {
+		// like opam, fall back to the opam directory (which might not exist)
+		files, err := gitClient.ListFiles(ctx, gitURL, commit, git.ListOptions{Path: opamDir})
+		if err == nil {
+			opamFiles = opamPackages(files)
 		}
 	}
 
@@ -56,15 +87,33 @@ func FindOpamPackage(gitURL, commit string) (string, error) {
 	return opamFiles[0], nil
 }
 
+// opamPackages returns the names of the packages defined by the opam files
+// among paths.
+func opamPackages(paths []string) []string {
+	var packages []string
+	for _, p := range paths {
+		if name, ok := strings.CutSuffix(path.Base(p), ".opam"); ok {
+			packages = append(packages, name)
+		}
+	}
+	return packages
+}
+
 // ExtendCommitHash resolves an abbreviated commit hash to a full hash.
 // If the commit is already 40 characters (full hash), it returns without change.
 // Returns true if the hash was extended, false otherwise.
 func (dep *PinDepend) ExtendCommitHash() (bool, error) {
+	return dep.ExtendCommitHashContext(context.Background())
+}
+
+// ExtendCommitHashContext is like ExtendCommitHash but cancels the request
+// when ctx is done.
+func (dep *PinDepend) ExtendCommitHashContext(ctx context.Context) (bool, error) {
 	if dep.Commit == "" || len(dep.Commit) == 40 {
 		return false, nil
 	}
 
-	fullHash, err := git.ResolveCommit(dep.BaseUrl(), dep.Commit)
+	fullHash, err := gitClient.ResolveCommit(ctx, dep.BaseUrl(), dep.Commit)
 	if err != nil {
 		return false, err
 	}
@@ -80,13 +129,19 @@ func (dep *PinDepend) ExtendCommitHash() (bool, error) {
 // It fetches the package's opam file at the specified git commit and returns
 // its pin-depends.
 func (dep *PinDepend) FetchDependencies() ([]PinDepend, error) {
+	return dep.FetchDependenciesContext(context.Background())
+}
+
+// FetchDependenciesContext is like FetchDependencies but cancels the download
+// when ctx is done.
+func (dep *PinDepend) FetchDependenciesContext(ctx context.Context) ([]PinDepend, error) {
 	// Check if this package is known to not have pin-depends
 	if packagesWithoutPinDepends[dep.Package] {
 		return nil, nil
 	}
 
 	// Fetch the opam file at the specific commit
-	data, err := fetchOpamFile(dep.URL, dep.Package, dep.Commit)
+	data, err := fetchOpamFile(ctx, dep.URL, dep.Package, dep.Commit)
 	if err != nil {
 		return nil, err
 	}
@@ -97,45 +152,100 @@ func (dep *PinDepend) FetchDependencies() ([]PinDepend, error) {
 		return nil, fmt.Errorf("failed to parse opam file: %w", err)
 	}
 
-	deps := append(opamFile.GetPinDepends(), opamFile.GetIndirect()...)
+	var deps []PinDepend
+	for dep := range opamFile.AllPinDepends() {
+		deps = append(deps, dep)
+	}
 	return deps, nil
 }
 
 // ExtendCommitHashes extends any abbreviated commit hashes in direct
 // pin-depends to full hashes.
 func (f *OpamFile) ExtendCommitHashes() error {
+	return f.ExtendCommitHashesContext(context.Background())
+}
+
+// ExtendCommitHashesContext is like ExtendCommitHashes but stops when ctx is
+// done.
+func (f *OpamFile) ExtendCommitHashesContext(ctx context.Context) error {
 	directDeps := f.GetPinDepends()
 	for _, dep := range directDeps {
-		extended, err := dep.ExtendCommitHash()
+		extended, err := dep.ExtendCommitHashContext(ctx)
 		if err != nil {
 			return err
 		}
 		if extended {
-			f.AddPinDepend(dep)
+			if err := f.AddPinDepend(dep); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
+// IndirectOrder controls the order in which indirect pin-depends are emitted.
+type IndirectOrder int
+
+const (
+	// OrderAlphabetical sorts indirect dependencies by package name.
+	OrderAlphabetical IndirectOrder = iota
+	// OrderTopological sorts indirect dependencies so that every package comes
+	// after the packages it depends on (ties are broken alphabetically). This
+	// is the order in which they should be passed to `opam pin add`.
+	OrderTopological
+)
+
+// IndirectOptions configures UpdateIndirectDependenciesWith and
+// UpdateIndirectDependenciesContext.
+type IndirectOptions struct {
+	Order IndirectOrder
+	// Attribute groups the indirect section by the direct dependency that
+	// requires each pin, with a "## via <package>" comment above each group.
+	// Ordering applies within each group. Groups are sorted by the name of the
+	// package, or with OrderTopological, so that every package still follows
+	// its dependencies (which fails if groups require each other).
+	//
+	// Attribution is always maintained if the indirect section already has
+	// "## via" comments.
+	Attribute bool
+}
+
 // UpdateIndirectDependencies updates the indirect dependencies of an opam file.
 // It also extends any abbreviated commit hashes to full hashes.
 //
 // It returns true if the indirect dependencies were updated, false otherwise.
 func (f *OpamFile) UpdateIndirectDependencies() (bool, error) {
+	return f.UpdateIndirectDependenciesWith(IndirectOptions{})
+}
+
+// UpdateIndirectDependenciesWith is like UpdateIndirectDependencies, but
+// takes options controlling how the indirect section is generated.
+func (f *OpamFile) UpdateIndirectDependenciesWith(opts IndirectOptions) (bool, error) {
+	return f.UpdateIndirectDependenciesContext(context.Background(), opts)
+}
+
+// UpdateIndirectDependenciesContext is like UpdateIndirectDependenciesWith,
+// but stops fetching opam files when ctx is done.
+func (f *OpamFile) UpdateIndirectDependenciesContext(ctx context.Context, opts IndirectOptions) (bool, error) {
 	changed := false
 
-	seen := make(map[string]bool)
+	// via maps each indirect package to the first direct dependency that
+	// requires it
+	via := make(map[string]string)
 	oldIndirects := f.GetIndirect()
 	indirects := []PinDepend{}
-	for _, dep := range f.GetPinDepends() {
-		newIndirects, err := dep.FetchDependencies()
-		if err != nil {
-			return false, err
-		}
-		for _, newDep := range newIndirects {
-			if !seen[newDep.Package] {
+	direct := f.GetPinDepends()
+	required, err := fetchEach(ctx, direct, func(ctx context.Context, dep PinDepend) ([]PinDepend, error) {
+		return dep.FetchDependenciesContext(ctx)
+	})
+	if err != nil {
+		return false, err
+	}
+	for i, dep := range direct {
+		for _, newDep := range required[i] {
+			if _, seen := via[newDep.Package]; !seen {
 				indirects = append(indirects, newDep)
-				seen[newDep.Package] = true
+				via[newDep.Package] = dep.Package
 			}
 		}
 	}
@@ -147,9 +257,294 @@ func (f *OpamFile) UpdateIndirectDependencies() (bool, error) {
 		}
 		return 0
 	})
-	f.SetIndirect(indirects)
+	var requires map[string][]string
+	if opts.Order == OrderTopological {
+		requires, err = fetchRequires(ctx, indirects)
+		if err != nil {
+			return false, err
+		}
+		indirects = sortTopological(indirects, requires)
+	}
+	groups := []IndirectGroup{{Deps: indirects}}
+	if opts.Attribute || f.hasAttribution() {
+		groups = groupByVia(indirects, via)
+		if opts.Order == OrderTopological {
+			groups, err = sortGroupsTopological(groups, indirects, requires)
+			if err != nil {
+				return false, err
+			}
+		}
+		indirects = nil
+		for _, group := range groups {
+			indirects = append(indirects, group.Deps...)
+		}
+	}
+	if err := f.SetIndirectGroups(groups); err != nil {
+		return false, err
+	}
 	if !slices.Equal(oldIndirects, indirects) {
 		changed = true
 	}
 	return changed, nil
 }
+
+// groupByVia splits deps into groups by the direct dependency that requires
+// them, preserving their order within each group. Groups are sorted by the
+// name of the direct dependency.
+func groupByVia(deps []PinDepend, via map[string]string) []IndirectGroup {
+	var groups []IndirectGroup
+	for _, dep := range deps {
+		i := slices.IndexFunc(groups, func(g IndirectGroup) bool {
+			return g.Via == via[dep.Package]
+		})
+		if i < 0 {
+			groups = append(groups, IndirectGroup{Via: via[dep.Package]})
+			i = len(groups) - 1
+		}
+		groups[i].Deps = append(groups[i].Deps, dep)
+	}
+	slices.SortStableFunc(groups, func(a, b IndirectGroup) int {
+		return strings.Compare(a.Via, b.Via)
+	})
+	return groups
+}
+
+// sortGroupsTopological orders the groups of groupByVia so that every package
+// still comes after the packages it requires, where deps is the topological
+// order the groups were split from. Groups that are ready at the same time are
+// ordered by where their first package appears in deps.
+//
+// It fails if no such order exists, when packages in two groups require each
+// other.
+func sortGroupsTopological(groups []IndirectGroup, deps []PinDepend, requires map[string][]string) ([]IndirectGroup, error) {
+	position := make(map[string]int, len(deps))
+	for i, dep := range deps {
+		position[dep.Package] = i
+	}
+	groups = slices.Clone(groups)
+	slices.SortFunc(groups, func(a, b IndirectGroup) int {
+		return position[a.Deps[0].Package] - position[b.Deps[0].Package]
+	})
+	groupOf := make(map[string]int)
+	for i, group := range groups {
+		for _, dep := range group.Deps {
+			groupOf[dep.Package] = i
+		}
+	}
+	// remaining[i] counts the unemitted groups that groups[i] requires
+	remaining := make([]int, len(groups))
+	dependents := make([][]int, len(groups))
+	for i, group := range groups {
+		required := make(map[int]bool)
+		for _, dep := range group.Deps {
+			for _, req := range requires[dep.Package] {
+				if j, ok := groupOf[req]; ok && j != i && !required[j] {
+					required[j] = true
+					remaining[i]++
+					dependents[j] = append(dependents[j], i)
+				}
+			}
+		}
+	}
+
+	sorted := make([]IndirectGroup, 0, len(groups))
+	emitted := make([]bool, len(groups))
+	for len(sorted) < len(groups) {
+		next := -1
+		for i := range groups {
+			if !emitted[i] && remaining[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			var cycle []string
+			for i, group := range groups {
+				if !emitted[i] {
+					cycle = append(cycle, group.Via)
+				}
+			}
+			return nil, fmt.Errorf("cannot order the indirect dependencies via %s topologically, since they require each other; drop the \"## via\" comments",
+				strings.Join(cycle, ", "))
+		}
+		emitted[next] = true
+		sorted = append(sorted, groups[next])
+		for _, i := range dependents[next] {
+			remaining[i]--
+		}
+	}
+	return sorted, nil
+}
+
+// fetchRequires fetches the opam file of each dependency and returns the
+// packages in its depends block, indexed by package name.
+func fetchRequires(ctx context.Context, deps []PinDepend) (map[string][]string, error) {
+	dependencies, err := fetchEach(ctx, deps, func(ctx context.Context, dep PinDepend) ([]string, error) {
+		data, err := fetchOpamFile(ctx, dep.URL, dep.Package, dep.Commit)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", dep.Package, err)
+		}
+		opamFile, err := Parse(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse opam file for %s: %w", dep.Package, err)
+		}
+		return opamFile.GetDependencies(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	requires := make(map[string][]string)
+	for i, dep := range deps {
+		requires[dep.Package] = dependencies[i]
+	}
+	return requires, nil
+}
+
+// maxConcurrentFetches limits how many dependencies fetchEach processes at
+// once
+const maxConcurrentFetches = 8
+
+// fetchEach runs fetch for each of deps concurrently (most of the time is
+// spent waiting for the network), returning the results in the same order.
+//
+// The first failure cancels the remaining fetches, and its error is returned.
+func fetchEach[T any](ctx context.Context, deps []PinDepend,
+	fetch func(ctx context.Context, dep PinDepend) (T, error)) ([]T, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]T, len(deps))
+	var firstErr error
+	var errOnce sync.Once
+	sem := make(chan struct{}, maxConcurrentFetches)
+	var wg sync.WaitGroup
+	for i, dep := range deps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			result, err := fetch(ctx, dep)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+// sortTopological orders deps so that each package comes after the packages
+// it requires, according to requires (which maps a package to the names of
+// its dependencies). Dependencies outside of deps are ignored.
+//
+// Among packages that are ready at the same time, the order of deps is
+// preserved. If requires has a cycle, the remaining packages are emitted in
+// their original order.
+func sortTopological(deps []PinDepend, requires map[string][]string) []PinDepend {
+	index := make(map[string]int, len(deps))
+	for i, dep := range deps {
+		index[dep.Package] = i
+	}
+
+	// remaining[i] counts the unemitted dependencies of deps[i]
+	remaining := make([]int, len(deps))
+	dependents := make([][]int, len(deps))
+	for i, dep := range deps {
+		for _, req := range requires[dep.Package] {
+			j, ok := index[req]
+			if !ok || j == i {
+				continue
+			}
+			remaining[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	sorted := make([]PinDepend, 0, len(deps))
+	emitted := make([]bool, len(deps))
+	for len(sorted) < len(deps) {
+		next := -1
+		for i := range deps {
+			if !emitted[i] && remaining[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			// cycle: emit the rest in order
+			for i, dep := range deps {
+				if !emitted[i] {
+					sorted = append(sorted, dep)
+				}
+			}
+			break
+		}
+		emitted[next] = true
+		sorted = append(sorted, deps[next])
+		for _, i := range dependents[next] {
+			remaining[i]--
+		}
+	}
+	return sorted
+}
+
+// PinConflict records a package that is pinned differently by a dependency
+// than by the current opam file.
+type PinConflict struct {
+	Existing PinDepend // pin in the current opam file
+	Required PinDepend // pin required by the dependency
+}
+
+func (c PinConflict) String() string {
+	if c.Existing.URL != c.Required.URL {
+		return fmt.Sprintf("%s: pinned to %s#%s, but required from %s#%s",
+			c.Existing.Package,
+			c.Existing.URL, c.Existing.Commit,
+			c.Required.URL, c.Required.Commit)
+	}
+	return fmt.Sprintf("%s: pinned to %s, but required at %s",
+		c.Existing.Package, c.Existing.Commit, c.Required.Commit)
+}
+
+// PinConflicts compares required (typically the pin-depends of a new
+// dependency) against all pins in f, direct and indirect, and returns the
+// packages that are pinned to a different URL or commit.
+//
+// Commits are compared up to abbreviation, so an abbreviated hash does not
+// conflict with a full hash it is a prefix of.
+func (f *OpamFile) PinConflicts(required []PinDepend) []PinConflict {
+	existing := make(map[string]PinDepend)
+	for dep := range f.AllPinDepends() {
+		if _, ok := existing[dep.Package]; !ok {
+			existing[dep.Package] = dep
+		}
+	}
+	var conflicts []PinConflict
+	for _, req := range required {
+		req.Normalize()
+		dep, ok := existing[req.Package]
+		if !ok {
+			continue
+		}
+		if dep.URL != req.URL || !sameCommit(dep.Commit, req.Commit) {
+			conflicts = append(conflicts, PinConflict{Existing: dep, Required: req})
+		}
+	}
+	return conflicts
+}
+
+// sameCommit checks if two (possibly abbreviated) commit hashes agree
+func sameCommit(a, b string) bool {
+	if a == "" || b == "" {
+		return a == b
+	}
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
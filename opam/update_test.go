@@ -1,7 +1,16 @@
 package opam
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/mit-pdos/perennial-cli/git"
 	"github.com/stretchr/testify/assert"
@@ -20,32 +29,83 @@ func TestFetchDependencies_KnownPackage(t *testing.T) {
 	assert.Nil(t, deps)
 }
 
-func TestFetchDependencies(t *testing.T) {
-	// Test with perennial-example-proof repository (this is a live test)
-	// First, get the latest commit
-	commit, err := git.GetLatestCommit("https://github.com/tchajed/perennial-example-proof")
-	require.NoError(t, err)
+// fakeClient serves repositories from memory, mapping each URL and commit to
+// the repository's files at that commit.
+type fakeClient struct {
+	git.Client // other methods are not used by these tests
+	files      map[string]map[string]string
+}
 
-	dep := PinDepend{
-		Package: "example-proof",
-		URL:     "git+https://github.com/tchajed/perennial-example-proof",
-		Commit:  commit,
+// useFakeClient replaces the git client for the duration of a test.
+func useFakeClient(t *testing.T, c git.Client) {
+	SetGitClient(c)
+	t.Cleanup(func() { SetGitClient(nil) })
+}
+
+func (c fakeClient) at(gitURL, commit string) (map[string]string, error) {
+	files, ok := c.files[gitURL+"#"+commit]
+	if !ok {
+		return nil, fmt.Errorf("commit %s not found in %s", commit, gitURL)
+	}
+	return files, nil
+}
+
+func (c fakeClient) ListFiles(ctx context.Context, gitURL, commit string, opts git.ListOptions) ([]string, error) {
+	files, err := c.at(gitURL, commit)
+	if err != nil {
+		return nil, err
 	}
+	dir := strings.Trim(opts.Path, "/")
+	if dir == "" {
+		dir = "."
+	}
+	var paths []string
+	for p := range files {
+		if path.Dir(p) == dir {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+func (c fakeClient) GetFile(ctx context.Context, gitURL, commit, path string) ([]byte, error) {
+	files, err := c.at(gitURL, commit)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := files[path]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", path, git.ErrNotFound)
+	}
+	return []byte(data), nil
+}
+
+func TestFetchDependencies(t *testing.T) {
+	url := "git+https://github.com/tchajed/perennial-example-proof"
+	commit := "3f2e8a3f8c3c6c0b0b0f6b6f1c1d2e3f4a5b6c7d"
+	useFakeClient(t, fakeClient{files: map[string]map[string]string{
+		url + "#" + commit: {"opam/example-proof.opam": exampleOpam},
+	}})
+
+	dep := PinDepend{Package: "example-proof", URL: url, Commit: commit}
 	deps, err := dep.FetchDependencies()
 	require.NoError(t, err)
 
 	// The function should return all pin-depends (both direct and indirect)
-	assert.NotNil(t, deps)
-
-	// Verify that we got some dependencies
-	assert.Greater(t, len(deps), 0, "perennial-example-proof should have at least one pin-depend")
-
-	// Check that all returned dependencies have required fields
+	assert.Greater(t, len(deps), 0, "example-proof should have at least one pin-depend")
 	for _, dep := range deps {
 		assert.NotEmpty(t, dep.Package, "package name should not be empty")
 		assert.NotEmpty(t, dep.URL, "URL should not be empty")
 		assert.NotEmpty(t, dep.Commit, "commit should not be empty")
 	}
+
+	name, err := FindOpamPackage(url, commit)
+	require.NoError(t, err)
+	assert.Equal(t, "example-proof", name)
+
+	dep.Commit = "0000000"
+	_, err = dep.FetchDependencies()
+	assert.ErrorContains(t, err, "not found")
 }
 
 func TestPackagesWithoutPinDepends(t *testing.T) {
@@ -61,3 +121,200 @@ func TestPackagesWithoutPinDepends(t *testing.T) {
 			"package %s should be in packagesWithoutPinDepends", pkg)
 	}
 }
+
+func TestSortTopological(t *testing.T) {
+	deps := []PinDepend{
+		{Package: "iris-named-props"},
+		{Package: "rocq-iris"},
+		{Package: "rocq-stdpp"},
+	}
+	requires := map[string][]string{
+		"iris-named-props": {"rocq-iris", "rocq"},
+		"rocq-iris":        {"rocq-stdpp"},
+	}
+	sorted := sortTopological(deps, requires)
+	var names []string
+	for _, dep := range sorted {
+		names = append(names, dep.Package)
+	}
+	assert.Equal(t, []string{"rocq-stdpp", "rocq-iris", "iris-named-props"}, names)
+}
+
+func TestSortTopological_Cycle(t *testing.T) {
+	deps := []PinDepend{
+		{Package: "a"},
+		{Package: "b"},
+		{Package: "c"},
+	}
+	requires := map[string][]string{
+		"a": {"b"},
+		"b": {"a"},
+	}
+	sorted := sortTopological(deps, requires)
+	var names []string
+	for _, dep := range sorted {
+		names = append(names, dep.Package)
+	}
+	assert.Equal(t, []string{"c", "a", "b"}, names)
+}
+
+func TestPinConflicts(t *testing.T) {
+	f := parseString(t, exampleOpam)
+
+	conflicts := f.PinConflicts([]PinDepend{
+		// same pin as the direct dependency, abbreviated
+		{Package: "perennial", URL: "https://github.com/mit-pdos/perennial", Commit: "577140b0594f"},
+		// different commit than the indirect dependency
+		{Package: "rocq-iris", URL: "git+https://gitlab.mpi-sws.org/iris/iris", Commit: "0123456789"},
+		// different URL
+		{Package: "iris-named-props", URL: "git+https://github.com/fork/iris-named-props", Commit: "c388714a93b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5"},
+		// not pinned at all
+		{Package: "new-package", URL: "git+https://example.com/new", Commit: "abc"},
+	})
+	require.Len(t, conflicts, 2)
+	assert.Equal(t, "rocq-iris", conflicts[0].Existing.Package)
+	assert.Equal(t, "0123456789", conflicts[0].Required.Commit)
+	assert.Equal(t, "rocq-iris: pinned to fde0f86992a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5, but required at 0123456789",
+		conflicts[0].String())
+	assert.Equal(t, "iris-named-props", conflicts[1].Existing.Package)
+	assert.Contains(t, conflicts[1].String(), "required from git+https://github.com/fork/iris-named-props#")
+}
+
+func TestGroupByVia(t *testing.T) {
+	deps := []PinDepend{
+		{Package: "iris-named-props"},
+		{Package: "rocq-iris"},
+		{Package: "rocq-stdpp"},
+	}
+	via := map[string]string{
+		"iris-named-props": "perennial",
+		"rocq-iris":        "perennial",
+		"rocq-stdpp":       "example-proof",
+	}
+	groups := groupByVia(deps, via)
+	assert.Equal(t, []IndirectGroup{
+		{Via: "example-proof", Deps: []PinDepend{{Package: "rocq-stdpp"}}},
+		{Via: "perennial", Deps: []PinDepend{{Package: "iris-named-props"}, {Package: "rocq-iris"}}},
+	}, groups)
+}
+
+func TestSortGroupsTopological(t *testing.T) {
+	// alphabetically, the "a" group comes first, but rocq-iris (via a)
+	// requires rocq-stdpp (via b)
+	deps := []PinDepend{
+		{Package: "rocq-stdpp"},
+		{Package: "rocq-iris"},
+		{Package: "iris-named-props"},
+	}
+	via := map[string]string{
+		"rocq-stdpp":       "b",
+		"rocq-iris":        "a",
+		"iris-named-props": "a",
+	}
+	requires := map[string][]string{
+		"iris-named-props": {"rocq-iris"},
+		"rocq-iris":        {"rocq-stdpp"},
+	}
+	groups, err := sortGroupsTopological(groupByVia(deps, via), deps, requires)
+	require.NoError(t, err)
+	assert.Equal(t, []IndirectGroup{
+		{Via: "b", Deps: []PinDepend{{Package: "rocq-stdpp"}}},
+		{Via: "a", Deps: []PinDepend{{Package: "rocq-iris"}, {Package: "iris-named-props"}}},
+	}, groups)
+
+	// groups that need not come first are ordered by their first package,
+	// even if that package only comes first by the alphabetical tie-break
+	deps = []PinDepend{{Package: "x"}, {Package: "y"}, {Package: "z"}}
+	via = map[string]string{"x": "b", "y": "a", "z": "b"}
+	groups, err = sortGroupsTopological(groupByVia(deps, via), deps, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "b", groups[0].Via)
+
+	// a package in a requires one in b, which requires another in a
+	deps = []PinDepend{{Package: "x"}, {Package: "y"}, {Package: "z"}}
+	via = map[string]string{"x": "a", "y": "b", "z": "a"}
+	requires = map[string][]string{"y": {"x"}, "z": {"y"}}
+	_, err = sortGroupsTopological(groupByVia(deps, via), deps, requires)
+	assert.ErrorContains(t, err, "via a, b")
+}
+
+// newPackageRepo creates a local repository containing files (mapping paths
+// to contents), returning its path and commit. Local repositories are read
+// through the git package's clone cache, which is placed in a temporary
+// directory.
+func newPackageRepo(t *testing.T, files map[string]string) (string, string) {
+	t.Helper()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	dir := t.TempDir()
+	gitCmd(t, dir, "init", "--quiet")
+	for name, contents := range files {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+	}
+	gitCmd(t, dir, "add", ".")
+	gitCmd(t, dir, "commit", "--quiet", "-m", "initial commit")
+	return dir, gitCmd(t, dir, "rev-parse", "HEAD")
+}
+
+func TestFindOpamPackage(t *testing.T) {
+	repo, commit := newPackageRepo(t, map[string]string{
+		"example.opam": exampleOpam,
+		"README.md":    "",
+	})
+	name, err := FindOpamPackage(repo, commit)
+	require.NoError(t, err)
+	assert.Equal(t, "example", name)
+}
+
+func TestFindOpamPackage_OpamDir(t *testing.T) {
+	repo, commit := newPackageRepo(t, map[string]string{
+		"opam/example.opam": exampleOpam,
+		"README.md":         "",
+	})
+	name, err := FindOpamPackage(repo, commit)
+	require.NoError(t, err)
+	assert.Equal(t, "example", name)
+
+	dep := PinDepend{Package: "example", URL: repo, Commit: commit}
+	deps, err := dep.FetchDependencies()
+	require.NoError(t, err)
+	assert.NotEmpty(t, deps)
+}
+
+func TestFetchEach(t *testing.T) {
+	var deps []PinDepend
+	for i := range 20 {
+		deps = append(deps, PinDepend{Package: fmt.Sprintf("p%d", i)})
+	}
+	var running, maxRunning atomic.Int32
+	names, err := fetchEach(context.Background(), deps, func(ctx context.Context, dep PinDepend) (string, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return dep.Package, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "p0", names[0])
+	assert.Equal(t, "p19", names[19])
+	assert.LessOrEqual(t, maxRunning.Load(), int32(maxConcurrentFetches))
+
+	// the first failure cancels the other fetches
+	_, err = fetchEach(context.Background(), deps, func(ctx context.Context, dep PinDepend) (string, error) {
+		if dep.Package == "p3" {
+			return "", errors.New("p3 failed")
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+			return dep.Package, nil
+		}
+	})
+	assert.EqualError(t, err, "p3 failed")
+}
@@ -0,0 +1,79 @@
+package opam
+
+import (
+	"context"
+	"fmt"
+)
+
+// PinStatus describes how a pinned commit relates to the branches of its
+// remote.
+type PinStatus int
+
+const (
+	// PinCurrent means the pin is at the remote's HEAD.
+	PinCurrent PinStatus = iota
+	// PinBehind means the pinned commit is reachable from some branch, but is
+	// not the remote's HEAD.
+	PinBehind
+	// PinUnreachable means the pinned commit is not reachable from any branch
+	// (for example, after a force-push), so fresh clones may fail to fetch it.
+	PinUnreachable
+)
+
+func (s PinStatus) String() string {
+	switch s {
+	case PinCurrent:
+		return "up-to-date"
+	case PinBehind:
+		return "behind HEAD"
+	case PinUnreachable:
+		return "unreachable"
+	}
+	return fmt.Sprintf("PinStatus(%d)", int(s))
+}
+
+// CheckStatus determines if dep is pinned to the latest commit, an older
+// commit, or a commit that is no longer reachable from any branch of its
+// remote.
+func (dep *PinDepend) CheckStatus() (PinStatus, error) {
+	return dep.CheckStatusContext(context.Background())
+}
+
+// CheckStatusContext is like CheckStatus but stops waiting for the remote when
+// ctx is done.
+func (dep *PinDepend) CheckStatusContext(ctx context.Context) (PinStatus, error) {
+	head, err := gitClient.GetLatestCommit(ctx, dep.BaseUrl())
+	if err != nil {
+		return PinCurrent, err
+	}
+	if sameCommit(head, dep.Commit) {
+		return PinCurrent, nil
+	}
+	reachable, err := gitClient.IsReachable(ctx, dep.BaseUrl(), dep.Commit)
+	if err != nil {
+		return PinCurrent, err
+	}
+	if !reachable {
+		return PinUnreachable, nil
+	}
+	return PinBehind, nil
+}
+
+// MovedTo checks whether dep's repository was renamed or transferred, and if
+// so returns the URL it should be pinned to instead (in the same form as
+// dep.URL). It returns "" if the repository has not moved.
+func (dep *PinDepend) MovedTo() (string, error) {
+	return dep.MovedToContext(context.Background())
+}
+
+// MovedToContext is like MovedTo but cancels the request when ctx is done.
+func (dep *PinDepend) MovedToContext(ctx context.Context) (string, error) {
+	url, err := gitClient.CanonicalURL(ctx, dep.URL)
+	if err != nil {
+		return "", err
+	}
+	if url == dep.URL {
+		return "", nil
+	}
+	return url, nil
+}
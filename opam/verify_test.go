@@ -0,0 +1,76 @@
+package opam
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/mit-pdos/perennial-cli/git"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gitCmd runs a git command in dir and returns its trimmed output.
+func gitCmd(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, "git %v: %s", args, output)
+	return strings.TrimSpace(string(output))
+}
+
+func TestCheckStatus(t *testing.T) {
+	repo := t.TempDir()
+	gitCmd(t, repo, "init", "--quiet", "--initial-branch=main")
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "first")
+	first := gitCmd(t, repo, "rev-parse", "HEAD")
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "dropped")
+	dropped := gitCmd(t, repo, "rev-parse", "HEAD")
+	gitCmd(t, repo, "reset", "--quiet", "--hard", first)
+	gitCmd(t, repo, "commit", "--quiet", "--allow-empty", "-m", "second")
+	second := gitCmd(t, repo, "rev-parse", "HEAD")
+
+	tests := []struct {
+		commit string
+		want   PinStatus
+	}{
+		{second, PinCurrent},
+		{first, PinBehind},
+		{dropped, PinUnreachable},
+	}
+	for _, tt := range tests {
+		dep := PinDepend{Package: "test", URL: repo, Commit: tt.commit}
+		status, err := dep.CheckStatus()
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, status, "status of %s", tt.commit)
+	}
+}
+
+// movedClient reports that repositories under old/ moved to new/
+type movedClient struct {
+	git.Client
+}
+
+func (movedClient) CanonicalURL(ctx context.Context, gitURL string) (string, error) {
+	return strings.Replace(gitURL, "/old/", "/new/", 1), nil
+}
+
+func TestMovedTo(t *testing.T) {
+	useFakeClient(t, movedClient{})
+	dep := PinDepend{Package: "example", URL: "git+https://github.com/old/example", Commit: "abc123"}
+	moved, err := dep.MovedTo()
+	require.NoError(t, err)
+	assert.Equal(t, "git+https://github.com/new/example", moved)
+
+	dep.URL = "git+https://github.com/new/example"
+	moved, err = dep.MovedTo()
+	require.NoError(t, err)
+	assert.Empty(t, moved)
+}
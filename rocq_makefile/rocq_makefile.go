@@ -45,8 +45,8 @@ func GetMakefileVars(makefilePath string, vars []string) map[string]string {
 	return result
 }
 
-// getRocqVarsForProjFile gets the COQLIBS and COQLIBINSTALL variables that rocq
-// makefile generates for a given _RocqProject file.
+// getRocqVarsForProjFile gets the COQLIBS, COQLIBINSTALL, and COQDOCINSTALL
+// variables that rocq makefile generates for a given _RocqProject file.
 func getRocqVarsForProjFile(projFile string) map[string]string {
 	// 1. Run rocq makefile -f projFile -o <tmp Makefile.rocq>
 	tmpPath := ".tmp.Makefile.rocq"
@@ -60,12 +60,12 @@ func getRocqVarsForProjFile(projFile string) map[string]string {
 		panic(fmt.Sprintf("failed to run rocq makefile: %v", err))
 	}
 
-	// 2. Get COQLIB and COQLIBINSTALL using GetMakefileVars
-	return GetMakefileVars(tmpPath, []string{"COQLIBS", "COQLIBINSTALL"})
+	// 2. Get COQLIB, COQLIBINSTALL, and COQDOCINSTALL using GetMakefileVars
+	return GetMakefileVars(tmpPath, []string{"COQLIBS", "COQLIBINSTALL", "COQDOCINSTALL"})
 }
 
-// GetRocqVars extracts the COQLIBS and COQLIBINSTALL variables that rocq
-// makefile generates.
+// GetRocqVars extracts the COQLIBS, COQLIBINSTALL, and COQDOCINSTALL variables
+// that rocq makefile generates.
 //
 // It uses _RocqProject (falling back to _CoqProject) for the COQLIBS
 // configuration.
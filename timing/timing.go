@@ -0,0 +1,177 @@
+// timing records how long each Rocq file takes to compile
+//
+// Times are imported from the output of rocq makefile's timing support, and
+// saved in the project so that dependency analyses (such as sharding files for
+// CI or finding the critical path of a build) can weigh files by their cost.
+package timing
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultFile is where a project's compile times are saved, next to
+// .rocqdeps.d.
+const DefaultFile = ".rocqtimes.json"
+
+// Times maps each .v file to its compile time in seconds.
+type Times map[string]float64
+
+var (
+	// timedLine is printed for each file by make TIMED=1 (and make
+	// pretty-timed), for example
+	//
+	//	src/foo.vo (real: 1.52, user: 1.31, sys: 0.20, mem: 401860 ko)
+	timedLine = regexp.MustCompile(`^(\S+) \(real: [0-9.]+, user: ([0-9.]+), sys: ([0-9.]+)`)
+	// tableLine is a row of the table make pretty-timed prints at the end of
+	// the build, for example
+	//
+	//	0m01.51s | 401860 ko | src/foo.vo
+	tableLine = regexp.MustCompile(`^\s*(?:([0-9]+)m)?([0-9.]+)s\s*\|(?:.*\|)?\s*(\S+)\s*$`)
+	// sentenceTime is the time of one sentence in a .v.timing file from make
+	// TIMING=1, for example
+	//
+	//	Chars 0 - 26 [Require~Coq.ZArith.BinInt.] 0.157 secs (0.128u,0.028s)
+	sentenceTime = regexp.MustCompile(` ([0-9.]+) secs \([0-9.]+u,[0-9.]+s\)\s*$`)
+)
+
+// sourceFile returns the .v file for a file name in build output, which is
+// either the .vo file or has no extension. ok is false for other files (such
+// as .vos files).
+func sourceFile(name string) (file string, ok bool) {
+	name = filepath.Clean(name)
+	switch filepath.Ext(name) {
+	case ".vo":
+		return strings.TrimSuffix(name, ".vo") + ".v", true
+	case "":
+		return name + ".v", true
+	}
+	return "", false
+}
+
+// ParseLog reads the compile time of each file from the output of a build,
+// with make TIMED=1 or make pretty-timed (including the table of times at the
+// end). If a file appears more than once, the last time is used.
+func ParseLog(r io.Reader) (Times, error) {
+	times := make(Times)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := timedLine.FindStringSubmatch(line); m != nil {
+			file, ok := sourceFile(m[1])
+			if !ok {
+				continue
+			}
+			user, _ := strconv.ParseFloat(m[2], 64)
+			sys, _ := strconv.ParseFloat(m[3], 64)
+			times[file] = user + sys
+		} else if m := tableLine.FindStringSubmatch(line); m != nil {
+			file, ok := sourceFile(m[3])
+			if !ok {
+				continue
+			}
+			minutes, _ := strconv.ParseFloat(m[1], 64)
+			seconds, _ := strconv.ParseFloat(m[2], 64)
+			times[file] = 60*minutes + seconds
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return times, nil
+}
+
+// ParseTimingFile reads the compile time of a file from the per-sentence
+// times in its .v.timing file, produced by make TIMING=1.
+func ParseTimingFile(r io.Reader) (float64, error) {
+	total := 0.0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if m := sentenceTime.FindStringSubmatch(scanner.Text()); m != nil {
+			secs, _ := strconv.ParseFloat(m[1], 64)
+			total += secs
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// Import reads compile times from a build log or a .v.timing file (based on
+// its name).
+func Import(path string) (Times, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if file, ok := strings.CutSuffix(path, ".v.timing"); ok {
+		secs, err := ParseTimingFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return Times{filepath.Clean(file) + ".v": secs}, nil
+	}
+	times, err := ParseLog(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return times, nil
+}
+
+// Load reads a database of compile times saved with Save.
+func Load(path string) (Times, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	times := make(Times)
+	if err := json.Unmarshal(data, &times); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return times, nil
+}
+
+// Save writes the database to path, as JSON with one file per line (sorted,
+// so that it can be committed with small diffs).
+func (t Times) Save(path string) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Merge adds the times in other to t, replacing existing times.
+func (t Times) Merge(other Times) {
+	maps.Copy(t, other)
+}
+
+// Weight returns the compile time of a file, as a weight for dependency
+// analyses. Files without a recorded time (such as new files) are assumed to
+// take the average time.
+func (t Times) Weight() func(file string) float64 {
+	avg := 1.0
+	if len(t) > 0 {
+		total := 0.0
+		for _, secs := range t {
+			total += secs
+		}
+		avg = total / float64(len(t))
+	}
+	return func(file string) float64 {
+		if secs, ok := t[file]; ok {
+			return secs
+		}
+		return avg
+	}
+}
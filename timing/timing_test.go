@@ -0,0 +1,81 @@
+package timing
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLog(t *testing.T) {
+	times, err := ParseLog(strings.NewReader(`ROCQ DEP VFILES
+ROCQ compile src/a.v
+src/a.vo (real: 2.05, user: 1.50, sys: 0.25, mem: 401860 ko)
+ROCQ compile src/b.v
+src/b (real: 0.40, user: 0.30, sys: 0.05, mem: 201860 ko)
+src/b.vos (real: 0.10, user: 0.08, sys: 0.01, mem: 101860 ko)
+Time     |  Peak Mem | File Name
+----------------------------------------
+1m02.50s | 1144060 ko | Total Time / Peak Mem
+----------------------------------------
+1m00.25s |  433420 ko | src/c.vo
+0m01.00s |  233420 ko | src/a.vo
+`))
+	require.NoError(t, err)
+	assert.Equal(t, Times{
+		"src/a.v": 1.0,
+		"src/b.v": 0.35,
+		"src/c.v": 60.25,
+	}, roundTimes(times))
+}
+
+// roundTimes rounds times to hundredths of a second, to compare them exactly
+func roundTimes(times Times) Times {
+	rounded := make(Times)
+	for file, secs := range times {
+		rounded[file] = float64(int(secs*100+0.5)) / 100
+	}
+	return rounded
+}
+
+func TestParseTimingFile(t *testing.T) {
+	secs, err := ParseTimingFile(strings.NewReader(`Chars 0 - 26 [Require~Coq.ZArith.BinInt.] 0.157 secs (0.128u,0.028s)
+Chars 27 - 61 [Lemma~foo~:~True.] 0. secs (0.u,0.s)
+Chars 62 - 80 [Proof.~auto.~Qed.] 1.5 secs (1.4u,0.1s)
+`))
+	require.NoError(t, err)
+	assert.InDelta(t, 1.657, secs, 1e-9)
+}
+
+func TestImportAndSave(t *testing.T) {
+	dir := t.TempDir()
+	timingFile := filepath.Join(dir, "a.v.timing")
+	require.NoError(t, os.WriteFile(timingFile,
+		[]byte("Chars 0 - 10 [Qed.] 2.5 secs (2.4u,0.1s)\n"), 0644))
+	times, err := Import(timingFile)
+	require.NoError(t, err)
+	assert.Equal(t, Times{filepath.Join(dir, "a.v"): 2.5}, times)
+
+	logFile := filepath.Join(dir, "build.log")
+	require.NoError(t, os.WriteFile(logFile,
+		[]byte("b.vo (real: 1.00, user: 0.75, sys: 0.25, mem: 1000 ko)\n"), 0644))
+	log, err := Import(logFile)
+	require.NoError(t, err)
+	times.Merge(log)
+
+	db := filepath.Join(dir, DefaultFile)
+	require.NoError(t, times.Save(db))
+	loaded, err := Load(db)
+	require.NoError(t, err)
+	assert.Equal(t, times, loaded)
+}
+
+func TestWeight(t *testing.T) {
+	weight := Times{"a.v": 1, "b.v": 3}.Weight()
+	assert.Equal(t, 3.0, weight("b.v"))
+	assert.Equal(t, 2.0, weight("new.v"))
+	assert.Equal(t, 1.0, Times{}.Weight()("a.v"))
+}